@@ -2,19 +2,52 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"github.com/eqkez0r/gophermart/internal/config"
+	"github.com/eqkez0r/gophermart/internal/expiry"
+	"github.com/eqkez0r/gophermart/internal/holds"
+	"github.com/eqkez0r/gophermart/internal/notify"
 	"github.com/eqkez0r/gophermart/internal/orderfetcher"
+	"github.com/eqkez0r/gophermart/internal/scheduler"
+	"github.com/eqkez0r/gophermart/internal/secrets"
 	httpserver "github.com/eqkez0r/gophermart/internal/server"
+	"github.com/eqkez0r/gophermart/internal/statements"
 	"github.com/eqkez0r/gophermart/internal/storage"
+	"github.com/eqkez0r/gophermart/internal/storage/postgres"
+	"github.com/eqkez0r/gophermart/internal/tiers"
+	"github.com/eqkez0r/gophermart/internal/webhooks"
+	"github.com/eqkez0r/gophermart/pkg/jwt"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
 	"go.uber.org/zap"
 	"log"
+	"os"
 	"os/signal"
 	"sync"
 	"syscall"
 )
 
 func main() {
-	logger, err := zap.NewDevelopment()
+	//gophermart config print shows the effective configuration
+	args := os.Args[1:]
+	printConfig := len(args) >= 2 && args[0] == "config" && args[1] == "print"
+	if printConfig {
+		args = args[2:]
+	}
+	cfg, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if printConfig {
+		fmt.Print(cfg)
+		return
+	}
+
+	logger, level, err := newLogger(cfg.Logging)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -22,28 +55,154 @@ func main() {
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
+	//registered before the slow startup, an early SIGHUP would kill the
+	//process otherwise. It waits in the channel until the reloader exists.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 
-	cfg, err := config.NewConfig()
+	suggaredLogger.Infof("starting server with config:\n%s", cfg)
+	jwt.SetTTL(cfg.Auth.TokenTTL, cfg.Auth.ChallengeTTL)
+	//the secrets are read from their references, the files are watched
+	//for rotation
+	resolve := func(ref string) string {
+		v, err := secrets.Resolve(ref)
+		if err != nil {
+			suggaredLogger.Fatal(err)
+		}
+		return v
+	}
+	watcher := secrets.NewWatcher(suggaredLogger)
+	if key := resolve(cfg.Auth.JWTKey); key != "" {
+		if err = jwt.SetKey([]byte(key)); err != nil {
+			suggaredLogger.Fatal(err)
+		}
+		err = watcher.Watch(func(v []string) error {
+			return jwt.SetKey([]byte(v[0]))
+		}, cfg.Auth.JWTKey)
+		if err != nil {
+			suggaredLogger.Fatal(err)
+		}
+	} else {
+		suggaredLogger.Warn("no jwt key is set, a random one is used and the tokens don't survive a restart")
+	}
+
+	s, err := storage.NewStorage(ctx, suggaredLogger, "postgresql", resolve(cfg.Database.URI), postgres.Options{
+		Password:        resolve(cfg.Database.Password),
+		MaxConns:        cfg.Database.MaxConns,
+		MinConns:        cfg.Database.MinConns,
+		MaxConnLifetime: cfg.Database.MaxConnLifetime,
+		ConnectRetries:  cfg.Database.ConnectRetries,
+	})
 	if err != nil {
 		suggaredLogger.Fatal(err)
 	}
-	suggaredLogger.Infof("starting server with config: %+v", cfg)
-	s, err := storage.NewStorage(ctx, suggaredLogger, "postgresql", cfg.DatabaseURI)
+	err = watcher.Watch(func(v []string) error {
+		return s.RotateCredentials(ctx, v[0], v[1])
+	}, cfg.Database.URI, cfg.Database.Password)
 	if err != nil {
 		suggaredLogger.Fatal(err)
 	}
 
+	for _, login := range cfg.Auth.Admins {
+		if err = s.SetUserRole(ctx, login, obj.RoleAdmin); err != nil {
+			suggaredLogger.Warnw("failed to grant admin role", "login", login, "error", err)
+		}
+	}
+
 	var wg sync.WaitGroup
-	of := orderfetcher.New(suggaredLogger, cfg.AccrualSystemAddress, s)
+	of := orderfetcher.New(suggaredLogger, cfg.Accrual.Address, s, cfg.Accrual.PollInterval, cfg.Accrual.Timeout)
 
 	wg.Add(1)
 	go of.Run(ctx, &wg)
 
-	server, err := httpserver.New(ctx, cfg, suggaredLogger, s, of)
+	jobs := []*scheduler.Job{
+		statements.Job(suggaredLogger, s, cfg.Loyalty.StatementsInterval),
+		//runs without tiers as well to reset the tiers of a previous setup
+		tiers.Job(suggaredLogger, s, cfg.Loyalty.Tiers, cfg.Loyalty.TiersInterval),
+		holds.Job(suggaredLogger, s, cfg.Balance.HoldsInterval),
+		webhooks.Job(suggaredLogger, s, webhooks.Policy{
+			MaxAttempts: cfg.Webhooks.MaxAttempts,
+			Backoff:     cfg.Webhooks.Backoff,
+			MaxBackoff:  cfg.Webhooks.MaxBackoff,
+			Timeout:     cfg.Webhooks.Timeout,
+		}, cfg.Webhooks.Interval),
+	}
+	notifiers := notify.Dispatcher{}
+	if cfg.Notify.Sink != "" {
+		sink, err := notify.NewFileSink(cfg.Notify.Sink)
+		if err != nil {
+			suggaredLogger.Fatal(err)
+		}
+		defer sink.Close()
+		for channel := range obj.NotificationChannels {
+			notifiers[channel] = sink
+		}
+	}
+	if cfg.Notify.SMTPAddr != "" {
+		if notifiers[obj.ChannelEmail], err = notify.NewSMTP(cfg.Notify.SMTPAddr, cfg.Notify.SMTPFrom, cfg.Notify.SMTPUsername, resolve(cfg.Notify.SMTPPassword)); err != nil {
+			suggaredLogger.Fatal(err)
+		}
+	}
+	for channel := range obj.NotificationChannels {
+		if notifiers[channel] == nil {
+			suggaredLogger.Warnf("no driver for the %s notification channel, users can't choose it", channel)
+		}
+	}
+	jobs = append(jobs, notify.Job(suggaredLogger, s, notifiers, cfg.Notify.Interval))
+	if policy := (expiry.Policy{Months: cfg.Loyalty.PointsExpiryMonths}); policy.Enabled() {
+		jobs = append(jobs, expiry.Job(suggaredLogger, s, policy, cfg.Loyalty.PointsExpiryInterval))
+	}
+	jobs = append(jobs, secrets.Job(watcher, cfg.Secrets.WatchInterval))
+	sched := scheduler.New(suggaredLogger, jobs...)
+	wg.Add(1)
+	go sched.Run(ctx, &wg)
+
+	//SIGHUP and the admin endpoint apply the reloadable settings
+	reloader := config.NewReloader(suggaredLogger, args, cfg)
+	reloader.OnReload(func(cfg *config.Config) {
+		//validated on load
+		_ = level.UnmarshalText([]byte(cfg.Logging.Level))
+		jwt.SetTTL(cfg.Auth.TokenTTL, cfg.Auth.ChallengeTTL)
+		of.SetPolicy(cfg.Accrual.PollInterval, cfg.Accrual.Timeout)
+	})
+
+	server, err := httpserver.New(ctx, cfg, suggaredLogger, s, of, reloader)
 	if err != nil {
 		suggaredLogger.Fatal(err)
 	}
+	reloader.OnReload(server.Reload)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				signal.Stop(hup)
+				return
+			case <-hup:
+				//the reloader logs the changes and the errors
+				_, _ = reloader.Reload()
+			}
+		}
+	}()
+
 	server.Run(ctx)
 	wg.Wait()
 	server.GracefulShutdown(ctx)
 }
+
+// newLogger builds the development logger for the console format and
+// the production one for json. The returned level changes the level of
+// the running logger.
+func newLogger(cfg config.Logging) (*zap.Logger, zap.AtomicLevel, error) {
+	level, err := zap.ParseAtomicLevel(cfg.Level)
+	if err != nil {
+		return nil, level, err
+	}
+	zcfg := zap.NewDevelopmentConfig()
+	if cfg.Format == "json" {
+		zcfg = zap.NewProductionConfig()
+	}
+	zcfg.Level = level
+	logger, err := zcfg.Build()
+	return logger, level, err
+}
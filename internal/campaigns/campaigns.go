@@ -0,0 +1,70 @@
+package campaigns
+
+import (
+	"errors"
+	"fmt"
+	"github.com/eqkez0r/gophermart/internal/tiers"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"math"
+	"strings"
+)
+
+const maxOrderPrefixLength = 20
+
+var (
+	errEmptyName      = errors.New("campaign name is required")
+	errInvalidWindow  = errors.New("campaign must end after it starts")
+	errInvalidBoost   = errors.New("campaign needs either a multiplier above 1 or a positive bonus")
+	errInvalidPrefix  = errors.New("campaign order prefix must be digits")
+	errUnknownSegment = errors.New("campaign segment is not a loyalty tier")
+)
+
+// Validate checks a campaign definition. Segments are the names of the
+// configured loyalty tiers.
+func Validate(c *obj.Campaign, segments []*obj.Tier) error {
+	switch {
+	case strings.TrimSpace(c.Name) == "":
+		return errEmptyName
+	case !c.EndsAt.After(c.StartsAt):
+		return errInvalidWindow
+	case !(c.Multiplier > 1 && c.Bonus == 0 || c.Multiplier == 0 && c.Bonus > 0):
+		return errInvalidBoost
+	case len(c.OrderPrefix) > maxOrderPrefixLength || strings.Trim(c.OrderPrefix, "0123456789") != "":
+		return errInvalidPrefix
+	}
+	if c.Segment == "" {
+		return nil
+	}
+	for _, t := range segments {
+		if t.Name == c.Segment {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", errUnknownSegment, c.Segment)
+}
+
+// Boost returns the points campaign c adds to an accrual, rounded to
+// cents.
+func Boost(c *obj.Campaign, accrual float32) float32 {
+	if c.Multiplier > 0 {
+		return tiers.Apply(accrual, c.Multiplier) - accrual
+	}
+	return float32(math.Round(float64(c.Bonus)*100) / 100)
+}
+
+// Best picks the campaign adding the most points to an accrual, the
+// earliest one of equal campaigns. Campaigns don't stack, and accruals
+// without points get no boost.
+func Best(cs []*obj.Campaign, accrual float32) (*obj.Campaign, float32) {
+	if accrual <= 0 {
+		return nil, 0
+	}
+	var best *obj.Campaign
+	var boost float32
+	for _, c := range cs {
+		if b := Boost(c, accrual); b > boost {
+			best, boost = c, b
+		}
+	}
+	return best, boost
+}
@@ -0,0 +1,66 @@
+package campaigns
+
+import (
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	start := time.Date(2024, 5, 4, 0, 0, 0, 0, time.UTC)
+	end := start.Add(48 * time.Hour)
+	segments := []*obj.Tier{{Name: "silver", Threshold: 1000, Multiplier: 1.1}}
+
+	tests := []struct {
+		name     string
+		campaign obj.Campaign
+		wantErr  bool
+	}{
+		{name: "multiplier", campaign: obj.Campaign{Name: "double points", StartsAt: start, EndsAt: end, Multiplier: 2}},
+		{name: "bonus with segment and prefix", campaign: obj.Campaign{Name: "silver", StartsAt: start, EndsAt: end,
+			Bonus: 50, Segment: "silver", OrderPrefix: "42"}},
+		{name: "no name", campaign: obj.Campaign{StartsAt: start, EndsAt: end, Multiplier: 2}, wantErr: true},
+		{name: "ends before start", campaign: obj.Campaign{Name: "x", StartsAt: end, EndsAt: start, Multiplier: 2}, wantErr: true},
+		{name: "no boost", campaign: obj.Campaign{Name: "x", StartsAt: start, EndsAt: end}, wantErr: true},
+		{name: "both boosts", campaign: obj.Campaign{Name: "x", StartsAt: start, EndsAt: end, Multiplier: 2, Bonus: 5}, wantErr: true},
+		{name: "multiplier below 1", campaign: obj.Campaign{Name: "x", StartsAt: start, EndsAt: end, Multiplier: 0.5}, wantErr: true},
+		{name: "negative bonus", campaign: obj.Campaign{Name: "x", StartsAt: start, EndsAt: end, Bonus: -5}, wantErr: true},
+		{name: "prefix not digits", campaign: obj.Campaign{Name: "x", StartsAt: start, EndsAt: end, Bonus: 5, OrderPrefix: "4a"}, wantErr: true},
+		{name: "unknown segment", campaign: obj.Campaign{Name: "x", StartsAt: start, EndsAt: end, Bonus: 5, Segment: "gold"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(&tt.campaign, segments); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBest(t *testing.T) {
+	double := &obj.Campaign{CampaignID: 1, Multiplier: 2}
+	bonus := &obj.Campaign{CampaignID: 2, Bonus: 50}
+	sameBonus := &obj.Campaign{CampaignID: 3, Bonus: 50}
+
+	tests := []struct {
+		name      string
+		campaigns []*obj.Campaign
+		accrual   float32
+		want      *obj.Campaign
+		wantBoost float32
+	}{
+		{name: "none", accrual: 100},
+		{name: "multiplier wins", campaigns: []*obj.Campaign{bonus, double}, accrual: 100, want: double, wantBoost: 100},
+		{name: "bonus wins", campaigns: []*obj.Campaign{double, bonus}, accrual: 20.5, want: bonus, wantBoost: 50},
+		{name: "earliest of equal", campaigns: []*obj.Campaign{bonus, sameBonus}, accrual: 10, want: bonus, wantBoost: 50},
+		{name: "no accrual", campaigns: []*obj.Campaign{bonus}, accrual: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, boost := Best(tt.campaigns, tt.accrual)
+			if got != tt.want || boost != tt.wantBoost {
+				t.Errorf("Best() = %v, %v, want %v, %v", got, boost, tt.want, tt.wantBoost)
+			}
+		})
+	}
+}
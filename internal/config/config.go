@@ -3,41 +3,529 @@ package config
 import (
 	"errors"
 	"flag"
+	"fmt"
+	"github.com/eqkez0r/gophermart/internal/secrets"
+	"github.com/eqkez0r/gophermart/internal/tiers"
 	e "github.com/eqkez0r/gophermart/pkg/error"
+	"github.com/eqkez0r/gophermart/pkg/jwt"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
 	"github.com/ilyakaznacheev/cleanenv"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Config is layered from the lowest to the highest priority: the
+// defaults, the config file, the flags set on the command line and the
+// environment. The file is YAML or TOML, chosen by its extension, with
+// one section per group below. Settings tagged reload are applied to the
+// running server by a Reloader, the others need a restart. Secrets may
+// reference a file:// or an env: value, see secrets.Resolve.
 type Config struct {
-	RunAddress           string `env:"RUN_ADDRESS"`
-	DatabaseURI          string `env:"DATABASE_URI"`
-	AccrualSystemAddress string `env:"ACCRUAL_SYSTEM_ADDRESS"`
+	Server   Server   `yaml:"server" toml:"server"`
+	Database Database `yaml:"database" toml:"database"`
+	Auth     Auth     `yaml:"auth" toml:"auth"`
+	Accrual  Accrual  `yaml:"accrual" toml:"accrual"`
+	Logging  Logging  `yaml:"logging" toml:"logging"`
+	Loyalty  Loyalty  `yaml:"loyalty" toml:"loyalty"`
+	Balance  Balance  `yaml:"balance" toml:"balance"`
+	Webhooks Webhooks `yaml:"webhooks" toml:"webhooks"`
+	Notify   Notify   `yaml:"notify" toml:"notify"`
+	Secrets  Secrets  `yaml:"secrets" toml:"secrets"`
+}
+
+type Server struct {
+	Address string `yaml:"address" toml:"address" env:"RUN_ADDRESS"`
+	// Debug additionally validates responses against the OpenAPI
+	// document and logs the violations.
+	Debug bool `yaml:"debug" toml:"debug" env:"DEBUG"`
+	// GzipTypes are the content types compressed for clients accepting
+	// gzip.
+	GzipTypes []string `yaml:"gzip_types" toml:"gzip_types" env:"GZIP_TYPES" env-separator:","`
+	// TrustedProxies are the addresses or CIDRs of reverse proxies whose
+	// X-Forwarded-For header gives the client IP. None are trusted by
+	// default, the client IP is the remote address then.
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies" env:"TRUSTED_PROXIES" env-separator:","`
+	// MaxBodySize caps request bodies in bytes, after gzip decoding too.
+	MaxBodySize int64 `yaml:"max_body_size" toml:"max_body_size" env:"MAX_BODY_SIZE"`
+}
+
+type Database struct {
+	URI string `yaml:"uri" toml:"uri" env:"DATABASE_URI"`
+	// Password replaces the password of the URI, so the URI can stay in
+	// plain config while the password is a file reference.
+	Password string `yaml:"password" toml:"password" env:"DATABASE_PASSWORD"`
+	// The pool keeps between MinConns and MaxConns connections and
+	// replaces them after MaxConnLifetime. Zero values leave the pgx
+	// defaults.
+	MaxConns        int32         `yaml:"max_conns" toml:"max_conns" env:"DATABASE_MAX_CONNS"`
+	MinConns        int32         `yaml:"min_conns" toml:"min_conns" env:"DATABASE_MIN_CONNS"`
+	MaxConnLifetime time.Duration `yaml:"max_conn_lifetime" toml:"max_conn_lifetime" env:"DATABASE_MAX_CONN_LIFETIME"`
+	// ConnectRetries is how often connecting and migrating is retried
+	// on startup.
+	ConnectRetries int `yaml:"connect_retries" toml:"connect_retries" env:"DATABASE_CONNECT_RETRIES"`
+}
+
+type Auth struct {
+	// JWTKey signs the tokens, at least 32 bytes. Without a key a random
+	// one is used and the tokens don't survive a restart.
+	JWTKey string `yaml:"jwt_key" toml:"jwt_key" env:"JWT_KEY"`
+	// Mode is header, cookie or both. Cookie sessions are meant for
+	// browser clients and come with CSRF protection.
+	Mode           string `yaml:"mode" toml:"mode" env:"AUTH_MODE"`
+	CookieSecure   bool   `yaml:"cookie_secure" toml:"cookie_secure" env:"COOKIE_SECURE"`
+	CookieSameSite string `yaml:"cookie_samesite" toml:"cookie_samesite" env:"COOKIE_SAMESITE"`
+	// Access tokens live TokenTTL, the tokens between the password and
+	// the second factor ChallengeTTL.
+	TokenTTL     time.Duration `yaml:"token_ttl" toml:"token_ttl" env:"TOKEN_TTL" reload:"true"`
+	ChallengeTTL time.Duration `yaml:"challenge_ttl" toml:"challenge_ttl" env:"CHALLENGE_TTL" reload:"true"`
+	// Withdrawals above the threshold require a 2FA verification made
+	// within TwoFactorMaxAge for users with 2FA enabled.
+	TwoFactorWithdrawThreshold float64       `yaml:"two_factor_withdraw_threshold" toml:"two_factor_withdraw_threshold" env:"TWO_FACTOR_WITHDRAW_THRESHOLD" reload:"true"`
+	TwoFactorMaxAge            time.Duration `yaml:"two_factor_max_age" toml:"two_factor_max_age" env:"TWO_FACTOR_MAX_AGE" reload:"true"`
+	// Admins are granted the admin role on startup.
+	Admins []string `yaml:"admins" toml:"admins" env:"ADMIN_LOGINS" env-separator:","`
+	// APIKeyMaxRateLimit caps the requests per minute of an API key, the
+	// rate limits asked for on key creation are clamped to it.
+	APIKeyMaxRateLimit int `yaml:"api_key_max_rate_limit" toml:"api_key_max_rate_limit" env:"API_KEY_MAX_RATE_LIMIT"`
+}
+
+type Accrual struct {
+	Address string `yaml:"address" toml:"address" env:"ACCRUAL_SYSTEM_ADDRESS"`
+	// The unfinished orders are polled every PollInterval, each request
+	// is given Timeout.
+	PollInterval time.Duration `yaml:"poll_interval" toml:"poll_interval" env:"ACCRUAL_POLL_INTERVAL" reload:"true"`
+	Timeout      time.Duration `yaml:"timeout" toml:"timeout" env:"ACCRUAL_TIMEOUT" reload:"true"`
+}
+
+type Logging struct {
+	// Level is debug, info, warn or error and Format console or json.
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL" reload:"true"`
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT"`
+}
+
+type Loyalty struct {
+	// StatementsInterval is how often the monthly statements job looks
+	// for completed months without a statement.
+	StatementsInterval time.Duration `yaml:"statements_interval" toml:"statements_interval" env:"STATEMENTS_INTERVAL"`
+	// Accrued points expire PointsExpiryMonths after the order is
+	// processed, 0 keeps them forever. The balance lists the points
+	// expiring within PointsExpiringSoon.
+	PointsExpiryMonths   int           `yaml:"points_expiry_months" toml:"points_expiry_months" env:"POINTS_EXPIRY_MONTHS"`
+	PointsExpiringSoon   time.Duration `yaml:"points_expiring_soon" toml:"points_expiring_soon" env:"POINTS_EXPIRING_SOON" reload:"true"`
+	PointsExpiryInterval time.Duration `yaml:"points_expiry_interval" toml:"points_expiry_interval" env:"POINTS_EXPIRY_INTERVAL"`
+	// LoyaltyTiers defines the tiers as name:threshold:multiplier, see
+	// tiers.Parse. They are parsed into Tiers on load.
+	LoyaltyTiers  string        `yaml:"tiers" toml:"tiers" env:"LOYALTY_TIERS"`
+	TiersInterval time.Duration `yaml:"tiers_interval" toml:"tiers_interval" env:"TIERS_INTERVAL"`
+	Tiers         []*obj.Tier   `yaml:"-" toml:"-"`
+	// Referrers and referees are credited when the referee's first order
+	// is processed. MaxReferrals limits the rewarded referrals per user,
+	// 0 means no limit.
+	ReferrerBonus float64 `yaml:"referrer_bonus" toml:"referrer_bonus" env:"REFERRAL_REFERRER_BONUS" reload:"true"`
+	RefereeBonus  float64 `yaml:"referee_bonus" toml:"referee_bonus" env:"REFERRAL_REFEREE_BONUS" reload:"true"`
+	MaxReferrals  int     `yaml:"max_referrals" toml:"max_referrals" env:"REFERRAL_MAX_PER_USER" reload:"true"`
+}
+
+type Balance struct {
+	// TransferDailyLimit caps the points a user sends to others per UTC
+	// day, 0 means no limit.
+	TransferDailyLimit float64 `yaml:"transfer_daily_limit" toml:"transfer_daily_limit" env:"TRANSFER_DAILY_LIMIT" reload:"true"`
+	// Holds live HoldTTL unless the client asks for another lifetime up
+	// to HoldMaxTTL. Expired holds are swept every HoldsInterval.
+	HoldTTL       time.Duration `yaml:"hold_ttl" toml:"hold_ttl" env:"HOLD_TTL" reload:"true"`
+	HoldMaxTTL    time.Duration `yaml:"hold_max_ttl" toml:"hold_max_ttl" env:"HOLD_MAX_TTL" reload:"true"`
+	HoldsInterval time.Duration `yaml:"holds_interval" toml:"holds_interval" env:"HOLDS_INTERVAL"`
+	// Withdrawals and holds are checked against the withdraw rules, zero
+	// values disable a rule. See obj.WithdrawRules.
+	WithdrawMaxAmount     float64       `yaml:"withdraw_max_amount" toml:"withdraw_max_amount" env:"WITHDRAW_MAX_AMOUNT" reload:"true"`
+	WithdrawDailyCap      float64       `yaml:"withdraw_daily_cap" toml:"withdraw_daily_cap" env:"WITHDRAW_DAILY_CAP" reload:"true"`
+	WithdrawWeeklyCap     float64       `yaml:"withdraw_weekly_cap" toml:"withdraw_weekly_cap" env:"WITHDRAW_WEEKLY_CAP" reload:"true"`
+	WithdrawMinAccountAge time.Duration `yaml:"withdraw_min_account_age" toml:"withdraw_min_account_age" env:"WITHDRAW_MIN_ACCOUNT_AGE" reload:"true"`
+	WithdrawMaxPerHour    int           `yaml:"withdraw_max_per_hour" toml:"withdraw_max_per_hour" env:"WITHDRAW_MAX_PER_HOUR" reload:"true"`
+	WithdrawNewDeviceAge  time.Duration `yaml:"withdraw_new_device_age" toml:"withdraw_new_device_age" env:"WITHDRAW_NEW_DEVICE_AGE" reload:"true"`
+}
+
+type Webhooks struct {
+	// Webhook deliveries are sent every Interval. Failed ones are
+	// retried after Backoff, doubled up to MaxBackoff, until MaxAttempts
+	// attempts failed.
+	Interval    time.Duration `yaml:"interval" toml:"interval" env:"WEBHOOKS_INTERVAL"`
+	Timeout     time.Duration `yaml:"timeout" toml:"timeout" env:"WEBHOOK_TIMEOUT"`
+	MaxAttempts int           `yaml:"max_attempts" toml:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS"`
+	Backoff     time.Duration `yaml:"backoff" toml:"backoff" env:"WEBHOOK_BACKOFF"`
+	MaxBackoff  time.Duration `yaml:"max_backoff" toml:"max_backoff" env:"WEBHOOK_MAX_BACKOFF"`
+}
+
+type Notify struct {
+	// Notifications are written to Sink, a file path or stdout, and
+	// emails are sent through the SMTP server at SMTPAddr if set.
+	// Users can't choose the channels without either.
+	Sink         string        `yaml:"sink" toml:"sink" env:"NOTIFY_SINK"`
+	Interval     time.Duration `yaml:"interval" toml:"interval" env:"NOTIFY_INTERVAL"`
+	SMTPAddr     string        `yaml:"smtp_addr" toml:"smtp_addr" env:"SMTP_ADDR"`
+	SMTPFrom     string        `yaml:"smtp_from" toml:"smtp_from" env:"SMTP_FROM"`
+	SMTPUsername string        `yaml:"smtp_username" toml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string        `yaml:"smtp_password" toml:"smtp_password" env:"SMTP_PASSWORD"`
+}
+
+// Channels are the notification channels with a driver.
+func (n Notify) Channels() map[string]bool {
+	channels := make(map[string]bool)
+	if n.Sink != "" {
+		for channel := range obj.NotificationChannels {
+			channels[channel] = true
+		}
+	}
+	if n.SMTPAddr != "" {
+		channels[obj.ChannelEmail] = true
+	}
+	return channels
+}
+
+type Secrets struct {
+	// The files referenced by the database credentials and the JWT key
+	// are checked for rotation every WatchInterval.
+	WatchInterval time.Duration `yaml:"watch_interval" toml:"watch_interval" env:"SECRETS_WATCH_INTERVAL"`
 }
 
 const (
-	defaultRunAddr           = "127.0.0.1:8888"
-	defaultAccrualSystemAddr = "http://127.0.0.1:8080"
+	// configEnv names the config file when the -config flag is not set.
+	configEnv = "CONFIG"
+
+	defaultRunAddr            = "127.0.0.1:8888"
+	defaultConnectRetries     = 3
+	defaultMaxBodySize        = 1 << 20
+	defaultAccrualSystemAddr  = "http://127.0.0.1:8080"
+	defaultPollInterval       = time.Second
+	defaultAccrualTimeout     = 10 * time.Second
+	defaultLogLevel           = "debug"
+	defaultLogFormat          = "console"
+	defaultTokenTTL           = 5 * time.Minute
+	defaultChallengeTTL       = 2 * time.Minute
+	defaultTwoFactorThreshold = 1000
+	defaultTwoFactorMaxAge    = 5 * time.Minute
+	defaultAPIKeyMaxRateLimit = 600
+	defaultAuthMode           = "header"
+	defaultCookieSameSite     = "strict"
+	defaultStatementsInterval = time.Hour
+	defaultPointsExpiringSoon = 30 * 24 * time.Hour
+	defaultExpiryInterval     = time.Hour
+	defaultTiersInterval      = time.Hour
+	defaultMaxReferrals       = 50
+	defaultTransferDailyLimit = 5000
+	defaultHoldTTL            = 15 * time.Minute
+	defaultHoldMaxTTL         = 24 * time.Hour
+	defaultHoldsInterval      = time.Minute
+	defaultWebhooksInterval   = 5 * time.Second
+	defaultWebhookTimeout     = 10 * time.Second
+	defaultWebhookMaxAttempts = 8
+	defaultWebhookBackoff     = 30 * time.Second
+	defaultWebhookMaxBackoff  = 6 * time.Hour
+	defaultNotifyInterval     = 10 * time.Second
+	defaultWatchInterval      = 10 * time.Second
 )
 
 var (
-	errEmptyDatabaseURI = errors.New("empty database uri")
+	errEmptyRunAddress    = errors.New("empty run address")
+	errEmptyDatabaseURI   = errors.New("empty database uri")
+	errInvalidBodySize    = errors.New("max body size must be positive")
+	errInvalidPool        = errors.New("pool sizes must not be negative and min conns not above max conns")
+	errInvalidRetries     = errors.New("retries must not be negative")
+	errInvalidTTL         = errors.New("token lifetimes and timeouts must be positive")
+	errInvalidLogLevel    = errors.New("log level must be debug, info, warn or error")
+	errInvalidLogFormat   = errors.New("log format must be console or json")
+	errInvalidAuthMode    = errors.New("auth mode must be header, cookie or both")
+	errInvalidSameSite    = errors.New("cookie samesite must be strict, lax or none")
+	errInsecureSameSite   = errors.New("cookie samesite none requires secure cookies")
+	errInvalidInterval    = errors.New("job intervals must be positive")
+	errInvalidExpiry      = errors.New("points expiry months and window must not be negative")
+	errInvalidReferral    = errors.New("referral bonuses and limit must not be negative")
+	errInvalidTransfer    = errors.New("transfer daily limit must not be negative")
+	errInvalidRateLimit   = errors.New("api key max rate limit must be positive")
+	errInvalidHoldTTL     = errors.New("hold ttl must be positive and not above the max ttl")
+	errInvalidRules       = errors.New("withdraw rules must not be negative")
+	errEmptySMTPFrom      = errors.New("smtp sender is required with an smtp server")
+	errShortJWTKey        = errors.New("jwt key must be at least 32 bytes")
+	errInvalidWebhooks    = errors.New("webhook timeout, attempts and backoff must be positive and the backoff not above the max backoff")
+	errInvalidProxy       = errors.New("trusted proxies must be ip addresses or cidrs")
+	errUnknownConfigType  = errors.New("config file must be .yaml, .yml or .toml")
+	errUnknownConfigField = errors.New("unknown config fields")
 )
 
-func NewConfig() (*Config, error) {
+// Default returns the configuration used for everything neither the
+// config file, the flags nor the environment set.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Address:     defaultRunAddr,
+			MaxBodySize: defaultMaxBodySize,
+			GzipTypes:   []string{"text/html", "html/text", "application/json", "text/csv", "application/x-ndjson"},
+		},
+		Database: Database{
+			ConnectRetries: defaultConnectRetries,
+		},
+		Auth: Auth{
+			Mode:                       defaultAuthMode,
+			CookieSecure:               true,
+			CookieSameSite:             defaultCookieSameSite,
+			TokenTTL:                   defaultTokenTTL,
+			ChallengeTTL:               defaultChallengeTTL,
+			TwoFactorWithdrawThreshold: defaultTwoFactorThreshold,
+			TwoFactorMaxAge:            defaultTwoFactorMaxAge,
+			APIKeyMaxRateLimit:         defaultAPIKeyMaxRateLimit,
+		},
+		Accrual: Accrual{
+			Address:      defaultAccrualSystemAddr,
+			PollInterval: defaultPollInterval,
+			Timeout:      defaultAccrualTimeout,
+		},
+		Logging: Logging{
+			Level:  defaultLogLevel,
+			Format: defaultLogFormat,
+		},
+		Loyalty: Loyalty{
+			StatementsInterval:   defaultStatementsInterval,
+			PointsExpiringSoon:   defaultPointsExpiringSoon,
+			PointsExpiryInterval: defaultExpiryInterval,
+			TiersInterval:        defaultTiersInterval,
+			MaxReferrals:         defaultMaxReferrals,
+		},
+		Balance: Balance{
+			TransferDailyLimit: defaultTransferDailyLimit,
+			HoldTTL:            defaultHoldTTL,
+			HoldMaxTTL:         defaultHoldMaxTTL,
+			HoldsInterval:      defaultHoldsInterval,
+		},
+		Webhooks: Webhooks{
+			Interval:    defaultWebhooksInterval,
+			Timeout:     defaultWebhookTimeout,
+			MaxAttempts: defaultWebhookMaxAttempts,
+			Backoff:     defaultWebhookBackoff,
+			MaxBackoff:  defaultWebhookMaxBackoff,
+		},
+		Notify: Notify{
+			Interval: defaultNotifyInterval,
+		},
+		Secrets: Secrets{
+			WatchInterval: defaultWatchInterval,
+		},
+	}
+}
+
+// Load builds the configuration from the command line arguments, the
+// config file they or the environment name and the environment.
+func Load(args []string) (*Config, error) {
 	const op = "Initial config error: "
 
-	cfg := &Config{}
-	flag.StringVar(&cfg.RunAddress, "a", defaultRunAddr, "run address")
-	flag.StringVar(&cfg.DatabaseURI, "d", "", "database uri")
-	flag.StringVar(&cfg.AccrualSystemAddress, "r", defaultAccrualSystemAddr, "")
-	flag.Parse()
+	cfg := Default()
+	var path string
+	fs := flag.NewFlagSet("gophermart", flag.ContinueOnError)
+	fs.StringVar(&path, "config", "", "yaml or toml config file, overridden by flags and env")
+	fs.StringVar(&cfg.Server.Address, "a", cfg.Server.Address, "run address")
+	fs.BoolVar(&cfg.Server.Debug, "debug", cfg.Server.Debug, "validate responses against the api specification")
+	fs.Var((*listValue)(&cfg.Server.GzipTypes), "gzip-types", "comma separated content types compressed for clients accepting gzip")
+	fs.Int64Var(&cfg.Server.MaxBodySize, "max-body-size", cfg.Server.MaxBodySize, "max size of request bodies in bytes")
+	fs.Var((*listValue)(&cfg.Server.TrustedProxies), "trusted-proxies", "comma separated addresses or cidrs of trusted reverse proxies")
+	fs.StringVar(&cfg.Database.URI, "d", cfg.Database.URI, "database uri")
+	fs.StringVar(&cfg.Database.Password, "db-password", cfg.Database.Password, "database password replacing the one of the uri")
+	fs.Var((*int32Value)(&cfg.Database.MaxConns), "db-max-conns", "max connections of the database pool")
+	fs.Var((*int32Value)(&cfg.Database.MinConns), "db-min-conns", "min connections of the database pool")
+	fs.DurationVar(&cfg.Database.MaxConnLifetime, "db-max-conn-lifetime", cfg.Database.MaxConnLifetime, "lifetime of database connections")
+	fs.IntVar(&cfg.Database.ConnectRetries, "db-connect-retries", cfg.Database.ConnectRetries, "retries of connecting and migrating on startup")
+	fs.StringVar(&cfg.Accrual.Address, "r", cfg.Accrual.Address, "accrual system address")
+	fs.DurationVar(&cfg.Accrual.PollInterval, "accrual-poll-interval", cfg.Accrual.PollInterval, "interval of polling the unfinished orders")
+	fs.DurationVar(&cfg.Accrual.Timeout, "accrual-timeout", cfg.Accrual.Timeout, "timeout of an accrual system request")
+	fs.StringVar(&cfg.Logging.Level, "log-level", cfg.Logging.Level, "log level: debug, info, warn or error")
+	fs.StringVar(&cfg.Logging.Format, "log-format", cfg.Logging.Format, "log format: console or json")
+	fs.StringVar(&cfg.Auth.JWTKey, "jwt-key", cfg.Auth.JWTKey, "key signing the tokens, random if empty")
+	fs.StringVar(&cfg.Auth.Mode, "auth-mode", cfg.Auth.Mode, "auth mode: header, cookie or both")
+	fs.BoolVar(&cfg.Auth.CookieSecure, "cookie-secure", cfg.Auth.CookieSecure, "set the secure attribute on session cookies")
+	fs.StringVar(&cfg.Auth.CookieSameSite, "cookie-samesite", cfg.Auth.CookieSameSite, "samesite attribute of session cookies")
+	fs.DurationVar(&cfg.Auth.TokenTTL, "token-ttl", cfg.Auth.TokenTTL, "lifetime of access tokens")
+	fs.DurationVar(&cfg.Auth.ChallengeTTL, "challenge-ttl", cfg.Auth.ChallengeTTL, "lifetime of 2fa challenge tokens")
+	fs.Float64Var(&cfg.Auth.TwoFactorWithdrawThreshold, "2fa-threshold", cfg.Auth.TwoFactorWithdrawThreshold, "withdraw sum requiring fresh 2fa")
+	fs.DurationVar(&cfg.Auth.TwoFactorMaxAge, "2fa-max-age", cfg.Auth.TwoFactorMaxAge, "max age of 2fa verification for withdrawals")
+	fs.Var((*listValue)(&cfg.Auth.Admins), "admins", "comma separated logins granted the admin role")
+	fs.IntVar(&cfg.Auth.APIKeyMaxRateLimit, "api-key-max-rate-limit", cfg.Auth.APIKeyMaxRateLimit, "max requests per minute of an api key")
+	fs.DurationVar(&cfg.Loyalty.StatementsInterval, "statements-interval", cfg.Loyalty.StatementsInterval, "interval of the monthly statements job")
+	fs.IntVar(&cfg.Loyalty.PointsExpiryMonths, "points-expiry-months", cfg.Loyalty.PointsExpiryMonths, "months until accrued points expire, 0 disables expiry")
+	fs.DurationVar(&cfg.Loyalty.PointsExpiringSoon, "points-expiring-soon", cfg.Loyalty.PointsExpiringSoon, "window of the expiring soon balance section")
+	fs.DurationVar(&cfg.Loyalty.PointsExpiryInterval, "points-expiry-interval", cfg.Loyalty.PointsExpiryInterval, "interval of the points expiry job")
+	fs.StringVar(&cfg.Loyalty.LoyaltyTiers, "loyalty-tiers", cfg.Loyalty.LoyaltyTiers, "loyalty tiers as name:threshold:multiplier separated by commas")
+	fs.DurationVar(&cfg.Loyalty.TiersInterval, "tiers-interval", cfg.Loyalty.TiersInterval, "interval of the tier recalculation job")
+	fs.Float64Var(&cfg.Loyalty.ReferrerBonus, "referrer-bonus", cfg.Loyalty.ReferrerBonus, "bonus of the referrer after the first order of the referee")
+	fs.Float64Var(&cfg.Loyalty.RefereeBonus, "referee-bonus", cfg.Loyalty.RefereeBonus, "bonus of the referee after its first order")
+	fs.IntVar(&cfg.Loyalty.MaxReferrals, "max-referrals", cfg.Loyalty.MaxReferrals, "max rewarded referrals per user, 0 for no limit")
+	fs.Float64Var(&cfg.Balance.TransferDailyLimit, "transfer-daily-limit", cfg.Balance.TransferDailyLimit, "points a user may transfer per day, 0 for no limit")
+	fs.DurationVar(&cfg.Balance.HoldTTL, "hold-ttl", cfg.Balance.HoldTTL, "default lifetime of balance holds")
+	fs.DurationVar(&cfg.Balance.HoldMaxTTL, "hold-max-ttl", cfg.Balance.HoldMaxTTL, "max lifetime of balance holds")
+	fs.DurationVar(&cfg.Balance.HoldsInterval, "holds-interval", cfg.Balance.HoldsInterval, "interval of the expired holds sweeper")
+	fs.Float64Var(&cfg.Balance.WithdrawMaxAmount, "withdraw-max-amount", cfg.Balance.WithdrawMaxAmount, "max sum of a single withdrawal, 0 for no limit")
+	fs.Float64Var(&cfg.Balance.WithdrawDailyCap, "withdraw-daily-cap", cfg.Balance.WithdrawDailyCap, "max sum withdrawn within 24 hours, 0 for no limit")
+	fs.Float64Var(&cfg.Balance.WithdrawWeeklyCap, "withdraw-weekly-cap", cfg.Balance.WithdrawWeeklyCap, "max sum withdrawn within 7 days, 0 for no limit")
+	fs.DurationVar(&cfg.Balance.WithdrawMinAccountAge, "withdraw-min-account-age", cfg.Balance.WithdrawMinAccountAge, "min age of accounts allowed to withdraw")
+	fs.IntVar(&cfg.Balance.WithdrawMaxPerHour, "withdraw-max-per-hour", cfg.Balance.WithdrawMaxPerHour, "max withdrawals within an hour, 0 for no limit")
+	fs.DurationVar(&cfg.Balance.WithdrawNewDeviceAge, "withdraw-new-device-age", cfg.Balance.WithdrawNewDeviceAge, "time after the first sign-in from a device until it may withdraw")
+	fs.DurationVar(&cfg.Webhooks.Interval, "webhooks-interval", cfg.Webhooks.Interval, "interval of the webhook delivery worker")
+	fs.DurationVar(&cfg.Webhooks.Timeout, "webhook-timeout", cfg.Webhooks.Timeout, "timeout of a webhook delivery")
+	fs.IntVar(&cfg.Webhooks.MaxAttempts, "webhook-max-attempts", cfg.Webhooks.MaxAttempts, "attempts of a webhook delivery until it is dead")
+	fs.DurationVar(&cfg.Webhooks.Backoff, "webhook-backoff", cfg.Webhooks.Backoff, "delay of the first webhook retry")
+	fs.DurationVar(&cfg.Webhooks.MaxBackoff, "webhook-max-backoff", cfg.Webhooks.MaxBackoff, "max delay between webhook retries")
+	fs.StringVar(&cfg.Notify.Sink, "notify-sink", cfg.Notify.Sink, "file or stdout receiving the notifications")
+	fs.DurationVar(&cfg.Notify.Interval, "notify-interval", cfg.Notify.Interval, "interval of the notification worker")
+	fs.StringVar(&cfg.Notify.SMTPAddr, "smtp-addr", cfg.Notify.SMTPAddr, "host:port of the smtp server sending email notifications")
+	fs.StringVar(&cfg.Notify.SMTPFrom, "smtp-from", cfg.Notify.SMTPFrom, "sender of email notifications")
+	fs.StringVar(&cfg.Notify.SMTPUsername, "smtp-username", cfg.Notify.SMTPUsername, "smtp username, empty to skip auth")
+	fs.StringVar(&cfg.Notify.SMTPPassword, "smtp-password", cfg.Notify.SMTPPassword, "smtp password")
+	fs.DurationVar(&cfg.Secrets.WatchInterval, "secrets-watch-interval", cfg.Secrets.WatchInterval, "interval of checking secret files for rotation")
+	if err := fs.Parse(args); err != nil {
+		return nil, e.Wrap(op, err)
+	}
+
+	if env, ok := os.LookupEnv(configEnv); ok {
+		path = env
+	}
+	if path != "" {
+		//the file goes under the flags, so the flags set on the command
+		//line are applied once more after reading it
+		set := make(map[string]string)
+		fs.Visit(func(f *flag.Flag) {
+			set[f.Name] = f.Value.String()
+		})
+		if err := readFile(path, cfg); err != nil {
+			return nil, e.Wrap(op, fmt.Errorf("%s: %w", path, err))
+		}
+		for name, value := range set {
+			if err := fs.Set(name, value); err != nil {
+				return nil, e.Wrap(op, err)
+			}
+		}
+	}
 
 	err := cleanenv.ReadEnv(cfg)
 	if err != nil {
 		return nil, e.Wrap(op, err)
 	}
-	if cfg.DatabaseURI == "" {
-		return nil, e.Wrap(op, errEmptyDatabaseURI)
+	if err = cfg.Validate(); err != nil {
+		return nil, e.Wrap(op, err)
 	}
 
 	return cfg, nil
 }
+
+// Validate checks the configuration and parses the loyalty tiers. All
+// invalid settings are reported at once, each prefixed with its key in
+// the config file.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key string, err error) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+
+	check(c.Server.Address != "", "server.address", errEmptyRunAddress)
+	check(c.Server.MaxBodySize > 0, "server.max_body_size", errInvalidBodySize)
+	for _, proxy := range c.Server.TrustedProxies {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		check(cidrErr == nil || net.ParseIP(proxy) != nil, "server.trusted_proxies", errInvalidProxy)
+	}
+	check(c.Database.URI != "", "database.uri", errEmptyDatabaseURI)
+	check(c.Database.MaxConns >= 0 && c.Database.MinConns >= 0 && c.Database.MaxConnLifetime >= 0 &&
+		(c.Database.MaxConns == 0 || c.Database.MinConns <= c.Database.MaxConns), "database", errInvalidPool)
+	check(c.Database.ConnectRetries >= 0, "database.connect_retries", errInvalidRetries)
+	check(c.Accrual.PollInterval > 0, "accrual.poll_interval", errInvalidInterval)
+	check(c.Accrual.Timeout > 0, "accrual.timeout", errInvalidTTL)
+	switch c.Logging.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "logging.level", errInvalidLogLevel)
+	}
+	switch c.Logging.Format {
+	case "console", "json":
+	default:
+		check(false, "logging.format", errInvalidLogFormat)
+	}
+	switch c.Auth.Mode {
+	case "header", "cookie", "both":
+	default:
+		check(false, "auth.mode", errInvalidAuthMode)
+	}
+	switch c.Auth.CookieSameSite {
+	case "strict", "lax":
+	case "none":
+		check(c.Auth.CookieSecure, "auth.cookie_samesite", errInsecureSameSite)
+	default:
+		check(false, "auth.cookie_samesite", errInvalidSameSite)
+	}
+	check(c.Auth.TokenTTL > 0, "auth.token_ttl", errInvalidTTL)
+	check(c.Auth.ChallengeTTL > 0, "auth.challenge_ttl", errInvalidTTL)
+	check(c.Auth.APIKeyMaxRateLimit > 0, "auth.api_key_max_rate_limit", errInvalidRateLimit)
+	check(c.Loyalty.StatementsInterval > 0 && c.Loyalty.PointsExpiryInterval > 0 && c.Loyalty.TiersInterval > 0,
+		"loyalty", errInvalidInterval)
+	check(c.Loyalty.PointsExpiryMonths >= 0 && c.Loyalty.PointsExpiringSoon >= 0, "loyalty", errInvalidExpiry)
+	check(c.Loyalty.ReferrerBonus >= 0 && c.Loyalty.RefereeBonus >= 0 && c.Loyalty.MaxReferrals >= 0, "loyalty", errInvalidReferral)
+	check(c.Balance.TransferDailyLimit >= 0, "balance.transfer_daily_limit", errInvalidTransfer)
+	check(c.Balance.HoldsInterval > 0, "balance.holds_interval", errInvalidInterval)
+	check(c.Balance.HoldTTL > 0 && c.Balance.HoldTTL <= c.Balance.HoldMaxTTL, "balance.hold_ttl", errInvalidHoldTTL)
+	check(c.Balance.WithdrawMaxAmount >= 0 && c.Balance.WithdrawDailyCap >= 0 && c.Balance.WithdrawWeeklyCap >= 0 &&
+		c.Balance.WithdrawMinAccountAge >= 0 && c.Balance.WithdrawMaxPerHour >= 0 && c.Balance.WithdrawNewDeviceAge >= 0,
+		"balance", errInvalidRules)
+	check(c.Webhooks.Interval > 0, "webhooks.interval", errInvalidInterval)
+	check(c.Webhooks.Timeout > 0 && c.Webhooks.MaxAttempts > 0 && c.Webhooks.Backoff > 0 &&
+		c.Webhooks.MaxBackoff >= c.Webhooks.Backoff, "webhooks", errInvalidWebhooks)
+	check(c.Notify.Interval > 0, "notify.interval", errInvalidInterval)
+	check(c.Notify.SMTPAddr == "" || c.Notify.SMTPFrom != "", "notify.smtp_from", errEmptySMTPFrom)
+	check(c.Secrets.WatchInterval > 0, "secrets.watch_interval", errInvalidInterval)
+	for _, secret := range []struct{ key, ref string }{
+		{"database.uri", c.Database.URI},
+		{"database.password", c.Database.Password},
+		{"auth.jwt_key", c.Auth.JWTKey},
+		{"notify.smtp_password", c.Notify.SMTPPassword},
+	} {
+		v, err := secrets.Resolve(secret.ref)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", secret.key, err))
+			continue
+		}
+		if secret.key == "auth.jwt_key" {
+			check(v == "" || len(v) >= jwt.MinKeyLen, secret.key, errShortJWTKey)
+		}
+	}
+
+	var err error
+	if c.Loyalty.Tiers, err = tiers.Parse(c.Loyalty.LoyaltyTiers); err != nil {
+		errs = append(errs, fmt.Errorf("loyalty.tiers: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// listValue is a comma separated flag which replaces the list.
+type listValue []string
+
+func (l *listValue) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listValue) Set(s string) error {
+	*l = strings.Split(s, ",")
+	return nil
+}
+
+type int32Value int32
+
+func (i *int32Value) String() string {
+	return strconv.FormatInt(int64(*i), 10)
+}
+
+func (i *int32Value) Set(s string) error {
+	v, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return err
+	}
+	*i = int32Value(v)
+	return nil
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const yamlConfig = `
+server:
+  address: 0.0.0.0:9000
+  gzip_types: [application/json]
+database:
+  uri: postgres://gophermart:s3cret@db:5432/gophermart?sslmode=disable
+  max_conns: 20
+accrual:
+  poll_interval: 3s
+auth:
+  token_ttl: 15m
+  admins: [alice, bob]
+notify:
+  smtp_addr: smtp:587
+  smtp_from: noreply@gophermart.local
+  smtp_password: hunter2
+`
+
+const tomlConfig = `
+[server]
+address = "0.0.0.0:9000"
+
+[database]
+uri = "host=db user=gophermart password=s3cret dbname=gophermart"
+
+[loyalty]
+tiers = "silver:1000:1.1"
+statements_interval = "2h"
+`
+
+func writeConfig(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfig(t, "gophermart.yaml", yamlConfig)
+	t.Setenv("ACCRUAL_POLL_INTERVAL", "5s")
+
+	cfg, err := Load([]string{"-config", path, "-a", "127.0.0.1:7000", "-accrual-poll-interval", "4s"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	//the flags override the file and the environment the flags
+	if cfg.Server.Address != "127.0.0.1:7000" {
+		t.Errorf("Server.Address = %v, want the flag", cfg.Server.Address)
+	}
+	if cfg.Accrual.PollInterval != 5*time.Second {
+		t.Errorf("Accrual.PollInterval = %v, want the env", cfg.Accrual.PollInterval)
+	}
+	if cfg.Database.MaxConns != 20 || cfg.Auth.TokenTTL != 15*time.Minute ||
+		strings.Join(cfg.Auth.Admins, ",") != "alice,bob" || strings.Join(cfg.Server.GzipTypes, ",") != "application/json" {
+		t.Errorf("Load() = %+v, want the file settings", cfg)
+	}
+	if cfg.Auth.ChallengeTTL != defaultChallengeTTL || cfg.Webhooks.MaxAttempts != defaultWebhookMaxAttempts {
+		t.Errorf("Load() = %+v, want the defaults for unset settings", cfg)
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	t.Setenv(configEnv, writeConfig(t, "gophermart.toml", tomlConfig))
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Server.Address != "0.0.0.0:9000" || cfg.Loyalty.StatementsInterval != 2*time.Hour || len(cfg.Loyalty.Tiers) != 1 {
+		t.Errorf("Load() = %+v, want the file settings", cfg)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		args    []string
+		wantErr error
+		wantKey string
+	}{
+		{name: "no database", args: []string{}, wantErr: errEmptyDatabaseURI, wantKey: "database.uri"},
+		{name: "auth mode", args: []string{"-d", "postgres://db", "-auth-mode", "basic"},
+			wantErr: errInvalidAuthMode, wantKey: "auth.mode"},
+		{name: "token ttl", args: []string{"-d", "postgres://db", "-token-ttl", "0s"},
+			wantErr: errInvalidTTL, wantKey: "auth.token_ttl"},
+		{name: "body size", args: []string{"-d", "postgres://db", "-max-body-size", "0"},
+			wantErr: errInvalidBodySize, wantKey: "server.max_body_size"},
+		{name: "trusted proxy", args: []string{"-d", "postgres://db", "-trusted-proxies", "10.0.0.0/8,proxy.local"},
+			wantErr: errInvalidProxy, wantKey: "server.trusted_proxies"},
+		{name: "log level", args: []string{"-d", "postgres://db", "-log-level", "trace"},
+			wantErr: errInvalidLogLevel, wantKey: "logging.level"},
+		{name: "pool", file: "c.yaml", content: "database:\n  uri: postgres://db\n  max_conns: 2\n  min_conns: 4\n",
+			wantErr: errInvalidPool, wantKey: "database"},
+		{name: "unknown toml key", file: "c.toml", content: "[database]\nurl = \"postgres://db\"\n",
+			wantErr: errUnknownConfigField},
+		{name: "unknown yaml key", file: "c.yaml", content: "databse:\n  uri: postgres://db\n", wantKey: "databse"},
+		{name: "file type", file: "c.json", content: "{}", wantErr: errUnknownConfigType},
+		{name: "missing secret file", args: []string{"-d", "file:///run/secrets/gophermart-missing"}, wantKey: "database.uri"},
+		{name: "unset secret env", args: []string{"-d", "postgres://db", "-db-password", "env:GOPHERMART_UNSET"},
+			wantKey: "database.password"},
+		{name: "short jwt key", args: []string{"-d", "postgres://db", "-jwt-key", "too-short-key"},
+			wantErr: errShortJWTKey, wantKey: "auth.jwt_key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = []string{"-config", writeConfig(t, tt.file, tt.content)}
+			}
+			_, err := Load(args)
+			if err == nil {
+				t.Fatalf("Load() error = nil, want %v", tt.wantErr)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Load() error = %v, want %v", err, tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantKey) {
+				t.Errorf("Load() error = %v, want it to name %v", err, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		name string
+		uri  string
+		want string
+	}{
+		{name: "url", uri: "postgres://gophermart:s3cret@db:5432/gophermart?sslmode=disable",
+			want: "postgres://gophermart:xxxxx@db:5432/gophermart?sslmode=disable"},
+		{name: "url query", uri: "postgres://db/gophermart?password=s3cret", want: "postgres://db/gophermart?password=xxxxx"},
+		{name: "key value", uri: "host=db password=s3cret dbname=gophermart", want: "host=db password=xxxxx dbname=gophermart"},
+		{name: "reference", uri: "env:GOPHERMART_DATABASE_URI", want: "env:GOPHERMART_DATABASE_URI"},
+		{name: "quoted", uri: "host=db password='s3 cret' dbname=gophermart", want: "host=db password=xxxxx dbname=gophermart"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Database.URI = tt.uri
+			cfg.Notify.SMTPPassword = "hunter2"
+			cfg.Auth.JWTKey = "file:///run/secrets/jwt_key"
+
+			out := cfg.String()
+			if strings.Contains(out, "s3cret") || strings.Contains(out, "s3 cret") || strings.Contains(out, "hunter2") {
+				t.Errorf("String() leaks a secret:\n%s", out)
+			}
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("String() = %s, want uri %v", out, tt.want)
+			}
+			//references tell where the secret is, so they are shown
+			if !strings.Contains(out, "file:///run/secrets/jwt_key") {
+				t.Errorf("String() = %s, want the jwt key reference", out)
+			}
+			if cfg.Database.URI != tt.uri || cfg.Notify.SMTPPassword != "hunter2" {
+				t.Errorf("String() modified the config")
+			}
+		})
+	}
+}
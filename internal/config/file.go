@@ -0,0 +1,98 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/eqkez0r/gophermart/internal/secrets"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// redacted replaces the secrets in the printed configuration, the same
+// way url.URL.Redacted does.
+const redacted = "xxxxx"
+
+// dsnPassword matches the password of a key=value connection string.
+var dsnPassword = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// readFile decodes the config file over cfg. Keys the configuration
+// doesn't know are reported, so a typo doesn't silently keep a default.
+func readFile(path string, cfg *Config) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err = dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		return nil
+	case ".toml":
+		md, err := toml.Decode(string(b), cfg)
+		if err != nil {
+			return err
+		}
+		if keys := md.Undecoded(); len(keys) > 0 {
+			return fmt.Errorf("%w: %v", errUnknownConfigField, keys)
+		}
+		return nil
+	default:
+		return errUnknownConfigType
+	}
+}
+
+// Redacted returns a copy of the configuration with the secrets
+// replaced, which is safe to print and log.
+func (c *Config) Redacted() *Config {
+	r := *c
+	r.Database.URI = redactURI(c.Database.URI)
+	r.Database.Password = redactSecret(c.Database.Password)
+	r.Auth.JWTKey = redactSecret(c.Auth.JWTKey)
+	r.Notify.SMTPPassword = redactSecret(c.Notify.SMTPPassword)
+	return &r
+}
+
+// redactSecret hides the secret unless it is a reference, which tells
+// where the secret is kept rather than the secret itself.
+func redactSecret(v string) string {
+	if v == "" || secrets.IsRef(v) {
+		return v
+	}
+	return redacted
+}
+
+// String renders the redacted configuration in the YAML config file
+// format.
+func (c *Config) String() string {
+	b, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
+
+// redactURI hides the password of both URL and key=value connection
+// strings.
+func redactURI(uri string) string {
+	if secrets.IsRef(uri) {
+		return uri
+	}
+	if u, err := url.Parse(uri); err == nil && u.Scheme != "" {
+		if q := u.Query(); q.Has("password") {
+			q.Set("password", redacted)
+			u.RawQuery = q.Encode()
+		}
+		return u.Redacted()
+	}
+	return dsnPassword.ReplaceAllString(uri, "${1}"+redacted)
+}
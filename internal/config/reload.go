@@ -0,0 +1,116 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	"go.uber.org/zap"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var ErrNotReloadable = errors.New("changed settings require a restart")
+
+// Change is a setting which differs between two configurations. Secrets
+// are redacted in Old and New.
+type Change struct {
+	Key        string `json:"key"`
+	Old        string `json:"old"`
+	New        string `json:"new"`
+	Reloadable bool   `json:"reloadable"`
+}
+
+// Diff lists the settings of next which differ from prev, keyed like in
+// the config file.
+func Diff(prev, next *Config) []Change {
+	var changes []Change
+	pv, nv := reflect.ValueOf(*prev), reflect.ValueOf(*next)
+	//the values are shown from the redacted copies
+	rpv, rnv := reflect.ValueOf(*prev.Redacted()), reflect.ValueOf(*next.Redacted())
+	for i := 0; i < pv.NumField(); i++ {
+		section := pv.Type().Field(i)
+		for j := 0; j < section.Type.NumField(); j++ {
+			field := section.Type.Field(j)
+			name := field.Tag.Get("yaml")
+			if name == "-" || reflect.DeepEqual(pv.Field(i).Field(j).Interface(), nv.Field(i).Field(j).Interface()) {
+				continue
+			}
+			changes = append(changes, Change{
+				Key:        section.Tag.Get("yaml") + "." + name,
+				Old:        fmt.Sprint(rpv.Field(i).Field(j).Interface()),
+				New:        fmt.Sprint(rnv.Field(i).Field(j).Interface()),
+				Reloadable: field.Tag.Get("reload") == "true",
+			})
+		}
+	}
+	return changes
+}
+
+// Reloader loads the configuration again from the arguments the server
+// was started with, the config file and the environment. Valid
+// configurations changing only reloadable settings are handed to the
+// hooks, anything else keeps the running configuration.
+type Reloader struct {
+	logger  *zap.SugaredLogger
+	args    []string
+	mu      sync.Mutex
+	current *Config
+	hooks   []func(*Config)
+}
+
+func NewReloader(logger *zap.SugaredLogger, args []string, cfg *Config) *Reloader {
+	return &Reloader{
+		logger:  logger,
+		args:    args,
+		current: cfg,
+	}
+}
+
+// OnReload registers a hook applying the reloadable settings of the new
+// configuration. Hooks must swap the settings atomically, as they run
+// while the server keeps serving.
+func (r *Reloader) OnReload(hook func(*Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, hook)
+}
+
+// Reload applies the changed settings and returns them.
+func (r *Reloader) Reload() ([]Change, error) {
+	const op = "Config reload error: "
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := Load(r.args)
+	if err != nil {
+		r.logger.Warn(e.Wrap(op, err))
+		return nil, err
+	}
+	changes := Diff(r.current, cfg)
+	var rejected []string
+	for _, c := range changes {
+		if !c.Reloadable {
+			rejected = append(rejected, c.Key)
+		}
+	}
+	if len(rejected) > 0 {
+		err = fmt.Errorf("%w: %s", ErrNotReloadable, strings.Join(rejected, ", "))
+		r.logger.Warn(e.Wrap(op, err))
+		return nil, err
+	}
+	if len(changes) == 0 {
+		r.logger.Info("config reloaded without changes")
+		return changes, nil
+	}
+
+	for _, hook := range r.hooks {
+		hook(cfg)
+	}
+	r.current = cfg
+	for _, c := range changes {
+		r.logger.Infow("config setting reloaded", "key", c.Key, "old", c.Old, "new", c.New)
+	}
+	return changes, nil
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"errors"
+	"go.uber.org/zap"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	prev := Default()
+	prev.Database.URI = "postgres://gophermart:old@db/gophermart"
+	next := Default()
+	next.Database.URI = "postgres://gophermart:new@db/gophermart"
+	next.Logging.Level = "warn"
+	next.Auth.Admins = []string{"alice"}
+
+	want := map[string]Change{
+		"database.uri": {Key: "database.uri", Old: "postgres://gophermart:xxxxx@db/gophermart",
+			New: "postgres://gophermart:xxxxx@db/gophermart"},
+		"logging.level": {Key: "logging.level", Old: "debug", New: "warn", Reloadable: true},
+		"auth.admins":   {Key: "auth.admins", Old: "[]", New: "[alice]"},
+	}
+	changes := Diff(prev, next)
+	if len(changes) != len(want) {
+		t.Fatalf("Diff() = %+v, want %d changes", changes, len(want))
+	}
+	for _, c := range changes {
+		if c != want[c.Key] {
+			t.Errorf("Diff() change = %+v, want %+v", c, want[c.Key])
+		}
+	}
+}
+
+func TestReloader(t *testing.T) {
+	path := writeConfig(t, "gophermart.yaml", "database:\n  uri: postgres://db\n")
+	args := []string{"-config", path}
+	cfg, err := Load(args)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	r := NewReloader(zap.NewNop().Sugar(), args, cfg)
+	var applied *Config
+	r.OnReload(func(cfg *Config) { applied = cfg })
+
+	tests := []struct {
+		name        string
+		content     string
+		wantErr     error
+		wantChanges int
+		wantApplied bool
+	}{
+		{name: "unchanged", content: "database:\n  uri: postgres://db\n"},
+		{name: "reloadable", content: "database:\n  uri: postgres://db\nlogging:\n  level: warn\naccrual:\n  poll_interval: 5s\n",
+			wantChanges: 2, wantApplied: true},
+		{name: "listen address", content: "database:\n  uri: postgres://db\nserver:\n  address: 0.0.0.0:80\n",
+			wantErr: ErrNotReloadable},
+		{name: "invalid", content: "database:\n  uri: postgres://db\nlogging:\n  level: trace\n", wantErr: errInvalidLogLevel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applied = nil
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			changes, err := r.Reload()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Reload() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(changes) != tt.wantChanges {
+				t.Errorf("Reload() = %+v, want %d changes", changes, tt.wantChanges)
+			}
+			if (applied != nil) != tt.wantApplied {
+				t.Errorf("Reload() applied = %v, want %v", applied != nil, tt.wantApplied)
+			}
+		})
+	}
+	//the rejected reloads keep the applied config
+	if r.current.Logging.Level != "warn" || r.current.Accrual.PollInterval != 5*time.Second {
+		t.Errorf("Reloader current = %+v, want the reloaded settings", r.current)
+	}
+}
@@ -0,0 +1,93 @@
+package expiry
+
+import (
+	"context"
+	"github.com/eqkez0r/gophermart/internal/scheduler"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Policy expires accrued points Months after the order is processed.
+// Soon is how far ahead the balance lists the points about to expire.
+type Policy struct {
+	Months int
+	Soon   time.Duration
+}
+
+// Enabled reports whether points expire at all.
+func (p Policy) Enabled() bool {
+	return p.Months > 0
+}
+
+type Expirer interface {
+	ExpirePoints(ctx context.Context, months int, now time.Time) (int64, error)
+}
+
+// Job expires the points which are due. It is only scheduled when the
+// policy is enabled.
+func Job(
+	logger *zap.SugaredLogger,
+	store Expirer,
+	policy Policy,
+	interval time.Duration,
+) *scheduler.Job {
+	return &scheduler.Job{
+		Name:     "points expiry",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			n, err := store.ExpirePoints(ctx, policy.Months, time.Now())
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				logger.Infof("expired %d point lots", n)
+			}
+			return nil
+		},
+	}
+}
+
+// Consume takes amount from the lots in the given order, which is the
+// order they were accrued in, and returns the lots it changed. Whatever
+// the lots don't cover comes from points without a lot, e.g. balance
+// adjustments, which never expire.
+func Consume(lots []*obj.PointLot, amount float32) []*obj.PointLot {
+	changed := make([]*obj.PointLot, 0)
+	for _, lot := range lots {
+		if amount <= 0 {
+			break
+		}
+		if lot.Remaining <= 0 {
+			continue
+		}
+		if lot.Remaining <= amount {
+			amount -= lot.Remaining
+			lot.Remaining = 0
+		} else {
+			lot.Remaining -= amount
+			amount = 0
+		}
+		changed = append(changed, lot)
+	}
+	return changed
+}
+
+// Expire splits the due lots, oldest first, into the points expiring now
+// and the points kept because active holds reserve them. Kept points
+// stay in their lot and expire once the hold is released. Lots never
+// hold more than the balance, the cap only guards against a negative
+// balance after manual changes.
+func Expire(lots []*obj.PointLot, balance, held float32) (expired, kept []float32) {
+	available := max(balance-held, 0)
+	expired = make([]float32, len(lots))
+	kept = make([]float32, len(lots))
+	for i, lot := range lots {
+		covered := max(min(lot.Remaining, balance), 0)
+		balance -= covered
+		expired[i] = min(covered, available)
+		available -= expired[i]
+		kept[i] = covered - expired[i]
+	}
+	return expired, kept
+}
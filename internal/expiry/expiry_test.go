@@ -0,0 +1,141 @@
+package expiry
+
+import (
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"reflect"
+	"testing"
+)
+
+func TestConsume(t *testing.T) {
+	tests := []struct {
+		name          string
+		lots          []float32
+		amount        float32
+		wantRemaining []float32
+		wantChanged   []uint64
+	}{
+		{
+			name:          "part of the oldest lot",
+			lots:          []float32{100, 50},
+			amount:        30,
+			wantRemaining: []float32{70, 50},
+			wantChanged:   []uint64{1},
+		},
+		{
+			name:          "exactly the oldest lot",
+			lots:          []float32{100, 50},
+			amount:        100,
+			wantRemaining: []float32{0, 50},
+			wantChanged:   []uint64{1},
+		},
+		{
+			name:          "across lots",
+			lots:          []float32{100, 50, 20},
+			amount:        120,
+			wantRemaining: []float32{0, 30, 20},
+			wantChanged:   []uint64{1, 2},
+		},
+		{
+			name:          "spent lots are skipped",
+			lots:          []float32{0, 40, 20},
+			amount:        50,
+			wantRemaining: []float32{0, 0, 10},
+			wantChanged:   []uint64{2, 3},
+		},
+		{
+			name:          "more than the lots",
+			lots:          []float32{10, 5},
+			amount:        40,
+			wantRemaining: []float32{0, 0},
+			wantChanged:   []uint64{1, 2},
+		},
+		{
+			name:          "fractional",
+			lots:          []float32{0.5, 729.98},
+			amount:        100.25,
+			wantRemaining: []float32{0, 630.23},
+			wantChanged:   []uint64{1, 2},
+		},
+		{
+			name:          "nothing",
+			lots:          []float32{10},
+			amount:        0,
+			wantRemaining: []float32{10},
+			wantChanged:   []uint64{},
+		},
+		{
+			name:          "no lots",
+			amount:        10,
+			wantRemaining: []float32{},
+			wantChanged:   []uint64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lots := make([]*obj.PointLot, len(tt.lots))
+			for i, r := range tt.lots {
+				lots[i] = &obj.PointLot{LotID: uint64(i + 1), Remaining: r}
+			}
+
+			changed := Consume(lots, tt.amount)
+
+			gotChanged := make([]uint64, 0, len(changed))
+			for _, lot := range changed {
+				gotChanged = append(gotChanged, lot.LotID)
+			}
+			if !reflect.DeepEqual(gotChanged, tt.wantChanged) {
+				t.Errorf("Consume() changed = %v, want %v", gotChanged, tt.wantChanged)
+			}
+			gotRemaining := make([]float32, 0, len(lots))
+			for _, lot := range lots {
+				gotRemaining = append(gotRemaining, lot.Remaining)
+			}
+			if !reflect.DeepEqual(gotRemaining, tt.wantRemaining) {
+				t.Errorf("Consume() remaining = %v, want %v", gotRemaining, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestExpire(t *testing.T) {
+	tests := []struct {
+		name        string
+		lots        []float32
+		balance     float32
+		held        float32
+		wantExpired []float32
+		wantKept    []float32
+	}{
+		{name: "all due", lots: []float32{100, 50}, balance: 200,
+			wantExpired: []float32{100, 50}, wantKept: []float32{0, 0}},
+		{name: "active hold", lots: []float32{100, 50}, balance: 150, held: 80,
+			wantExpired: []float32{70, 0}, wantKept: []float32{30, 50}},
+		{name: "hold of points without a lot", lots: []float32{100}, balance: 300, held: 150,
+			wantExpired: []float32{100}, wantKept: []float32{0}},
+		{name: "whole balance held", lots: []float32{100}, balance: 100, held: 100,
+			wantExpired: []float32{0}, wantKept: []float32{100}},
+		{name: "lots above the balance", lots: []float32{100, 50}, balance: 120,
+			wantExpired: []float32{100, 20}, wantKept: []float32{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lots := make([]*obj.PointLot, 0, len(tt.lots))
+			for i, r := range tt.lots {
+				lots = append(lots, &obj.PointLot{LotID: uint64(i + 1), Remaining: r})
+			}
+			expired, kept := Expire(lots, tt.balance, tt.held)
+			if !reflect.DeepEqual(expired, tt.wantExpired) || !reflect.DeepEqual(kept, tt.wantKept) {
+				t.Errorf("Expire() = %v, %v, want %v, %v", expired, kept, tt.wantExpired, tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestPolicyEnabled(t *testing.T) {
+	if (Policy{}).Enabled() {
+		t.Errorf("Enabled() = true for 0 months")
+	}
+	if !(Policy{Months: 12}).Enabled() {
+		t.Errorf("Enabled() = false for 12 months")
+	}
+}
@@ -0,0 +1,54 @@
+package holds
+
+import (
+	"context"
+	"github.com/eqkez0r/gophermart/internal/scheduler"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Policy bounds the lifetime of holds. Holds requested without a lifetime
+// live TTL, longer ones than MaxTTL are rejected.
+type Policy struct {
+	TTL    time.Duration
+	MaxTTL time.Duration
+}
+
+// ExpiresAt returns when a hold created at now and requested to live
+// seconds expires. It reports false if the lifetime is out of bounds.
+func (p Policy) ExpiresAt(now time.Time, seconds int) (time.Time, bool) {
+	ttl := p.TTL
+	if seconds != 0 {
+		ttl = time.Duration(seconds) * time.Second
+	}
+	if ttl <= 0 || ttl > p.MaxTTL {
+		return time.Time{}, false
+	}
+	return now.Add(ttl), true
+}
+
+type Expirer interface {
+	ExpireHolds(ctx context.Context, now time.Time) (int64, error)
+}
+
+// Job releases the holds which expired without being captured.
+func Job(
+	logger *zap.SugaredLogger,
+	store Expirer,
+	interval time.Duration,
+) *scheduler.Job {
+	return &scheduler.Job{
+		Name:     "holds expiry",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			n, err := store.ExpireHolds(ctx, time.Now())
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				logger.Infof("released %d expired holds", n)
+			}
+			return nil
+		},
+	}
+}
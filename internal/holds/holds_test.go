@@ -0,0 +1,35 @@
+package holds
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyExpiresAt(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	policy := Policy{TTL: 15 * time.Minute, MaxTTL: time.Hour}
+
+	tests := []struct {
+		name    string
+		seconds int
+		want    time.Time
+		wantOK  bool
+	}{
+		{name: "default", seconds: 0, want: now.Add(15 * time.Minute), wantOK: true},
+		{name: "requested", seconds: 120, want: now.Add(2 * time.Minute), wantOK: true},
+		{name: "max", seconds: 3600, want: now.Add(time.Hour), wantOK: true},
+		{name: "too long", seconds: 3601},
+		{name: "negative", seconds: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := policy.ExpiresAt(now, tt.seconds)
+			if ok != tt.wantOK {
+				t.Fatalf("ExpiresAt() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ExpiresAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package limits
+
+import (
+	"fmt"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"time"
+)
+
+// Check evaluates the rules for a withdrawal of sum at now and returns
+// the error of the first rule blocking it. Every rule has its own error
+// code, so clients can tell them apart.
+func Check(rules *obj.WithdrawRules, a *obj.WithdrawActivity, sum float32, now time.Time) error {
+	switch {
+	case !rules.Enabled():
+		return nil
+	case rules.MaxAmount > 0 && sum > rules.MaxAmount:
+		return e.ErrWithdrawAmountLimit.WithDetail(fmt.Sprintf("at most %v per withdrawal", rules.MaxAmount))
+	case rules.MinAccountAge > 0 && now.Sub(a.RegisteredAt) < rules.MinAccountAge:
+		return e.ErrAccountTooNew.WithDetail("withdrawals are allowed from " + a.RegisteredAt.Add(rules.MinAccountAge).UTC().Format(time.RFC3339))
+	case rules.NewDeviceAge > 0 && (a.DeviceSeenAt.IsZero() || now.Sub(a.DeviceSeenAt) < rules.NewDeviceAge):
+		return e.ErrNewDevice
+	case rules.MaxPerHour > 0 && a.LastHour >= rules.MaxPerHour:
+		return e.ErrWithdrawVelocity.WithDetail(fmt.Sprintf("at most %d per hour", rules.MaxPerHour))
+	case rules.DailyCap > 0 && a.Day+sum > rules.DailyCap:
+		return e.ErrWithdrawDailyLimit.WithDetail(fmt.Sprintf("%v of %v left", max(rules.DailyCap-a.Day, 0), rules.DailyCap))
+	case rules.WeeklyCap > 0 && a.Week+sum > rules.WeeklyCap:
+		return e.ErrWithdrawWeeklyLimit.WithDetail(fmt.Sprintf("%v of %v left", max(rules.WeeklyCap-a.Week, 0), rules.WeeklyCap))
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package limits
+
+import (
+	"errors"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	rules := &obj.WithdrawRules{
+		MaxAmount:     1000,
+		DailyCap:      1500,
+		WeeklyCap:     5000,
+		MinAccountAge: 7 * 24 * time.Hour,
+		MaxPerHour:    3,
+		NewDeviceAge:  24 * time.Hour,
+	}
+	usual := obj.WithdrawActivity{
+		RegisteredAt: now.AddDate(0, -1, 0),
+		Day:          200,
+		Week:         1200,
+		LastHour:     1,
+		DeviceSeenAt: now.AddDate(0, 0, -3),
+	}
+
+	tests := []struct {
+		name     string
+		rules    *obj.WithdrawRules
+		activity func(a *obj.WithdrawActivity)
+		sum      float32
+		want     error
+	}{
+		{name: "allowed", rules: rules, sum: 500},
+		{name: "no rules", rules: nil, sum: 1e6, activity: func(a *obj.WithdrawActivity) { a.DeviceSeenAt = time.Time{} }},
+		{name: "max amount", rules: rules, sum: 1000.01, want: e.ErrWithdrawAmountLimit},
+		{name: "new account", rules: rules, sum: 10, want: e.ErrAccountTooNew,
+			activity: func(a *obj.WithdrawActivity) { a.RegisteredAt = now.Add(-time.Hour) }},
+		{name: "unknown device", rules: rules, sum: 10, want: e.ErrNewDevice,
+			activity: func(a *obj.WithdrawActivity) { a.DeviceSeenAt = time.Time{} }},
+		{name: "new device", rules: rules, sum: 10, want: e.ErrNewDevice,
+			activity: func(a *obj.WithdrawActivity) { a.DeviceSeenAt = now.Add(-23 * time.Hour) }},
+		{name: "velocity", rules: rules, sum: 10, want: e.ErrWithdrawVelocity,
+			activity: func(a *obj.WithdrawActivity) { a.LastHour = 3 }},
+		{name: "daily cap", rules: rules, sum: 1000, want: e.ErrWithdrawDailyLimit,
+			activity: func(a *obj.WithdrawActivity) { a.Day = 600 }},
+		{name: "daily cap reached exactly", rules: rules, sum: 900,
+			activity: func(a *obj.WithdrawActivity) { a.Day = 600 }},
+		{name: "weekly cap", rules: rules, sum: 500, want: e.ErrWithdrawWeeklyLimit,
+			activity: func(a *obj.WithdrawActivity) { a.Week = 4600 }},
+		{name: "single rule", rules: &obj.WithdrawRules{MaxPerHour: 1}, sum: 1e6,
+			activity: func(a *obj.WithdrawActivity) { a.DeviceSeenAt, a.LastHour = time.Time{}, 0 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := usual
+			if tt.activity != nil {
+				tt.activity(&a)
+			}
+			err := Check(tt.rules, &a, tt.sum, now)
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Check() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileSink writes messages as JSON lines instead of sending them. It
+// handles every channel and is meant for development and debugging.
+type FileSink struct {
+	mu sync.Mutex
+	w  io.Writer
+	c  io.Closer
+}
+
+type sinkRecord struct {
+	Time time.Time `json:"time"`
+	*Message
+}
+
+// NewFileSink appends to the file at path, "stdout" and "-" write to the
+// standard output.
+func NewFileSink(path string) (*FileSink, error) {
+	if path == "stdout" || path == "-" {
+		return &FileSink{w: os.Stdout}, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{w: f, c: f}, nil
+}
+
+func (s *FileSink) Notify(_ context.Context, m *Message) error {
+	b, err := json.Marshal(&sinkRecord{Time: time.Now().UTC(), Message: m})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+func (s *FileSink) Close() error {
+	if s.c == nil {
+		return nil
+	}
+	return s.c.Close()
+}
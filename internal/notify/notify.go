@@ -0,0 +1,202 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eqkez0r/gophermart/internal/scheduler"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"go.uber.org/zap"
+	"net/mail"
+	"regexp"
+	"time"
+)
+
+const (
+	//notifications claimed by one run of the worker
+	batchSize = 50
+	//claimed notifications are hidden from other workers for the lease
+	lease       = time.Minute
+	maxAttempts = 5
+	retryDelay  = time.Minute
+	//push tokens of the common providers are far shorter
+	maxPushTokenLength = 4096
+)
+
+var (
+	errNoDriver         = errors.New("no notification driver for the channel")
+	errRender           = errors.New("notification can't be rendered")
+	errUnknownChannel   = errors.New("unknown notification channel")
+	errNoChannelDriver  = errors.New("notification channel is not available")
+	errUnknownEvent     = errors.New("unknown notification event")
+	errUnknownLocale    = errors.New("unsupported notification locale")
+	errNoRecipient      = errors.New("notification channel has no address")
+	errInvalidEmail     = errors.New("invalid notification email")
+	errInvalidPhone     = errors.New("notification phone must be in the E.164 format")
+	errInvalidPushToken = errors.New("invalid notification push token")
+)
+
+var phoneRe = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// Message is a rendered notification. Subject is dropped by channels
+// without one, e.g. sms.
+type Message struct {
+	Channel string `json:"channel"`
+	To      string `json:"to"`
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body"`
+}
+
+// Notifier delivers messages. Drivers handle one or more channels.
+type Notifier interface {
+	Notify(context.Context, *Message) error
+}
+
+// Dispatcher routes messages to the driver of their channel.
+type Dispatcher map[string]Notifier
+
+func (d Dispatcher) Notify(ctx context.Context, m *Message) error {
+	n, ok := d[m.Channel]
+	if !ok {
+		return fmt.Errorf("%w: %s", errNoDriver, m.Channel)
+	}
+	return n.Notify(ctx, m)
+}
+
+// Validate checks notification preferences and defaults the locale. Every
+// channel needs its address and to be one of channels, those with a driver.
+func Validate(p *obj.NotificationPrefs, channels map[string]bool) error {
+	if p.Locale == "" {
+		p.Locale = DefaultLocale
+	}
+	if _, ok := templates[p.Locale]; !ok {
+		return fmt.Errorf("%w: %s", errUnknownLocale, p.Locale)
+	}
+	for _, event := range p.Events {
+		if !obj.NotificationEvents[event] {
+			return fmt.Errorf("%w: %s", errUnknownEvent, event)
+		}
+	}
+	if p.Email != "" {
+		if a, err := mail.ParseAddress(p.Email); err != nil || a.Address != p.Email {
+			return errInvalidEmail
+		}
+	}
+	if p.Phone != "" && !phoneRe.MatchString(p.Phone) {
+		return errInvalidPhone
+	}
+	if len(p.PushToken) > maxPushTokenLength {
+		return errInvalidPushToken
+	}
+	for _, ch := range p.Channels {
+		if !obj.NotificationChannels[ch] {
+			return fmt.Errorf("%w: %s", errUnknownChannel, ch)
+		}
+		if !channels[ch] {
+			return fmt.Errorf("%w: %s", errNoChannelDriver, ch)
+		}
+		if Recipient(p, ch) == "" {
+			return fmt.Errorf("%w: %s", errNoRecipient, ch)
+		}
+	}
+	return nil
+}
+
+// Recipient returns the address of the user on the channel.
+func Recipient(p *obj.NotificationPrefs, channel string) string {
+	switch channel {
+	case obj.ChannelEmail:
+		return p.Email
+	case obj.ChannelSMS:
+		return p.Phone
+	case obj.ChannelPush:
+		return p.PushToken
+	}
+	return ""
+}
+
+type Store interface {
+	ClaimNotifications(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*obj.Notification, error)
+	SettleNotification(context.Context, *obj.Notification) error
+}
+
+type Worker struct {
+	logger   *zap.SugaredLogger
+	store    Store
+	notifier Notifier
+}
+
+func NewWorker(
+	logger *zap.SugaredLogger,
+	store Store,
+	notifier Notifier,
+) *Worker {
+	return &Worker{
+		logger:   logger,
+		store:    store,
+		notifier: notifier,
+	}
+}
+
+// Run renders and sends the notifications which are due. Failed sends are
+// retried with a growing delay, notifications which can't be rendered or
+// have no driver fail right away.
+func (w *Worker) Run(ctx context.Context) error {
+	ns, err := w.store.ClaimNotifications(ctx, time.Now(), lease, batchSize)
+	if err != nil {
+		return err
+	}
+	for _, n := range ns {
+		w.settle(n, w.send(ctx, n))
+		if err = w.store.SettleNotification(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Worker) send(ctx context.Context, n *obj.Notification) error {
+	subject, body, err := Render(n.Event, n.Locale, n.Data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errRender, err)
+	}
+	return w.notifier.Notify(ctx, &Message{
+		Channel: n.Channel,
+		To:      n.Recipient,
+		Subject: subject,
+		Body:    body,
+	})
+}
+
+// settle moves the notification to its next state after the send.
+func (w *Worker) settle(n *obj.Notification, err error) {
+	n.Attempts++
+	now := time.Now()
+	if err == nil {
+		n.Status, n.Error, n.NextAttemptAt, n.SentAt = obj.NotificationStatusSent, "", nil, &now
+		return
+	}
+	n.Error = err.Error()
+	//retries don't help notifications without a template or a driver
+	if errors.Is(err, errRender) || errors.Is(err, errNoDriver) || n.Attempts >= maxAttempts {
+		n.Status, n.NextAttemptAt = obj.NotificationStatusFailed, nil
+		w.logger.Warnw("notification failed", "notification", n.NotificationID, "channel", n.Channel, "error", err)
+		return
+	}
+	next := now.Add(retryDelay << (n.Attempts - 1))
+	n.Status, n.NextAttemptAt = obj.NotificationStatusPending, &next
+}
+
+// Job runs the notification worker every interval.
+func Job(
+	logger *zap.SugaredLogger,
+	store Store,
+	notifier Notifier,
+	interval time.Duration,
+) *scheduler.Job {
+	return &scheduler.Job{
+		Name:     "notifications",
+		Interval: interval,
+		Run:      NewWorker(logger, store, notifier).Run,
+	}
+}
@@ -0,0 +1,209 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const processed = `{"number":"2377225624","status":"PROCESSED","accrual":150,"upload_at":"2024-05-01T10:00:00Z",
+	"campaign":{"id":1,"name":"summer","bonus":50}}`
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name        string
+		event       string
+		locale      string
+		data        string
+		wantSubject string
+		wantBody    string
+		wantErr     bool
+	}{
+		{name: "processed", event: obj.EventOrderProcessed, locale: "en", data: processed,
+			wantSubject: "Order 2377225624 is processed",
+			wantBody:    "Your order 2377225624 is processed, 150.00 points are credited to your balance. The summer campaign added 50.00 of them."},
+		{name: "processed ru", event: obj.EventOrderProcessed, locale: "ru", data: `{"number":"2377225624","accrual":12.5}`,
+			wantSubject: "Заказ 2377225624 обработан",
+			wantBody:    "Ваш заказ 2377225624 обработан, на баланс начислено баллов: 12.50."},
+		{name: "invalid falls back to en", event: obj.EventOrderInvalid, locale: "de", data: `{"number":"2377225624"}`,
+			wantSubject: "Order 2377225624 is rejected",
+			wantBody:    "Your order 2377225624 was rejected by the accrual system, no points are credited for it."},
+		{name: "no template", event: obj.EventWithdrawalCreated, locale: "en", data: `{}`, wantErr: true},
+		{name: "bad data", event: obj.EventOrderInvalid, locale: "en", data: `{`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, body, err := Render(tt.event, tt.locale, []byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if subject != tt.wantSubject {
+				t.Errorf("Render() subject = %q, want %q", subject, tt.wantSubject)
+			}
+			if body != tt.wantBody {
+				t.Errorf("Render() body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefs   obj.NotificationPrefs
+		wantErr error
+	}{
+		{name: "email", prefs: obj.NotificationPrefs{Email: "alice@example.com", Channels: []string{"email"},
+			Events: []string{"order.processed", "order.invalid"}}},
+		{name: "sms and push", prefs: obj.NotificationPrefs{Locale: "ru", Phone: "+79991234567", PushToken: "tok",
+			Channels: []string{"sms", "push"}, Events: []string{"order.processed"}}},
+		{name: "nothing", prefs: obj.NotificationPrefs{}},
+		{name: "locale", prefs: obj.NotificationPrefs{Locale: "xx"}, wantErr: errUnknownLocale},
+		{name: "event", prefs: obj.NotificationPrefs{Events: []string{"withdrawal.created"}}, wantErr: errUnknownEvent},
+		{name: "channel", prefs: obj.NotificationPrefs{Channels: []string{"fax"}}, wantErr: errUnknownChannel},
+		{name: "no address", prefs: obj.NotificationPrefs{Channels: []string{"sms"}}, wantErr: errNoRecipient},
+		{name: "email", prefs: obj.NotificationPrefs{Email: "Alice <alice@example.com>"}, wantErr: errInvalidEmail},
+		{name: "phone", prefs: obj.NotificationPrefs{Phone: "89991234567"}, wantErr: errInvalidPhone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(&tt.prefs, obj.NotificationChannels)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && tt.prefs.Locale == "" {
+				t.Errorf("Validate() locale is not defaulted")
+			}
+		})
+	}
+}
+
+func TestValidateChannels(t *testing.T) {
+	channels := map[string]bool{obj.ChannelEmail: true}
+	prefs := obj.NotificationPrefs{Email: "alice@example.com", Phone: "+79991234567",
+		Channels: []string{"email", "sms"}}
+	if err := Validate(&prefs, channels); !errors.Is(err, errNoChannelDriver) {
+		t.Fatalf("Validate() error = %v, want %v", err, errNoChannelDriver)
+	}
+	prefs.Channels = []string{"email"}
+	if err := Validate(&prefs, channels); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+}
+
+type memStore struct {
+	pending []*obj.Notification
+	settled []*obj.Notification
+}
+
+func (s *memStore) ClaimNotifications(_ context.Context, now time.Time, _ time.Duration, _ int) ([]*obj.Notification, error) {
+	var ns []*obj.Notification
+	for _, n := range s.pending {
+		if n.Status == obj.NotificationStatusPending && (n.NextAttemptAt == nil || !n.NextAttemptAt.After(now)) {
+			ns = append(ns, n)
+		}
+	}
+	return ns, nil
+}
+
+func (s *memStore) SettleNotification(_ context.Context, n *obj.Notification) error {
+	s.settled = append(s.settled, n)
+	return nil
+}
+
+type failingNotifier struct{}
+
+func (failingNotifier) Notify(context.Context, *Message) error {
+	return errors.New("provider unavailable")
+}
+
+func TestWorker(t *testing.T) {
+	var out bytes.Buffer
+	sink := &FileSink{w: &out}
+	email := &obj.Notification{NotificationID: 1, Event: obj.EventOrderProcessed, Channel: obj.ChannelEmail,
+		Recipient: "alice@example.com", Locale: "en", Data: []byte(processed), Status: obj.NotificationStatusPending}
+	sms := &obj.Notification{NotificationID: 2, Event: obj.EventOrderInvalid, Channel: obj.ChannelSMS,
+		Recipient: "+79991234567", Locale: "en", Data: []byte(`{"number":"1"}`), Status: obj.NotificationStatusPending}
+	push := &obj.Notification{NotificationID: 3, Event: obj.EventOrderInvalid, Channel: obj.ChannelPush,
+		Recipient: "tok", Locale: "en", Data: []byte(`{"number":"1"}`), Status: obj.NotificationStatusPending}
+	store := &memStore{pending: []*obj.Notification{email, sms, push}}
+
+	w := NewWorker(zap.NewNop().Sugar(), store, Dispatcher{
+		obj.ChannelEmail: sink,
+		obj.ChannelSMS:   failingNotifier{},
+	})
+	if err := w.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if email.Status != obj.NotificationStatusSent || email.SentAt == nil {
+		t.Errorf("email = %+v, want sent", email)
+	}
+	m := &sinkRecord{}
+	if err := json.Unmarshal(out.Bytes(), m); err != nil {
+		t.Fatalf("sink output %q: %v", out.String(), err)
+	}
+	if m.To != email.Recipient || m.Subject != "Order 2377225624 is processed" {
+		t.Errorf("sink message = %+v", m.Message)
+	}
+	if sms.Status != obj.NotificationStatusPending || sms.NextAttemptAt == nil || sms.Error == "" {
+		t.Errorf("sms = %+v, want a pending retry", sms)
+	}
+	if push.Status != obj.NotificationStatusFailed || !strings.Contains(push.Error, errNoDriver.Error()) {
+		t.Errorf("push = %+v, want failed without a driver", push)
+	}
+	if len(store.settled) != 3 {
+		t.Errorf("settled = %d, want 3", len(store.settled))
+	}
+
+	for attempt := 2; attempt <= maxAttempts; attempt++ {
+		sms.NextAttemptAt = nil
+		if err := w.Run(context.Background()); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	}
+	if sms.Status != obj.NotificationStatusFailed || sms.Attempts != maxAttempts {
+		t.Errorf("sms = %+v, want failed after %d attempts", sms, maxAttempts)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.log")
+	for i := 0; i < 2; i++ {
+		sink, err := NewFileSink(path)
+		if err != nil {
+			t.Fatalf("NewFileSink() error = %v", err)
+		}
+		if err = sink.Notify(context.Background(), &Message{Channel: obj.ChannelPush, To: "tok", Body: "hi"}); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+		if err = sink.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lines := 0
+	for s := bufio.NewScanner(f); s.Scan(); lines++ {
+		m := &sinkRecord{}
+		if err = json.Unmarshal(s.Bytes(), m); err != nil || m.Body != "hi" {
+			t.Errorf("line %d = %q, %v", lines, s.Text(), err)
+		}
+	}
+	if lines != 2 {
+		t.Errorf("lines = %d, want 2 appended", lines)
+	}
+}
@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpStandIn is a local SMTP server which accepts one mail without TLS
+// or auth and hands it over on the mails channel.
+type smtpStandIn struct {
+	ln    net.Listener
+	mails chan *mail.Message
+	rcpt  chan string
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStandIn{ln: ln, mails: make(chan *mail.Message, 1), rcpt: make(chan string, 1)}
+	go s.serve(t)
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *smtpStandIn) serve(t *testing.T) {
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = io.WriteString(conn, line+"\r\n") }
+
+	reply("220 localhost ESMTP stand-in")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.rcpt <- strings.TrimSpace(line)[len("RCPT TO:"):]
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			m, err := mail.ReadMessage(strings.NewReader(data.String()))
+			if err != nil {
+				t.Errorf("stand-in read message: %v", err)
+				return
+			}
+			s.mails <- m
+			reply("250 OK queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSMTP(t *testing.T) {
+	server := newSMTPStandIn(t)
+	s, err := NewSMTP(server.ln.Addr().String(), "Gophermart <noreply@gophermart.local>", "", "")
+	if err != nil {
+		t.Fatalf("NewSMTP() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = s.Notify(ctx, &Message{
+		Channel: "email",
+		To:      "alice@example.com",
+		Subject: "Заказ 2377225624 обработан",
+		Body:    "Ваш заказ 2377225624 обработан, на баланс начислено баллов: 12.50.",
+	})
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	if got := <-server.rcpt; got != "<alice@example.com>" {
+		t.Errorf("RCPT TO = %q, want <alice@example.com>", got)
+	}
+	m := <-server.mails
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil || subject != "Заказ 2377225624 обработан" {
+		t.Errorf("Subject = %q, %v", subject, err)
+	}
+	if from := m.Header.Get("From"); !strings.Contains(from, "noreply@gophermart.local") {
+		t.Errorf("From = %q", from)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(m.Body))
+	if err != nil || strings.TrimSpace(string(body)) != "Ваш заказ 2377225624 обработан, на баланс начислено баллов: 12.50." {
+		t.Errorf("body = %q, %v", body, err)
+	}
+}
+
+func TestSMTPUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	s, err := NewSMTP(addr, "noreply@gophermart.local", "", "")
+	if err != nil {
+		t.Fatalf("NewSMTP() error = %v", err)
+	}
+	if err = s.Notify(context.Background(), &Message{To: "alice@example.com", Body: "hi"}); err == nil {
+		t.Errorf("Notify() error = nil, want a dial error")
+	}
+}
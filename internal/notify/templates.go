@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// DefaultLocale is used for users who haven't chosen a locale.
+const DefaultLocale = "en"
+
+var funcs = map[string]interface{}{
+	"points": func(f float32) string { return strconv.FormatFloat(float64(f), 'f', 2, 32) },
+}
+
+// Every template defines a subject and a body. The order events are
+// rendered with the order.
+var templates = map[string]map[string]*template.Template{
+	"en": {
+		obj.EventOrderProcessed: parse(`{{define "subject"}}Order {{.Number}} is processed{{end}}
+{{- define "body"}}Your order {{.Number}} is processed, {{points .Accrual}} points are credited to your balance.
+{{- with .Campaign}} The {{.Name}} campaign added {{points .Bonus}} of them.{{end}}{{end}}`),
+		obj.EventOrderInvalid: parse(`{{define "subject"}}Order {{.Number}} is rejected{{end}}
+{{- define "body"}}Your order {{.Number}} was rejected by the accrual system, no points are credited for it.{{end}}`),
+	},
+	"ru": {
+		obj.EventOrderProcessed: parse(`{{define "subject"}}Заказ {{.Number}} обработан{{end}}
+{{- define "body"}}Ваш заказ {{.Number}} обработан, на баланс начислено баллов: {{points .Accrual}}.
+{{- with .Campaign}} Из них {{points .Bonus}} по акции «{{.Name}}».{{end}}{{end}}`),
+		obj.EventOrderInvalid: parse(`{{define "subject"}}Заказ {{.Number}} отклонён{{end}}
+{{- define "body"}}Ваш заказ {{.Number}} отклонён системой начислений, баллы за него не начисляются.{{end}}`),
+	},
+}
+
+func parse(text string) *template.Template {
+	return template.Must(template.New("").Funcs(funcs).Parse(text))
+}
+
+// Render renders the subject and the body of the event in the locale, the
+// default locale is used for locales without templates. Data is the JSON
+// of the object the event is about.
+func Render(event, locale string, data []byte) (string, string, error) {
+	ts, ok := templates[locale]
+	if !ok {
+		ts = templates[DefaultLocale]
+	}
+	t, ok := ts[event]
+	if !ok {
+		return "", "", fmt.Errorf("no template for the event %s", event)
+	}
+
+	order := &obj.Order{}
+	if err := json.Unmarshal(data, order); err != nil {
+		return "", "", err
+	}
+
+	var subject, body strings.Builder
+	if err := t.ExecuteTemplate(&subject, "subject", order); err != nil {
+		return "", "", err
+	}
+	if err := t.ExecuteTemplate(&body, "body", order); err != nil {
+		return "", "", err
+	}
+	return subject.String(), body.String(), nil
+}
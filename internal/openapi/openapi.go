@@ -0,0 +1,324 @@
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"mime"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	componentsSchemas    = "#/components/schemas/"
+	componentsParameters = "#/components/parameters/"
+	componentsResponses  = "#/components/responses/"
+	componentsBodies     = "#/components/requestBodies/"
+)
+
+var (
+	ErrContentType = errors.New("unsupported content type")
+
+	errUnknownRef = errors.New("unknown reference")
+)
+
+// Spec is the subset of an OpenAPI 3.0 document needed to validate
+// requests and responses: operations, parameters, bodies and schemas.
+type Spec struct {
+	Paths      map[string]map[string]*Operation `yaml:"paths"`
+	Components struct {
+		Schemas       map[string]*Schema      `yaml:"schemas"`
+		Parameters    map[string]*Parameter   `yaml:"parameters"`
+		Responses     map[string]*Response    `yaml:"responses"`
+		RequestBodies map[string]*RequestBody `yaml:"requestBodies"`
+	} `yaml:"components"`
+
+	operations map[string]*Operation
+}
+
+type Operation struct {
+	OperationID string               `yaml:"operationId"`
+	Parameters  []*Parameter         `yaml:"parameters"`
+	RequestBody *RequestBody         `yaml:"requestBody"`
+	Responses   map[string]*Response `yaml:"responses"`
+}
+
+type Parameter struct {
+	Ref      string  `yaml:"$ref"`
+	Name     string  `yaml:"name"`
+	In       string  `yaml:"in"`
+	Required bool    `yaml:"required"`
+	Schema   *Schema `yaml:"schema"`
+}
+
+type RequestBody struct {
+	Ref      string                `yaml:"$ref"`
+	Required bool                  `yaml:"required"`
+	Content  map[string]*MediaType `yaml:"content"`
+}
+
+type Response struct {
+	Ref     string                `yaml:"$ref"`
+	Content map[string]*MediaType `yaml:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `yaml:"schema"`
+}
+
+// ValidationError lists every violation found in a request or response.
+type ValidationError struct {
+	Violations []string
+}
+
+func (v *ValidationError) Error() string {
+	return strings.Join(v.Violations, "; ")
+}
+
+// Request is the part of an HTTP request checked against an operation.
+type Request struct {
+	PathParams  map[string]string
+	Query       url.Values
+	ContentType string
+	Body        []byte
+}
+
+// Load parses an OpenAPI document and resolves the local references.
+func Load(data []byte) (*Spec, error) {
+	s := &Spec{}
+	if err := yaml.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if err := s.resolve(); err != nil {
+		return nil, err
+	}
+	s.operations = make(map[string]*Operation)
+	for path, methods := range s.Paths {
+		for method, op := range methods {
+			s.operations[key(method, path)] = op
+		}
+	}
+	return s, nil
+}
+
+// Operation returns the operation for method and route, nil if the spec
+// does not describe it. The route may use either the OpenAPI ({id}) or
+// the gin (:id) notation for path parameters.
+func (s *Spec) Operation(method, route string) *Operation {
+	return s.operations[key(method, route)]
+}
+
+// Operations returns the keys of all described operations as
+// "METHOD /path" in gin notation, sorted.
+func (s *Spec) Operations() []string {
+	keys := make([]string, 0, len(s.operations))
+	for k := range s.operations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Key returns the operation key of method and route as used by
+// Operations.
+func Key(method, route string) string {
+	return key(method, route)
+}
+
+func key(method, route string) string {
+	segments := strings.Split(strings.TrimSuffix(route, "/"), "/")
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			segments[i] = ":" + seg[1:len(seg)-1]
+		}
+	}
+	return strings.ToUpper(method) + " " + strings.Join(segments, "/")
+}
+
+// ValidateRequest checks the parameters and the body of r.
+func (op *Operation) ValidateRequest(r *Request) error {
+	v := &ValidationError{}
+	for _, p := range op.Parameters {
+		var (
+			value string
+			ok    bool
+		)
+		switch p.In {
+		case "path":
+			value, ok = r.PathParams[p.Name]
+		case "query":
+			if r.Query.Has(p.Name) {
+				value, ok = r.Query.Get(p.Name), true
+			}
+		default:
+			continue
+		}
+		if !ok || value == "" {
+			if p.Required {
+				v.Violations = append(v.Violations, fmt.Sprintf("%s parameter %q is required", p.In, p.Name))
+			}
+			continue
+		}
+		if p.Schema != nil {
+			p.Schema.validateString(p.In+" parameter "+strconv.Quote(p.Name), value, v)
+		}
+	}
+
+	if op.RequestBody != nil {
+		if len(r.Body) == 0 {
+			if op.RequestBody.Required {
+				v.Violations = append(v.Violations, "request body is required")
+			}
+		} else {
+			mt, err := mediaType(op.RequestBody.Content, r.ContentType)
+			if err != nil {
+				return err
+			}
+			if mt.Schema != nil {
+				mt.Schema.validateBody("request body", r.ContentType, r.Body, v)
+			}
+		}
+	}
+
+	if len(v.Violations) > 0 {
+		return v
+	}
+	return nil
+}
+
+// ValidateResponse checks that the status is documented and the body
+// matches the documented schema.
+func (op *Operation) ValidateResponse(status int, contentType string, body []byte) error {
+	resp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		if resp, ok = op.Responses["default"]; !ok {
+			return &ValidationError{Violations: []string{fmt.Sprintf("status %d is not documented", status)}}
+		}
+	}
+	if len(body) == 0 || len(resp.Content) == 0 {
+		return nil
+	}
+	mt, err := mediaType(resp.Content, contentType)
+	if err != nil {
+		return err
+	}
+	v := &ValidationError{}
+	if mt.Schema != nil {
+		mt.Schema.validateBody("response body", contentType, body, v)
+	}
+	if len(v.Violations) > 0 {
+		return v
+	}
+	return nil
+}
+
+func mediaType(content map[string]*MediaType, contentType string) (*MediaType, error) {
+	ct, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", ErrContentType, contentType)
+	}
+	mt, ok := content[ct]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrContentType, ct)
+	}
+	return mt, nil
+}
+
+func isJSON(contentType string) bool {
+	ct, _, _ := mime.ParseMediaType(contentType)
+	return ct == "application/json" || strings.HasSuffix(ct, "+json")
+}
+
+func (s *Spec) resolve() error {
+	r := &resolver{spec: s, done: make(map[*Schema]bool)}
+	for _, methods := range s.Paths {
+		for _, op := range methods {
+			for i, p := range op.Parameters {
+				if op.Parameters[i], r.err = r.parameter(p); r.err != nil {
+					return r.err
+				}
+			}
+			if op.RequestBody != nil && op.RequestBody.Ref != "" {
+				body, ok := s.Components.RequestBodies[strings.TrimPrefix(op.RequestBody.Ref, componentsBodies)]
+				if !ok {
+					return fmt.Errorf("%w %s", errUnknownRef, op.RequestBody.Ref)
+				}
+				op.RequestBody = body
+			}
+			if op.RequestBody != nil {
+				r.content(op.RequestBody.Content)
+			}
+			for status, resp := range op.Responses {
+				if resp.Ref != "" {
+					ref, ok := s.Components.Responses[strings.TrimPrefix(resp.Ref, componentsResponses)]
+					if !ok {
+						return fmt.Errorf("%w %s", errUnknownRef, resp.Ref)
+					}
+					op.Responses[status] = ref
+					resp = ref
+				}
+				r.content(resp.Content)
+			}
+			if r.err != nil {
+				return r.err
+			}
+		}
+	}
+	return nil
+}
+
+type resolver struct {
+	spec *Spec
+	done map[*Schema]bool
+	err  error
+}
+
+func (r *resolver) parameter(p *Parameter) (*Parameter, error) {
+	if p.Ref != "" {
+		ref, ok := r.spec.Components.Parameters[strings.TrimPrefix(p.Ref, componentsParameters)]
+		if !ok {
+			return nil, fmt.Errorf("%w %s", errUnknownRef, p.Ref)
+		}
+		p = ref
+	}
+	p.Schema = r.schema(p.Schema)
+	return p, r.err
+}
+
+func (r *resolver) content(content map[string]*MediaType) {
+	for _, mt := range content {
+		mt.Schema = r.schema(mt.Schema)
+	}
+}
+
+// schema returns s with the references of s and its subschemas replaced
+// by the component schemas. Each schema is visited once, so recursive
+// schemas are fine.
+func (r *resolver) schema(s *Schema) *Schema {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		ref, ok := r.spec.Components.Schemas[strings.TrimPrefix(s.Ref, componentsSchemas)]
+		if !ok {
+			r.err = fmt.Errorf("%w %s", errUnknownRef, s.Ref)
+			return s
+		}
+		s = ref
+	}
+	if r.done[s] {
+		return s
+	}
+	r.done[s] = true
+	if err := s.compile(); err != nil {
+		r.err = err
+		return s
+	}
+	for name, p := range s.Properties {
+		s.Properties[name] = r.schema(p)
+	}
+	s.Items = r.schema(s.Items)
+	return s
+}
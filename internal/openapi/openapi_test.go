@@ -0,0 +1,217 @@
+package openapi
+
+import (
+	"errors"
+	"github.com/eqkez0r/gophermart"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr bool
+	}{
+		{name: "embedded spec", doc: string(gophermart.OpenAPI)},
+		{
+			name: "unknown schema",
+			doc: `
+paths:
+  /a:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Missing'
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid pattern",
+			doc: `
+paths:
+  /a:
+    get:
+      parameters:
+        - name: q
+          in: query
+          schema:
+            type: string
+            pattern: '(['
+`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load([]byte(tt.doc))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOperation_ValidateRequest(t *testing.T) {
+	spec, err := Load(gophermart.OpenAPI)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		route      string
+		req        *Request
+		wantErr    bool
+		wantCTErr  bool
+		violations int
+	}{
+		{
+			name:   "valid credentials",
+			method: http.MethodPost, route: "/api/user/register",
+			req: &Request{ContentType: "application/json", Body: []byte(`{"login":"a","password":"b"}`)},
+		},
+		{
+			name:   "missing password",
+			method: http.MethodPost, route: "/api/user/register",
+			req:     &Request{ContentType: "application/json", Body: []byte(`{"login":"a"}`)},
+			wantErr: true, violations: 1,
+		},
+		{
+			name:   "wrong types",
+			method: http.MethodPost, route: "/api/user/register",
+			req:     &Request{ContentType: "application/json", Body: []byte(`{"login":1,"password":""}`)},
+			wantErr: true, violations: 2,
+		},
+		{
+			name:   "malformed json",
+			method: http.MethodPost, route: "/api/user/login/",
+			req:     &Request{ContentType: "application/json", Body: []byte(`{"login":`)},
+			wantErr: true, violations: 1,
+		},
+		{
+			name:   "missing body",
+			method: http.MethodPost, route: "/api/user/login",
+			req:     &Request{ContentType: "application/json"},
+			wantErr: true, violations: 1,
+		},
+		{
+			name:   "wrong content type",
+			method: http.MethodPost, route: "/api/user/orders",
+			req:     &Request{ContentType: "application/json", Body: []byte(`"12345678903"`)},
+			wantErr: true, wantCTErr: true,
+		},
+		{
+			name:   "plain text order",
+			method: http.MethodPost, route: "/api/user/orders",
+			req: &Request{ContentType: "text/plain; charset=utf-8", Body: []byte("12345678903")},
+		},
+		{
+			name:   "non positive sum",
+			method: http.MethodPost, route: "/api/user/balance/withdraw",
+			req:     &Request{ContentType: "application/json", Body: []byte(`{"order":"2377225624","sum":0}`)},
+			wantErr: true, violations: 1,
+		},
+		{
+			name:   "unknown scope",
+			method: http.MethodPost, route: "/api/user/keys",
+			req:     &Request{ContentType: "application/json", Body: []byte(`{"name":"pos","scopes":["orders:delete"]}`)},
+			wantErr: true, violations: 1,
+		},
+		{
+			name:   "path parameter",
+			method: http.MethodDelete, route: "/api/user/keys/:id",
+			req:     &Request{PathParams: map[string]string{"id": "abc"}},
+			wantErr: true, violations: 1,
+		},
+		{
+			name:   "query parameters",
+			method: http.MethodGet, route: "/api/admin/audit",
+			req:     &Request{Query: url.Values{"from": {"yesterday"}, "limit": {"-1"}}},
+			wantErr: true, violations: 2,
+		},
+		{
+			name:   "valid query parameters",
+			method: http.MethodGet, route: "/api/admin/audit",
+			req: &Request{Query: url.Values{"from": {"2024-01-02T15:04:05Z"}, "limit": {"10"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := spec.Operation(tt.method, tt.route)
+			if op == nil {
+				t.Fatalf("Operation(%s, %s) = nil", tt.method, tt.route)
+			}
+			err := op.ValidateRequest(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrContentType) != tt.wantCTErr {
+				t.Errorf("ValidateRequest() error = %v, want content type error %v", err, tt.wantCTErr)
+			}
+			var v *ValidationError
+			if errors.As(err, &v) && len(v.Violations) != tt.violations {
+				t.Errorf("ValidateRequest() violations = %q, want %d", v.Violations, tt.violations)
+			}
+		})
+	}
+}
+
+func TestOperation_ValidateResponse(t *testing.T) {
+	spec, err := Load(gophermart.OpenAPI)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		route       string
+		status      int
+		contentType string
+		body        string
+		wantErr     bool
+	}{
+		{
+			name: "valid list", route: "/api/user/orders", status: http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body:        `[{"number":"12345678903","status":"PROCESSED","accrual":500,"upload_at":"2020-12-10T15:15:45+03:00"}]`,
+		},
+		{
+			name: "unknown status value", route: "/api/user/orders", status: http.StatusOK,
+			contentType: "application/json",
+			body:        `[{"number":"12345678903","status":"DONE","upload_at":"2020-12-10T15:15:45+03:00"}]`,
+			wantErr:     true,
+		},
+		{
+			name: "null list", route: "/api/user/orders", status: http.StatusOK,
+			contentType: "application/json", body: `null`, wantErr: true,
+		},
+		{
+			name: "nullable list", route: "/api/admin/users/:login/orders", status: http.StatusOK,
+			contentType: "application/json", body: `null`,
+		},
+		{name: "no content", route: "/api/user/orders", status: http.StatusNoContent},
+		{name: "undocumented status", route: "/api/user/orders", status: http.StatusTeapot, wantErr: true},
+		{
+			name: "problem", route: "/api/user/orders", status: http.StatusUnauthorized,
+			contentType: "application/problem+json",
+			body:        `{"type":"about:blank","title":"Unauthorized","status":401,"code":"unauthorized"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := spec.Operation(http.MethodGet, tt.route)
+			if op == nil {
+				t.Fatalf("Operation(GET, %s) = nil", tt.route)
+			}
+			err := op.ValidateResponse(tt.status, tt.contentType, []byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
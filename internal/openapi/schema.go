@@ -0,0 +1,214 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Schema is the subset of the OpenAPI schema object the validator
+// understands. Unknown keywords are ignored.
+type Schema struct {
+	Ref              string             `yaml:"$ref"`
+	Type             string             `yaml:"type"`
+	Format           string             `yaml:"format"`
+	Nullable         bool               `yaml:"nullable"`
+	Enum             []interface{}      `yaml:"enum"`
+	Required         []string           `yaml:"required"`
+	Properties       map[string]*Schema `yaml:"properties"`
+	Items            *Schema            `yaml:"items"`
+	MinItems         *int               `yaml:"minItems"`
+	MaxItems         *int               `yaml:"maxItems"`
+	MinLength        *int               `yaml:"minLength"`
+	MaxLength        *int               `yaml:"maxLength"`
+	Pattern          string             `yaml:"pattern"`
+	Minimum          *float64           `yaml:"minimum"`
+	Maximum          *float64           `yaml:"maximum"`
+	ExclusiveMinimum bool               `yaml:"exclusiveMinimum"`
+	ExclusiveMaximum bool               `yaml:"exclusiveMaximum"`
+
+	pattern *regexp.Regexp
+}
+
+func (s *Schema) compile() error {
+	if s.Pattern == "" {
+		return nil
+	}
+	var err error
+	s.pattern, err = regexp.Compile(s.Pattern)
+	return err
+}
+
+// validateBody decodes a body of the given content type and validates
+// it. Non-JSON bodies are validated as a single string.
+func (s *Schema) validateBody(name, contentType string, body []byte, v *ValidationError) {
+	if !isJSON(contentType) {
+		s.validateString(name, string(body), v)
+		return
+	}
+	var value interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		v.Violations = append(v.Violations, fmt.Sprintf("%s is not valid json", name))
+		return
+	}
+	s.validate(name, value, v)
+}
+
+// validateString validates a raw parameter value, converting it to the
+// schema type first.
+func (s *Schema) validateString(name, raw string, v *ValidationError) {
+	switch s.Type {
+	case "integer":
+		if _, err := strconv.ParseInt(raw, 10, 64); err != nil {
+			v.Violations = append(v.Violations, fmt.Sprintf("%s must be an integer", name))
+			return
+		}
+		s.validate(name, json.Number(raw), v)
+	case "number":
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			v.Violations = append(v.Violations, fmt.Sprintf("%s must be a number", name))
+			return
+		}
+		s.validate(name, json.Number(raw), v)
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			v.Violations = append(v.Violations, fmt.Sprintf("%s must be a boolean", name))
+			return
+		}
+		s.validate(name, b, v)
+	default:
+		s.validate(name, raw, v)
+	}
+}
+
+func (s *Schema) validate(name string, value interface{}, v *ValidationError) {
+	if value == nil {
+		if !s.Nullable {
+			v.Violations = append(v.Violations, fmt.Sprintf("%s must not be null", name))
+		}
+		return
+	}
+	if len(s.Enum) > 0 && !s.inEnum(value) {
+		v.Violations = append(v.Violations, fmt.Sprintf("%s must be one of %v", name, s.Enum))
+		return
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			v.Violations = append(v.Violations, fmt.Sprintf("%s must be an object", name))
+			return
+		}
+		for _, r := range s.Required {
+			if _, ok := obj[r]; !ok {
+				v.Violations = append(v.Violations, fmt.Sprintf("%s.%s is required", name, r))
+			}
+		}
+		//sorted for stable messages
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if p, ok := s.Properties[k]; ok {
+				p.validate(name+"."+k, obj[k], v)
+			}
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			v.Violations = append(v.Violations, fmt.Sprintf("%s must be an array", name))
+			return
+		}
+		if s.MinItems != nil && len(arr) < *s.MinItems {
+			v.Violations = append(v.Violations, fmt.Sprintf("%s must have at least %d items", name, *s.MinItems))
+		}
+		if s.MaxItems != nil && len(arr) > *s.MaxItems {
+			v.Violations = append(v.Violations, fmt.Sprintf("%s must have at most %d items", name, *s.MaxItems))
+		}
+		if s.Items != nil {
+			for i, item := range arr {
+				s.Items.validate(fmt.Sprintf("%s[%d]", name, i), item, v)
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			v.Violations = append(v.Violations, fmt.Sprintf("%s must be a string", name))
+			return
+		}
+		s.validateStringValue(name, str, v)
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			v.Violations = append(v.Violations, fmt.Sprintf("%s must be a %s", name, s.Type))
+			return
+		}
+		s.validateNumber(name, n, v)
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			v.Violations = append(v.Violations, fmt.Sprintf("%s must be a boolean", name))
+		}
+	}
+}
+
+func (s *Schema) validateStringValue(name, str string, v *ValidationError) {
+	if s.MinLength != nil && len([]rune(str)) < *s.MinLength {
+		v.Violations = append(v.Violations, fmt.Sprintf("%s must be at least %d characters", name, *s.MinLength))
+	}
+	if s.MaxLength != nil && len([]rune(str)) > *s.MaxLength {
+		v.Violations = append(v.Violations, fmt.Sprintf("%s must be at most %d characters", name, *s.MaxLength))
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		v.Violations = append(v.Violations, fmt.Sprintf("%s must match %s", name, s.Pattern))
+	}
+	switch s.Format {
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, str); err != nil {
+			v.Violations = append(v.Violations, fmt.Sprintf("%s must be an RFC 3339 date-time", name))
+		}
+	case "date":
+		if _, err := time.Parse(time.DateOnly, str); err != nil {
+			v.Violations = append(v.Violations, fmt.Sprintf("%s must be a date", name))
+		}
+	}
+}
+
+func (s *Schema) validateNumber(name string, n json.Number, v *ValidationError) {
+	if s.Type == "integer" {
+		if _, err := n.Int64(); err != nil {
+			v.Violations = append(v.Violations, fmt.Sprintf("%s must be an integer", name))
+			return
+		}
+	}
+	f, err := n.Float64()
+	if err != nil {
+		v.Violations = append(v.Violations, fmt.Sprintf("%s must be a number", name))
+		return
+	}
+	if s.Minimum != nil && (f < *s.Minimum || s.ExclusiveMinimum && f == *s.Minimum) {
+		v.Violations = append(v.Violations, fmt.Sprintf("%s is below the minimum %v", name, *s.Minimum))
+	}
+	if s.Maximum != nil && (f > *s.Maximum || s.ExclusiveMaximum && f == *s.Maximum) {
+		v.Violations = append(v.Violations, fmt.Sprintf("%s is above the maximum %v", name, *s.Maximum))
+	}
+}
+
+func (s *Schema) inEnum(value interface{}) bool {
+	got := fmt.Sprint(value)
+	for _, e := range s.Enum {
+		if fmt.Sprint(e) == got {
+			return true
+		}
+	}
+	return false
+}
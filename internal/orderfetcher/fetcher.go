@@ -9,12 +9,14 @@ import (
 	"net/http"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type OrdersProvider interface {
 	GetUnfinishedOrders(ctx context.Context) ([]*obj.Order, error)
 	UpdateAccrual(context.Context, uint64, *obj.Accrual) error
+	TouchOrder(context.Context, string) error
 }
 
 type OrderFetcher struct {
@@ -22,24 +24,42 @@ type OrderFetcher struct {
 	logger     *zap.SugaredLogger
 	accrualuri string
 	client     *resty.Client
+	//durations, swapped on config reload
+	interval atomic.Int64
+	timeout  atomic.Int64
 }
 
+// New returns a fetcher polling the unfinished orders every interval,
+// each request to the accrual system is given timeout.
 func New(
 	logger *zap.SugaredLogger,
 	accrualuri string,
 	s OrdersProvider,
+	interval time.Duration,
+	timeout time.Duration,
 ) *OrderFetcher {
 
-	return &OrderFetcher{
+	or := &OrderFetcher{
 		storage:    s,
 		client:     resty.New(),
 		logger:     logger,
 		accrualuri: accrualuri,
 	}
+	or.SetPolicy(interval, timeout)
+	return or
+}
+
+// SetPolicy changes the poll interval and the request timeout, starting
+// with the next poll.
+func (or *OrderFetcher) SetPolicy(interval, timeout time.Duration) {
+	or.interval.Store(int64(interval))
+	or.timeout.Store(int64(timeout))
 }
 
 func (or *OrderFetcher) Run(ctx context.Context, wg *sync.WaitGroup) {
 	or.logger.Infof("Fetching orders from %s", or.accrualuri)
+	//the first poll is made right away
+	var delay time.Duration
 	for {
 		select {
 		case <-ctx.Done():
@@ -48,8 +68,9 @@ func (or *OrderFetcher) Run(ctx context.Context, wg *sync.WaitGroup) {
 				wg.Done()
 				return
 			}
-		default:
+		case <-time.After(delay):
 			{
+				delay = time.Duration(or.interval.Load())
 				orders, err := or.storage.GetUnfinishedOrders(ctx)
 				if err != nil {
 					or.logger.Warnw("failed to get unfinished orders", "error", err)
@@ -61,11 +82,14 @@ func (or *OrderFetcher) Run(ctx context.Context, wg *sync.WaitGroup) {
 					url := or.accrualuri + "/api/orders/" + o.Number
 					//or.logger.Debugf("Send request to order number %s", url)
 
-					res, err := or.client.R().Get(url)
+					res, err := or.get(ctx, url)
 					if err != nil {
 						or.logger.Warnw("failed to get orders", "error", err)
 						continue
 					}
+					if err = or.storage.TouchOrder(ctx, o.Number); err != nil {
+						or.logger.Warnw("failed to record order poll", "error", err)
+					}
 					//or.logger.Infof("Successfully request to order number %d. \n"+
 					//	" Recieved status code %d", o.Number, res.StatusCode())
 
@@ -108,9 +132,13 @@ func (or *OrderFetcher) Run(ctx context.Context, wg *sync.WaitGroup) {
 						}
 					}
 				}
-				//or.logger.Info("order fetcher delay")
-				//time.Sleep(5 * time.Second)
 			}
 		}
 	}
 }
+
+func (or *OrderFetcher) get(ctx context.Context, url string) (*resty.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(or.timeout.Load()))
+	defer cancel()
+	return or.client.R().SetContext(ctx).Get(url)
+}
@@ -0,0 +1,70 @@
+package scheduler
+
+import (
+	"context"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// Job is a background task run every Interval. A failed run is logged
+// and retried on the next tick.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(context.Context) error
+}
+
+type Scheduler struct {
+	logger *zap.SugaredLogger
+	jobs   []*Job
+}
+
+func New(
+	logger *zap.SugaredLogger,
+	jobs ...*Job,
+) *Scheduler {
+	return &Scheduler{
+		logger: logger,
+		jobs:   jobs,
+	}
+}
+
+// Run starts every job right away and then on its interval until ctx is
+// done. Jobs run concurrently, but a job never overlaps with itself.
+func (s *Scheduler) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	var jobs sync.WaitGroup
+	for _, job := range s.jobs {
+		jobs.Add(1)
+		go func(job *Job) {
+			defer jobs.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+	jobs.Wait()
+	s.logger.Infof("scheduler stopped")
+}
+
+func (s *Scheduler) loop(ctx context.Context, job *Job) {
+	op := "Error in " + job.Name + " job: "
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+	for {
+		start := time.Now()
+		if err := job.Run(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Error(e.Wrap(op, err))
+		} else {
+			s.logger.Debugf("%s job finished in %s", job.Name, time.Since(start))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	var ok, failing atomic.Int32
+	s := New(zap.NewNop().Sugar(),
+		&Job{Name: "ok", Interval: 10 * time.Millisecond, Run: func(context.Context) error {
+			ok.Add(1)
+			return nil
+		}},
+		&Job{Name: "failing", Interval: 10 * time.Millisecond, Run: func(context.Context) error {
+			failing.Add(1)
+			return errors.New("boom")
+		}},
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 55*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go s.Run(ctx, &wg)
+	wg.Wait()
+
+	//the first run is immediate, a failure doesn't stop the job
+	if ok.Load() < 2 {
+		t.Errorf("Run() ok job ran %d times, want at least 2", ok.Load())
+	}
+	if failing.Load() < 2 {
+		t.Errorf("Run() failing job ran %d times, want at least 2", failing.Load())
+	}
+}
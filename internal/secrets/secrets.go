@@ -0,0 +1,160 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eqkez0r/gophermart/internal/scheduler"
+	"go.uber.org/zap"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// FilePrefix references a file holding the value, such as a docker or
+	// kubernetes secret. The file is watched for rotation.
+	FilePrefix = "file://"
+	// EnvPrefix references an environment variable holding the value.
+	EnvPrefix = "env:"
+)
+
+var (
+	errEnvNotSet = errors.New("referenced environment variable is not set")
+	errEmptyFile = errors.New("referenced file is empty")
+)
+
+// IsRef reports whether the value references a file or an environment
+// variable instead of being the value itself.
+func IsRef(v string) bool {
+	return strings.HasPrefix(v, FilePrefix) || strings.HasPrefix(v, EnvPrefix)
+}
+
+// Resolve returns the referenced value, other values are returned as
+// they are. The trailing newline of files is dropped.
+func Resolve(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, FilePrefix):
+		path := strings.TrimPrefix(v, FilePrefix)
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		s := strings.TrimRight(string(b), "\r\n")
+		if s == "" {
+			return "", fmt.Errorf("%w: %s", errEmptyFile, path)
+		}
+		return s, nil
+	case strings.HasPrefix(v, EnvPrefix):
+		name := strings.TrimPrefix(v, EnvPrefix)
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("%w: %s", errEnvNotSet, name)
+		}
+		return s, nil
+	default:
+		return v, nil
+	}
+}
+
+// Watcher re-reads the referenced files and hands changed values to the
+// hooks registered with Watch, which rotate the secrets.
+type Watcher struct {
+	logger  *zap.SugaredLogger
+	mu      sync.Mutex
+	watches []*watch
+}
+
+type watch struct {
+	refs   []string
+	values []string
+	rotate func([]string) error
+}
+
+func NewWatcher(logger *zap.SugaredLogger) *Watcher {
+	return &Watcher{logger: logger}
+}
+
+// Watch calls rotate with the resolved values of refs whenever one of
+// the referenced files changes. The current values are read right away,
+// references without a file are never rotated. A failed rotation is
+// retried on the next check, so the new values must not be applied
+// partially.
+func (w *Watcher) Watch(rotate func(values []string) error, refs ...string) error {
+	files := false
+	for _, ref := range refs {
+		files = files || strings.HasPrefix(ref, FilePrefix)
+	}
+	if !files {
+		return nil
+	}
+	values, err := resolveAll(refs)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.watches = append(w.watches, &watch{refs: refs, values: values, rotate: rotate})
+	return nil
+}
+
+// Run checks the watched files once.
+func (w *Watcher) Run(_ context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var errs []error
+	for _, wt := range w.watches {
+		values, err := resolveAll(wt.refs)
+		if err != nil {
+			//a secret being rewritten is picked up on the next check
+			errs = append(errs, err)
+			continue
+		}
+		if equal(values, wt.values) {
+			continue
+		}
+		if err = wt.rotate(values); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		wt.values = values
+		w.logger.Infow("secret rotated", "refs", wt.refs)
+	}
+	return errors.Join(errs...)
+}
+
+// Job checks the watched files every interval.
+func Job(w *Watcher, interval time.Duration) *scheduler.Job {
+	return &scheduler.Job{
+		Name:     "secrets rotation",
+		Interval: interval,
+		Run:      w.Run,
+	}
+}
+
+func resolveAll(refs []string) ([]string, error) {
+	values := make([]string, len(refs))
+	for i, ref := range refs {
+		v, err := Resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
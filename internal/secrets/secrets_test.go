@@ -0,0 +1,100 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db_password")
+	if err := os.WriteFile(path, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(t.TempDir(), "empty")
+	if err := os.WriteFile(empty, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOPHERMART_TEST_SECRET", "from env")
+
+	tests := []struct {
+		name    string
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{name: "file", ref: FilePrefix + path, want: "s3cret"},
+		{name: "env", ref: EnvPrefix + "GOPHERMART_TEST_SECRET", want: "from env"},
+		{name: "literal", ref: "postgres://db", want: "postgres://db"},
+		{name: "empty", ref: "", want: ""},
+		{name: "missing file", ref: FilePrefix + path + ".missing", wantErr: true},
+		{name: "empty file", ref: FilePrefix + empty, wantErr: true},
+		{name: "unset env", ref: EnvPrefix + "GOPHERMART_TEST_UNSET", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwt_key")
+	write := func(v string) {
+		if err := os.WriteFile(path, []byte(v), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("first")
+
+	var rotated []string
+	var failing bool
+	w := NewWatcher(zap.NewNop().Sugar())
+	err := w.Watch(func(v []string) error {
+		if failing {
+			return errors.New("not accepted yet")
+		}
+		rotated = append(rotated, v[0]+"/"+v[1])
+		return nil
+	}, FilePrefix+path, "literal")
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	//references without a file are not watched
+	if err = w.Watch(func([]string) error { t.Error("rotated a literal"); return nil }, "literal"); err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+
+	run := func() error { return w.Run(context.Background()) }
+	if err = run(); err != nil || len(rotated) != 0 {
+		t.Fatalf("Run() = %v, %v, want no rotation of unchanged files", rotated, err)
+	}
+
+	write("second")
+	failing = true
+	if err = run(); err == nil || len(rotated) != 0 {
+		t.Fatalf("Run() = %v, %v, want the failed rotation reported", rotated, err)
+	}
+	//the failed rotation is retried
+	failing = false
+	if err = run(); err != nil || len(rotated) != 1 || rotated[0] != "second/literal" {
+		t.Fatalf("Run() = %v, %v, want second/literal", rotated, err)
+	}
+	if err = run(); err != nil || len(rotated) != 1 {
+		t.Errorf("Run() = %v, %v, want a single rotation", rotated, err)
+	}
+
+	os.Remove(path)
+	if err = run(); err == nil {
+		t.Errorf("Run() error = nil, want the missing file reported")
+	}
+}
@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eqkez0r/gophermart/internal/server/middleware"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+const (
+	AdminUsersHandlerPath         = "/users"
+	AdminUserHandlerPath          = "/users/:login"
+	AdminUserOrdersHandlerPath    = "/users/:login/orders"
+	AdminUserWithdrawalsPath      = "/users/:login/withdrawals"
+	AdminUserLedgerHandlerPath    = "/users/:login/ledger"
+	AdminAdjustBalanceHandlerPath = "/users/:login/balance"
+	AdminBlockUserHandlerPath     = "/users/:login/block"
+	AdminUnblockUserHandlerPath   = "/users/:login/unblock"
+	AdminSetRoleHandlerPath       = "/users/:login/role"
+	AdminRepollOrderHandlerPath   = "/orders/:number/repoll"
+	AdminRefundHandlerPath        = "/withdrawals/:number/refund"
+
+	defaultSearchLimit = 50
+	maxSearchLimit     = 200
+)
+
+var (
+	errEmptyReason = e.ErrInvalidRequest.WithDetail("reason is required")
+	errInvalidRole = e.ErrInvalidRequest.WithDetail("invalid role")
+)
+
+type UserInfoProvider interface {
+	GetUserInfo(context.Context, string) (*obj.UserInfo, error)
+}
+
+type UserSearchProvider interface {
+	SearchUsers(context.Context, string, int) ([]*obj.UserInfo, error)
+}
+
+type AdminOrdersProvider interface {
+	UserInfoProvider
+	OrderListProvider
+}
+
+type AdminWithdrawalsProvider interface {
+	UserInfoProvider
+	WithdrawalsProvider
+}
+
+type AdminLedgerProvider interface {
+	UserInfoProvider
+	Ledger(context.Context, string) ([]*obj.LedgerEntry, error)
+}
+
+type BalanceAdjustProvider interface {
+	AdjustBalance(context.Context, string, float32, string) error
+}
+
+type UserBlockProvider interface {
+	SetUserBlocked(context.Context, string, bool) error
+}
+
+type UserRoleProvider interface {
+	SetUserRole(context.Context, string, string) error
+}
+
+type OrderRepollProvider interface {
+	RepollOrder(context.Context, string) error
+}
+
+type WithdrawalRefundProvider interface {
+	RefundWithdrawal(context.Context, string, float32, string) (*obj.Withdraw, error)
+}
+
+type roleRequest struct {
+	Role string `json:"role"`
+}
+
+func AdminUsersHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store UserSearchProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in admin users handler: "
+
+		limit := defaultSearchLimit
+		if l := c.Query("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n <= 0 {
+				err := e.ErrInvalidRequest.WithDetail(fmt.Sprintf("invalid limit %q", l))
+				logger.Error(e.Wrap(op, err))
+				fail(c, err)
+				return
+			}
+			limit = min(n, maxSearchLimit)
+		}
+
+		users, err := store.SearchUsers(ctx, c.Query("q"), limit)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, users)
+	}
+}
+
+func AdminUserHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store UserInfoProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in admin user handler: "
+
+		user, ok := targetUser(ctx, c, logger, store, op)
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+func AdminUserOrdersHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store AdminOrdersProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in admin user orders handler: "
+
+		user, ok := targetUser(ctx, c, logger, store, op)
+		if !ok {
+			return
+		}
+
+		filter, err := listFilter(c, orderStatuses)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		limit := pageLimit(filter)
+		orders, err := store.GetOrdersList(ctx, user.Login, filter)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+		orders = paginate(c, orders, limit, orderCursor)
+
+		c.JSON(http.StatusOK, orders)
+	}
+}
+
+func AdminUserWithdrawalsHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store AdminWithdrawalsProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in admin user withdrawals handler: "
+
+		user, ok := targetUser(ctx, c, logger, store, op)
+		if !ok {
+			return
+		}
+
+		filter, err := listFilter(c, withdrawStatuses)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		limit := pageLimit(filter)
+		withdrawals, err := store.Withdrawals(ctx, user.Login, filter)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+		withdrawals = paginate(c, withdrawals, limit, withdrawCursor)
+
+		c.JSON(http.StatusOK, withdrawals)
+	}
+}
+
+func AdminUserLedgerHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store AdminLedgerProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in admin user ledger handler: "
+
+		user, ok := targetUser(ctx, c, logger, store, op)
+		if !ok {
+			return
+		}
+
+		entries, err := store.Ledger(ctx, user.Login)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, entries)
+	}
+}
+
+// AdminAdjustBalanceHandler credits or debits a user's balance manually.
+// The reason is mandatory and ends up in the ledger and the audit log.
+func AdminAdjustBalanceHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store BalanceAdjustProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in admin adjust balance handler: "
+
+		req := &obj.BalanceAdjustment{}
+		if err := c.ShouldBindJSON(req); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, e.ErrInvalidRequest.WithCause(err))
+			return
+		}
+		if req.Reason == "" {
+			logger.Error(e.Wrap(op, errEmptyReason))
+			fail(c, errEmptyReason)
+			return
+		}
+		if req.Amount == 0 {
+			err := e.ErrInvalidRequest.WithDetail("empty field")
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+		c.Set(middleware.AuditDetailsKey, fmt.Sprintf("amount=%v reason=%q", req.Amount, req.Reason))
+
+		if err := store.AdjustBalance(auditContext(ctx, c), c.Param("login"), req.Amount, req.Reason); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func AdminBlockUserHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store UserBlockProvider,
+	blocked bool,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in admin block user handler: "
+
+		if err := store.SetUserBlocked(ctx, c.Param("login"), blocked); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func AdminSetRoleHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store UserRoleProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in admin set role handler: "
+
+		req := &roleRequest{}
+		if err := c.ShouldBindJSON(req); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, e.ErrInvalidRequest.WithCause(err))
+			return
+		}
+		if !obj.Roles[req.Role] {
+			logger.Error(e.Wrap(op, errInvalidRole))
+			fail(c, errInvalidRole)
+			return
+		}
+		c.Set(middleware.AuditDetailsKey, "role="+req.Role)
+
+		if err := store.SetUserRole(ctx, c.Param("login"), req.Role); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func AdminRepollOrderHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store OrderRepollProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in admin repoll order handler: "
+
+		if err := store.RepollOrder(ctx, c.Param("number")); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.Status(http.StatusAccepted)
+	}
+}
+
+func AdminRefundHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store WithdrawalRefundProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in admin refund handler: "
+
+		req := &obj.Refund{}
+		if err := c.ShouldBindJSON(req); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, e.ErrInvalidRequest.WithCause(err))
+			return
+		}
+		if req.Reason == "" {
+			logger.Error(e.Wrap(op, errEmptyReason))
+			fail(c, errEmptyReason)
+			return
+		}
+		if req.Amount < 0 {
+			err := e.ErrInvalidRequest.WithDetail("amount must not be negative")
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+		c.Set(middleware.AuditDetailsKey, fmt.Sprintf("amount=%v reason=%q", req.Amount, req.Reason))
+
+		withdraw, err := store.RefundWithdrawal(auditContext(ctx, c), c.Param("number"), req.Amount, req.Reason)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, withdraw)
+	}
+}
+
+func targetUser(
+	ctx context.Context,
+	c *gin.Context,
+	logger *zap.SugaredLogger,
+	store UserInfoProvider,
+	op string,
+) (*obj.UserInfo, bool) {
+	user, err := store.GetUserInfo(ctx, c.Param("login"))
+	if err != nil {
+		logger.Error(e.Wrap(op, err))
+		if errors.Is(err, e.ErrUserNotFound) {
+			fail(c, err)
+			return nil, false
+		}
+		fail(c, err)
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type balanceAdjustStore struct {
+	balances map[string]float32
+	reasons  []string
+}
+
+func (s *balanceAdjustStore) AdjustBalance(_ context.Context, login string, amount float32, reason string) error {
+	balance, ok := s.balances[login]
+	if !ok {
+		return e.ErrUserNotFound
+	}
+	if balance+amount < 0 {
+		return e.ErrBalanceIsNotEnough
+	}
+	s.balances[login] = balance + amount
+	s.reasons = append(s.reasons, reason)
+	return nil
+}
+
+func TestAdminAdjustBalanceHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name  string
+		login string
+		body  string
+		want  int
+	}{
+		{name: "credit", login: "alice", body: `{"amount":10,"reason":"goodwill"}`, want: http.StatusOK},
+		{name: "debit", login: "alice", body: `{"amount":-5,"reason":"correction"}`, want: http.StatusOK},
+		{name: "overdraft", login: "alice", body: `{"amount":-500,"reason":"correction"}`, want: http.StatusPaymentRequired},
+		{name: "no reason", login: "alice", body: `{"amount":10}`, want: http.StatusBadRequest},
+		{name: "zero amount", login: "alice", body: `{"amount":0,"reason":"noop"}`, want: http.StatusBadRequest},
+		{name: "unknown user", login: "bob", body: `{"amount":10,"reason":"goodwill"}`, want: http.StatusNotFound},
+	}
+
+	store := &balanceAdjustStore{balances: map[string]float32{"alice": 100}}
+	r := gin.New()
+	r.POST(AdminAdjustBalanceHandlerPath, AdminAdjustBalanceHandler(context.Background(), zap.NewNop().Sugar(), store))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/users/"+tt.login+"/balance", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("AdminAdjustBalanceHandler() status = %v, want %v", w.Code, tt.want)
+			}
+		})
+	}
+
+	if store.balances["alice"] != 105 {
+		t.Errorf("AdminAdjustBalanceHandler() balance = %v, want 105", store.balances["alice"])
+	}
+}
+
+type refundStore struct {
+	withdrawals map[string]*obj.Withdraw
+}
+
+func (s *refundStore) RefundWithdrawal(_ context.Context, number string, amount float32, _ string) (*obj.Withdraw, error) {
+	w, ok := s.withdrawals[number]
+	if !ok {
+		return nil, e.ErrWithdrawalNotFound
+	}
+	left := w.Sum - w.Refunded
+	switch {
+	case left <= 0:
+		return nil, e.ErrWithdrawalRefunded
+	case amount == 0:
+		amount = left
+	case amount > left:
+		return nil, e.ErrRefundExceedsWithdrawal
+	}
+	w.Refunded += amount
+	w.Status = obj.WithdrawStatusPartiallyRefunded
+	if w.Refunded == w.Sum {
+		w.Status = obj.WithdrawStatusRefunded
+	}
+	return w, nil
+}
+
+func TestAdminRefundHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		number     string
+		body       string
+		want       int
+		wantStatus string
+	}{
+		{name: "partial", number: "2377225624", body: `{"amount":30,"reason":"returned item"}`,
+			want: http.StatusOK, wantStatus: obj.WithdrawStatusPartiallyRefunded},
+		{name: "exceeds", number: "2377225624", body: `{"amount":80,"reason":"returned item"}`, want: http.StatusUnprocessableEntity},
+		{name: "rest", number: "2377225624", body: `{"reason":"order cancelled"}`,
+			want: http.StatusOK, wantStatus: obj.WithdrawStatusRefunded},
+		{name: "already refunded", number: "2377225624", body: `{"reason":"order cancelled"}`, want: http.StatusConflict},
+		{name: "no reason", number: "79927398713", body: `{"amount":10}`, want: http.StatusBadRequest},
+		{name: "negative amount", number: "79927398713", body: `{"amount":-10,"reason":"typo"}`, want: http.StatusBadRequest},
+		{name: "unknown withdrawal", number: "12345678903", body: `{"reason":"order cancelled"}`, want: http.StatusNotFound},
+	}
+
+	store := &refundStore{withdrawals: map[string]*obj.Withdraw{
+		"2377225624":  {Order: "2377225624", Sum: 100, Status: obj.WithdrawStatusCompleted},
+		"79927398713": {Order: "79927398713", Sum: 50, Status: obj.WithdrawStatusCompleted},
+	}}
+	r := gin.New()
+	r.POST(AdminRefundHandlerPath, AdminRefundHandler(context.Background(), zap.NewNop().Sugar(), store))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/withdrawals/"+tt.number+"/refund", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("AdminRefundHandler() status = %v, want %v", w.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			got := &obj.Withdraw{}
+			if err := json.Unmarshal(w.Body.Bytes(), got); err != nil {
+				t.Fatalf("AdminRefundHandler() body: %v", err)
+			}
+			if got.Status != tt.wantStatus {
+				t.Errorf("AdminRefundHandler() withdrawal status = %v, want %v", got.Status, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/eqkez0r/gophermart/utils/hash"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+const (
+	APIKeysHandlerPath      = "/keys"
+	APIKeyRevokeHandlerPath = "/keys/:id"
+
+	apiKeyPrefix           = "gm_"
+	apiKeyPrefixLen        = 8
+	defaultAPIKeyRateLimit = 60
+)
+
+var (
+	errInvalidScope = e.ErrInvalidRequest.WithDetail("invalid api key scope")
+)
+
+type APIKeyCreateProvider interface {
+	NewAPIKey(context.Context, string, *obj.APIKey, string) error
+}
+
+type APIKeyListProvider interface {
+	APIKeys(context.Context, string) ([]*obj.APIKey, error)
+}
+
+type APIKeyRevokeProvider interface {
+	RevokeAPIKey(context.Context, string, uint64) error
+}
+
+// APIKeyCreateHandler creates a key and returns it in plain text. Only the
+// hash is stored, so the key can't be shown again. The rate limit of the
+// key is clamped to maxRateLimit.
+func APIKeyCreateHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store APIKeyCreateProvider,
+	maxRateLimit int,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in api key create handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		key := &obj.APIKey{}
+		if err = c.ShouldBindJSON(key); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, e.ErrInvalidRequest.WithCause(err))
+			return
+		}
+		if key.Name == "" || len(key.Scopes) == 0 {
+			err := e.ErrInvalidRequest.WithDetail("name and scopes are required")
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+		for _, s := range key.Scopes {
+			if !obj.APIKeyScopes[s] {
+				logger.Error(e.Wrap(op, errInvalidScope))
+				fail(c, errInvalidScope)
+				return
+			}
+		}
+		if key.RateLimit <= 0 {
+			key.RateLimit = defaultAPIKeyRateLimit
+		}
+		key.RateLimit = min(key.RateLimit, maxRateLimit)
+
+		key.Key, err = generateAPIKey()
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+		key.Prefix = key.Key[:apiKeyPrefixLen]
+
+		if err = store.NewAPIKey(ctx, login, key, hash.HashToken(key.Key)); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, key)
+	}
+}
+
+func APIKeyListHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store APIKeyListProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in api key list handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		keys, err := store.APIKeys(ctx, login)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		if len(keys) == 0 {
+			c.Status(http.StatusNoContent)
+			return
+		}
+
+		c.JSON(http.StatusOK, keys)
+	}
+}
+
+func APIKeyRevokeHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store APIKeyRevokeProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in api key revoke handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, e.ErrInvalidRequest.WithCause(err))
+			return
+		}
+
+		if err = store.RevokeAPIKey(ctx, login, id); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func generateAPIKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(b), nil
+}
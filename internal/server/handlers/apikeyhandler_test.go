@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/eqkez0r/gophermart/internal/server/middleware"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/eqkez0r/gophermart/utils/hash"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type apiKeyStore struct {
+	hashes map[string]*obj.APIKey
+}
+
+func (s *apiKeyStore) NewAPIKey(_ context.Context, _ string, key *obj.APIKey, keyHash string) error {
+	key.KeyID = uint64(len(s.hashes) + 1)
+	s.hashes[keyHash] = key
+	return nil
+}
+
+// withLogin stands in for middleware.Auth in handler tests.
+func withLogin(login string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(middleware.LoginKey, login)
+	}
+}
+
+func TestAPIKeyCreateHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name      string
+		body      string
+		want      int
+		wantLimit int
+	}{
+		{name: "valid", body: `{"name":"pos","scopes":["orders:write"]}`, want: http.StatusCreated, wantLimit: defaultAPIKeyRateLimit},
+		{name: "rate limit", body: `{"name":"pos","scopes":["orders:write"],"rate_limit":100}`, want: http.StatusCreated, wantLimit: 100},
+		{name: "rate limit above max", body: `{"name":"pos","scopes":["orders:write"],"rate_limit":100000}`,
+			want: http.StatusCreated, wantLimit: 600},
+		{name: "unknown scope", body: `{"name":"pos","scopes":["admin"]}`, want: http.StatusBadRequest},
+		{name: "no scopes", body: `{"name":"pos"}`, want: http.StatusBadRequest},
+		{name: "no name", body: `{"scopes":["orders:write"]}`, want: http.StatusBadRequest},
+		{name: "bad json", body: `{`, want: http.StatusBadRequest},
+	}
+
+	store := &apiKeyStore{hashes: make(map[string]*obj.APIKey)}
+	r := gin.New()
+	r.POST(APIKeysHandlerPath, withLogin("alice"), APIKeyCreateHandler(context.Background(), zap.NewNop().Sugar(), store, 600))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, APIKeysHandlerPath, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("APIKeyCreateHandler() status = %v, want %v", w.Code, tt.want)
+			}
+			if tt.want != http.StatusCreated {
+				return
+			}
+			key := &obj.APIKey{}
+			if err := json.Unmarshal(w.Body.Bytes(), key); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(key.Key, apiKeyPrefix) || key.Prefix != key.Key[:apiKeyPrefixLen] {
+				t.Errorf("APIKeyCreateHandler() key = %v, prefix = %v", key.Key, key.Prefix)
+			}
+			if key.RateLimit != tt.wantLimit {
+				t.Errorf("APIKeyCreateHandler() rate limit = %v, want %v", key.RateLimit, tt.wantLimit)
+			}
+			if _, ok := store.hashes[hash.HashToken(key.Key)]; !ok {
+				t.Errorf("APIKeyCreateHandler() stored key is not a hash of the returned one")
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	AuditLogHandlerPath    = "/audit"
+	AuditExportHandlerPath = "/audit/export"
+
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+type AuditLogProvider interface {
+	AuditRecords(context.Context, *obj.AuditFilter, func(*obj.AuditRecord) error) error
+}
+
+func AuditLogHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store AuditLogProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in audit log handler: "
+
+		filter, err := auditFilter(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+		if filter.Limit == 0 {
+			filter.Limit = defaultAuditLimit
+		}
+		filter.Limit = min(filter.Limit, maxAuditLimit)
+
+		records := make([]*obj.AuditRecord, 0)
+		err = store.AuditRecords(ctx, filter, func(r *obj.AuditRecord) error {
+			records = append(records, r)
+			return nil
+		})
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, records)
+	}
+}
+
+// AuditExportHandler streams the matching records as JSON lines without
+// holding them in memory. The limit is not applied unless given.
+func AuditExportHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store AuditLogProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in audit export handler: "
+
+		filter, err := auditFilter(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Content-Disposition", `attachment; filename="audit.jsonl"`)
+		c.Status(http.StatusOK)
+
+		enc := json.NewEncoder(c.Writer)
+		err = store.AuditRecords(ctx, filter, func(r *obj.AuditRecord) error {
+			return enc.Encode(r)
+		})
+		if err != nil {
+			//the status is already sent, the client sees a truncated export
+			logger.Error(e.Wrap(op, err))
+			c.Abort()
+		}
+	}
+}
+
+func auditFilter(c *gin.Context) (*obj.AuditFilter, error) {
+	filter := &obj.AuditFilter{
+		Actor:  c.Query("actor"),
+		Action: c.Query("action"),
+		Target: c.Query("target"),
+	}
+	var err error
+	if v := c.Query("from"); v != "" {
+		if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, e.ErrInvalidRequest.WithDetail("invalid from").WithCause(err)
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, e.ErrInvalidRequest.WithDetail("invalid to").WithCause(err)
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 0 {
+			return nil, e.ErrInvalidRequest.WithDetail(fmt.Sprintf("invalid limit %q", v))
+		}
+	}
+	return filter, nil
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type auditLogStore struct {
+	records []*obj.AuditRecord
+}
+
+func (s *auditLogStore) AuditRecords(_ context.Context, f *obj.AuditFilter, fn func(*obj.AuditRecord) error) error {
+	for _, r := range s.records {
+		if f.Actor != "" && r.Actor != f.Actor {
+			continue
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestAuditExportHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := &auditLogStore{records: []*obj.AuditRecord{
+		{RecordID: 1, Actor: "alice", Action: "user.login"},
+		{RecordID: 2, Actor: "bob", Action: "user.login"},
+		{RecordID: 3, Actor: "alice", Action: "balance.withdraw"},
+	}}
+	r := gin.New()
+	r.GET(AuditExportHandlerPath, AuditExportHandler(context.Background(), zap.NewNop().Sugar(), store))
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+		lines int
+	}{
+		{name: "all", query: "", want: http.StatusOK, lines: 3},
+		{name: "by actor", query: "?actor=alice", want: http.StatusOK, lines: 2},
+		{name: "bad from", query: "?from=yesterday", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, AuditExportHandlerPath+tt.query, nil))
+
+			if w.Code != tt.want {
+				t.Fatalf("AuditExportHandler() status = %v, want %v", w.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			lines := 0
+			sc := bufio.NewScanner(w.Body)
+			for sc.Scan() {
+				rec := &obj.AuditRecord{}
+				if err := json.Unmarshal(sc.Bytes(), rec); err != nil {
+					t.Fatalf("AuditExportHandler() invalid line %q: %v", sc.Text(), err)
+				}
+				lines++
+			}
+			if lines != tt.lines {
+				t.Errorf("AuditExportHandler() lines = %v, want %v", lines, tt.lines)
+			}
+		})
+	}
+}
@@ -2,11 +2,15 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/eqkez0r/gophermart/internal/server/middleware"
+	"github.com/eqkez0r/gophermart/pkg/audit"
 	e "github.com/eqkez0r/gophermart/pkg/error"
 	"github.com/eqkez0r/gophermart/pkg/jwt"
 	obj "github.com/eqkez0r/gophermart/pkg/objects"
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 	"net/http"
@@ -18,57 +22,130 @@ const (
 
 type GetUserProvider interface {
 	GetUser(context.Context, string) (*obj.User, error)
+	GetTOTP(context.Context, string) (*obj.TOTP, error)
+	AuditRecordProvider
+}
+
+type AuditRecordProvider interface {
+	NewAuditRecord(context.Context, *obj.AuditRecord) error
 }
 
 func AuthHandler(
 	ctx context.Context,
 	logger *zap.SugaredLogger,
 	storage GetUserProvider,
-
+	session middleware.SessionConfig,
 ) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		const op = "Error in auth handler: "
 
 		u := &obj.User{}
 		if c.ContentType() != "application/json" {
-			logger.Error(e.Wrap(op, errInvalidFormat))
-			c.Status(http.StatusBadRequest)
+			logger.Error(e.Wrap(op, e.ErrInvalidContentType))
+			fail(c, e.ErrInvalidContentType)
 			return
 		}
-		err := c.BindJSON(u)
+		err := c.ShouldBindJSON(u)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusInternalServerError)
+			fail(c, e.ErrInvalidRequest.WithCause(err))
 			return
 		}
 		if u.Login == "" || u.Password == "" {
-			logger.Error(e.Wrap(op, fmt.Errorf("empty field")))
-			c.Status(http.StatusBadRequest)
+			err = e.ErrInvalidRequest.WithDetail("login and password are required")
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
 			return
 		}
 
 		user, err := storage.GetUser(ctx, u.Login)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusInternalServerError)
+			if errors.Is(err, pgx.ErrNoRows) {
+				auditLogin(ctx, c, logger, storage, u.Login, http.StatusUnauthorized, "unknown login")
+				fail(c, e.ErrInvalidCredentials)
+				return
+			}
+			fail(c, err)
 			return
 		}
 
 		if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(u.Password)) != nil {
 			logger.Error(e.Wrap(op, fmt.Errorf("invalid password")))
-			c.Status(http.StatusUnauthorized)
+			auditLogin(ctx, c, logger, storage, u.Login, http.StatusUnauthorized, "invalid password")
+			fail(c, e.ErrInvalidCredentials)
+			return
+		}
+
+		if user.Blocked {
+			logger.Error(e.Wrap(op, e.ErrUserBlocked))
+			auditLogin(ctx, c, logger, storage, u.Login, http.StatusForbidden, "blocked")
+			fail(c, e.ErrUserBlocked)
 			return
 		}
 
-		token, err := jwt.CreateJWT(u.Login)
+		t, err := storage.GetTOTP(ctx, u.Login)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusInternalServerError)
+			fail(c, err)
+			return
+		}
+		if t.Enabled {
+			challenge, exp, err := jwt.CreateChallengeJWT(u.Login)
+			if err != nil {
+				logger.Error(e.Wrap(op, err))
+				fail(c, err)
+				return
+			}
+			auditLogin(ctx, c, logger, storage, u.Login, http.StatusAccepted, "second factor required")
+			c.JSON(http.StatusAccepted, &obj.TwoFactorChallenge{
+				Challenge: challenge,
+				ExpiresAt: exp,
+			})
 			return
 		}
 
-		c.Header("Authorization", token)
+		token, err := jwt.CreateJWT(u.Login, user.Role)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		auditLogin(ctx, c, logger, storage, u.Login, http.StatusOK, "")
+		if err = middleware.SetSession(c, session, token); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
 
 		c.Status(http.StatusOK)
 	}
 }
+
+// auditLogin records a login attempt. Failures to write the record are
+// logged only, they must not change the outcome of the login.
+func auditLogin(
+	ctx context.Context,
+	c *gin.Context,
+	logger *zap.SugaredLogger,
+	store AuditRecordProvider,
+	login string,
+	status int,
+	details string,
+) {
+	action := audit.ActionLogin
+	if status >= http.StatusBadRequest {
+		action = audit.ActionLoginFailed
+	}
+	err := store.NewAuditRecord(auditContext(ctx, c), &obj.AuditRecord{
+		Actor:   login,
+		Action:  action,
+		Target:  login,
+		Details: details,
+		Status:  status,
+	})
+	if err != nil {
+		logger.Warnw("failed to write login audit record", "error", err)
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"github.com/eqkez0r/gophermart/internal/server/middleware"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"reflect"
@@ -13,6 +14,7 @@ func TestAuthHandler(t *testing.T) {
 		ctx     context.Context
 		logger  *zap.SugaredLogger
 		storage GetUserProvider
+		session middleware.SessionConfig
 	}
 	tests := []struct {
 		name string
@@ -24,7 +26,7 @@ func TestAuthHandler(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := AuthHandler(tt.args.ctx, tt.args.logger, tt.args.storage); !reflect.DeepEqual(got, tt.want) {
+			if got := AuthHandler(tt.args.ctx, tt.args.logger, tt.args.storage, tt.args.session); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("AuthHandler() = %v, want %v", got, tt.want)
 			}
 		})
@@ -2,12 +2,13 @@ package handlers
 
 import (
 	"context"
+	"github.com/eqkez0r/gophermart/internal/expiry"
 	e "github.com/eqkez0r/gophermart/pkg/error"
-	"github.com/eqkez0r/gophermart/pkg/jwt"
 	obj "github.com/eqkez0r/gophermart/pkg/objects"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"net/http"
+	"time"
 )
 
 const (
@@ -16,32 +17,43 @@ const (
 
 type BalanceProvider interface {
 	GetBalance(ctx context.Context, login string) (*obj.AccrualBalance, error)
+	ExpiringPoints(ctx context.Context, login string, months int, until time.Time) ([]*obj.ExpiringPoints, error)
 }
 
+// BalanceHandler returns the balance of the user. With points expiry
+// enabled it lists the points expiring within the policy window.
 func BalanceHandler(
 	ctx context.Context,
 	logger *zap.SugaredLogger,
 	store BalanceProvider,
+	policy expiry.Policy,
 ) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		const op = "Balance handler error: "
 
-		token := c.Request.Header.Get("Authorization")
-		logger.Infof("call balance. token %s", token)
-		login, _, err := jwt.JWTPayload(token)
+		login, err := userLogin(c)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusInternalServerError)
+			fail(c, err)
 			return
 		}
 
 		balance, err := store.GetBalance(ctx, login)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusInternalServerError)
+			fail(c, err)
 			return
 		}
 
+		if policy.Enabled() && policy.Soon > 0 {
+			balance.ExpiringSoon, err = store.ExpiringPoints(ctx, login, policy.Months, time.Now().Add(policy.Soon))
+			if err != nil {
+				logger.Error(e.Wrap(op, err))
+				fail(c, err)
+				return
+			}
+		}
+
 		logger.Infof("getting balance: %v", balance)
 		c.JSON(http.StatusOK, balance)
 	}
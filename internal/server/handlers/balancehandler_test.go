@@ -2,29 +2,78 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"github.com/eqkez0r/gophermart/internal/expiry"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
-	"reflect"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 )
 
+type balanceStore struct {
+	expiring []*obj.ExpiringPoints
+	until    time.Time
+}
+
+func (s *balanceStore) GetBalance(context.Context, string) (*obj.AccrualBalance, error) {
+	return &obj.AccrualBalance{Balance: 500.5, Withdraw: 42}, nil
+}
+
+func (s *balanceStore) ExpiringPoints(_ context.Context, _ string, _ int, until time.Time) ([]*obj.ExpiringPoints, error) {
+	s.until = until
+	return s.expiring, nil
+}
+
 func TestBalanceHandler(t *testing.T) {
-	type args struct {
-		ctx    context.Context
-		logger *zap.SugaredLogger
-		store  BalanceProvider
+	gin.SetMode(gin.TestMode)
+
+	expiring := []*obj.ExpiringPoints{
+		{Number: "12345678903", Amount: 120, ExpiresAt: time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)},
 	}
+
 	tests := []struct {
-		name string
-		args args
-		want gin.HandlerFunc
+		name         string
+		policy       expiry.Policy
+		wantExpiring int
 	}{
-		// TODO: Add test cases.
+		{name: "expiry disabled", policy: expiry.Policy{Soon: 24 * time.Hour}},
+		{name: "expiring soon", policy: expiry.Policy{Months: 12, Soon: 30 * 24 * time.Hour}, wantExpiring: 1},
+		{name: "no window", policy: expiry.Policy{Months: 12}},
 	}
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := BalanceHandler(tt.args.ctx, tt.args.logger, tt.args.store); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("BalanceHandler() = %v, want %v", got, tt.want)
+			store := &balanceStore{expiring: expiring}
+			r := gin.New()
+			r.GET("/balance", withLogin("alice"), BalanceHandler(context.Background(), zap.NewNop().Sugar(), store, tt.policy))
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/balance", nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("BalanceHandler() status = %v, want %v", w.Code, http.StatusOK)
+			}
+			got := &obj.AccrualBalance{}
+			if err := json.Unmarshal(w.Body.Bytes(), got); err != nil {
+				t.Fatalf("BalanceHandler() body: %v", err)
+			}
+			if got.Balance != 500.5 || got.Withdraw != 42 {
+				t.Errorf("BalanceHandler() = %+v", got)
+			}
+			if len(got.ExpiringSoon) != tt.wantExpiring {
+				t.Fatalf("BalanceHandler() expiring = %v, want %v", len(got.ExpiringSoon), tt.wantExpiring)
+			}
+			if tt.wantExpiring == 0 {
+				return
+			}
+			if !got.ExpiringSoon[0].ExpiresAt.Equal(expiring[0].ExpiresAt) {
+				t.Errorf("BalanceHandler() expires at = %v, want %v", got.ExpiringSoon[0].ExpiresAt, expiring[0].ExpiresAt)
+			}
+			if d := time.Until(store.until); d < 29*24*time.Hour || d > tt.policy.Soon {
+				t.Errorf("BalanceHandler() window ends in %v, want %v", d, tt.policy.Soon)
 			}
 		})
 	}
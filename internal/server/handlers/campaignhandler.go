@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/eqkez0r/gophermart/internal/campaigns"
+	"github.com/eqkez0r/gophermart/internal/server/middleware"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+const (
+	AdminCampaignsHandlerPath = "/campaigns"
+	AdminCampaignHandlerPath  = "/campaigns/:id"
+)
+
+type CampaignsProvider interface {
+	Campaigns(context.Context) ([]*obj.Campaign, error)
+}
+
+type CampaignSaveProvider interface {
+	NewCampaign(context.Context, *obj.Campaign) error
+	UpdateCampaign(context.Context, *obj.Campaign) error
+}
+
+type CampaignDeleteProvider interface {
+	DeleteCampaign(context.Context, uint64) error
+}
+
+func AdminCampaignsHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store CampaignsProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in admin campaigns handler: "
+
+		cs, err := store.Campaigns(ctx)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		if len(cs) == 0 {
+			c.Status(http.StatusNoContent)
+			return
+		}
+
+		c.JSON(http.StatusOK, cs)
+	}
+}
+
+// AdminSaveCampaignHandler creates a campaign, or replaces the campaign
+// of the id path parameter when there is one. Segments must be names of
+// the given tiers.
+func AdminSaveCampaignHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store CampaignSaveProvider,
+	segments []*obj.Tier,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in admin save campaign handler: "
+
+		campaign := &obj.Campaign{}
+		if err := c.ShouldBindJSON(campaign); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, e.ErrInvalidRequest.WithCause(err))
+			return
+		}
+		if err := campaigns.Validate(campaign, segments); err != nil {
+			err := e.ErrInvalidRequest.WithDetail(err.Error())
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		save, status := store.NewCampaign, http.StatusCreated
+		if param := c.Param("id"); param != "" {
+			id, err := strconv.ParseUint(param, 10, 64)
+			if err != nil {
+				logger.Error(e.Wrap(op, err))
+				fail(c, e.ErrInvalidRequest.WithCause(err))
+				return
+			}
+			campaign.CampaignID = id
+			save, status = store.UpdateCampaign, http.StatusOK
+		}
+		c.Set(middleware.AuditDetailsKey, fmt.Sprintf("name=%q starts_at=%s ends_at=%s multiplier=%v bonus=%v",
+			campaign.Name, campaign.StartsAt, campaign.EndsAt, campaign.Multiplier, campaign.Bonus))
+
+		if err := save(ctx, campaign); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.JSON(status, campaign)
+	}
+}
+
+func AdminDeleteCampaignHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store CampaignDeleteProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in admin delete campaign handler: "
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, e.ErrInvalidRequest.WithCause(err))
+			return
+		}
+
+		if err = store.DeleteCampaign(ctx, id); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type campaignStore struct {
+	campaigns map[uint64]*obj.Campaign
+	next      uint64
+}
+
+func (s *campaignStore) NewCampaign(_ context.Context, c *obj.Campaign) error {
+	s.next++
+	c.CampaignID = s.next
+	s.campaigns[c.CampaignID] = c
+	return nil
+}
+
+func (s *campaignStore) UpdateCampaign(_ context.Context, c *obj.Campaign) error {
+	if _, ok := s.campaigns[c.CampaignID]; !ok {
+		return e.ErrCampaignNotFound
+	}
+	s.campaigns[c.CampaignID] = c
+	return nil
+}
+
+func (s *campaignStore) DeleteCampaign(_ context.Context, id uint64) error {
+	if _, ok := s.campaigns[id]; !ok {
+		return e.ErrCampaignNotFound
+	}
+	delete(s.campaigns, id)
+	return nil
+}
+
+func TestAdminSaveCampaignHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const window = `"starts_at":"2024-06-01T00:00:00Z","ends_at":"2024-07-01T00:00:00Z"`
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{name: "multiplier", method: http.MethodPost, path: "/campaigns",
+			body: `{"name":"summer",` + window + `,"multiplier":2}`, want: http.StatusCreated},
+		{name: "bonus for tier", method: http.MethodPost, path: "/campaigns",
+			body: `{"name":"gold week",` + window + `,"bonus":50,"segment":"gold","order_prefix":"12"}`, want: http.StatusCreated},
+		{name: "both boosts", method: http.MethodPost, path: "/campaigns",
+			body: `{"name":"summer",` + window + `,"multiplier":2,"bonus":50}`, want: http.StatusBadRequest},
+		{name: "unknown segment", method: http.MethodPost, path: "/campaigns",
+			body: `{"name":"summer",` + window + `,"bonus":50,"segment":"platinum"}`, want: http.StatusBadRequest},
+		{name: "ends before start", method: http.MethodPost, path: "/campaigns",
+			body: `{"name":"summer","starts_at":"2024-07-01T00:00:00Z","ends_at":"2024-06-01T00:00:00Z","bonus":50}`,
+			want: http.StatusBadRequest},
+		{name: "update", method: http.MethodPut, path: "/campaigns/1",
+			body: `{"name":"summer",` + window + `,"multiplier":3}`, want: http.StatusOK},
+		{name: "update unknown", method: http.MethodPut, path: "/campaigns/7",
+			body: `{"name":"summer",` + window + `,"multiplier":3}`, want: http.StatusNotFound},
+		{name: "update bad id", method: http.MethodPut, path: "/campaigns/x",
+			body: `{"name":"summer",` + window + `,"multiplier":3}`, want: http.StatusBadRequest},
+		{name: "delete", method: http.MethodDelete, path: "/campaigns/2", want: http.StatusNoContent},
+		{name: "delete again", method: http.MethodDelete, path: "/campaigns/2", want: http.StatusNotFound},
+	}
+
+	store := &campaignStore{campaigns: map[uint64]*obj.Campaign{}}
+	segments := []*obj.Tier{{Name: "silver"}, {Name: "gold"}}
+	r := gin.New()
+	r.POST(AdminCampaignsHandlerPath, AdminSaveCampaignHandler(context.Background(), zap.NewNop().Sugar(), store, segments))
+	r.PUT(AdminCampaignHandlerPath, AdminSaveCampaignHandler(context.Background(), zap.NewNop().Sugar(), store, segments))
+	r.DELETE(AdminCampaignHandlerPath, AdminDeleteCampaignHandler(context.Background(), zap.NewNop().Sugar(), store))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("AdminSaveCampaignHandler() status = %v, want %v", w.Code, tt.want)
+			}
+		})
+	}
+
+	if got := store.campaigns[1].Multiplier; got != 3 {
+		t.Errorf("AdminSaveCampaignHandler() multiplier = %v, want 3", got)
+	}
+}
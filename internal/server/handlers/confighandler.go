@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/eqkez0r/gophermart/internal/config"
+	"github.com/eqkez0r/gophermart/internal/server/middleware"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+)
+
+const (
+	AdminReloadConfigHandlerPath = "/config/reload"
+)
+
+type ConfigReloader interface {
+	Reload() ([]config.Change, error)
+}
+
+// AdminReloadConfigHandler reloads the configuration like SIGHUP does and
+// returns the applied changes.
+func AdminReloadConfigHandler(
+	logger *zap.SugaredLogger,
+	reloader ConfigReloader,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in admin reload config handler: "
+
+		changes, err := reloader.Reload()
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			if errors.Is(err, config.ErrNotReloadable) {
+				fail(c, e.ErrConfigNotReloadable.WithDetail(err.Error()))
+				return
+			}
+			fail(c, e.ErrConfigInvalid.WithDetail(err.Error()))
+			return
+		}
+		if changes == nil {
+			changes = []config.Change{}
+		}
+
+		keys := make([]string, len(changes))
+		for i, change := range changes {
+			keys[i] = change.Key
+		}
+		c.Set(middleware.AuditDetailsKey, "changed="+strings.Join(keys, ","))
+		c.JSON(http.StatusOK, changes)
+	}
+}
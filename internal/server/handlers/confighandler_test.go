@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/eqkez0r/gophermart/internal/config"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type configReloader struct {
+	changes []config.Change
+	err     error
+}
+
+func (r *configReloader) Reload() ([]config.Change, error) {
+	return r.changes, r.err
+}
+
+func TestAdminReloadConfigHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		reloader    *configReloader
+		want        int
+		wantChanges int
+	}{
+		{name: "changed", reloader: &configReloader{changes: []config.Change{
+			{Key: "logging.level", Old: "debug", New: "warn", Reloadable: true},
+		}}, want: http.StatusOK, wantChanges: 1},
+		{name: "unchanged", reloader: &configReloader{}, want: http.StatusOK},
+		{name: "not reloadable", reloader: &configReloader{err: fmt.Errorf("%w: server.address", config.ErrNotReloadable)},
+			want: http.StatusConflict},
+		{name: "invalid", reloader: &configReloader{err: errors.New("logging.level: log level must be debug, info, warn or error")},
+			want: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.POST(AdminReloadConfigHandlerPath, AdminReloadConfigHandler(zap.NewNop().Sugar(), tt.reloader))
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, AdminReloadConfigHandlerPath, nil))
+
+			if w.Code != tt.want {
+				t.Fatalf("AdminReloadConfigHandler() status = %v, want %v", w.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var changes []config.Change
+			if err := json.Unmarshal(w.Body.Bytes(), &changes); err != nil || changes == nil || len(changes) != tt.wantChanges {
+				t.Errorf("AdminReloadConfigHandler() body = %s, want %d changes", w.Body, tt.wantChanges)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"context"
+	"github.com/eqkez0r/gophermart/internal/server/middleware"
+	"github.com/eqkez0r/gophermart/pkg/audit"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"time"
+)
+
+// userLogin returns the login stored in the context by middleware.Auth.
+func userLogin(c *gin.Context) (string, error) {
+	login := c.GetString(middleware.LoginKey)
+	if login == "" {
+		return "", e.ErrUnauthorized
+	}
+	return login, nil
+}
+
+// mfaVerifiedAt returns the time of the last second factor check of the
+// current session, zero if there was none.
+func mfaVerifiedAt(c *gin.Context) time.Time {
+	return c.GetTime(middleware.MFAVerifiedAtKey)
+}
+
+// auditContext attaches the request metadata to ctx, so the storage layer
+// can attribute audit records to the request.
+func auditContext(ctx context.Context, c *gin.Context) context.Context {
+	meta := &audit.Meta{
+		Actor:     c.GetString(middleware.LoginKey),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		RequestID: c.GetString(middleware.RequestIDKey),
+	}
+	if key, ok := c.Get(middleware.APIKeyKey); ok {
+		if key, _ := key.(*obj.APIKey); key != nil {
+			meta.APIKeyID = key.KeyID
+		}
+	}
+	return audit.WithMeta(ctx, meta)
+}
+
+// fail attaches err for the problem renderer and sets the status declared
+// by err, 500 for errors which are not domain errors.
+func fail(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Status(e.StatusOf(err))
+}
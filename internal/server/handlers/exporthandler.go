@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ExportHandlerPath = "/export"
+
+	exportFormatCSV   = "csv"
+	exportFormatJSONL = "jsonl"
+
+	// exportFlushRows is how often rows are pushed to the client.
+	exportFlushRows = 500
+)
+
+var exportCSVHeader = []string{"type", "time", "number", "status", "amount", "kind", "reason"}
+
+type ExportProvider interface {
+	Export(ctx context.Context, login string, from, to time.Time, fn func(*obj.ExportRecord) error) error
+}
+
+// ExportHandler streams the user's orders, withdrawals and balance
+// movements as CSV or JSON lines. Rows are written as they are read, the
+// Gzip middleware compresses the stream for clients accepting it.
+func ExportHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store ExportProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in export handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		var from, to time.Time
+		if v := c.Query("from"); v != "" {
+			if from, err = time.Parse(time.RFC3339, v); err != nil {
+				err = e.ErrInvalidRequest.WithDetail("invalid from").WithCause(err)
+				logger.Error(e.Wrap(op, err))
+				fail(c, err)
+				return
+			}
+		}
+		if v := c.Query("to"); v != "" {
+			if to, err = time.Parse(time.RFC3339, v); err != nil {
+				err = e.ErrInvalidRequest.WithDetail("invalid to").WithCause(err)
+				logger.Error(e.Wrap(op, err))
+				fail(c, err)
+				return
+			}
+		}
+
+		var write func(*obj.ExportRecord) error
+		flush := func() error { return nil }
+		switch format := c.DefaultQuery("format", exportFormatCSV); format {
+		case exportFormatCSV:
+			w := csv.NewWriter(c.Writer)
+			write = func(r *obj.ExportRecord) error {
+				return w.Write(exportCSVRow(r))
+			}
+			flush = func() error {
+				w.Flush()
+				return w.Error()
+			}
+			c.Header("Content-Type", "text/csv; charset=utf-8")
+			c.Header("Content-Disposition", `attachment; filename="export.csv"`)
+			c.Status(http.StatusOK)
+			if err = w.Write(exportCSVHeader); err != nil {
+				logger.Error(e.Wrap(op, err))
+				c.Abort()
+				return
+			}
+		case exportFormatJSONL:
+			enc := json.NewEncoder(c.Writer)
+			write = func(r *obj.ExportRecord) error {
+				return enc.Encode(r)
+			}
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Header("Content-Disposition", `attachment; filename="export.jsonl"`)
+			c.Status(http.StatusOK)
+		default:
+			err = e.ErrInvalidRequest.WithDetail("format must be csv or jsonl")
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		rows := 0
+		err = store.Export(ctx, login, from, to, func(r *obj.ExportRecord) error {
+			if err := write(r); err != nil {
+				return err
+			}
+			if rows++; rows%exportFlushRows == 0 {
+				if err := flush(); err != nil {
+					return err
+				}
+				c.Writer.Flush()
+			}
+			return nil
+		})
+		if err == nil {
+			err = flush()
+		}
+		if err != nil {
+			//the status is already sent, the client sees a truncated export
+			logger.Error(e.Wrap(op, err))
+			c.Abort()
+		}
+	}
+}
+
+func exportCSVRow(r *obj.ExportRecord) []string {
+	amount := ""
+	if r.Amount != nil {
+		amount = strconv.FormatFloat(float64(*r.Amount), 'f', -1, 32)
+	}
+	return []string{r.Type, r.Time.Format(time.RFC3339), csvText(r.Number), csvText(r.Status), amount,
+		csvText(r.Kind), csvText(r.Reason)}
+}
+
+// csvText keeps spreadsheets from running text cells as formulas by
+// prefixing the ones starting with a formula character with a quote.
+// Amounts are formatted here and stay numbers, a leading minus included.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/eqkez0r/gophermart/internal/server/middleware"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type exportStore struct {
+	records []*obj.ExportRecord
+}
+
+func (s *exportStore) Export(_ context.Context, _ string, from, to time.Time, fn func(*obj.ExportRecord) error) error {
+	for _, r := range s.records {
+		if !from.IsZero() && r.Time.Before(from) || !to.IsZero() && !r.Time.Before(to) {
+			continue
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestExportHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	accrual, withdrawn := float32(729.98), float32(-100)
+	store := &exportStore{records: []*obj.ExportRecord{
+		{Type: obj.ExportTypeOrder, Time: base, Number: "12345678903", Status: obj.OrderStatusProcessed, Amount: &accrual},
+		{Type: obj.ExportTypeOrder, Time: base.Add(time.Hour), Number: "2377225624", Status: obj.OrderStatusNew},
+		{Type: obj.ExportTypeMovement, Time: base.Add(2 * time.Hour), Number: "79927398713", Amount: &withdrawn,
+			Kind: obj.LedgerKindAdjustment, Reason: "order, \"gift\""},
+	}}
+
+	tests := []struct {
+		name     string
+		query    string
+		gzip     bool
+		want     int
+		wantRows int
+	}{
+		{name: "csv", query: "format=csv", want: http.StatusOK, wantRows: 3},
+		{name: "default format", query: "", want: http.StatusOK, wantRows: 3},
+		{name: "jsonl", query: "format=jsonl", want: http.StatusOK, wantRows: 3},
+		{name: "period", query: "format=jsonl&from=2024-05-01T10:30:00Z&to=2024-05-01T11:30:00Z", want: http.StatusOK, wantRows: 1},
+		{name: "gzip", query: "format=csv", gzip: true, want: http.StatusOK, wantRows: 3},
+		{name: "invalid format", query: "format=xlsx", want: http.StatusBadRequest},
+		{name: "invalid from", query: "from=today", want: http.StatusBadRequest},
+	}
+
+	r := gin.New()
+	r.GET(ExportHandlerPath, withLogin("alice"), middleware.Gzip(zap.NewNop().Sugar(), []string{"text/csv"}),
+		ExportHandler(context.Background(), zap.NewNop().Sugar(), store))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, ExportHandlerPath+"?"+tt.query, nil)
+			if tt.gzip {
+				req.Header.Set("Accept-Encoding", "gzip")
+				req.Header.Set("Accept", "text/csv")
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("ExportHandler() status = %v, want %v", w.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var body io.Reader = w.Body
+			if tt.gzip {
+				if w.Header().Get("Content-Encoding") != "gzip" {
+					t.Fatalf("ExportHandler() is not compressed")
+				}
+				gz, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatalf("ExportHandler() gzip: %v", err)
+				}
+				body = gz
+			}
+
+			rows := 0
+			if strings.Contains(tt.query, "jsonl") {
+				s := bufio.NewScanner(body)
+				for s.Scan() {
+					r := &obj.ExportRecord{}
+					if err := json.Unmarshal(s.Bytes(), r); err != nil {
+						t.Fatalf("ExportHandler() line %q: %v", s.Text(), err)
+					}
+					rows++
+				}
+			} else {
+				records, err := csv.NewReader(body).ReadAll()
+				if err != nil {
+					t.Fatalf("ExportHandler() csv: %v", err)
+				}
+				if strings.Join(records[0], ",") != strings.Join(exportCSVHeader, ",") {
+					t.Errorf("ExportHandler() header = %v", records[0])
+				}
+				rows = len(records) - 1
+			}
+			if rows != tt.wantRows {
+				t.Errorf("ExportHandler() rows = %v, want %v", rows, tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestExportCSVRow(t *testing.T) {
+	amount := float32(-100)
+	tests := []struct {
+		name   string
+		reason string
+		want   string
+	}{
+		{name: "text", reason: "goodwill", want: "goodwill"},
+		{name: "formula", reason: "=HYPERLINK(\"http://evil\")", want: "'=HYPERLINK(\"http://evil\")"},
+		{name: "plus", reason: "+1", want: "'+1"},
+		{name: "minus", reason: "-1+1", want: "'-1+1"},
+		{name: "at", reason: "@SUM(A1)", want: "'@SUM(A1)"},
+		{name: "tab", reason: "\t=1", want: "'\t=1"},
+		{name: "carriage return", reason: "\r=1", want: "'\r=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := exportCSVRow(&obj.ExportRecord{Type: obj.ExportTypeMovement, Amount: &amount,
+				Kind: obj.LedgerKindAdjustment, Reason: tt.reason})
+			if row[6] != tt.want {
+				t.Errorf("exportCSVRow() reason = %q, want %q", row[6], tt.want)
+			}
+			//amounts are numbers, not formulas
+			if row[4] != "-100" {
+				t.Errorf("exportCSVRow() amount = %q, want -100", row[4])
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"context"
+	"github.com/eqkez0r/gophermart/internal/holds"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/eqkez0r/gophermart/utils/luhn"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	HoldsHandlerPath       = "/holds"
+	HoldCaptureHandlerPath = "/holds/:number/capture"
+	HoldReleaseHandlerPath = "/holds/:number/release"
+)
+
+type HoldProvider interface {
+	NewHold(ctx context.Context, login, number string, sum float32, expiresAt time.Time, rules *obj.WithdrawRules) (*obj.Hold, error)
+	GetTOTP(context.Context, string) (*obj.TOTP, error)
+}
+
+type HoldsProvider interface {
+	Holds(ctx context.Context, login string) ([]*obj.Hold, error)
+}
+
+type HoldResolveProvider interface {
+	CaptureHold(ctx context.Context, login, number string) (*obj.Hold, error)
+	ReleaseHold(ctx context.Context, login, number string) (*obj.Hold, error)
+}
+
+// HoldHandler reserves points of the user for an order. Holds are checked
+// against the step-up threshold and the withdraw rules like withdrawals,
+// as capturing them is not.
+func HoldHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store HoldProvider,
+	policy holds.Policy,
+	stepUp StepUpPolicy,
+	rules *obj.WithdrawRules,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in hold handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		req := &obj.HoldRequest{}
+		if err = c.ShouldBindJSON(req); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, e.ErrInvalidRequest.WithCause(err))
+			return
+		}
+		if req.Sum <= 0 {
+			err = e.ErrInvalidRequest.WithDetail("sum must be positive")
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+		expiresAt, ok := policy.ExpiresAt(time.Now(), req.ExpiresIn)
+		if !ok {
+			err = e.ErrInvalidRequest.WithDetail("expires_in must be positive and at most " + policy.MaxTTL.String())
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		number, err := strconv.ParseUint(req.Order, 10, 64)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, e.ErrOrderNumberNotNumeric.WithCause(err))
+			return
+		}
+		if !luhn.Valid(number) {
+			logger.Error(e.Wrap(op, e.ErrOrderNumberLuhn))
+			fail(c, e.ErrOrderNumberLuhn)
+			return
+		}
+
+		if stepUp.Threshold > 0 && req.Sum > stepUp.Threshold {
+			t, err := store.GetTOTP(ctx, login)
+			if err != nil {
+				logger.Error(e.Wrap(op, err))
+				fail(c, err)
+				return
+			}
+			if t.Enabled && !freshMFA(mfaVerifiedAt(c), stepUp.MaxAge) {
+				logger.Error(e.Wrap(op, e.ErrStepUpRequired))
+				fail(c, e.ErrStepUpRequired)
+				return
+			}
+		}
+
+		hold, err := store.NewHold(auditContext(ctx, c), login, req.Order, req.Sum, expiresAt, rules)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			logWithdrawRuleHit(logger, login, req.Sum, err)
+			fail(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, hold)
+	}
+}
+
+// HoldsHandler lists the active holds of the user.
+func HoldsHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store HoldsProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in holds handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		active, err := store.Holds(ctx, login)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		if len(active) == 0 {
+			logger.Infof("No holds for user %s", login)
+			c.Status(http.StatusNoContent)
+			return
+		}
+
+		c.JSON(http.StatusOK, active)
+	}
+}
+
+// HoldResolveHandler captures the active hold of the order into a
+// withdrawal or releases it.
+func HoldResolveHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store HoldResolveProvider,
+	capture bool,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in hold resolve handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		resolve := store.ReleaseHold
+		if capture {
+			resolve = store.CaptureHold
+		}
+		hold, err := resolve(auditContext(ctx, c), login, c.Param("number"))
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, hold)
+	}
+}
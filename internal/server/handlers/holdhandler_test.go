@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/eqkez0r/gophermart/internal/holds"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type holdStore struct {
+	balance float32
+	holds   map[string]*obj.Hold
+}
+
+func (s *holdStore) held(now time.Time) float32 {
+	var held float32
+	for _, h := range s.holds {
+		if h.Status == obj.HoldStatusActive && h.ExpiresAt.After(now) {
+			held += h.Sum
+		}
+	}
+	return held
+}
+
+func (s *holdStore) NewHold(_ context.Context, _, number string, sum float32, expiresAt time.Time, _ *obj.WithdrawRules) (*obj.Hold, error) {
+	if h, ok := s.holds[number]; ok && h.Status != obj.HoldStatusReleased {
+		return nil, e.ErrOrderReserved
+	}
+	if s.balance-s.held(time.Now()) < sum {
+		return nil, e.ErrBalanceIsNotEnough
+	}
+	h := &obj.Hold{Order: number, Sum: sum, Status: obj.HoldStatusActive, CreatedAt: time.Now(), ExpiresAt: expiresAt}
+	s.holds[number] = h
+	return h, nil
+}
+
+func (s *holdStore) GetTOTP(context.Context, string) (*obj.TOTP, error) {
+	return &obj.TOTP{}, nil
+}
+
+func (s *holdStore) Holds(context.Context, string) ([]*obj.Hold, error) {
+	active := make([]*obj.Hold, 0)
+	for _, h := range s.holds {
+		if h.Status == obj.HoldStatusActive {
+			active = append(active, h)
+		}
+	}
+	return active, nil
+}
+
+func (s *holdStore) resolve(number, status string) (*obj.Hold, error) {
+	h, ok := s.holds[number]
+	if !ok {
+		return nil, e.ErrHoldNotFound
+	}
+	if h.Status != obj.HoldStatusActive || !h.ExpiresAt.After(time.Now()) {
+		return nil, e.ErrHoldNotActive
+	}
+	h.Status = status
+	return h, nil
+}
+
+func (s *holdStore) CaptureHold(_ context.Context, _, number string) (*obj.Hold, error) {
+	h, err := s.resolve(number, obj.HoldStatusCaptured)
+	if err != nil {
+		return nil, err
+	}
+	s.balance -= h.Sum
+	return h, nil
+}
+
+func (s *holdStore) ReleaseHold(_ context.Context, _, number string) (*obj.Hold, error) {
+	return s.resolve(number, obj.HoldStatusReleased)
+}
+
+func TestHoldHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := &holdStore{balance: 500, holds: map[string]*obj.Hold{
+		"12345678903": {Order: "12345678903", Sum: 10, Status: obj.HoldStatusActive, ExpiresAt: time.Now().Add(-time.Minute)},
+	}}
+	logger := zap.NewNop().Sugar()
+	r := gin.New()
+	r.Use(withLogin("alice"))
+	r.POST(HoldsHandlerPath, HoldHandler(context.Background(), logger, store,
+		holds.Policy{TTL: 15 * time.Minute, MaxTTL: time.Hour}, StepUpPolicy{}, nil))
+	r.GET(HoldsHandlerPath, HoldsHandler(context.Background(), logger, store))
+	r.POST(HoldCaptureHandlerPath, HoldResolveHandler(context.Background(), logger, store, true))
+	r.POST(HoldReleaseHandlerPath, HoldResolveHandler(context.Background(), logger, store, false))
+
+	//the steps share the store and run in order
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		want       int
+		wantStatus string
+	}{
+		{name: "hold", method: http.MethodPost, path: "/holds", body: `{"order":"2377225624","sum":300}`,
+			want: http.StatusCreated, wantStatus: obj.HoldStatusActive},
+		{name: "held points are not available", method: http.MethodPost, path: "/holds",
+			body: `{"order":"79927398713","sum":300}`, want: http.StatusPaymentRequired},
+		{name: "order already held", method: http.MethodPost, path: "/holds",
+			body: `{"order":"2377225624","sum":1}`, want: http.StatusConflict},
+		{name: "luhn", method: http.MethodPost, path: "/holds", body: `{"order":"2377225625","sum":1}`,
+			want: http.StatusUnprocessableEntity},
+		{name: "too long", method: http.MethodPost, path: "/holds",
+			body: `{"order":"79927398713","sum":1,"expires_in":7200}`, want: http.StatusBadRequest},
+		{name: "zero sum", method: http.MethodPost, path: "/holds", body: `{"order":"79927398713","sum":0}`,
+			want: http.StatusBadRequest},
+		{name: "list", method: http.MethodGet, path: "/holds", want: http.StatusOK},
+		{name: "capture", method: http.MethodPost, path: "/holds/2377225624/capture",
+			want: http.StatusOK, wantStatus: obj.HoldStatusCaptured},
+		{name: "capture twice", method: http.MethodPost, path: "/holds/2377225624/capture", want: http.StatusConflict},
+		{name: "release captured", method: http.MethodPost, path: "/holds/2377225624/release", want: http.StatusConflict},
+		{name: "capture expired", method: http.MethodPost, path: "/holds/12345678903/capture", want: http.StatusConflict},
+		{name: "release unknown", method: http.MethodPost, path: "/holds/79927398713/release", want: http.StatusNotFound},
+		{name: "hold again", method: http.MethodPost, path: "/holds", body: `{"order":"79927398713","sum":200,"expires_in":60}`,
+			want: http.StatusCreated, wantStatus: obj.HoldStatusActive},
+		{name: "release", method: http.MethodPost, path: "/holds/79927398713/release",
+			want: http.StatusOK, wantStatus: obj.HoldStatusReleased},
+	}
+
+	for _, tt := range steps {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("%s %s status = %v, want %v", tt.method, tt.path, w.Code, tt.want)
+			}
+			if tt.wantStatus == "" {
+				return
+			}
+			got := &obj.Hold{}
+			if err := json.Unmarshal(w.Body.Bytes(), got); err != nil {
+				t.Fatalf("%s %s body: %v", tt.method, tt.path, err)
+			}
+			if got.Status != tt.wantStatus {
+				t.Errorf("%s %s hold status = %v, want %v", tt.method, tt.path, got.Status, tt.wantStatus)
+			}
+		})
+	}
+
+	if store.balance != 200 {
+		t.Errorf("balance = %v, want 200", store.balance)
+	}
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"github.com/eqkez0r/gophermart/internal/server/middleware"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+const (
+	LogoutHandlerPath = "/logout"
+)
+
+// LogoutHandler removes the session cookies. Header tokens are stateless
+// and simply expire.
+func LogoutHandler(
+	logger *zap.SugaredLogger,
+	session middleware.SessionConfig,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logger.Infof("logout, request %s", c.GetString(middleware.RequestIDKey))
+		middleware.ClearSession(c, session)
+		c.Status(http.StatusOK)
+	}
+}
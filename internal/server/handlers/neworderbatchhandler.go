@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/eqkez0r/gophermart/utils/luhn"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	NewOrderBatchHandlerPath = "/orders/batch"
+
+	maxBatchSize = 1000
+	// MaxBatchBodySize leaves room for maxBatchSize numbers of up to 19
+	// digits with quotes, separators and some whitespace. The BodyLimit
+	// middleware enforces it.
+	MaxBatchBodySize = maxBatchSize * 32
+)
+
+type NewOrderBatchProvider interface {
+	NewOrders(ctx context.Context, login string, numbers []string) (map[string]string, error)
+}
+
+// NewOrderBatchHandler uploads a JSON array or a newline separated list
+// of order numbers at once. Every number gets its own result, invalid
+// ones don't fail the batch.
+func NewOrderBatchHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store NewOrderBatchProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in new order batch handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		var numbers []string
+		switch c.ContentType() {
+		case "application/json":
+			if err = json.Unmarshal(body, &numbers); err != nil {
+				logger.Error(e.Wrap(op, err))
+				fail(c, e.ErrInvalidRequest.WithCause(err))
+				return
+			}
+		case "text/plain":
+			for _, line := range strings.Split(string(body), "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					numbers = append(numbers, line)
+				}
+			}
+		default:
+			logger.Error(e.Wrap(op, e.ErrInvalidContentType))
+			fail(c, e.ErrInvalidContentType)
+			return
+		}
+		if len(numbers) == 0 || len(numbers) > maxBatchSize {
+			err = e.ErrInvalidRequest.WithDetail(fmt.Sprintf("batch must contain 1 to %d numbers", maxBatchSize))
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		//numbers repeated in the batch are uploaded once
+		results := make([]*obj.BatchOrderResult, len(numbers))
+		valid := make([]string, 0, len(numbers))
+		seen := make(map[string]bool, len(numbers))
+		for i, n := range numbers {
+			results[i] = &obj.BatchOrderResult{Number: n}
+			number, err := strconv.ParseUint(n, 10, 64)
+			if err != nil || !luhn.Valid(number) {
+				results[i].Result = obj.BatchOrderInvalid
+				continue
+			}
+			if !seen[n] {
+				seen[n] = true
+				valid = append(valid, n)
+			}
+		}
+
+		uploaded := make(map[string]string)
+		if len(valid) > 0 {
+			if uploaded, err = store.NewOrders(auditContext(ctx, c), login, valid); err != nil {
+				logger.Error(e.Wrap(op, err))
+				fail(c, err)
+				return
+			}
+		}
+
+		seen = make(map[string]bool, len(valid))
+		for _, r := range results {
+			if r.Result == obj.BatchOrderInvalid {
+				continue
+			}
+			r.Result = uploaded[r.Number]
+			if seen[r.Number] {
+				r.Result = obj.BatchOrderAlreadyUploaded
+			}
+			seen[r.Number] = true
+		}
+
+		c.JSON(http.StatusOK, results)
+	}
+}
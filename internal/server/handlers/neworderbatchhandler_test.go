@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type orderBatchStore struct {
+	owners map[string]string
+}
+
+func (s *orderBatchStore) NewOrders(_ context.Context, login string, numbers []string) (map[string]string, error) {
+	results := make(map[string]string, len(numbers))
+	for _, n := range numbers {
+		switch owner, ok := s.owners[n]; {
+		case !ok:
+			s.owners[n] = login
+			results[n] = obj.BatchOrderAccepted
+		case owner == login:
+			results[n] = obj.BatchOrderAlreadyUploaded
+		default:
+			results[n] = obj.BatchOrderAnotherUser
+		}
+	}
+	return results, nil
+}
+
+func TestNewOrderBatchHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+		wantResults []string
+	}{
+		{
+			name:        "json",
+			contentType: "application/json",
+			body:        `["12345678903","2377225624","79927398713","12345"]`,
+			want:        http.StatusOK,
+			wantResults: []string{
+				obj.BatchOrderAccepted, obj.BatchOrderAlreadyUploaded, obj.BatchOrderAnotherUser, obj.BatchOrderInvalid,
+			},
+		},
+		{
+			name:        "plain text",
+			contentType: "text/plain",
+			body:        "4561261212345467\n\n abc \n4561261212345467\r\n",
+			want:        http.StatusOK,
+			wantResults: []string{obj.BatchOrderAccepted, obj.BatchOrderInvalid, obj.BatchOrderAlreadyUploaded},
+		},
+		{name: "empty", contentType: "application/json", body: `[]`, want: http.StatusBadRequest},
+		{name: "not an array", contentType: "application/json", body: `{"orders":[]}`, want: http.StatusBadRequest},
+		{name: "content type", contentType: "application/xml", body: `<orders/>`, want: http.StatusBadRequest},
+		{
+			name:        "too large",
+			contentType: "text/plain",
+			body:        strings.Repeat("12345678903\n", maxBatchSize+1),
+			want:        http.StatusBadRequest,
+		},
+	}
+
+	store := &orderBatchStore{owners: map[string]string{"2377225624": "alice", "79927398713": "bob"}}
+	r := gin.New()
+	r.POST(NewOrderBatchHandlerPath, withLogin("alice"), NewOrderBatchHandler(context.Background(), zap.NewNop().Sugar(), store))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, NewOrderBatchHandlerPath, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("NewOrderBatchHandler() status = %v, want %v", w.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var results []*obj.BatchOrderResult
+			if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+				t.Fatalf("NewOrderBatchHandler() body: %v", err)
+			}
+			got := make([]string, 0, len(results))
+			for _, r := range results {
+				got = append(got, r.Result)
+			}
+			if !reflect.DeepEqual(got, tt.wantResults) {
+				t.Errorf("NewOrderBatchHandler() results = %v, want %v", got, tt.wantResults)
+			}
+		})
+	}
+}
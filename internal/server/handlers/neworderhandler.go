@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	e "github.com/eqkez0r/gophermart/pkg/error"
-	"github.com/eqkez0r/gophermart/pkg/jwt"
 	"github.com/eqkez0r/gophermart/utils/luhn"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -35,37 +34,37 @@ func NewOrderHandler(
 		body, err := io.ReadAll(c.Request.Body)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusInternalServerError)
+			fail(c, err)
 			return
 		}
 
 		if ct != "text/plain" && len(body) == 0 {
+			err = e.ErrInvalidRequest.WithDetail("empty body")
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusBadRequest)
+			fail(c, err)
 			return
 		}
 
 		number, err := strconv.ParseUint(string(body), 10, 64)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusUnprocessableEntity)
+			fail(c, e.ErrOrderNumberNotNumeric.WithCause(err))
 			return
 		}
 
 		if !luhn.Valid(number) {
-			logger.Error(e.Wrap(op, errors.New("invalid order number")))
-			c.Status(http.StatusUnprocessableEntity)
+			logger.Error(e.Wrap(op, e.ErrOrderNumberLuhn))
+			fail(c, e.ErrOrderNumberLuhn)
 			return
 		}
-		token := c.Request.Header.Get("Authorization")
-		login, _, err := jwt.JWTPayload(token)
+		login, err := userLogin(c)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusUnauthorized)
+			fail(c, err)
 			return
 		}
 		logger.Infof("user id: %s", login)
-		if err = store.NewOrder(ctx, login, string(body)); err != nil {
+		if err = store.NewOrder(auditContext(ctx, c), login, string(body)); err != nil {
 			logger.Error(e.Wrap(op, err))
 			var pgErr *pgconn.PgError
 			switch {
@@ -81,12 +80,12 @@ func NewOrderHandler(
 			case errors.Is(err, e.ErrIsOrderExistWithAnotherCustomer):
 				{
 					logger.Error(e.Wrap(op, err))
-					c.Status(http.StatusConflict)
+					fail(c, err)
 					return
 				}
 			default:
 				{
-					c.Status(http.StatusInternalServerError)
+					fail(c, err)
 					return
 				}
 			}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"github.com/eqkez0r/gophermart/internal/notify"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+const (
+	NotificationPrefsHandlerPath = "/notifications"
+)
+
+type NotificationPrefsProvider interface {
+	NotificationPrefs(context.Context, string) (*obj.NotificationPrefs, error)
+}
+
+type NotificationPrefsUpdateProvider interface {
+	SetNotificationPrefs(context.Context, string, *obj.NotificationPrefs) error
+}
+
+// NotificationPrefsHandler returns the notification preferences of the
+// user. Users who haven't set any are not notified.
+func NotificationPrefsHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store NotificationPrefsProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in notification prefs handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		prefs, err := store.NotificationPrefs(ctx, login)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+		if prefs.Locale == "" {
+			prefs.Locale = notify.DefaultLocale
+		}
+
+		c.JSON(http.StatusOK, prefs)
+	}
+}
+
+// NotificationPrefsUpdateHandler replaces the notification preferences of
+// the user. Only channels, those with a driver, can be chosen.
+func NotificationPrefsUpdateHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store NotificationPrefsUpdateProvider,
+	channels map[string]bool,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in notification prefs update handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		prefs := &obj.NotificationPrefs{}
+		if err = c.ShouldBindJSON(prefs); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, e.ErrInvalidRequest.WithCause(err))
+			return
+		}
+		if err = notify.Validate(prefs, channels); err != nil {
+			err = e.ErrInvalidRequest.WithDetail(err.Error())
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+		if prefs.Channels == nil {
+			prefs.Channels = []string{}
+		}
+		if prefs.Events == nil {
+			prefs.Events = []string{}
+		}
+
+		if err = store.SetNotificationPrefs(ctx, login, prefs); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, prefs)
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type notificationPrefsStore struct {
+	prefs map[string]*obj.NotificationPrefs
+}
+
+func (s *notificationPrefsStore) SetNotificationPrefs(_ context.Context, login string, prefs *obj.NotificationPrefs) error {
+	s.prefs[login] = prefs
+	return nil
+}
+
+func TestNotificationPrefsUpdateHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		body       string
+		want       int
+		wantLocale string
+	}{
+		{name: "email", body: `{"email":"alice@example.com","channels":["email"],"events":["order.processed"]}`,
+			want: http.StatusOK, wantLocale: "en"},
+		{name: "sms in russian", body: `{"locale":"ru","phone":"+79991234567","channels":["sms"],"events":["order.invalid"]}`,
+			want: http.StatusOK, wantLocale: "ru"},
+		{name: "opt out", body: `{}`, want: http.StatusOK, wantLocale: "en"},
+		{name: "no driver", body: `{"push_token":"tok","channels":["push"],"events":["order.processed"]}`,
+			want: http.StatusBadRequest},
+		{name: "no address", body: `{"channels":["email"],"events":["order.processed"]}`, want: http.StatusBadRequest},
+		{name: "unknown event", body: `{"events":["withdrawal.created"]}`, want: http.StatusBadRequest},
+		{name: "unknown locale", body: `{"locale":"xx"}`, want: http.StatusBadRequest},
+		{name: "bad json", body: `{`, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &notificationPrefsStore{prefs: make(map[string]*obj.NotificationPrefs)}
+			r := gin.New()
+			r.PUT(NotificationPrefsHandlerPath, withLogin("alice"),
+				NotificationPrefsUpdateHandler(context.Background(), zap.NewNop().Sugar(), store,
+					map[string]bool{obj.ChannelEmail: true, obj.ChannelSMS: true}))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPut, NotificationPrefsHandlerPath, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("NotificationPrefsUpdateHandler() status = %v, want %v", w.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			prefs := store.prefs["alice"]
+			if prefs == nil || prefs.Locale != tt.wantLocale || prefs.Channels == nil || prefs.Events == nil {
+				t.Errorf("NotificationPrefsUpdateHandler() stored %+v, want locale %v", prefs, tt.wantLocale)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+)
+
+const (
+	OrderHandlerPath = "/orders/:number"
+)
+
+type OrderProvider interface {
+	UserOrder(ctx context.Context, login, number string) (*obj.OrderDetails, error)
+}
+
+// OrderHandler returns a single order of the user. Orders of other users
+// are answered with 404 like unknown ones. The response carries an ETag,
+// so polling clients get 304 until the status or the accrual changes.
+func OrderHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store OrderProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in order handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		order, err := store.UserOrder(ctx, login, c.Param("number"))
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		tag := orderETag(order)
+		c.Header("ETag", tag)
+		c.Header("Cache-Control", "private, no-cache")
+		if etagMatch(c.GetHeader("If-None-Match"), tag) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// orderETag is a weak tag over the state clients poll for. The poll
+// counters change on every accrual request and are left out on purpose.
+func orderETag(o *obj.OrderDetails) string {
+	accrual := "-"
+	if o.Accrual != nil {
+		accrual = fmt.Sprint(*o.Accrual)
+	}
+	sum := sha256.Sum256([]byte(o.Number + "|" + o.Status + "|" + accrual + "|" + o.UploadAt.UTC().String()))
+	return `W/"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// etagMatch implements the weak comparison of If-None-Match.
+func etagMatch(header, tag string) bool {
+	if header == "" {
+		return false
+	}
+	tag = strings.TrimPrefix(tag, "W/")
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
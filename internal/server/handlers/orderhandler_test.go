@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type orderStore struct {
+	owners map[string]string
+	orders map[string]*obj.OrderDetails
+}
+
+func (s *orderStore) UserOrder(_ context.Context, login, number string) (*obj.OrderDetails, error) {
+	if s.owners[number] != login {
+		return nil, e.ErrIsOrderIsNotExist
+	}
+	return s.orders[number], nil
+}
+
+func TestOrderHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	accrual := float32(500)
+	checked := time.Now()
+	order := &obj.OrderDetails{
+		Order: obj.Order{
+			Number:   "12345678903",
+			Status:   obj.OrderStatusProcessed,
+			Accrual:  &accrual,
+			UploadAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		},
+		CheckedAt: &checked,
+		Polls:     3,
+	}
+	store := &orderStore{
+		owners: map[string]string{"12345678903": "alice", "2377225624": "bob"},
+		orders: map[string]*obj.OrderDetails{"12345678903": order},
+	}
+	tag := orderETag(order)
+
+	//polling must not change the tag
+	polled := *order
+	polled.Polls++
+	if orderETag(&polled) != tag {
+		t.Errorf("orderETag() changed with the poll count")
+	}
+
+	tests := []struct {
+		name        string
+		number      string
+		ifNoneMatch string
+		want        int
+	}{
+		{name: "found", number: "12345678903", want: http.StatusOK},
+		{name: "not modified", number: "12345678903", ifNoneMatch: tag, want: http.StatusNotModified},
+		{name: "not modified in list", number: "12345678903", ifNoneMatch: `"other", ` + tag, want: http.StatusNotModified},
+		{name: "stale tag", number: "12345678903", ifNoneMatch: `W/"other"`, want: http.StatusOK},
+		{name: "another user", number: "2377225624", want: http.StatusNotFound},
+		{name: "unknown", number: "79927398713", want: http.StatusNotFound},
+	}
+
+	r := gin.New()
+	r.GET(OrderHandlerPath, withLogin("alice"), OrderHandler(context.Background(), zap.NewNop().Sugar(), store))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/orders/"+tt.number, nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("OrderHandler() status = %v, want %v", w.Code, tt.want)
+			}
+			if w.Code < http.StatusBadRequest && w.Header().Get("ETag") != tag {
+				t.Errorf("OrderHandler() ETag = %q, want %q", w.Header().Get("ETag"), tag)
+			}
+		})
+	}
+}
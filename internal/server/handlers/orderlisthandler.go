@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	e "github.com/eqkez0r/gophermart/pkg/error"
-	"github.com/eqkez0r/gophermart/pkg/jwt"
 	obj "github.com/eqkez0r/gophermart/pkg/objects"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -16,7 +15,7 @@ const (
 )
 
 type OrderListProvider interface {
-	GetOrdersList(ctx context.Context, login string) ([]*obj.Order, error)
+	GetOrdersList(ctx context.Context, login string, filter *obj.ListFilter) ([]*obj.Order, error)
 }
 
 func OrderListHandler(
@@ -27,21 +26,28 @@ func OrderListHandler(
 	return func(c *gin.Context) {
 		const op = "Error in new order list handler: "
 
-		token := c.Request.Header.Get("Authorization")
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
 
-		login, _, err := jwt.JWTPayload(token)
+		filter, err := listFilter(c, orderStatuses)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusInternalServerError)
+			fail(c, err)
 			return
 		}
 
-		orders, err := store.GetOrdersList(ctx, login)
+		limit := pageLimit(filter)
+		orders, err := store.GetOrdersList(ctx, login, filter)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusInternalServerError)
+			fail(c, err)
 			return
 		}
+		orders = paginate(c, orders, limit, orderCursor)
 
 		if len(orders) == 0 {
 			logger.Error(e.Wrap(op, errors.New("no orders found")))
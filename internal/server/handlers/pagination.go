@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	NextCursorHeader = "X-Next-Cursor"
+
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+var orderStatuses = map[string]bool{
+	obj.OrderStatusNew:        true,
+	obj.OrderStatusProcessing: true,
+	obj.OrderStatusInvalid:    true,
+	obj.OrderStatusProcessed:  true,
+}
+
+var withdrawStatuses = map[string]bool{
+	obj.WithdrawStatusCompleted:         true,
+	obj.WithdrawStatusRefunded:          true,
+	obj.WithdrawStatusPartiallyRefunded: true,
+}
+
+// listFilter parses the cursor, limit, sort, status, from and to query
+// parameters of list endpoints. Statuses not in allowed are rejected,
+// a nil allowed set disables the status filter. Without a cursor and a
+// limit the whole list is returned, as before pagination was added.
+func listFilter(c *gin.Context, allowed map[string]bool) (*obj.ListFilter, error) {
+	filter := &obj.ListFilter{
+		Desc: true,
+	}
+
+	var err error
+	if v := c.Query("cursor"); v != "" {
+		if filter.After, err = decodeCursor(v); err != nil {
+			return nil, e.ErrInvalidRequest.WithDetail("invalid cursor").WithCause(err)
+		}
+		filter.Limit = defaultPageSize
+	}
+	if v := c.Query("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 1 || filter.Limit > maxPageSize {
+			return nil, e.ErrInvalidRequest.WithDetail(fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+		}
+	}
+	switch c.DefaultQuery("sort", "desc") {
+	case "desc":
+	case "asc":
+		filter.Desc = false
+	default:
+		return nil, e.ErrInvalidRequest.WithDetail("sort must be asc or desc")
+	}
+	if v := c.Query("from"); v != "" {
+		if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, e.ErrInvalidRequest.WithDetail("invalid from").WithCause(err)
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, e.ErrInvalidRequest.WithDetail("invalid to").WithCause(err)
+		}
+	}
+	//both status=NEW&status=PROCESSING and status=NEW,PROCESSING work
+	for _, v := range c.QueryArray("status") {
+		for _, s := range strings.Split(v, ",") {
+			if !allowed[s] {
+				return nil, e.ErrInvalidRequest.WithDetail(fmt.Sprintf("invalid status %q", s))
+			}
+			filter.Statuses = append(filter.Statuses, s)
+		}
+	}
+	return filter, nil
+}
+
+// pageLimit returns the page size of filter and asks storage for one item
+// more, the extra one only tells paginate that the next page exists.
+// Zero means an unpaginated list.
+func pageLimit(filter *obj.ListFilter) int {
+	limit := filter.Limit
+	if limit > 0 {
+		filter.Limit++
+	}
+	return limit
+}
+
+// paginate cuts items to limit and, if there were more, advertises the
+// next page in the Link and X-Next-Cursor headers.
+func paginate[T any](c *gin.Context, items []T, limit int, cursor func(T) *obj.Cursor) []T {
+	if limit == 0 || len(items) <= limit {
+		return items
+	}
+	items = items[:limit]
+	next := encodeCursor(cursor(items[limit-1]))
+
+	u := *c.Request.URL
+	q := u.Query()
+	q.Set("cursor", next)
+	u.RawQuery = q.Encode()
+	c.Header("Link", fmt.Sprintf(`<%s>; rel="next"`, u.RequestURI()))
+	c.Header(NextCursorHeader, next)
+	return items
+}
+
+func orderCursor(o *obj.Order) *obj.Cursor {
+	return &obj.Cursor{Time: o.UploadAt, Number: o.Number}
+}
+
+func withdrawCursor(w *obj.Withdraw) *obj.Cursor {
+	return &obj.Cursor{Time: w.ProcessedAt, Number: w.Order}
+}
+
+func encodeCursor(cur *obj.Cursor) string {
+	b, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*obj.Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	cur := &obj.Cursor{}
+	if err = json.Unmarshal(b, cur); err != nil {
+		return nil, err
+	}
+	return cur, nil
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// orderPageStore applies the list filter in memory the way the storage
+// queries do.
+type orderPageStore struct {
+	orders []*obj.Order
+}
+
+func (s *orderPageStore) GetOrdersList(_ context.Context, _ string, filter *obj.ListFilter) ([]*obj.Order, error) {
+	less := func(a, b *obj.Order) bool {
+		if !a.UploadAt.Equal(b.UploadAt) {
+			return a.UploadAt.Before(b.UploadAt)
+		}
+		return a.Number < b.Number
+	}
+	sorted := slices.Clone(s.orders)
+	slices.SortFunc(sorted, func(a, b *obj.Order) int {
+		switch {
+		case less(a, b) != filter.Desc:
+			return -1
+		default:
+			return 1
+		}
+	})
+
+	page := make([]*obj.Order, 0)
+	for _, o := range sorted {
+		if len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, o.Status) {
+			continue
+		}
+		if !filter.From.IsZero() && o.UploadAt.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && !o.UploadAt.Before(filter.To) {
+			continue
+		}
+		if filter.After != nil {
+			cur := &obj.Order{UploadAt: filter.After.Time, Number: filter.After.Number}
+			if filter.Desc && !less(o, cur) || !filter.Desc && !less(cur, o) {
+				continue
+			}
+		}
+		if filter.Limit > 0 && len(page) == filter.Limit {
+			break
+		}
+		page = append(page, o)
+	}
+	return page, nil
+}
+
+func TestOrderListHandlerPagination(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	store := &orderPageStore{orders: []*obj.Order{
+		{Number: "1", Status: obj.OrderStatusProcessed, UploadAt: base},
+		{Number: "2", Status: obj.OrderStatusNew, UploadAt: base.Add(time.Hour)},
+		//same upload time, the number breaks the tie
+		{Number: "3", Status: obj.OrderStatusProcessed, UploadAt: base.Add(2 * time.Hour)},
+		{Number: "4", Status: obj.OrderStatusInvalid, UploadAt: base.Add(2 * time.Hour)},
+		{Number: "5", Status: obj.OrderStatusProcessed, UploadAt: base.Add(3 * time.Hour)},
+	}}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "newest first", query: "limit=2", want: []string{"5", "4", "3", "2", "1"}},
+		{name: "oldest first", query: "limit=2&sort=asc", want: []string{"1", "2", "3", "4", "5"}},
+		{name: "unpaginated", query: "", want: []string{"5", "4", "3", "2", "1"}},
+		{name: "unpaginated oldest first", query: "sort=asc", want: []string{"1", "2", "3", "4", "5"}},
+		{name: "status", query: "limit=1&status=PROCESSED", want: []string{"5", "3", "1"}},
+		{name: "statuses", query: "limit=1&status=NEW,INVALID", want: []string{"4", "2"}},
+		{
+			name:  "date range",
+			query: "limit=1&sort=asc&from=2024-05-01T11:00:00Z&to=2024-05-01T13:00:00Z",
+			want:  []string{"2", "3", "4"},
+		},
+	}
+
+	r := gin.New()
+	r.GET(OrderListHandlerPath, withLogin("alice"), OrderListHandler(context.Background(), zap.NewNop().Sugar(), store))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			url := OrderListHandlerPath + "?" + tt.query
+			for pages := 0; url != ""; pages++ {
+				if pages > len(store.orders) {
+					t.Fatalf("OrderListHandler() does not stop paginating")
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+				if w.Code != http.StatusOK {
+					t.Fatalf("OrderListHandler() status = %v, want %v", w.Code, http.StatusOK)
+				}
+				var orders []*obj.Order
+				if err := json.Unmarshal(w.Body.Bytes(), &orders); err != nil {
+					t.Fatalf("OrderListHandler() body: %v", err)
+				}
+				for _, o := range orders {
+					got = append(got, o.Number)
+				}
+
+				url = ""
+				if link := w.Header().Get("Link"); link != "" {
+					url = strings.TrimPrefix(strings.Split(link, ">")[0], "<")
+					if w.Header().Get(NextCursorHeader) == "" {
+						t.Errorf("OrderListHandler() Link without %s", NextCursorHeader)
+					}
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("OrderListHandler() orders = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+	}{
+		{name: "defaults", query: ""},
+		{name: "all parameters", query: "limit=10&sort=asc&status=NEW&from=2024-01-01T00:00:00Z&to=2024-02-01T00:00:00Z&cursor=" +
+			encodeCursor(&obj.Cursor{Time: time.Now(), Number: "12345678903"})},
+		{name: "zero limit", query: "limit=0", wantErr: true},
+		{name: "huge limit", query: "limit=100000", wantErr: true},
+		{name: "sort", query: "sort=up", wantErr: true},
+		{name: "status", query: "status=DONE", wantErr: true},
+		{name: "from", query: "from=yesterday", wantErr: true},
+		{name: "cursor", query: "cursor=not-a-cursor", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+			_, err := listFilter(c, orderStatuses)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("listFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+const (
+	ReferralsHandlerPath = "/referrals"
+)
+
+type ReferralsProvider interface {
+	Referrals(ctx context.Context, login string) (*obj.Referrals, error)
+}
+
+// ReferralsHandler returns the referral code of the user to share and the
+// users who signed up with it.
+func ReferralsHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store ReferralsProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in referrals handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		referrals, err := store.Referrals(ctx, login)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, referrals)
+	}
+}
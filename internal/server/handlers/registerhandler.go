@@ -3,7 +3,7 @@ package handlers
 import (
 	"context"
 	"errors"
-	"fmt"
+	"github.com/eqkez0r/gophermart/internal/server/middleware"
 	e "github.com/eqkez0r/gophermart/pkg/error"
 	"github.com/eqkez0r/gophermart/pkg/jwt"
 	obj "github.com/eqkez0r/gophermart/pkg/objects"
@@ -18,69 +18,78 @@ const (
 	RegisterHandlerPath = "/register"
 )
 
-var (
-	errInvalidFormat = errors.New("invalid format request")
-)
-
 type NewUserProvider interface {
-	NewUser(context.Context, *obj.User) error
+	NewUser(context.Context, *obj.User, *obj.ReferralTerms) error
 	GetLastUserID(context.Context) (uint64, error)
 }
 
+// RegisterHandler creates the user and starts a session. A referral code
+// of another user is optional, the referral is made with the given terms.
 func RegisterHandler(
 	ctx context.Context,
 	logger *zap.SugaredLogger,
 	storage NewUserProvider,
+	session middleware.SessionConfig,
+	terms obj.ReferralTerms,
 ) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		const op = "Error in register handler: "
 		newUser := &obj.User{}
 		if c.ContentType() != "application/json" {
-			logger.Error(e.Wrap(op, errInvalidFormat))
-			c.Status(http.StatusBadRequest)
+			logger.Error(e.Wrap(op, e.ErrInvalidContentType))
+			fail(c, e.ErrInvalidContentType)
 			return
 		}
-		err := c.BindJSON(newUser)
+		err := c.ShouldBindJSON(newUser)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusInternalServerError)
+			fail(c, e.ErrInvalidRequest.WithCause(err))
 			return
 		}
 		if newUser.Login == "" || newUser.Password == "" {
-			logger.Error(e.Wrap(op, fmt.Errorf("empty field")))
-			c.Status(http.StatusBadRequest)
+			err = e.ErrInvalidRequest.WithDetail("login and password are required")
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
 			return
 		}
 		newUser.Password, err = hash.HashPassword(newUser.Password)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusInternalServerError)
+			fail(c, err)
 			return
 		}
-		err = storage.NewUser(ctx, newUser)
+		err = storage.NewUser(auditContext(ctx, c), newUser, &terms)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
+			if errors.Is(err, e.ErrReferralCodeInvalid) {
+				fail(c, err)
+				return
+			}
 			var pgErr *pgconn.PgError
 			if errors.As(err, &pgErr) {
 				logger.Info(err, pgErr)
 				if pgErr.Code == "23505" {
 					logger.Error(e.Wrap(op, pgErr))
-					c.Status(http.StatusConflict)
+					fail(c, e.ErrLoginTaken.WithCause(pgErr))
 					return
 				}
 			}
-			c.Status(http.StatusInternalServerError)
+			fail(c, err)
 			return
 		}
 
-		token, err := jwt.CreateJWT(newUser.Login)
+		token, err := jwt.CreateJWT(newUser.Login, obj.RoleUser)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusInternalServerError)
+			fail(c, err)
 			return
 		}
 
-		c.Header("Authorization", token)
+		if err = middleware.SetSession(c, session, token); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
 		c.Status(http.StatusOK)
 	}
 }
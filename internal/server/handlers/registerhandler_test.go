@@ -1 +1,132 @@
 package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/eqkez0r/gophermart/internal/server/middleware"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type registerStore struct {
+	codes map[string]string
+	terms *obj.ReferralTerms
+	user  *obj.User
+}
+
+func (s *registerStore) NewUser(_ context.Context, user *obj.User, terms *obj.ReferralTerms) error {
+	if user.ReferralCode != "" && s.codes[user.ReferralCode] == "" {
+		return e.ErrReferralCodeInvalid
+	}
+	s.user, s.terms = user, terms
+	return nil
+}
+
+func (s *registerStore) GetLastUserID(context.Context) (uint64, error) {
+	return 1, nil
+}
+
+func TestRegisterHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	terms := obj.ReferralTerms{ReferrerBonus: 100, RefereeBonus: 50, MaxReferrals: 10}
+	tests := []struct {
+		name     string
+		body     string
+		want     int
+		wantCode string
+	}{
+		{name: "without referral", body: `{"login":"bob","password":"secret"}`, want: http.StatusOK},
+		{name: "with referral", body: `{"login":"bob","password":"secret","referral_code":"ALICE12345"}`,
+			want: http.StatusOK, wantCode: "ALICE12345"},
+		{name: "unknown referral", body: `{"login":"bob","password":"secret","referral_code":"NOPE"}`,
+			want: http.StatusUnprocessableEntity},
+		{name: "missing password", body: `{"login":"bob"}`, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &registerStore{codes: map[string]string{"ALICE12345": "alice"}}
+			r := gin.New()
+			r.POST(RegisterHandlerPath, RegisterHandler(context.Background(), zap.NewNop().Sugar(), store,
+				middleware.SessionConfig{Mode: middleware.AuthModeHeader}, terms))
+
+			req := httptest.NewRequest(http.MethodPost, RegisterHandlerPath, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("RegisterHandler() status = %v, want %v", w.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			if store.user.ReferralCode != tt.wantCode {
+				t.Errorf("RegisterHandler() referral code = %q, want %q", store.user.ReferralCode, tt.wantCode)
+			}
+			if *store.terms != terms {
+				t.Errorf("RegisterHandler() terms = %+v, want %+v", *store.terms, terms)
+			}
+			if store.user.Password == "secret" {
+				t.Errorf("RegisterHandler() stored the plain password")
+			}
+		})
+	}
+}
+
+type referralsStore struct{}
+
+func (referralsStore) Referrals(_ context.Context, login string) (*obj.Referrals, error) {
+	if login != "alice" {
+		return nil, e.ErrUserNotFound
+	}
+	rewarded := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+	return &obj.Referrals{Code: "ALICE12345", Referrals: []*obj.Referral{
+		{Login: "bob", Status: obj.ReferralStatusRewarded, Bonus: 100, CreatedAt: rewarded.Add(-24 * time.Hour), RewardedAt: &rewarded},
+		{Login: "mallory", Status: obj.ReferralStatusRejected, Reason: obj.ReferralRejectedSameIP, CreatedAt: rewarded},
+	}}, nil
+}
+
+func TestReferralsHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name  string
+		login string
+		want  int
+	}{
+		{name: "listing", login: "alice", want: http.StatusOK},
+		{name: "unknown user", login: "ghost", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET(ReferralsHandlerPath, withLogin(tt.login), ReferralsHandler(context.Background(), zap.NewNop().Sugar(), referralsStore{}))
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, ReferralsHandlerPath, nil))
+
+			if w.Code != tt.want {
+				t.Fatalf("ReferralsHandler() status = %v, want %v", w.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			got := &obj.Referrals{}
+			if err := json.Unmarshal(w.Body.Bytes(), got); err != nil {
+				t.Fatalf("ReferralsHandler() body: %v", err)
+			}
+			if got.Code != "ALICE12345" || len(got.Referrals) != 2 || got.Referrals[1].Reason != obj.ReferralRejectedSameIP {
+				t.Errorf("ReferralsHandler() = %+v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"github.com/eqkez0r/gophermart/internal/statements"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+const (
+	StatementsHandlerPath = "/statements"
+	StatementHandlerPath  = "/statements/:month"
+
+	statementFormatJSON = "json"
+	statementFormatText = "text"
+	statementFormatHTML = "html"
+)
+
+type StatementsProvider interface {
+	Statements(ctx context.Context, login string) ([]*obj.Statement, error)
+}
+
+type StatementProvider interface {
+	Statement(ctx context.Context, login string, month time.Time) (*obj.Statement, error)
+}
+
+// StatementsHandler lists the monthly statements of the user, the latest
+// month first.
+func StatementsHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store StatementsProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in statements handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		list, err := store.Statements(ctx, login)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		if len(list) == 0 {
+			logger.Infof("No statements for user %s", login)
+			c.Status(http.StatusNoContent)
+			return
+		}
+
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// StatementHandler returns the statement of a month given as yyyy-mm.
+// The format query parameter or the Accept header selects JSON, plain
+// text or HTML, the latter two are meant for printing.
+func StatementHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store StatementProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in statement handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		month, err := time.Parse(obj.StatementMonthLayout, c.Param("month"))
+		if err != nil {
+			err = e.ErrInvalidRequest.WithDetail("month must be yyyy-mm").WithCause(err)
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		format, err := statementFormat(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		statement, err := store.Statement(ctx, login, month)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		var (
+			buf         bytes.Buffer
+			contentType string
+		)
+		switch format {
+		case statementFormatText:
+			contentType = "text/plain; charset=utf-8"
+			err = statements.RenderText(&buf, login, statement)
+		case statementFormatHTML:
+			contentType = "text/html; charset=utf-8"
+			err = statements.RenderHTML(&buf, login, statement)
+		default:
+			c.JSON(http.StatusOK, statement)
+			return
+		}
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+		c.Data(http.StatusOK, contentType, buf.Bytes())
+	}
+}
+
+// statementFormat takes the format query parameter and falls back to the
+// Accept header, JSON is the default.
+func statementFormat(c *gin.Context) (string, error) {
+	switch format := c.Query("format"); format {
+	case statementFormatJSON, statementFormatText, statementFormatHTML:
+		return format, nil
+	case "":
+	default:
+		return "", e.ErrInvalidRequest.WithDetail("format must be json, text or html")
+	}
+	switch c.NegotiateFormat(gin.MIMEJSON, gin.MIMEPlain, gin.MIMEHTML) {
+	case gin.MIMEPlain:
+		return statementFormatText, nil
+	case gin.MIMEHTML:
+		return statementFormatHTML, nil
+	}
+	return statementFormatJSON, nil
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type statementStore struct {
+	statements map[string]*obj.Statement
+}
+
+func (s *statementStore) Statement(_ context.Context, _ string, month time.Time) (*obj.Statement, error) {
+	st, ok := s.statements[month.Format(obj.StatementMonthLayout)]
+	if !ok {
+		return nil, e.ErrStatementNotFound
+	}
+	return st, nil
+}
+
+func TestStatementHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := &statementStore{statements: map[string]*obj.Statement{
+		"2024-05": {
+			Month:       "2024-05",
+			Opening:     100,
+			Accruals:    500,
+			Withdrawals: 150.5,
+			Closing:     449.5,
+			GeneratedAt: time.Date(2024, 6, 1, 0, 10, 0, 0, time.UTC),
+		},
+	}}
+
+	tests := []struct {
+		name        string
+		month       string
+		query       string
+		accept      string
+		want        int
+		contentType string
+		contains    string
+	}{
+		{name: "json", month: "2024-05", want: http.StatusOK, contentType: "application/json"},
+		{name: "text", month: "2024-05", query: "format=text", want: http.StatusOK,
+			contentType: "text/plain", contains: "-150.50"},
+		{name: "html by accept", month: "2024-05", accept: "text/html", want: http.StatusOK,
+			contentType: "text/html", contains: "<td class=\"amount\">449.50</td>"},
+		{name: "format wins over accept", month: "2024-05", query: "format=json", accept: "text/html",
+			want: http.StatusOK, contentType: "application/json"},
+		{name: "unknown format", month: "2024-05", query: "format=pdf", want: http.StatusBadRequest},
+		{name: "invalid month", month: "2024-5", want: http.StatusBadRequest},
+		{name: "not found", month: "2024-04", want: http.StatusNotFound},
+	}
+
+	r := gin.New()
+	r.GET(StatementHandlerPath, withLogin("alice"), StatementHandler(context.Background(), zap.NewNop().Sugar(), store))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/statements/"+tt.month+"?"+tt.query, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("StatementHandler() status = %v, want %v", w.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.contentType) {
+				t.Errorf("StatementHandler() content type = %v, want %v", ct, tt.contentType)
+			}
+			if tt.contentType == "application/json" {
+				got := &obj.Statement{}
+				if err := json.Unmarshal(w.Body.Bytes(), got); err != nil {
+					t.Fatalf("StatementHandler() body: %v", err)
+				}
+				if got.Closing != 449.5 {
+					t.Errorf("StatementHandler() closing = %v, want 449.5", got.Closing)
+				}
+			}
+			if !strings.Contains(w.Body.String(), tt.contains) {
+				t.Errorf("StatementHandler() body = %q, want %q", w.Body.String(), tt.contains)
+			}
+		})
+	}
+}
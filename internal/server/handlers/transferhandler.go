@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+const (
+	TransferHandlerPath  = "/transfer"
+	TransfersHandlerPath = "/transfers"
+
+	maxTransferNoteLength = 200
+)
+
+type TransferProvider interface {
+	Transfer(ctx context.Context, from, to string, amount, dailyLimit float32, note string, rules *obj.WithdrawRules) (*obj.Transfer, error)
+	GetTOTP(context.Context, string) (*obj.TOTP, error)
+}
+
+type TransfersProvider interface {
+	Transfers(ctx context.Context, login string) ([]*obj.Transfer, error)
+}
+
+// TransferPolicy limits the points a user sends per UTC day, a zero
+// DailyLimit means no limit. Transfers above the step-up threshold need a
+// recent 2FA verification like withdrawals.
+type TransferPolicy struct {
+	DailyLimit float32
+	StepUp     StepUpPolicy
+}
+
+// TransferHandler moves points of the user to another user. Transfers
+// are checked against the withdraw rules and count toward their caps, so
+// they can't be used to drain an account past them.
+func TransferHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store TransferProvider,
+	policy TransferPolicy,
+	rules *obj.WithdrawRules,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in transfer handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		req := &obj.TransferRequest{}
+		if err = c.ShouldBindJSON(req); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, e.ErrInvalidRequest.WithCause(err))
+			return
+		}
+		switch {
+		case req.To == "":
+			err = e.ErrInvalidRequest.WithDetail("recipient is required")
+		case req.To == login:
+			err = e.ErrInvalidRequest.WithDetail("can't transfer to yourself")
+		case req.Amount <= 0:
+			err = e.ErrInvalidRequest.WithDetail("amount must be positive")
+		case len([]rune(req.Note)) > maxTransferNoteLength:
+			err = e.ErrInvalidRequest.WithDetail("note is too long")
+		}
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		if policy.StepUp.Threshold > 0 && req.Amount > policy.StepUp.Threshold {
+			t, err := store.GetTOTP(ctx, login)
+			if err != nil {
+				logger.Error(e.Wrap(op, err))
+				fail(c, err)
+				return
+			}
+			if t.Enabled && !freshMFA(mfaVerifiedAt(c), policy.StepUp.MaxAge) {
+				logger.Error(e.Wrap(op, e.ErrStepUpRequired))
+				fail(c, e.ErrStepUpRequired)
+				return
+			}
+		}
+
+		transfer, err := store.Transfer(auditContext(ctx, c), login, req.To, req.Amount, policy.DailyLimit, req.Note, rules)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			logWithdrawRuleHit(logger, login, req.Amount, err)
+			fail(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, transfer)
+	}
+}
+
+// TransfersHandler lists the transfers sent and received by the user.
+func TransfersHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store TransfersProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in transfers handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		transfers, err := store.Transfers(ctx, login)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		if len(transfers) == 0 {
+			logger.Infof("No transfers for user %s", login)
+			c.Status(http.StatusNoContent)
+			return
+		}
+
+		c.JSON(http.StatusOK, transfers)
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/eqkez0r/gophermart/internal/limits"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type transferStore struct {
+	balances map[string]float32
+	blocked  map[string]bool
+	sent     float32
+	totp     bool
+}
+
+func (s *transferStore) Transfer(_ context.Context, from, to string, amount, dailyLimit float32, note string, rules *obj.WithdrawRules) (*obj.Transfer, error) {
+	if _, ok := s.balances[to]; !ok {
+		return nil, e.ErrUserNotFound
+	}
+	if s.blocked[to] {
+		return nil, e.ErrUserBlocked
+	}
+	if s.balances[from] < amount {
+		return nil, e.ErrBalanceIsNotEnough
+	}
+	if dailyLimit > 0 && s.sent+amount > dailyLimit {
+		return nil, e.ErrTransferLimitExceeded
+	}
+	if err := limits.Check(rules, &obj.WithdrawActivity{Day: s.sent}, amount, time.Now()); err != nil {
+		return nil, err
+	}
+	s.balances[from] -= amount
+	s.balances[to] += amount
+	s.sent += amount
+	return &obj.Transfer{TransferID: 1, Direction: obj.TransferDirectionOut, Counterparty: to, Amount: amount, Note: note}, nil
+}
+
+func (s *transferStore) GetTOTP(context.Context, string) (*obj.TOTP, error) {
+	return &obj.TOTP{Enabled: s.totp}, nil
+}
+
+func TestTransferHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name         string
+		body         string
+		sent         float32
+		totp         bool
+		want         int
+		wantBalances map[string]float32
+	}{
+		{name: "transfer", body: `{"to":"bob","amount":100,"note":"for groceries"}`, want: http.StatusOK,
+			wantBalances: map[string]float32{"alice": 400, "bob": 100}},
+		{name: "whole balance", body: `{"to":"bob","amount":500}`, want: http.StatusOK,
+			wantBalances: map[string]float32{"alice": 0, "bob": 500}},
+		{name: "not enough", body: `{"to":"bob","amount":500.01}`, want: http.StatusPaymentRequired},
+		{name: "daily limit", body: `{"to":"bob","amount":100}`, sent: 950, want: http.StatusUnprocessableEntity},
+		{name: "unknown recipient", body: `{"to":"ghost","amount":1}`, want: http.StatusNotFound},
+		{name: "blocked recipient", body: `{"to":"mallory","amount":1}`, want: http.StatusForbidden},
+		{name: "to yourself", body: `{"to":"alice","amount":1}`, want: http.StatusBadRequest},
+		{name: "zero amount", body: `{"to":"bob","amount":0}`, want: http.StatusBadRequest},
+		{name: "negative amount", body: `{"to":"bob","amount":-10}`, want: http.StatusBadRequest},
+		{name: "no recipient", body: `{"amount":10}`, want: http.StatusBadRequest},
+		{name: "withdraw daily cap", body: `{"to":"bob","amount":100}`, sent: 550, want: http.StatusUnprocessableEntity},
+		{name: "step-up", body: `{"to":"bob","amount":300}`, totp: true, want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &transferStore{
+				balances: map[string]float32{"alice": 500, "bob": 0, "mallory": 0},
+				blocked:  map[string]bool{"mallory": true},
+				sent:     tt.sent,
+				totp:     tt.totp,
+			}
+			r := gin.New()
+			r.POST(TransferHandlerPath, withLogin("alice"), TransferHandler(context.Background(), zap.NewNop().Sugar(), store,
+				TransferPolicy{DailyLimit: 1000, StepUp: StepUpPolicy{Threshold: 200, MaxAge: time.Minute}},
+				&obj.WithdrawRules{DailyCap: 600}))
+
+			req := httptest.NewRequest(http.MethodPost, TransferHandlerPath, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("TransferHandler() status = %v, want %v", w.Code, tt.want)
+			}
+			for login, want := range tt.wantBalances {
+				if store.balances[login] != want {
+					t.Errorf("TransferHandler() balance of %s = %v, want %v", login, store.balances[login], want)
+				}
+			}
+			if tt.want != http.StatusOK {
+				if store.balances["alice"] != 500 {
+					t.Errorf("TransferHandler() changed the balance on failure")
+				}
+				return
+			}
+			got := &obj.Transfer{}
+			if err := json.Unmarshal(w.Body.Bytes(), got); err != nil {
+				t.Fatalf("TransferHandler() body: %v", err)
+			}
+			if got.Direction != obj.TransferDirectionOut || got.Counterparty != "bob" {
+				t.Errorf("TransferHandler() = %+v", got)
+			}
+		})
+	}
+}
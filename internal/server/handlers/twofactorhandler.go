@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"context"
+	"github.com/eqkez0r/gophermart/internal/server/middleware"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	"github.com/eqkez0r/gophermart/pkg/jwt"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/eqkez0r/gophermart/utils/hash"
+	"github.com/eqkez0r/gophermart/utils/totp"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	TOTPEnrollHandlerPath     = "/2fa/enroll"
+	TOTPConfirmHandlerPath    = "/2fa/confirm"
+	TOTPVerifyHandlerPath     = "/2fa/verify"
+	TwoFactorLoginHandlerPath = "/login/2fa"
+
+	totpIssuer         = "Gophermart"
+	recoveryCodesCount = 10
+
+	//after maxSecondFactorFailures invalid codes in a row the challenge is
+	//invalidated and the user is locked out for secondFactorLockout
+	maxSecondFactorFailures = 5
+	secondFactorLockout     = 15 * time.Minute
+)
+
+type TOTPEnrollProvider interface {
+	SetTOTPSecret(context.Context, string, string) error
+}
+
+type TOTPConfirmProvider interface {
+	GetTOTP(context.Context, string) (*obj.TOTP, error)
+	EnableTOTP(context.Context, string, int64, []string) error
+}
+
+type SecondFactorProvider interface {
+	GetTOTP(context.Context, string) (*obj.TOTP, error)
+	UseRecoveryCode(context.Context, string, string) (bool, error)
+	UseTOTPCounter(context.Context, string, int64) (bool, error)
+	SecondFactorFailed(context.Context, string, string, int, time.Time) error
+	ChallengeFailures(context.Context, string) (int, error)
+	UseChallenge(context.Context, string) (bool, error)
+	GetUserInfo(context.Context, string) (*obj.UserInfo, error)
+	AuditRecordProvider
+}
+
+func TOTPEnrollHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store TOTPEnrollProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in totp enroll handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		if err = store.SetTOTPSecret(ctx, login, secret); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, &obj.TOTPEnrolment{
+			Secret: secret,
+			URI:    totp.URI(totpIssuer, login, secret),
+		})
+	}
+}
+
+func TOTPConfirmHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store TOTPConfirmProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in totp confirm handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		req := &obj.TwoFactorCode{}
+		if err = c.ShouldBindJSON(req); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, e.ErrInvalidRequest.WithCause(err))
+			return
+		}
+
+		t, err := store.GetTOTP(ctx, login)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+		if t.Enabled {
+			logger.Error(e.Wrap(op, e.ErrTOTPAlreadyEnabled))
+			fail(c, e.ErrTOTPAlreadyEnabled)
+			return
+		}
+		if t.Secret == "" {
+			logger.Error(e.Wrap(op, e.ErrTOTPNotEnrolled))
+			fail(c, e.ErrTOTPNotEnrolled)
+			return
+		}
+		counter, ok := totp.Verify(t.Secret, req.Code, time.Now(), t.LastCounter)
+		if !ok {
+			logger.Error(e.Wrap(op, e.ErrTOTPCodeInvalid))
+			fail(c, e.ErrTOTPCodeInvalid)
+			return
+		}
+
+		codes, err := totp.RecoveryCodes(recoveryCodesCount)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+		hashes := make([]string, 0, len(codes))
+		for _, code := range codes {
+			hashes = append(hashes, hash.HashToken(code))
+		}
+
+		if err = store.EnableTOTP(ctx, login, counter, hashes); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, &obj.RecoveryCodes{Codes: codes})
+	}
+}
+
+// TwoFactorLoginHandler exchanges a challenge token issued by AuthHandler
+// and a valid TOTP or recovery code for an access token. A challenge is
+// exchanged once.
+func TwoFactorLoginHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store SecondFactorProvider,
+	session middleware.SessionConfig,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in two factor login handler: "
+
+		req := &obj.TwoFactorCode{}
+		if err := c.ShouldBindJSON(req); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, e.ErrInvalidRequest.WithCause(err))
+			return
+		}
+
+		challenge, err := jwt.ChallengeClaims(req.Challenge)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, e.ErrUnauthorized.WithCause(err))
+			return
+		}
+
+		issueMFAToken(ctx, c, logger, store, session, op, challenge.Login, challenge.ID, req)
+	}
+}
+
+// TOTPVerifyHandler is the step-up verification for an already logged in
+// user. The returned token carries a fresh 2FA timestamp.
+func TOTPVerifyHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store SecondFactorProvider,
+	session middleware.SessionConfig,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in totp verify handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		req := &obj.TwoFactorCode{}
+		if err = c.ShouldBindJSON(req); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, e.ErrInvalidRequest.WithCause(err))
+			return
+		}
+
+		issueMFAToken(ctx, c, logger, store, session, op, login, "", req)
+	}
+}
+
+// issueMFAToken checks the second factor of login, entered for the login
+// challenge challengeID or, if it is empty, for a step-up verification.
+// Invalid codes are counted, see maxSecondFactorFailures, and the challenge
+// is used up by a valid one.
+func issueMFAToken(
+	ctx context.Context,
+	c *gin.Context,
+	logger *zap.SugaredLogger,
+	store SecondFactorProvider,
+	session middleware.SessionConfig,
+	op, login, challengeID string,
+	req *obj.TwoFactorCode,
+) {
+	now := time.Now()
+	t, err := store.GetTOTP(ctx, login)
+	if err != nil {
+		logger.Error(e.Wrap(op, err))
+		fail(c, err)
+		return
+	}
+	if !t.Enabled {
+		logger.Error(e.Wrap(op, e.ErrTOTPNotEnrolled))
+		fail(c, e.ErrTOTPNotEnrolled)
+		return
+	}
+	if t.LockedUntil.After(now) {
+		logger.Error(e.Wrap(op, e.ErrSecondFactorLocked))
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(t.LockedUntil.Sub(now).Seconds()))))
+		fail(c, e.ErrSecondFactorLocked)
+		return
+	}
+	if challengeID != "" {
+		failures, err := store.ChallengeFailures(ctx, challengeID)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+		if failures >= maxSecondFactorFailures {
+			logger.Error(e.Wrap(op, e.ErrChallengeInvalid))
+			fail(c, e.ErrChallengeInvalid)
+			return
+		}
+	}
+
+	ok, err := checkSecondFactor(ctx, store, login, t, req, now)
+	if err != nil {
+		logger.Error(e.Wrap(op, err))
+		fail(c, err)
+		return
+	}
+	if !ok {
+		logger.Error(e.Wrap(op, e.ErrInvalidSecondFactor))
+		auditLogin(ctx, c, logger, store, login, http.StatusUnauthorized, "invalid second factor")
+		err = store.SecondFactorFailed(ctx, login, challengeID, maxSecondFactorFailures, now.Add(secondFactorLockout))
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+		fail(c, e.ErrInvalidSecondFactor)
+		return
+	}
+	if challengeID != "" {
+		used, err := store.UseChallenge(ctx, challengeID)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+		if !used {
+			logger.Error(e.Wrap(op, e.ErrChallengeInvalid))
+			fail(c, e.ErrChallengeInvalid)
+			return
+		}
+	}
+
+	user, err := store.GetUserInfo(ctx, login)
+	if err != nil {
+		logger.Error(e.Wrap(op, err))
+		fail(c, err)
+		return
+	}
+	if user.Blocked {
+		logger.Error(e.Wrap(op, e.ErrUserBlocked))
+		fail(c, e.ErrUserBlocked)
+		return
+	}
+
+	token, err := jwt.CreateMFAJWT(login, user.Role)
+	if err != nil {
+		logger.Error(e.Wrap(op, err))
+		fail(c, err)
+		return
+	}
+
+	auditLogin(ctx, c, logger, store, login, http.StatusOK, "second factor verified")
+	if err = middleware.SetSession(c, session, token); err != nil {
+		logger.Error(e.Wrap(op, err))
+		fail(c, err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// checkSecondFactor uses up the recovery code or the TOTP period of the
+// code, so neither is accepted twice.
+func checkSecondFactor(
+	ctx context.Context,
+	store SecondFactorProvider,
+	login string,
+	t *obj.TOTP,
+	req *obj.TwoFactorCode,
+	now time.Time,
+) (bool, error) {
+	if req.RecoveryCode != "" {
+		return store.UseRecoveryCode(ctx, login, hash.HashToken(req.RecoveryCode))
+	}
+	counter, ok := totp.Verify(t.Secret, req.Code, now, t.LastCounter)
+	if !ok {
+		return false, nil
+	}
+	return store.UseTOTPCounter(ctx, login, counter)
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/eqkez0r/gophermart/internal/server/middleware"
+	"github.com/eqkez0r/gophermart/pkg/jwt"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/eqkez0r/gophermart/utils/hash"
+	"github.com/eqkez0r/gophermart/utils/totp"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type secondFactorStore struct {
+	totp       *obj.TOTP
+	recovery   map[string]bool
+	failures   int
+	challenges map[string]int
+	used       map[string]bool
+}
+
+func (s *secondFactorStore) GetTOTP(context.Context, string) (*obj.TOTP, error) {
+	return s.totp, nil
+}
+
+func (s *secondFactorStore) UseRecoveryCode(_ context.Context, _ string, codeHash string) (bool, error) {
+	if s.recovery[codeHash] {
+		delete(s.recovery, codeHash)
+		return true, nil
+	}
+	return false, nil
+}
+
+func (s *secondFactorStore) UseTOTPCounter(_ context.Context, _ string, counter int64) (bool, error) {
+	if counter <= s.totp.LastCounter {
+		return false, nil
+	}
+	s.totp.LastCounter, s.failures = counter, 0
+	return true, nil
+}
+
+func (s *secondFactorStore) SecondFactorFailed(_ context.Context, _, challengeID string, maxFailures int, lockedUntil time.Time) error {
+	if s.failures++; s.failures >= maxFailures {
+		s.totp.LockedUntil, s.failures = lockedUntil, 0
+	}
+	if challengeID != "" {
+		s.challenges[challengeID]++
+	}
+	return nil
+}
+
+func (s *secondFactorStore) ChallengeFailures(_ context.Context, challengeID string) (int, error) {
+	return s.challenges[challengeID], nil
+}
+
+func (s *secondFactorStore) UseChallenge(_ context.Context, challengeID string) (bool, error) {
+	if s.used[challengeID] {
+		return false, nil
+	}
+	s.used[challengeID] = true
+	return true, nil
+}
+
+func (s *secondFactorStore) GetUserInfo(_ context.Context, login string) (*obj.UserInfo, error) {
+	return &obj.UserInfo{Login: login, Role: obj.RoleUser}, nil
+}
+
+func (s *secondFactorStore) NewAuditRecord(context.Context, *obj.AuditRecord) error {
+	return nil
+}
+
+func TestTwoFactorLoginHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.Code(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var challenges [3]string
+	for i := range challenges {
+		if challenges[i], _, err = jwt.CreateChallengeJWT("alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	challenge := challenges[0]
+	access, err := jwt.CreateJWT("alice", obj.RoleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		req  obj.TwoFactorCode
+		want int
+	}{
+		{name: "valid code", req: obj.TwoFactorCode{Challenge: challenge, Code: code}, want: http.StatusOK},
+		{name: "replayed code", req: obj.TwoFactorCode{Challenge: challenge, Code: code}, want: http.StatusUnauthorized},
+		{name: "invalid code", req: obj.TwoFactorCode{Challenge: challenge, Code: "000000"}, want: http.StatusUnauthorized},
+		{name: "recovery code", req: obj.TwoFactorCode{Challenge: challenges[1], RecoveryCode: "abcde-fghij"}, want: http.StatusOK},
+		{name: "recovery code reused", req: obj.TwoFactorCode{Challenge: challenges[2], RecoveryCode: "abcde-fghij"}, want: http.StatusUnauthorized},
+		{name: "challenge reused", req: obj.TwoFactorCode{Challenge: challenge, RecoveryCode: "klmno-pqrst"}, want: http.StatusUnauthorized},
+		{name: "access token as challenge", req: obj.TwoFactorCode{Challenge: access, Code: code}, want: http.StatusUnauthorized},
+	}
+
+	store := &secondFactorStore{
+		totp:       &obj.TOTP{Secret: secret, Enabled: true},
+		recovery:   map[string]bool{hash.HashToken("abcde-fghij"): true, hash.HashToken("klmno-pqrst"): true},
+		challenges: map[string]int{},
+		used:       map[string]bool{},
+	}
+	r := gin.New()
+	r.POST(TwoFactorLoginHandlerPath, TwoFactorLoginHandler(context.Background(), zap.NewNop().Sugar(), store, middleware.SessionConfig{Mode: middleware.AuthModeHeader}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.req)
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, TwoFactorLoginHandlerPath, bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("TwoFactorLoginHandler() status = %v, want %v", w.Code, tt.want)
+			}
+			if tt.want == http.StatusOK {
+				claims, err := jwt.ParseClaims(w.Header().Get("Authorization"))
+				if err != nil || claims.MFAVerifiedAt == nil {
+					t.Errorf("TwoFactorLoginHandler() token without mfa timestamp: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestTwoFactorLoginHandlerLockout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.Code(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &secondFactorStore{
+		totp:       &obj.TOTP{Secret: secret, Enabled: true},
+		challenges: map[string]int{},
+		used:       map[string]bool{},
+	}
+	r := gin.New()
+	r.POST(TwoFactorLoginHandlerPath, TwoFactorLoginHandler(context.Background(), zap.NewNop().Sugar(), store, middleware.SessionConfig{Mode: middleware.AuthModeHeader}))
+
+	login := func(challenge, code string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(obj.TwoFactorCode{Challenge: challenge, Code: code})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, TwoFactorLoginHandlerPath, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+	newChallenge := func() string {
+		challenge, _, err := jwt.CreateChallengeJWT("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return challenge
+	}
+
+	challenge := newChallenge()
+	for i := 0; i < maxSecondFactorFailures-1; i++ {
+		if w := login(challenge, "000000"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("TwoFactorLoginHandler() status = %v, want %v", w.Code, http.StatusUnauthorized)
+		}
+	}
+	//the user is locked out on the last failure, even with a valid code
+	//and a new challenge
+	if w := login(challenge, "000000"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("TwoFactorLoginHandler() status = %v, want %v", w.Code, http.StatusUnauthorized)
+	}
+	w := login(newChallenge(), code)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("TwoFactorLoginHandler() status = %v, want %v with Retry-After", w.Code, http.StatusTooManyRequests)
+	}
+
+	//after the lockout the used up challenge stays invalid
+	store.totp.LockedUntil = time.Time{}
+	if w = login(challenge, code); w.Code != http.StatusUnauthorized {
+		t.Errorf("TwoFactorLoginHandler() status = %v, want the challenge invalidated", w.Code)
+	}
+	if w = login(newChallenge(), code); w.Code != http.StatusOK {
+		t.Errorf("TwoFactorLoginHandler() status = %v, want %v", w.Code, http.StatusOK)
+	}
+}
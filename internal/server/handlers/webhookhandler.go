@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/eqkez0r/gophermart/internal/webhooks"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	WebhooksHandlerPath          = "/webhooks"
+	WebhookHandlerPath           = "/webhooks/:id"
+	WebhookDeliveriesHandlerPath = "/webhooks/:id/deliveries"
+	WebhookRedeliverHandlerPath  = "/webhooks/:id/deliveries/:delivery/redeliver"
+
+	webhookSecretPrefix = "whsec_"
+	maxWebhookURLLength = 2048
+)
+
+var (
+	errInvalidWebhookURL   = e.ErrInvalidRequest.WithDetail("webhook url must be an absolute http or https url of a public host")
+	errInvalidWebhookEvent = e.ErrInvalidRequest.WithDetail("invalid webhook event")
+)
+
+type WebhookCreateProvider interface {
+	NewWebhook(context.Context, string, *obj.Webhook) error
+}
+
+type WebhookListProvider interface {
+	Webhooks(context.Context, string) ([]*obj.Webhook, error)
+}
+
+type WebhookDeleteProvider interface {
+	DeleteWebhook(context.Context, string, uint64) error
+}
+
+type WebhookDeliveriesProvider interface {
+	WebhookDeliveries(context.Context, string, uint64) ([]*obj.WebhookDelivery, error)
+}
+
+type WebhookRedeliverProvider interface {
+	RedeliverWebhook(context.Context, string, uint64, uint64) (*obj.WebhookDelivery, error)
+}
+
+// WebhookCreateHandler registers a webhook and returns it with the secret
+// signing its deliveries. The secret is not shown again.
+func WebhookCreateHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store WebhookCreateProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in webhook create handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		hook := &obj.Webhook{}
+		if err = c.ShouldBindJSON(hook); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, e.ErrInvalidRequest.WithCause(err))
+			return
+		}
+		if !validWebhookURL(hook.URL) {
+			logger.Error(e.Wrap(op, errInvalidWebhookURL))
+			fail(c, errInvalidWebhookURL)
+			return
+		}
+		if len(hook.Events) == 0 {
+			err := e.ErrInvalidRequest.WithDetail("events are required")
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+		for _, event := range hook.Events {
+			if !obj.WebhookEvents[event] {
+				logger.Error(e.Wrap(op, errInvalidWebhookEvent))
+				fail(c, errInvalidWebhookEvent)
+				return
+			}
+		}
+
+		hook.Secret, err = generateWebhookSecret()
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		if err = store.NewWebhook(ctx, login, hook); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, hook)
+	}
+}
+
+func WebhookListHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store WebhookListProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in webhook list handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		hooks, err := store.Webhooks(ctx, login)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		if len(hooks) == 0 {
+			c.Status(http.StatusNoContent)
+			return
+		}
+
+		c.JSON(http.StatusOK, hooks)
+	}
+}
+
+func WebhookDeleteHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store WebhookDeleteProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in webhook delete handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, e.ErrInvalidRequest.WithCause(err))
+			return
+		}
+
+		if err = store.DeleteWebhook(ctx, login, id); err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// WebhookDeliveriesHandler lists the latest deliveries of a webhook with
+// the log of their attempts.
+func WebhookDeliveriesHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store WebhookDeliveriesProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in webhook deliveries handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, e.ErrInvalidRequest.WithCause(err))
+			return
+		}
+
+		ds, err := store.WebhookDeliveries(ctx, login, id)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		if len(ds) == 0 {
+			c.Status(http.StatusNoContent)
+			return
+		}
+
+		c.JSON(http.StatusOK, ds)
+	}
+}
+
+// WebhookRedeliverHandler queues a delivery again, e.g. a dead one after
+// the receiver is fixed.
+func WebhookRedeliverHandler(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	store WebhookRedeliverProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in webhook redeliver handler: "
+
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, e.ErrInvalidRequest.WithCause(err))
+			return
+		}
+		deliveryID, err := strconv.ParseUint(c.Param("delivery"), 10, 64)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, e.ErrInvalidRequest.WithCause(err))
+			return
+		}
+
+		d, err := store.RedeliverWebhook(ctx, login, id, deliveryID)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
+
+		c.JSON(http.StatusAccepted, d)
+	}
+}
+
+// validWebhookURL rejects the hosts obviously not public early. Names
+// resolving to such addresses are refused when a delivery is sent.
+func validWebhookURL(raw string) bool {
+	if len(raw) > maxWebhookURLLength {
+		return false
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Hostname() == "" {
+		return false
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return webhooks.Public(addr)
+	}
+	return true
+}
+
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type webhookStore struct {
+	hooks      []*obj.Webhook
+	deliveries map[uint64]*obj.WebhookDelivery
+}
+
+func (s *webhookStore) NewWebhook(_ context.Context, _ string, w *obj.Webhook) error {
+	w.WebhookID = uint64(len(s.hooks) + 1)
+	s.hooks = append(s.hooks, w)
+	return nil
+}
+
+func (s *webhookStore) RedeliverWebhook(_ context.Context, _ string, id, deliveryID uint64) (*obj.WebhookDelivery, error) {
+	d, ok := s.deliveries[deliveryID]
+	if !ok || d.WebhookID != id {
+		return nil, e.ErrWebhookDeliveryNotFound
+	}
+	d.Status, d.Attempts = obj.DeliveryStatusPending, 0
+	return d, nil
+}
+
+func TestWebhookCreateHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "valid", body: `{"url":"https://partner.example/hooks","events":["order.processed","withdrawal.created"]}`,
+			want: http.StatusCreated},
+		{name: "unknown event", body: `{"url":"https://partner.example/hooks","events":["order.deleted"]}`,
+			want: http.StatusBadRequest},
+		{name: "no events", body: `{"url":"https://partner.example/hooks"}`, want: http.StatusBadRequest},
+		{name: "loopback", body: `{"url":"http://127.0.0.1:8080/hooks","events":["order.invalid"]}`, want: http.StatusBadRequest},
+		{name: "localhost", body: `{"url":"http://localhost/hooks","events":["order.invalid"]}`, want: http.StatusBadRequest},
+		{name: "metadata", body: `{"url":"http://169.254.169.254/latest","events":["order.invalid"]}`, want: http.StatusBadRequest},
+		{name: "cgnat", body: `{"url":"http://100.100.100.200/latest","events":["order.invalid"]}`, want: http.StatusBadRequest},
+		{name: "nat64", body: `{"url":"http://[64:ff9b::a9fe:a9fe]/latest","events":["order.invalid"]}`, want: http.StatusBadRequest},
+		{name: "private", body: `{"url":"https://[fd00::1]/hooks","events":["order.invalid"]}`, want: http.StatusBadRequest},
+		{name: "relative url", body: `{"url":"/hooks","events":["order.invalid"]}`, want: http.StatusBadRequest},
+		{name: "other scheme", body: `{"url":"ftp://partner.example/hooks","events":["order.invalid"]}`,
+			want: http.StatusBadRequest},
+		{name: "bad json", body: `{`, want: http.StatusBadRequest},
+	}
+
+	store := &webhookStore{}
+	r := gin.New()
+	r.POST(WebhooksHandlerPath, withLogin("alice"), WebhookCreateHandler(context.Background(), zap.NewNop().Sugar(), store))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, WebhooksHandlerPath, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("WebhookCreateHandler() status = %v, want %v", w.Code, tt.want)
+			}
+			if w.Code != http.StatusCreated {
+				return
+			}
+			hook := &obj.Webhook{}
+			if err := json.Unmarshal(w.Body.Bytes(), hook); err != nil {
+				t.Fatalf("WebhookCreateHandler() body: %v", err)
+			}
+			if !strings.HasPrefix(hook.Secret, webhookSecretPrefix) || hook.Secret != store.hooks[len(store.hooks)-1].Secret {
+				t.Errorf("WebhookCreateHandler() secret = %q, want the stored secret", hook.Secret)
+			}
+		})
+	}
+}
+
+func TestWebhookRedeliverHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{name: "dead delivery", path: "/webhooks/1/deliveries/7/redeliver", want: http.StatusAccepted},
+		{name: "other webhook", path: "/webhooks/2/deliveries/7/redeliver", want: http.StatusNotFound},
+		{name: "unknown delivery", path: "/webhooks/1/deliveries/8/redeliver", want: http.StatusNotFound},
+		{name: "bad id", path: "/webhooks/1/deliveries/x/redeliver", want: http.StatusBadRequest},
+	}
+
+	d := &obj.WebhookDelivery{DeliveryID: 7, WebhookID: 1, Status: obj.DeliveryStatusDead, Attempts: 8}
+	store := &webhookStore{deliveries: map[uint64]*obj.WebhookDelivery{7: d}}
+	r := gin.New()
+	r.POST(WebhookRedeliverHandlerPath, withLogin("alice"), WebhookRedeliverHandler(context.Background(), zap.NewNop().Sugar(), store))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, nil))
+
+			if w.Code != tt.want {
+				t.Errorf("WebhookRedeliverHandler() status = %v, want %v", w.Code, tt.want)
+			}
+		})
+	}
+
+	if d.Status != obj.DeliveryStatusPending {
+		t.Errorf("WebhookRedeliverHandler() delivery status = %v, want %v", d.Status, obj.DeliveryStatusPending)
+	}
+}
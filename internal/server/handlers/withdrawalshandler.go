@@ -3,7 +3,6 @@ package handlers
 import (
 	"context"
 	e "github.com/eqkez0r/gophermart/pkg/error"
-	"github.com/eqkez0r/gophermart/pkg/jwt"
 	obj "github.com/eqkez0r/gophermart/pkg/objects"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -15,7 +14,7 @@ const (
 )
 
 type WithdrawalsProvider interface {
-	Withdrawals(context.Context, string) ([]*obj.Withdraw, error)
+	Withdrawals(context.Context, string, *obj.ListFilter) ([]*obj.Withdraw, error)
 }
 
 func WithdrawalsHandler(
@@ -26,21 +25,28 @@ func WithdrawalsHandler(
 	return func(c *gin.Context) {
 		const op = "Error in withdrawals handler: "
 
-		token := c.Request.Header.Get("Authorization")
+		login, err := userLogin(c)
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			fail(c, err)
+			return
+		}
 
-		login, _, err := jwt.JWTPayload(token)
+		filter, err := listFilter(c, withdrawStatuses)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusInternalServerError)
+			fail(c, err)
 			return
 		}
 
-		withdrawals, err := store.Withdrawals(ctx, login)
+		limit := pageLimit(filter)
+		withdrawals, err := store.Withdrawals(ctx, login, filter)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusInternalServerError)
+			fail(c, err)
 			return
 		}
+		withdrawals = paginate(c, withdrawals, limit, withdrawCursor)
 
 		if len(withdrawals) == 0 {
 			logger.Infof("No Withdrawals for user %s", login)
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	e "github.com/eqkez0r/gophermart/pkg/error"
-	"github.com/eqkez0r/gophermart/pkg/jwt"
 	obj "github.com/eqkez0r/gophermart/pkg/objects"
 	"github.com/eqkez0r/gophermart/utils/luhn"
 	"github.com/gin-gonic/gin"
@@ -13,6 +12,7 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 const (
@@ -20,73 +20,102 @@ const (
 )
 
 type WithdrawHandlerProvider interface {
-	NewWithdraw(context.Context, string, string, float32) error
+	NewWithdraw(context.Context, string, string, float32, *obj.WithdrawRules) error
+	GetTOTP(context.Context, string) (*obj.TOTP, error)
+}
+
+// StepUpPolicy describes when a withdrawal needs a recent 2FA verification.
+// A zero Threshold disables the check.
+type StepUpPolicy struct {
+	Threshold float32
+	MaxAge    time.Duration
 }
 
 func WithdrawHandler(
 	ctx context.Context,
 	logger *zap.SugaredLogger,
 	store WithdrawHandlerProvider,
+	policy StepUpPolicy,
+	rules *obj.WithdrawRules,
 ) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		const op = "Error in withdraw handler: "
 
-		token := c.Request.Header.Get("Authorization")
 		withdraw := &obj.Withdraw{}
-		login, _, err := jwt.JWTPayload(token)
+		login, err := userLogin(c)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusInternalServerError)
+			fail(c, err)
 			return
 		}
 
 		body, err := io.ReadAll(c.Request.Body)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusInternalServerError)
+			fail(c, err)
 			return
 		}
 
 		err = json.Unmarshal(body, withdraw)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusInternalServerError)
+			fail(c, e.ErrInvalidRequest.WithCause(err))
 			return
 		}
 
 		number, err := strconv.Atoi(withdraw.Order)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusUnprocessableEntity)
+			fail(c, e.ErrOrderNumberNotNumeric.WithCause(err))
 			return
 		}
 
 		if !luhn.Valid(uint64(number)) {
-			logger.Error(e.Wrap(op, errors.New("invalid order number")))
-			c.Status(http.StatusUnprocessableEntity)
+			logger.Error(e.Wrap(op, e.ErrOrderNumberLuhn))
+			fail(c, e.ErrOrderNumberLuhn)
 			return
 		}
 
-		err = store.NewWithdraw(ctx, login, withdraw.Order, withdraw.Sum)
+		if policy.Threshold > 0 && withdraw.Sum > policy.Threshold {
+			t, err := store.GetTOTP(ctx, login)
+			if err != nil {
+				logger.Error(e.Wrap(op, err))
+				fail(c, err)
+				return
+			}
+			if t.Enabled && !freshMFA(mfaVerifiedAt(c), policy.MaxAge) {
+				logger.Error(e.Wrap(op, e.ErrStepUpRequired))
+				fail(c, e.ErrStepUpRequired)
+				return
+			}
+		}
+
+		err = store.NewWithdraw(auditContext(ctx, c), login, withdraw.Order, withdraw.Sum, rules)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			switch {
-			case errors.Is(err, e.ErrIsOrderIsNotExist):
-				{
-					c.Status(http.StatusUnprocessableEntity)
-				}
-			case errors.Is(err, e.ErrBalanceIsNotEnough):
-				{
-					c.Status(http.StatusPaymentRequired)
-				}
-			default:
-				{
-					c.Status(http.StatusInternalServerError)
-				}
-			}
+			logWithdrawRuleHit(logger, login, withdraw.Sum, err)
+			fail(c, err)
 			return
 		}
 
 		c.Status(http.StatusOK)
 	}
 }
+
+// logWithdrawRuleHit logs the withdrawals blocked by a withdraw rule.
+func logWithdrawRuleHit(logger *zap.SugaredLogger, login string, sum float32, err error) {
+	switch {
+	case errors.Is(err, e.ErrWithdrawAmountLimit),
+		errors.Is(err, e.ErrWithdrawDailyLimit),
+		errors.Is(err, e.ErrWithdrawWeeklyLimit),
+		errors.Is(err, e.ErrWithdrawVelocity),
+		errors.Is(err, e.ErrAccountTooNew),
+		errors.Is(err, e.ErrNewDevice):
+		rule, _ := e.As(err)
+		logger.Warnw("withdrawal blocked by rule", "rule", rule.Code, "login", login, "sum", sum)
+	}
+}
+
+func freshMFA(verifiedAt time.Time, maxAge time.Duration) bool {
+	return !verifiedAt.IsZero() && time.Since(verifiedAt) <= maxAge
+}
@@ -2,29 +2,112 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"github.com/eqkez0r/gophermart/internal/limits"
+	"github.com/eqkez0r/gophermart/internal/server/middleware"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
-	"reflect"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
+type withdrawStore struct {
+	balance  float32
+	activity obj.WithdrawActivity
+	totp     bool
+}
+
+func (s *withdrawStore) NewWithdraw(_ context.Context, _, _ string, sum float32, rules *obj.WithdrawRules) error {
+	if s.balance < sum {
+		return e.ErrBalanceIsNotEnough
+	}
+	if err := limits.Check(rules, &s.activity, sum, time.Now()); err != nil {
+		return err
+	}
+	s.balance -= sum
+	return nil
+}
+
+func (s *withdrawStore) GetTOTP(context.Context, string) (*obj.TOTP, error) {
+	return &obj.TOTP{Enabled: s.totp}, nil
+}
+
 func TestWithdrawHandler(t *testing.T) {
-	type args struct {
-		ctx    context.Context
-		logger *zap.SugaredLogger
-		store  WithdrawHandlerProvider
+	gin.SetMode(gin.TestMode)
+
+	rules := &obj.WithdrawRules{
+		MaxAmount:     300,
+		DailyCap:      400,
+		MinAccountAge: 24 * time.Hour,
+		MaxPerHour:    2,
+		NewDeviceAge:  time.Hour,
 	}
+	usual := obj.WithdrawActivity{
+		RegisteredAt: time.Now().AddDate(0, -1, 0),
+		DeviceSeenAt: time.Now().AddDate(0, 0, -1),
+	}
+
 	tests := []struct {
-		name string
-		args args
-		want gin.HandlerFunc
+		name     string
+		body     string
+		activity func(a *obj.WithdrawActivity)
+		totp     bool
+		want     int
+		wantCode string
 	}{
-		// TODO: Add test cases.
+		{name: "withdraw", body: `{"order":"2377225624","sum":100}`, want: http.StatusOK},
+		{name: "not enough", body: `{"order":"2377225624","sum":600}`, want: http.StatusPaymentRequired},
+		{name: "luhn", body: `{"order":"2377225625","sum":100}`, want: http.StatusUnprocessableEntity},
+		{name: "step-up", body: `{"order":"2377225624","sum":250}`, totp: true, want: http.StatusForbidden},
+		{name: "max amount", body: `{"order":"2377225624","sum":301}`,
+			want: http.StatusUnprocessableEntity, wantCode: "withdraw_amount_limit"},
+		{name: "daily cap", body: `{"order":"2377225624","sum":200}`,
+			activity: func(a *obj.WithdrawActivity) { a.Day = 250 },
+			want:     http.StatusUnprocessableEntity, wantCode: "withdraw_daily_limit"},
+		{name: "velocity", body: `{"order":"2377225624","sum":10}`,
+			activity: func(a *obj.WithdrawActivity) { a.LastHour = 2 },
+			want:     http.StatusTooManyRequests, wantCode: "withdraw_velocity_limit"},
+		{name: "new account", body: `{"order":"2377225624","sum":10}`,
+			activity: func(a *obj.WithdrawActivity) { a.RegisteredAt = time.Now() },
+			want:     http.StatusForbidden, wantCode: "account_too_new"},
+		{name: "new device", body: `{"order":"2377225624","sum":10}`,
+			activity: func(a *obj.WithdrawActivity) { a.DeviceSeenAt = time.Time{} },
+			want:     http.StatusForbidden, wantCode: "new_device"},
 	}
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := WithdrawHandler(tt.args.ctx, tt.args.logger, tt.args.store); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("WithdrawHandler() = %v, want %v", got, tt.want)
+			store := &withdrawStore{balance: 500, activity: usual, totp: tt.totp}
+			if tt.activity != nil {
+				tt.activity(&store.activity)
+			}
+			r := gin.New()
+			r.Use(middleware.Problem(zap.NewNop().Sugar()))
+			r.POST(WithdrawHandlerPath, withLogin("alice"), WithdrawHandler(context.Background(), zap.NewNop().Sugar(), store,
+				StepUpPolicy{Threshold: 200, MaxAge: time.Minute}, rules))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, WithdrawHandlerPath, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("WithdrawHandler() status = %v, want %v", w.Code, tt.want)
+			}
+			if tt.wantCode == "" {
+				return
+			}
+			p := &obj.Problem{}
+			if err := json.Unmarshal(w.Body.Bytes(), p); err != nil {
+				t.Fatalf("WithdrawHandler() problem: %v", err)
+			}
+			if p.Code != tt.wantCode {
+				t.Errorf("WithdrawHandler() code = %v, want %v", p.Code, tt.wantCode)
 			}
 		})
 	}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"github.com/eqkez0r/gophermart/pkg/audit"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"strings"
+)
+
+// AuditDetailsKey is set by handlers to attach details, e.g. the reason
+// of a balance adjustment, to the audit record of the request.
+const AuditDetailsKey = "audit_details"
+
+type AuditProvider interface {
+	NewAuditRecord(context.Context, *obj.AuditRecord) error
+}
+
+// AdminAudit writes an audit record for every request of the group after
+// the handler has finished.
+func AdminAudit(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	storage AuditProvider,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Audit middleware error: "
+
+		c.Next()
+
+		target := make([]string, 0, len(c.Params))
+		for _, p := range c.Params {
+			target = append(target, p.Key+"="+p.Value)
+		}
+		record := &obj.AuditRecord{
+			Action:  audit.ActionAdminPrefix + c.Request.Method + " " + c.FullPath(),
+			Target:  strings.Join(target, ","),
+			Details: c.GetString(AuditDetailsKey),
+			Status:  c.Writer.Status(),
+		}
+		meta := &audit.Meta{
+			Actor:     c.GetString(LoginKey),
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			RequestID: c.GetString(RequestIDKey),
+		}
+		if err := storage.NewAuditRecord(audit.WithMeta(ctx, meta), record); err != nil {
+			logger.Error(e.Wrap(op, err))
+		}
+	}
+}
@@ -2,64 +2,197 @@ package middleware
 
 import (
 	"context"
-	"fmt"
 	e "github.com/eqkez0r/gophermart/pkg/error"
 	"github.com/eqkez0r/gophermart/pkg/jwt"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/eqkez0r/gophermart/utils/hash"
+	"github.com/eqkez0r/gophermart/utils/ratelimit"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
-	"net/http"
+	"math"
+	"strconv"
 	"time"
 )
 
+const (
+	APIKeyHeader = "X-API-Key"
+
+	// Keys of the values Auth stores in the gin context.
+	LoginKey         = "login"
+	RoleKey          = "role"
+	MFAVerifiedAtKey = "mfa_verified_at"
+	APIKeyKey        = "api_key"
+)
+
 type GetUserProvider interface {
-	IsUserExist(context.Context, string) (bool, error)
+	GetUserInfo(context.Context, string) (*obj.UserInfo, error)
+	GetAPIKey(context.Context, string) (*obj.APIKey, error)
+	TouchAPIKey(context.Context, uint64) error
 }
 
+// Auth accepts a JWT in the Authorization header (or the session cookie
+// if enabled) or an API key in the X-API-Key header and stores the
+// authenticated login in the context. API keys are limited to their rate
+// limit, at most maxKeyRateLimit requests per minute.
 func Auth(
 	ctx context.Context,
 	logger *zap.SugaredLogger,
 	storage GetUserProvider,
+	session SessionConfig,
+	maxKeyRateLimit int,
 ) gin.HandlerFunc {
+	limiter := ratelimit.New(time.Minute)
 	return func(c *gin.Context) {
 		const op = "Auth middleware error: "
-		token := c.Request.Header.Get("Authorization")
+
+		if apiKey := c.Request.Header.Get(APIKeyHeader); apiKey != "" {
+			key, err := storage.GetAPIKey(ctx, hash.HashToken(apiKey))
+			if err != nil {
+				logger.Error(e.Wrap(op, err))
+				abort(c, e.ErrUnauthorized.WithCause(err))
+				return
+			}
+
+			id := strconv.FormatUint(key.KeyID, 10)
+			limit := key.RateLimit
+			if limit <= 0 || limit > maxKeyRateLimit {
+				limit = maxKeyRateLimit
+			}
+			if !limiter.Allow(id, limit) {
+				logger.Error(e.Wrap(op, e.ErrRateLimited))
+				retryAfter := math.Ceil(limiter.RetryAfter(id).Seconds())
+				c.Header("Retry-After", strconv.Itoa(int(retryAfter)))
+				abort(c, e.ErrRateLimited)
+				return
+			}
+
+			user, err := storage.GetUserInfo(ctx, key.Login)
+			if err != nil {
+				logger.Error(e.Wrap(op, err))
+				abort(c, e.ErrUnauthorized.WithCause(err))
+				return
+			}
+			if user.Blocked {
+				logger.Error(e.Wrap(op, e.ErrUserBlocked))
+				abort(c, e.ErrUserBlocked)
+				return
+			}
+
+			if err = storage.TouchAPIKey(ctx, key.KeyID); err != nil {
+				logger.Warnw("failed to update api key last usage", "error", err)
+			}
+
+			c.Set(LoginKey, key.Login)
+			c.Set(RoleKey, user.Role)
+			c.Set(APIKeyKey, key)
+			c.Next()
+			return
+		}
+
+		token, fromCookie := sessionToken(c, session)
 		if token == "" {
-			logger.Error(e.Wrap(op, fmt.Errorf("empty field")))
-			c.Status(http.StatusUnauthorized)
-			c.Abort()
+			err := e.ErrUnauthorized.WithDetail("missing credentials")
+			logger.Error(e.Wrap(op, err))
+			abort(c, err)
 			return
 		}
 
-		login, ttl, err := jwt.JWTPayload(token)
+		claims, err := jwt.AccessClaims(token)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusUnauthorized)
-			c.Abort()
+			abort(c, e.ErrUnauthorized.WithCause(err))
 			return
 		}
+		login, ttl := claims.Login, claims.ExpiresAt.Time
 
-		ok, err := storage.IsUserExist(ctx, login)
+		user, err := storage.GetUserInfo(ctx, login)
 		if err != nil {
 			logger.Error(e.Wrap(op, err))
-			c.Status(http.StatusUnauthorized)
-			c.Abort()
+			abort(c, e.ErrUnauthorized.WithCause(err))
 			return
 		}
 
-		if !ok {
-			logger.Error(e.Wrap(op, fmt.Errorf("user not found")))
-			c.Status(http.StatusUnauthorized)
-			c.Abort()
+		//role and block state are read from the database, so changes take
+		//effect before the token expires
+		if user.Blocked {
+			logger.Error(e.Wrap(op, e.ErrUserBlocked))
+			abort(c, e.ErrUserBlocked)
 			return
 		}
 
 		if time.Now().After(ttl) {
-			logger.Error(e.Wrap(op, fmt.Errorf("token expired")))
-			c.Status(http.StatusUnauthorized)
-			c.Abort()
+			err = e.ErrUnauthorized.WithDetail("token expired")
+			logger.Error(e.Wrap(op, err))
+			abort(c, err)
+			return
+		}
+
+		c.Set(LoginKey, login)
+		c.Set(RoleKey, user.Role)
+		c.Set(SessionCookieKey, fromCookie)
+		if claims.MFAVerifiedAt != nil {
+			c.Set(MFAVerifiedAtKey, claims.MFAVerifiedAt.Time)
+		}
+		c.Next()
+	}
+}
+
+// RequireScope rejects requests made with an API key lacking scope.
+// Requests authenticated with a JWT have every scope.
+func RequireScope(
+	logger *zap.SugaredLogger,
+	scope string,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Scope middleware error: "
+		v, ok := c.Get(APIKeyKey)
+		if !ok {
+			c.Next()
+			return
+		}
+		if key, _ := v.(*obj.APIKey); key == nil || !key.HasScope(scope) {
+			logger.Error(e.Wrap(op, e.ErrInsufficientScope))
+			abort(c, e.ErrInsufficientScope)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSession rejects requests made with an API key. It guards account
+// management routes such as key creation and 2FA enrolment.
+func RequireSession(
+	logger *zap.SugaredLogger,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Session middleware error: "
+		if _, ok := c.Get(APIKeyKey); ok {
+			err := e.ErrForbidden.WithDetail("not available for api keys")
+			logger.Error(e.Wrap(op, err))
+			abort(c, err)
 			return
 		}
+		c.Next()
+	}
+}
 
+// RequireRole rejects requests of users whose role is not in roles.
+func RequireRole(
+	logger *zap.SugaredLogger,
+	roles ...string,
+) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(roles))
+	for _, r := range roles {
+		allowed[r] = true
+	}
+	return func(c *gin.Context) {
+		const op = "Role middleware error: "
+		if !allowed[c.GetString(RoleKey)] {
+			err := e.ErrForbidden.WithDetail("role is not allowed")
+			logger.Error(e.Wrap(op, err))
+			abort(c, err)
+			return
+		}
 		c.Next()
 	}
 }
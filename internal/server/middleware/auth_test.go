@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"context"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/eqkez0r/gophermart/utils/hash"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type authStore struct {
+	keys    map[string]*obj.APIKey
+	revoked map[string]bool
+}
+
+func (s *authStore) GetUserInfo(_ context.Context, login string) (*obj.UserInfo, error) {
+	return &obj.UserInfo{Login: login, Role: obj.RoleUser}, nil
+}
+
+func (s *authStore) GetAPIKey(_ context.Context, keyHash string) (*obj.APIKey, error) {
+	key, ok := s.keys[keyHash]
+	if !ok || s.revoked[keyHash] {
+		return nil, e.ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func (s *authStore) TouchAPIKey(context.Context, uint64) error {
+	return nil
+}
+
+func TestAuthAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := &authStore{
+		keys: map[string]*obj.APIKey{
+			hash.HashToken("gm_reader"):  {KeyID: 1, Login: "alice", Scopes: []string{obj.ScopeOrdersRead}, RateLimit: 60},
+			hash.HashToken("gm_revoked"): {KeyID: 2, Login: "alice", Scopes: []string{obj.ScopeOrdersRead}, RateLimit: 60},
+			hash.HashToken("gm_limited"): {KeyID: 3, Login: "alice", Scopes: []string{obj.ScopeOrdersRead}, RateLimit: 2},
+			//above the server max, clamped to it
+			hash.HashToken("gm_greedy"): {KeyID: 4, Login: "alice", Scopes: []string{obj.ScopeOrdersRead}, RateLimit: 1000},
+		},
+		revoked: map[string]bool{hash.HashToken("gm_revoked"): true},
+	}
+	r := gin.New()
+	r.Use(Problem(zap.NewNop().Sugar()), Auth(context.Background(), zap.NewNop().Sugar(), store, SessionConfig{Mode: AuthModeHeader}, 3))
+	r.GET("/orders", RequireScope(zap.NewNop().Sugar(), obj.ScopeOrdersRead), func(c *gin.Context) {
+		if c.GetString(LoginKey) != "alice" {
+			t.Errorf("Auth() login = %v, want alice", c.GetString(LoginKey))
+		}
+		c.Status(http.StatusOK)
+	})
+	r.POST("/orders", RequireScope(zap.NewNop().Sugar(), obj.ScopeOrdersWrite), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	do := func(method, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/orders", nil)
+		req.Header.Set(APIKeyHeader, key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		key    string
+		want   int
+	}{
+		{name: "valid key", method: http.MethodGet, key: "gm_reader", want: http.StatusOK},
+		{name: "unknown key", method: http.MethodGet, key: "gm_unknown", want: http.StatusUnauthorized},
+		{name: "revoked key", method: http.MethodGet, key: "gm_revoked", want: http.StatusUnauthorized},
+		{name: "missing scope", method: http.MethodPost, key: "gm_reader", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do(tt.method, tt.key); w.Code != tt.want {
+				t.Errorf("Auth() status = %v, want %v", w.Code, tt.want)
+			}
+		})
+	}
+
+	t.Run("rate limit", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if w := do(http.MethodGet, "gm_limited"); w.Code != http.StatusOK {
+				t.Fatalf("Auth() status = %v, want %v", w.Code, http.StatusOK)
+			}
+		}
+		w := do(http.MethodGet, "gm_limited")
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+			t.Errorf("Auth() status = %v, want %v with Retry-After", w.Code, http.StatusTooManyRequests)
+		}
+	})
+
+	t.Run("max rate limit", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			if w := do(http.MethodGet, "gm_greedy"); w.Code != http.StatusOK {
+				t.Fatalf("Auth() status = %v, want %v", w.Code, http.StatusOK)
+			}
+		}
+		if w := do(http.MethodGet, "gm_greedy"); w.Code != http.StatusTooManyRequests {
+			t.Errorf("Auth() status = %v, want the key clamped to the max rate limit", w.Code)
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+const bodyLimitKey = "body_limit"
+
+// BodyLimit caps request bodies at max bytes, routes sets other caps by
+// the full path of the route. It must run before the body is read, the
+// Gzip middleware applies the cap to the decoded body as well.
+func BodyLimit(max int64, routes map[string]int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := max
+		if n, ok := routes[c.FullPath()]; ok {
+			limit = n
+		}
+		c.Set(bodyLimitKey, limit)
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
+		c.Next()
+	}
+}
+
+// bodyError turns an exceeded body limit into its problem, other read
+// errors are invalid requests.
+func bodyError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return e.ErrRequestTooLarge.WithDetail(fmt.Sprintf("body must not exceed %d bytes", tooLarge.Limit))
+	}
+	return e.ErrInvalidRequest.WithCause(err)
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/eqkez0r/gophermart"
+	"github.com/eqkez0r/gophermart/internal/openapi"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	spec, err := openapi.Load(gophermart.OpenAPI)
+	if err != nil {
+		t.Fatalf("openapi.Load() error = %v", err)
+	}
+
+	const limit = 1024
+	valid := `{"login":"a","password":"b"}`
+	//padding keeps the json valid past the limit
+	large := `{"login":"a","password":"b","pad":"` + strings.Repeat("a", 64*limit) + `"}`
+	gzipped := func(s string) string {
+		var b bytes.Buffer
+		gz := gzip.NewWriter(&b)
+		_, _ = gz.Write([]byte(s))
+		_ = gz.Close()
+		return b.String()
+	}
+
+	tests := []struct {
+		name string
+		body string
+		gzip bool
+		want int
+	}{
+		{name: "within the limit", body: valid, want: http.StatusOK},
+		{name: "above the limit", body: large, want: http.StatusRequestEntityTooLarge},
+		{name: "gzip within the limit", body: gzipped(valid), gzip: true, want: http.StatusOK},
+		//compresses to far below the limit, the decoded size counts
+		{name: "gzip bomb", body: gzipped(large), gzip: true, want: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.gzip && len(tt.body) > limit {
+				t.Fatalf("compressed body of %d bytes is above the limit", len(tt.body))
+			}
+			r := gin.New()
+			r.Use(Problem(zap.NewNop().Sugar()), BodyLimit(limit, nil), Gzip(zap.NewNop().Sugar(), nil),
+				Validate(zap.NewNop().Sugar(), spec, false))
+			r.POST("/api/user/register", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/user/register", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.gzip {
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("BodyLimit() status = %v, want %v", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"compress/gzip"
+	"errors"
 	"github.com/eqkez0r/gophermart/internal/server/writers"
 	e "github.com/eqkez0r/gophermart/pkg/error"
 	"github.com/gin-gonic/gin"
@@ -10,33 +11,19 @@ import (
 	"strings"
 )
 
-var avaliableTypes = map[string]bool{
-	"text/html":        true,
-	"application/json": true,
-	"html/text":        true,
-}
-
+// Gzip decodes gzip request bodies and compresses the responses of the
+// given content types for clients accepting gzip. Decoded bodies are
+// capped like the compressed ones, see BodyLimit.
 func Gzip(
 	logger *zap.SugaredLogger,
+	types []string,
 ) gin.HandlerFunc {
+	avaliableTypes := make(map[string]bool, len(types))
+	for _, t := range types {
+		avaliableTypes[t] = true
+	}
 	return func(context *gin.Context) {
 		op := "Error in gzip decode handler: "
-		//compress response
-		ae := context.GetHeader("Accept-Encoding")
-		ct := context.GetHeader("Content-Type")
-		ac := context.GetHeader("Accept")
-		if (strings.Contains(ae, "gzip")) &&
-			(avaliableTypes[ct] || avaliableTypes[ac]) {
-			w := context.Writer
-			gzipWriter := gzip.NewWriter(w)
-			defer gzipWriter.Close()
-			wd := writers.GzipWriter{
-				ResponseWriter: context.Writer,
-				Writer:         gzipWriter,
-			}
-			context.Writer = wd
-			context.Writer.Header().Set("Content-Encoding", "gzip")
-		}
 
 		//uncompressed request
 		ce := context.GetHeader("Content-Encoding")
@@ -44,13 +31,39 @@ func Gzip(
 			gzipReader, err := gzip.NewReader(context.Request.Body)
 			if err != nil {
 				logger.Error(e.Wrap(op, err))
-				context.Status(http.StatusInternalServerError)
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					abort(context, bodyError(err))
+					return
+				}
+				abort(context, e.ErrInvalidRequest.WithDetail("invalid gzip body"))
 				return
 			}
 			defer gzipReader.Close()
 
 			context.Request.Body = gzipReader
+			if limit, ok := context.Get(bodyLimitKey); ok {
+				context.Request.Body = http.MaxBytesReader(context.Writer, gzipReader, limit.(int64))
+			}
 		}
+
+		//compress response
+		ae := context.GetHeader("Accept-Encoding")
+		ct := context.GetHeader("Content-Type")
+		ac := context.GetHeader("Accept")
+		if (strings.Contains(ae, "gzip")) &&
+			(avaliableTypes[ct] || avaliableTypes[ac]) {
+			w := context.Writer
+			gzipWriter := writers.NewGzipWriter(w)
+			context.Writer = gzipWriter
+			defer func() {
+				if err := gzipWriter.Close(); err != nil {
+					logger.Error(e.Wrap(op, err))
+				}
+				context.Writer = w
+			}()
+		}
+
 		context.Next()
 	}
 }
@@ -49,6 +49,7 @@ func Logger(
 			"STATUS", respData.status,
 			"SIZE", respData.size,
 			"DURATION", duration,
+			"REQUEST_ID", context.GetString(RequestIDKey),
 		)
 	}
 }
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"encoding/json"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+)
+
+const (
+	ProblemContentType = "application/problem+json"
+
+	problemTypePrefix = "urn:gophermart:problem:"
+)
+
+// Problem renders error responses left without a body as RFC 7807
+// problem documents. The code and title come from the last domain error
+// attached with c.Error, the status is the one set by the handler.
+func Problem(
+	logger *zap.SugaredLogger,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Problem middleware error: "
+
+		c.Next()
+
+		status := c.Writer.Status()
+		if status < http.StatusBadRequest || c.Writer.Written() || c.Request.Method == http.MethodHead {
+			return
+		}
+
+		p := NewProblem(c, status)
+		c.Header("Content-Type", ProblemContentType)
+		if err := json.NewEncoder(c.Writer).Encode(p); err != nil {
+			logger.Error(e.Wrap(op, err))
+		}
+	}
+}
+
+func NewProblem(c *gin.Context, status int) *obj.Problem {
+	p := &obj.Problem{
+		Status:    status,
+		Instance:  c.Request.URL.Path,
+		RequestID: c.GetString(RequestIDKey),
+	}
+
+	var de *e.Error
+	for i := len(c.Errors) - 1; i >= 0 && de == nil; i-- {
+		de, _ = e.As(c.Errors[i].Err)
+	}
+	if de == nil {
+		//no domain error, derive a generic one from the status
+		p.Type = "about:blank"
+		p.Title = http.StatusText(status)
+		p.Code = strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+		return p
+	}
+	p.Type = problemTypePrefix + de.Code
+	p.Title = de.Title
+	p.Code = de.Code
+	p.Detail = de.Detail
+	return p
+}
+
+// abort attaches err for the problem renderer, sets the status declared
+// by err and stops the chain.
+func abort(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Status(e.StatusOf(err))
+	c.Abort()
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProblem(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		handler     gin.HandlerFunc
+		want        int
+		wantCode    string
+		wantDetail  string
+		wantProblem bool
+	}{
+		{
+			name: "domain error",
+			handler: func(c *gin.Context) {
+				_ = c.Error(e.Wrap("op: ", e.ErrOrderNumberLuhn))
+				c.Status(http.StatusUnprocessableEntity)
+			},
+			want:        http.StatusUnprocessableEntity,
+			wantCode:    "order_number_invalid_luhn",
+			wantProblem: true,
+		},
+		{
+			name: "domain error with detail",
+			handler: func(c *gin.Context) {
+				_ = c.Error(e.ErrInvalidRequest.WithDetail("empty field").WithCause(errors.New("eof")))
+				c.Status(http.StatusBadRequest)
+			},
+			want:        http.StatusBadRequest,
+			wantCode:    "invalid_request",
+			wantDetail:  "empty field",
+			wantProblem: true,
+		},
+		{
+			name: "plain error",
+			handler: func(c *gin.Context) {
+				_ = c.Error(errors.New("connection refused"))
+				c.Status(http.StatusInternalServerError)
+			},
+			want:        http.StatusInternalServerError,
+			wantCode:    "internal_server_error",
+			wantProblem: true,
+		},
+		{
+			name: "body already written",
+			handler: func(c *gin.Context) {
+				c.String(http.StatusConflict, "conflict")
+			},
+			want: http.StatusConflict,
+		},
+		{
+			name: "success",
+			handler: func(c *gin.Context) {
+				c.Status(http.StatusAccepted)
+			},
+			want: http.StatusAccepted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(RequestID(), Problem(zap.NewNop().Sugar()))
+			r.GET("/", tt.handler)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if w.Code != tt.want {
+				t.Errorf("Problem() status = %v, want %v", w.Code, tt.want)
+			}
+			isProblem := w.Header().Get("Content-Type") == ProblemContentType
+			if isProblem != tt.wantProblem {
+				t.Fatalf("Problem() content type = %q", w.Header().Get("Content-Type"))
+			}
+			if !tt.wantProblem {
+				return
+			}
+			p := &obj.Problem{}
+			if err := json.Unmarshal(w.Body.Bytes(), p); err != nil {
+				t.Fatalf("Problem() body: %v", err)
+			}
+			if p.Code != tt.wantCode || p.Detail != tt.wantDetail || p.Status != tt.want {
+				t.Errorf("Problem() = %+v, want code %q detail %q", p, tt.wantCode, tt.wantDetail)
+			}
+			if p.RequestID == "" || p.RequestID != w.Header().Get(RequestIDHeader) {
+				t.Errorf("Problem() request id = %q, header %q", p.RequestID, w.Header().Get(RequestIDHeader))
+			}
+		})
+	}
+}
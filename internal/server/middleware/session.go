@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+const (
+	AuthModeHeader = "header"
+	AuthModeCookie = "cookie"
+	AuthModeBoth   = "both"
+
+	SessionCookie = "gophermart_session"
+	CSRFCookie    = "gophermart_csrf"
+	CSRFHeader    = "X-CSRF-Token"
+
+	// SessionCookieKey is set in the context when the request was
+	// authenticated with the session cookie.
+	SessionCookieKey = "session_cookie"
+)
+
+// SessionConfig describes how tokens are handed to clients. In the header
+// mode the token is returned in the Authorization header only, in the
+// cookie mode it is set as an HttpOnly cookie, and both does both.
+type SessionConfig struct {
+	Mode     string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+func (s SessionConfig) useHeader() bool {
+	return s.Mode != AuthModeCookie
+}
+
+func (s SessionConfig) useCookie() bool {
+	return s.Mode == AuthModeCookie || s.Mode == AuthModeBoth
+}
+
+// SetSession returns the token to the client according to the mode. With
+// cookies a new CSRF token is issued as well, it is readable by scripts
+// and has to be sent back in the X-CSRF-Token header.
+func SetSession(c *gin.Context, s SessionConfig, token string) error {
+	if s.useHeader() {
+		c.Header("Authorization", token)
+	}
+	if !s.useCookie() {
+		return nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	csrf := hex.EncodeToString(b)
+
+	setCookie(c, s, SessionCookie, token, true, 0)
+	setCookie(c, s, CSRFCookie, csrf, false, 0)
+	c.Header(CSRFHeader, csrf)
+	return nil
+}
+
+func ClearSession(c *gin.Context, s SessionConfig) {
+	setCookie(c, s, SessionCookie, "", true, -1)
+	setCookie(c, s, CSRFCookie, "", false, -1)
+}
+
+// sessionToken returns the token from the Authorization header or, if
+// cookies are enabled, from the session cookie.
+func sessionToken(c *gin.Context, s SessionConfig) (string, bool) {
+	if token := c.Request.Header.Get("Authorization"); token != "" {
+		return token, false
+	}
+	if !s.useCookie() {
+		return "", false
+	}
+	token, err := c.Cookie(SessionCookie)
+	if err != nil {
+		return "", false
+	}
+	return token, true
+}
+
+// CSRF implements the double-submit check for state-changing requests
+// authenticated with the session cookie. Other requests are not
+// vulnerable to CSRF and pass through.
+func CSRF(
+	logger *zap.SugaredLogger,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "CSRF middleware error: "
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if !c.GetBool(SessionCookieKey) {
+			c.Next()
+			return
+		}
+
+		cookie, err := c.Cookie(CSRFCookie)
+		header := c.GetHeader(CSRFHeader)
+		if err != nil || cookie == "" ||
+			subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) != 1 {
+			logger.Error(e.Wrap(op, e.ErrCSRFMismatch))
+			abort(c, e.ErrCSRFMismatch)
+			return
+		}
+		c.Next()
+	}
+}
+
+func setCookie(c *gin.Context, s SessionConfig, name, value string, httpOnly bool, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   s.Secure,
+		HttpOnly: httpOnly,
+		SameSite: s.SameSite,
+	})
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		method     string
+		fromCookie bool
+		cookie     string
+		header     string
+		want       int
+	}{
+		{name: "safe method", method: http.MethodGet, fromCookie: true, want: http.StatusOK},
+		{name: "header auth", method: http.MethodPost, fromCookie: false, want: http.StatusOK},
+		{name: "matching token", method: http.MethodPost, fromCookie: true, cookie: "abc", header: "abc", want: http.StatusOK},
+		{name: "missing header", method: http.MethodPost, fromCookie: true, cookie: "abc", want: http.StatusForbidden},
+		{name: "wrong header", method: http.MethodDelete, fromCookie: true, cookie: "abc", header: "abd", want: http.StatusForbidden},
+		{name: "missing cookie", method: http.MethodPost, fromCookie: true, header: "abc", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Handle(tt.method, "/", func(c *gin.Context) {
+				c.Set(SessionCookieKey, tt.fromCookie)
+			}, CSRF(zap.NewNop().Sugar()), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set(CSRFHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("CSRF() status = %v, want %v", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		mode       string
+		wantHeader bool
+		wantCookie bool
+	}{
+		{name: "header", mode: AuthModeHeader, wantHeader: true},
+		{name: "cookie", mode: AuthModeCookie, wantCookie: true},
+		{name: "both", mode: AuthModeBoth, wantHeader: true, wantCookie: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			if err := SetSession(c, SessionConfig{Mode: tt.mode, Secure: true, SameSite: http.SameSiteStrictMode}, "token"); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := w.Header().Get("Authorization") == "token"; got != tt.wantHeader {
+				t.Errorf("SetSession() header = %v, want %v", got, tt.wantHeader)
+			}
+			var session *http.Cookie
+			for _, ck := range w.Result().Cookies() {
+				if ck.Name == SessionCookie {
+					session = ck
+				}
+			}
+			if (session != nil) != tt.wantCookie {
+				t.Fatalf("SetSession() cookie = %v, want %v", session != nil, tt.wantCookie)
+			}
+			if session != nil && (!session.HttpOnly || !session.Secure || session.SameSite != http.SameSiteStrictMode) {
+				t.Errorf("SetSession() cookie attributes = %+v", session)
+			}
+		})
+	}
+}
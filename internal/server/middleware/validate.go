@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/eqkez0r/gophermart/internal/openapi"
+	"github.com/eqkez0r/gophermart/internal/server/writers"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"io"
+)
+
+// maxRecordedBody bounds the response copy kept for validation. Longer
+// bodies, e.g. exports, are only checked for a documented status.
+const maxRecordedBody = 1 << 20
+
+// Validate checks requests against the OpenAPI operation of the matched
+// route and rejects invalid ones with 400. With responses enabled, meant
+// for debugging, responses are checked too and violations are logged.
+func Validate(
+	logger *zap.SugaredLogger,
+	spec *openapi.Spec,
+	responses bool,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const op = "Error in validate middleware: "
+
+		operation := spec.Operation(c.Request.Method, c.FullPath())
+		if operation == nil {
+			//the route test keeps the spec in sync with the routes
+			logger.Errorf("%sno operation for %s %s", op, c.Request.Method, c.FullPath())
+			c.Next()
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			var err error
+			body, err = io.ReadAll(c.Request.Body)
+			if err != nil {
+				logger.Error(e.Wrap(op, err))
+				abort(c, bodyError(err))
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		params := make(map[string]string, len(c.Params))
+		for _, p := range c.Params {
+			params[p.Key] = p.Value
+		}
+		err := operation.ValidateRequest(&openapi.Request{
+			PathParams:  params,
+			Query:       c.Request.URL.Query(),
+			ContentType: c.GetHeader("Content-Type"),
+			Body:        body,
+		})
+		if err != nil {
+			logger.Error(e.Wrap(op, err))
+			if errors.Is(err, openapi.ErrContentType) {
+				abort(c, e.ErrInvalidContentType.WithDetail(err.Error()))
+				return
+			}
+			abort(c, e.ErrRequestValidation.WithDetail(err.Error()))
+			return
+		}
+
+		if !responses {
+			c.Next()
+			return
+		}
+
+		w := c.Writer
+		rec := writers.NewBodyRecorder(w, maxRecordedBody)
+		c.Writer = rec
+		c.Next()
+		c.Writer = w
+
+		b, truncated := rec.Body()
+		if truncated {
+			b = nil
+		}
+		if err = operation.ValidateResponse(rec.Status(), rec.Header().Get("Content-Type"), b); err != nil {
+			logger.Error(e.Wrap(op, fmt.Errorf("response of %s %s: %w", c.Request.Method, c.FullPath(), err)))
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"encoding/json"
+	"github.com/eqkez0r/gophermart"
+	"github.com/eqkez0r/gophermart/internal/openapi"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	spec, err := openapi.Load(gophermart.OpenAPI)
+	if err != nil {
+		t.Fatalf("openapi.Load() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+		wantCode    string
+	}{
+		{name: "valid", contentType: "application/json", body: `{"login":"a","password":"b"}`, want: http.StatusOK},
+		{name: "missing field", contentType: "application/json", body: `{"login":"a"}`, want: http.StatusBadRequest, wantCode: "request_validation_failed"},
+		{name: "bad json", contentType: "application/json", body: `{`, want: http.StatusBadRequest, wantCode: "request_validation_failed"},
+		{name: "content type", contentType: "text/plain", body: `a:b`, want: http.StatusBadRequest, wantCode: "invalid_content_type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(Problem(zap.NewNop().Sugar()), Validate(zap.NewNop().Sugar(), spec, true))
+			r.POST("/api/user/register", func(c *gin.Context) {
+				//the body must still be readable after validation
+				b, _ := io.ReadAll(c.Request.Body)
+				if string(b) != tt.body {
+					t.Errorf("handler body = %q, want %q", b, tt.body)
+				}
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/user/register", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("Validate() status = %v, want %v", w.Code, tt.want)
+			}
+			if tt.wantCode == "" {
+				return
+			}
+			p := &obj.Problem{}
+			if err := json.Unmarshal(w.Body.Bytes(), p); err != nil {
+				t.Fatalf("Validate() body: %v", err)
+			}
+			if p.Code != tt.wantCode || p.Detail == "" {
+				t.Errorf("Validate() problem = %+v, want code %q", p, tt.wantCode)
+			}
+		})
+	}
+}
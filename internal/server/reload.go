@@ -0,0 +1,40 @@
+package httpserver
+
+import (
+	"github.com/eqkez0r/gophermart/internal/config"
+	"github.com/gin-gonic/gin"
+	"sync/atomic"
+)
+
+// reloadable is a handler depending on reloadable settings. It is built
+// again from the new configuration on reload and swapped atomically, so
+// requests in flight finish with the settings they started with.
+type reloadable struct {
+	build   func(*config.Config) gin.HandlerFunc
+	handler atomic.Pointer[gin.HandlerFunc]
+}
+
+func (r *reloadable) set(cfg *config.Config) {
+	h := r.build(cfg)
+	r.handler.Store(&h)
+}
+
+func (r *reloadable) serve(c *gin.Context) {
+	(*r.handler.Load())(c)
+}
+
+// reloadable returns a handler built from cfg which is rebuilt by Reload.
+func (s *HTTPServer) reloadable(cfg *config.Config, build func(*config.Config) gin.HandlerFunc) gin.HandlerFunc {
+	r := &reloadable{build: build}
+	r.set(cfg)
+	s.reloadables = append(s.reloadables, r)
+	return r.serve
+}
+
+// Reload applies the reloadable settings of cfg to the handlers. It is
+// meant to be registered with config.Reloader.OnReload.
+func (s *HTTPServer) Reload(cfg *config.Config) {
+	for _, r := range s.reloadables {
+		r.set(cfg)
+	}
+}
@@ -2,12 +2,17 @@ package httpserver
 
 import (
 	"context"
+	"github.com/eqkez0r/gophermart"
 	"github.com/eqkez0r/gophermart/internal/config"
+	"github.com/eqkez0r/gophermart/internal/expiry"
+	"github.com/eqkez0r/gophermart/internal/holds"
+	"github.com/eqkez0r/gophermart/internal/openapi"
 	"github.com/eqkez0r/gophermart/internal/orderfetcher"
 	"github.com/eqkez0r/gophermart/internal/server/handlers"
 	"github.com/eqkez0r/gophermart/internal/server/middleware"
 	"github.com/eqkez0r/gophermart/internal/storage"
 	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"net/http"
@@ -19,11 +24,14 @@ type HTTPServer struct {
 	cfg    *config.Config
 	logger *zap.SugaredLogger
 	s      storage.Storage
+	//handlers rebuilt on config reload
+	reloadables []*reloadable
 }
 
 const (
 	APIUserRoute    = "/api/user"
 	APIBalanceRoute = "/balance"
+	APIAdminRoute   = "/api/admin"
 )
 
 func New(
@@ -32,49 +40,193 @@ func New(
 	logger *zap.SugaredLogger,
 	s storage.Storage,
 	of *orderfetcher.OrderFetcher,
+	reloader handlers.ConfigReloader,
 ) (*HTTPServer, error) {
-	//const op = "Initial server error"
+	const op = "Initial server error: "
 
 	gin.DisableConsoleColor()
 	gin.SetMode(gin.ReleaseMode)
 	engine := gin.New()
 	engine.RedirectFixedPath = true
+	//ClientIP, used by audit, rate limits and referrals, only reads
+	//X-Forwarded-For from these
+	if err := engine.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, e.Wrap(op, err)
+	}
+	srv := &HTTPServer{
+		server: &http.Server{
+			Addr:    cfg.Server.Address,
+			Handler: engine,
+		},
+		engine: engine,
+		cfg:    cfg,
+		logger: logger,
+	}
+
+	session := middleware.SessionConfig{
+		Mode:     cfg.Auth.Mode,
+		Secure:   cfg.Auth.CookieSecure,
+		SameSite: sameSite(cfg.Auth.CookieSameSite),
+	}
+
+	spec, err := openapi.Load(gophermart.OpenAPI)
+	if err != nil {
+		return nil, e.Wrap(op, err)
+	}
+	validate := middleware.Validate(logger, spec, cfg.Server.Debug)
 
 	//middleware
-	engine.Use(middleware.Logger(logger))
+	engine.Use(middleware.RequestID(), middleware.Logger(logger), middleware.Problem(logger),
+		middleware.BodyLimit(cfg.Server.MaxBodySize, map[string]int64{
+			APIUserRoute + handlers.NewOrderBatchHandlerPath: handlers.MaxBatchBodySize,
+		}))
 	//handlers
-	authAPI := engine.Group(APIUserRoute)
-	authAPI.POST(handlers.RegisterHandlerPath, handlers.RegisterHandler(ctx, logger, s))
-	authAPI.POST(handlers.AuthHandlerPath, handlers.AuthHandler(ctx, logger, s))
+	authAPI := engine.Group(APIUserRoute, validate)
+	authAPI.POST(handlers.RegisterHandlerPath, srv.reloadable(cfg, func(cfg *config.Config) gin.HandlerFunc {
+		return handlers.RegisterHandler(ctx, logger, s, session, obj.ReferralTerms{
+			ReferrerBonus: float32(cfg.Loyalty.ReferrerBonus),
+			RefereeBonus:  float32(cfg.Loyalty.RefereeBonus),
+			MaxReferrals:  cfg.Loyalty.MaxReferrals,
+		})
+	}))
+	authAPI.POST(handlers.AuthHandlerPath, handlers.AuthHandler(ctx, logger, s, session))
+	authAPI.POST(handlers.TwoFactorLoginHandlerPath, handlers.TwoFactorLoginHandler(ctx, logger, s, session))
+	authAPI.POST(handlers.LogoutHandlerPath, handlers.LogoutHandler(logger, session))
 
 	userAPI := engine.Group(APIUserRoute)
-	userAPI.Use(middleware.Logger(logger), middleware.Auth(ctx, logger, s), middleware.Gzip(logger))
-	userAPI.POST(handlers.NewOrderHandlerPath, handlers.NewOrderHandler(ctx, logger, s))
-	userAPI.GET(handlers.OrderListHandlerPath, handlers.OrderListHandler(ctx, logger, s))
-	userAPI.GET(handlers.WithdrawalsHandlerPath, handlers.WithdrawalsHandler(ctx, logger, s))
+	userAPI.Use(middleware.Logger(logger), middleware.Auth(ctx, logger, s, session, cfg.Auth.APIKeyMaxRateLimit), middleware.CSRF(logger), middleware.Gzip(logger, cfg.Server.GzipTypes), validate)
+	userAPI.POST(handlers.NewOrderHandlerPath,
+		middleware.RequireScope(logger, obj.ScopeOrdersWrite), handlers.NewOrderHandler(ctx, logger, s))
+	userAPI.POST(handlers.NewOrderBatchHandlerPath,
+		middleware.RequireScope(logger, obj.ScopeOrdersWrite), handlers.NewOrderBatchHandler(ctx, logger, s))
+	userAPI.GET(handlers.OrderListHandlerPath,
+		middleware.RequireScope(logger, obj.ScopeOrdersRead), handlers.OrderListHandler(ctx, logger, s))
+	userAPI.GET(handlers.OrderHandlerPath,
+		middleware.RequireScope(logger, obj.ScopeOrdersRead), handlers.OrderHandler(ctx, logger, s))
+	userAPI.GET(handlers.WithdrawalsHandlerPath,
+		middleware.RequireScope(logger, obj.ScopeBalanceRead), handlers.WithdrawalsHandler(ctx, logger, s))
+	userAPI.GET(handlers.ExportHandlerPath,
+		middleware.RequireScope(logger, obj.ScopeOrdersRead), middleware.RequireScope(logger, obj.ScopeBalanceRead),
+		handlers.ExportHandler(ctx, logger, s))
+	userAPI.GET(handlers.StatementsHandlerPath,
+		middleware.RequireScope(logger, obj.ScopeBalanceRead), handlers.StatementsHandler(ctx, logger, s))
+	userAPI.GET(handlers.StatementHandlerPath,
+		middleware.RequireScope(logger, obj.ScopeBalanceRead), handlers.StatementHandler(ctx, logger, s))
 
 	balanceAPI := userAPI.Group(APIBalanceRoute)
-	balanceAPI.GET(handlers.BalanceHandlerPath, handlers.BalanceHandler(ctx, logger, s))
-	balanceAPI.POST(handlers.WithdrawHandlerPath, handlers.WithdrawHandler(ctx, logger, s))
+	balanceAPI.GET(handlers.BalanceHandlerPath,
+		middleware.RequireScope(logger, obj.ScopeBalanceRead), srv.reloadable(cfg, func(cfg *config.Config) gin.HandlerFunc {
+			return handlers.BalanceHandler(ctx, logger, s, expiry.Policy{
+				Months: cfg.Loyalty.PointsExpiryMonths,
+				Soon:   cfg.Loyalty.PointsExpiringSoon,
+			})
+		}))
+	balanceAPI.POST(handlers.WithdrawHandlerPath,
+		middleware.RequireScope(logger, obj.ScopeBalanceWrite), srv.reloadable(cfg, func(cfg *config.Config) gin.HandlerFunc {
+			return handlers.WithdrawHandler(ctx, logger, s, stepUpPolicy(cfg), withdrawRules(cfg))
+		}))
+	balanceAPI.POST(handlers.TransferHandlerPath,
+		middleware.RequireScope(logger, obj.ScopeBalanceWrite), srv.reloadable(cfg, func(cfg *config.Config) gin.HandlerFunc {
+			return handlers.TransferHandler(ctx, logger, s, handlers.TransferPolicy{
+				DailyLimit: float32(cfg.Balance.TransferDailyLimit),
+				StepUp:     stepUpPolicy(cfg),
+			}, withdrawRules(cfg))
+		}))
+	balanceAPI.GET(handlers.TransfersHandlerPath,
+		middleware.RequireScope(logger, obj.ScopeBalanceRead), handlers.TransfersHandler(ctx, logger, s))
+	balanceAPI.POST(handlers.HoldsHandlerPath,
+		middleware.RequireScope(logger, obj.ScopeBalanceWrite), srv.reloadable(cfg, func(cfg *config.Config) gin.HandlerFunc {
+			return handlers.HoldHandler(ctx, logger, s, holds.Policy{
+				TTL:    cfg.Balance.HoldTTL,
+				MaxTTL: cfg.Balance.HoldMaxTTL,
+			}, stepUpPolicy(cfg), withdrawRules(cfg))
+		}))
+	balanceAPI.GET(handlers.HoldsHandlerPath,
+		middleware.RequireScope(logger, obj.ScopeBalanceRead), handlers.HoldsHandler(ctx, logger, s))
+	balanceAPI.POST(handlers.HoldCaptureHandlerPath,
+		middleware.RequireScope(logger, obj.ScopeBalanceWrite), handlers.HoldResolveHandler(ctx, logger, s, true))
+	balanceAPI.POST(handlers.HoldReleaseHandlerPath,
+		middleware.RequireScope(logger, obj.ScopeBalanceWrite), handlers.HoldResolveHandler(ctx, logger, s, false))
 
-	server := &HTTPServer{
-		server: &http.Server{
-			Addr:    cfg.RunAddress,
-			Handler: engine,
-		},
-		engine: engine,
-		cfg:    cfg,
-		logger: logger,
+	//account management is not available for api keys
+	accountAPI := userAPI.Group("", middleware.RequireSession(logger))
+	accountAPI.POST(handlers.TOTPEnrollHandlerPath, handlers.TOTPEnrollHandler(ctx, logger, s))
+	accountAPI.POST(handlers.TOTPConfirmHandlerPath, handlers.TOTPConfirmHandler(ctx, logger, s))
+	accountAPI.POST(handlers.TOTPVerifyHandlerPath, handlers.TOTPVerifyHandler(ctx, logger, s, session))
+	accountAPI.POST(handlers.APIKeysHandlerPath, handlers.APIKeyCreateHandler(ctx, logger, s, cfg.Auth.APIKeyMaxRateLimit))
+	accountAPI.GET(handlers.APIKeysHandlerPath, handlers.APIKeyListHandler(ctx, logger, s))
+	accountAPI.GET(handlers.ReferralsHandlerPath, handlers.ReferralsHandler(ctx, logger, s))
+	accountAPI.DELETE(handlers.APIKeyRevokeHandlerPath, handlers.APIKeyRevokeHandler(ctx, logger, s))
+	accountAPI.POST(handlers.WebhooksHandlerPath, handlers.WebhookCreateHandler(ctx, logger, s))
+	accountAPI.GET(handlers.WebhooksHandlerPath, handlers.WebhookListHandler(ctx, logger, s))
+	accountAPI.DELETE(handlers.WebhookHandlerPath, handlers.WebhookDeleteHandler(ctx, logger, s))
+	accountAPI.GET(handlers.WebhookDeliveriesHandlerPath, handlers.WebhookDeliveriesHandler(ctx, logger, s))
+	accountAPI.POST(handlers.WebhookRedeliverHandlerPath, handlers.WebhookRedeliverHandler(ctx, logger, s))
+	accountAPI.GET(handlers.NotificationPrefsHandlerPath, handlers.NotificationPrefsHandler(ctx, logger, s))
+	accountAPI.PUT(handlers.NotificationPrefsHandlerPath, handlers.NotificationPrefsUpdateHandler(ctx, logger, s, cfg.Notify.Channels()))
+
+	adminAPI := engine.Group(APIAdminRoute)
+	adminAPI.Use(middleware.Logger(logger), middleware.Auth(ctx, logger, s, session, cfg.Auth.APIKeyMaxRateLimit), middleware.CSRF(logger), middleware.RequireSession(logger),
+		middleware.RequireRole(logger, obj.RoleSupport, obj.RoleAdmin), middleware.AdminAudit(ctx, logger, s), validate)
+	adminAPI.GET(handlers.AdminUsersHandlerPath, handlers.AdminUsersHandler(ctx, logger, s))
+	adminAPI.GET(handlers.AdminUserHandlerPath, handlers.AdminUserHandler(ctx, logger, s))
+	adminAPI.GET(handlers.AdminUserOrdersHandlerPath, handlers.AdminUserOrdersHandler(ctx, logger, s))
+	adminAPI.GET(handlers.AdminUserWithdrawalsPath, handlers.AdminUserWithdrawalsHandler(ctx, logger, s))
+	adminAPI.GET(handlers.AdminUserLedgerHandlerPath, handlers.AdminUserLedgerHandler(ctx, logger, s))
+	adminAPI.POST(handlers.AdminRepollOrderHandlerPath, handlers.AdminRepollOrderHandler(ctx, logger, s))
+	adminAPI.GET(handlers.AdminCampaignsHandlerPath, handlers.AdminCampaignsHandler(ctx, logger, s))
+
+	//changes of money and access are reserved for admins
+	adminOnlyAPI := adminAPI.Group("", middleware.RequireRole(logger, obj.RoleAdmin))
+	adminOnlyAPI.POST(handlers.AdminAdjustBalanceHandlerPath, handlers.AdminAdjustBalanceHandler(ctx, logger, s))
+	adminOnlyAPI.POST(handlers.AdminRefundHandlerPath, handlers.AdminRefundHandler(ctx, logger, s))
+	adminOnlyAPI.POST(handlers.AdminBlockUserHandlerPath, handlers.AdminBlockUserHandler(ctx, logger, s, true))
+	adminOnlyAPI.POST(handlers.AdminUnblockUserHandlerPath, handlers.AdminBlockUserHandler(ctx, logger, s, false))
+	adminOnlyAPI.PUT(handlers.AdminSetRoleHandlerPath, handlers.AdminSetRoleHandler(ctx, logger, s))
+	adminOnlyAPI.POST(handlers.AdminCampaignsHandlerPath, handlers.AdminSaveCampaignHandler(ctx, logger, s, cfg.Loyalty.Tiers))
+	adminOnlyAPI.PUT(handlers.AdminCampaignHandlerPath, handlers.AdminSaveCampaignHandler(ctx, logger, s, cfg.Loyalty.Tiers))
+	adminOnlyAPI.DELETE(handlers.AdminCampaignHandlerPath, handlers.AdminDeleteCampaignHandler(ctx, logger, s))
+	adminOnlyAPI.GET(handlers.AuditLogHandlerPath, handlers.AuditLogHandler(ctx, logger, s))
+	adminOnlyAPI.GET(handlers.AuditExportHandlerPath, handlers.AuditExportHandler(ctx, logger, s))
+	adminOnlyAPI.POST(handlers.AdminReloadConfigHandlerPath, handlers.AdminReloadConfigHandler(logger, reloader))
+
+	return srv, nil
+}
+
+func stepUpPolicy(cfg *config.Config) handlers.StepUpPolicy {
+	return handlers.StepUpPolicy{
+		Threshold: float32(cfg.Auth.TwoFactorWithdrawThreshold),
+		MaxAge:    cfg.Auth.TwoFactorMaxAge,
 	}
+}
 
-	return server, nil
+func withdrawRules(cfg *config.Config) *obj.WithdrawRules {
+	return &obj.WithdrawRules{
+		MaxAmount:     float32(cfg.Balance.WithdrawMaxAmount),
+		DailyCap:      float32(cfg.Balance.WithdrawDailyCap),
+		WeeklyCap:     float32(cfg.Balance.WithdrawWeeklyCap),
+		MinAccountAge: cfg.Balance.WithdrawMinAccountAge,
+		MaxPerHour:    cfg.Balance.WithdrawMaxPerHour,
+		NewDeviceAge:  cfg.Balance.WithdrawNewDeviceAge,
+	}
+}
+
+func sameSite(v string) http.SameSite {
+	switch v {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
 }
 
 func (s *HTTPServer) Run(ctx context.Context) {
 	const op = "Server run error: "
 
 	go func() {
-		s.logger.Infof("Server was started on %s", s.cfg.RunAddress)
+		s.logger.Infof("Server was started on %s", s.cfg.Server.Address)
 		if err := s.server.ListenAndServe(); err != nil {
 			s.logger.Error(e.Wrap(op, err))
 		}
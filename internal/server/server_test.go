@@ -0,0 +1,81 @@
+package httpserver
+
+import (
+	"context"
+	"github.com/eqkez0r/gophermart"
+	"github.com/eqkez0r/gophermart/internal/config"
+	"github.com/eqkez0r/gophermart/internal/openapi"
+	"github.com/eqkez0r/gophermart/internal/server/handlers"
+	"github.com/eqkez0r/gophermart/internal/storage"
+	"github.com/eqkez0r/gophermart/pkg/jwt"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRoutesDocumented fails when a route is registered without being
+// described in OpenAPI.yaml, or the other way round.
+func TestRoutesDocumented(t *testing.T) {
+	cfg := config.Default()
+	srv, err := New(context.Background(), cfg, zap.NewNop().Sugar(), nil, nil, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	spec, err := openapi.Load(gophermart.OpenAPI)
+	if err != nil {
+		t.Fatalf("openapi.Load() error = %v", err)
+	}
+
+	registered := make(map[string]bool)
+	for _, r := range srv.engine.Routes() {
+		registered[openapi.Key(r.Method, r.Path)] = true
+		if spec.Operation(r.Method, r.Path) == nil {
+			t.Errorf("route %s %s is missing from OpenAPI.yaml", r.Method, r.Path)
+		}
+	}
+	for _, op := range spec.Operations() {
+		if !registered[op] {
+			t.Errorf("operation %s of OpenAPI.yaml is not registered", op)
+		}
+	}
+}
+
+// userStore knows the signed in user only, any other call panics.
+type userStore struct {
+	storage.Storage
+}
+
+func (userStore) GetUserInfo(_ context.Context, login string) (*obj.UserInfo, error) {
+	return &obj.UserInfo{Login: login, Role: obj.RoleUser}, nil
+}
+
+// TestBatchBodyLimit sends an order batch above its cap through the
+// whole middleware chain, it must be refused before anything buffers it.
+func TestBatchBodyLimit(t *testing.T) {
+	cfg := config.Default()
+	srv, err := New(context.Background(), cfg, zap.NewNop().Sugar(), userStore{}, nil, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	token, err := jwt.CreateJWT("alice", obj.RoleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := strings.Repeat("12345678903\n", handlers.MaxBatchBodySize/12+1)
+	if int64(len(body)) >= cfg.Server.MaxBodySize {
+		t.Fatalf("body of %d bytes is above the server max, the batch cap isn't tested", len(body))
+	}
+	req := httptest.NewRequest(http.MethodPost, APIUserRoute+handlers.NewOrderBatchHandlerPath, strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Authorization", token)
+	w := httptest.NewRecorder()
+	srv.engine.ServeHTTP(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("POST %s status = %v, want %v", handlers.NewOrderBatchHandlerPath, w.Code, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -1,15 +1,45 @@
 package writers
 
 import (
+	"compress/gzip"
 	"github.com/gin-gonic/gin"
-	"io"
 )
 
+// GzipWriter compresses the response body. The gzip stream and the
+// Content-Encoding header are created on the first write, so responses
+// without a body stay uncompressed.
 type GzipWriter struct {
 	gin.ResponseWriter
-	Writer io.Writer
+	gz *gzip.Writer
 }
 
-func (w GzipWriter) Write(b []byte) (int, error) {
-	return w.Writer.Write(b)
+func NewGzipWriter(w gin.ResponseWriter) *GzipWriter {
+	return &GzipWriter{ResponseWriter: w}
+}
+
+func (w *GzipWriter) Write(b []byte) (int, error) {
+	if w.gz == nil {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	return w.gz.Write(b)
+}
+
+func (w *GzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *GzipWriter) Flush() {
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *GzipWriter) Close() error {
+	if w.gz == nil {
+		return nil
+	}
+	return w.gz.Close()
 }
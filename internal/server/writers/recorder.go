@@ -0,0 +1,38 @@
+package writers
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+)
+
+// BodyRecorder passes the response through and keeps a copy of the
+// first limit bytes of the body.
+type BodyRecorder struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func NewBodyRecorder(w gin.ResponseWriter, limit int) *BodyRecorder {
+	return &BodyRecorder{ResponseWriter: w, limit: limit}
+}
+
+func (w *BodyRecorder) Write(b []byte) (int, error) {
+	if free := w.limit - w.body.Len(); free < len(b) {
+		w.truncated = true
+		w.body.Write(b[:max(free, 0)])
+	} else {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *BodyRecorder) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Body returns the recorded body and whether it was cut at the limit.
+func (w *BodyRecorder) Body() ([]byte, bool) {
+	return w.body.Bytes(), w.truncated
+}
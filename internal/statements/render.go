@@ -0,0 +1,82 @@
+package statements
+
+import (
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	htmltemplate "html/template"
+	"io"
+	"strconv"
+	texttemplate "text/template"
+)
+
+type view struct {
+	Login string
+	*obj.Statement
+}
+
+var funcs = map[string]interface{}{
+	"amount": func(f float32) string { return formatAmount(f) },
+	"signed": func(f float32) string {
+		if f < 0 {
+			return formatAmount(f)
+		}
+		return "+" + formatAmount(f)
+	},
+	//withdrawals are stored positive, 0 - f avoids printing -0.00
+	"negated": func(f float32) string { return formatAmount(0 - f) },
+}
+
+var textTemplate = texttemplate.Must(texttemplate.New("statement").Funcs(funcs).Parse(
+	`Gophermart statement {{.Month}}
+Account: {{.Login}}
+
+Opening balance {{printf "%14s" (amount .Opening)}}
+Accruals        {{printf "%14s" (signed .Accruals)}}
+Withdrawals     {{printf "%14s" (negated .Withdrawals)}}
+Adjustments     {{printf "%14s" (signed .Adjustments)}}
+Closing balance {{printf "%14s" (amount .Closing)}}
+
+Generated {{.GeneratedAt.UTC.Format "2006-01-02 15:04:05 UTC"}}
+`))
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("statement").Funcs(funcs).Parse(
+	`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Statement {{.Month}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td { padding: 0.3em 1em; border-bottom: 1px solid #ccc; }
+td.amount { text-align: right; font-variant-numeric: tabular-nums; }
+tr.total td { font-weight: bold; border-bottom: none; }
+</style>
+</head>
+<body>
+<h1>Statement {{.Month}}</h1>
+<p>Account: {{.Login}}</p>
+<table>
+<tr><td>Opening balance</td><td class="amount">{{amount .Opening}}</td></tr>
+<tr><td>Accruals</td><td class="amount">{{signed .Accruals}}</td></tr>
+<tr><td>Withdrawals</td><td class="amount">{{negated .Withdrawals}}</td></tr>
+<tr><td>Adjustments</td><td class="amount">{{signed .Adjustments}}</td></tr>
+<tr class="total"><td>Closing balance</td><td class="amount">{{amount .Closing}}</td></tr>
+</table>
+<p><small>Generated {{.GeneratedAt.UTC.Format "2006-01-02 15:04:05 UTC"}}</small></p>
+</body>
+</html>
+`))
+
+// RenderText writes a printable plain text statement.
+func RenderText(w io.Writer, login string, s *obj.Statement) error {
+	return textTemplate.Execute(w, view{Login: login, Statement: s})
+}
+
+// RenderHTML writes a printable HTML statement.
+func RenderHTML(w io.Writer, login string, s *obj.Statement) error {
+	return htmlTemplate.Execute(w, view{Login: login, Statement: s})
+}
+
+func formatAmount(f float32) string {
+	return strconv.FormatFloat(float64(f), 'f', 2, 32)
+}
@@ -0,0 +1,36 @@
+package statements
+
+import (
+	"context"
+	"github.com/eqkez0r/gophermart/internal/scheduler"
+	"go.uber.org/zap"
+	"time"
+)
+
+type Generator interface {
+	GenerateStatements(ctx context.Context, now time.Time) (int64, error)
+}
+
+// Job generates the statements of the months completed since its last
+// run. Running it more often than monthly only catches up sooner after
+// downtime, existing statements are kept as they are.
+func Job(
+	logger *zap.SugaredLogger,
+	store Generator,
+	interval time.Duration,
+) *scheduler.Job {
+	return &scheduler.Job{
+		Name:     "statements",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			n, err := store.GenerateStatements(ctx, time.Now())
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				logger.Infof("generated %d statements", n)
+			}
+			return nil
+		},
+	}
+}
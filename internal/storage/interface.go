@@ -3,19 +3,77 @@ package storage
 import (
 	"context"
 	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"time"
 )
 
 type Storage interface {
-	NewUser(context.Context, *obj.User) error
+	NewUser(context.Context, *obj.User, *obj.ReferralTerms) error
 	GetUser(context.Context, string) (*obj.User, error)
 	GetLastUserID(context.Context) (uint64, error)
 	IsUserExist(context.Context, string) (bool, error)
 	NewOrder(context.Context, string, string) error
-	GetOrdersList(context.Context, string) ([]*obj.Order, error)
+	NewOrders(context.Context, string, []string) (map[string]string, error)
+	GetOrdersList(context.Context, string, *obj.ListFilter) ([]*obj.Order, error)
 	GetUnfinishedOrders(context.Context) ([]*obj.Order, error)
+	UserOrder(context.Context, string, string) (*obj.OrderDetails, error)
+	TouchOrder(context.Context, string) error
 	GetBalance(context.Context, string) (*obj.AccrualBalance, error)
-	NewWithdraw(context.Context, string, string, float32) error
-	Withdrawals(context.Context, string) ([]*obj.Withdraw, error)
+	NewWithdraw(context.Context, string, string, float32, *obj.WithdrawRules) error
+	Withdrawals(context.Context, string, *obj.ListFilter) ([]*obj.Withdraw, error)
 	UpdateAccrual(context.Context, uint64, *obj.Accrual) error
+	SetTOTPSecret(context.Context, string, string) error
+	GetTOTP(context.Context, string) (*obj.TOTP, error)
+	EnableTOTP(context.Context, string, int64, []string) error
+	UseRecoveryCode(context.Context, string, string) (bool, error)
+	UseTOTPCounter(context.Context, string, int64) (bool, error)
+	SecondFactorFailed(context.Context, string, string, int, time.Time) error
+	ChallengeFailures(context.Context, string) (int, error)
+	UseChallenge(context.Context, string) (bool, error)
+	NewAPIKey(context.Context, string, *obj.APIKey, string) error
+	APIKeys(context.Context, string) ([]*obj.APIKey, error)
+	RevokeAPIKey(context.Context, string, uint64) error
+	GetAPIKey(context.Context, string) (*obj.APIKey, error)
+	TouchAPIKey(context.Context, uint64) error
+	GetUserInfo(context.Context, string) (*obj.UserInfo, error)
+	SearchUsers(context.Context, string, int) ([]*obj.UserInfo, error)
+	SetUserRole(context.Context, string, string) error
+	SetUserBlocked(context.Context, string, bool) error
+	AdjustBalance(context.Context, string, float32, string) error
+	Ledger(context.Context, string) ([]*obj.LedgerEntry, error)
+	RepollOrder(context.Context, string) error
+	Export(context.Context, string, time.Time, time.Time, func(*obj.ExportRecord) error) error
+	GenerateStatements(context.Context, time.Time) (int64, error)
+	Statements(context.Context, string) ([]*obj.Statement, error)
+	Statement(context.Context, string, time.Time) (*obj.Statement, error)
+	ExpirePoints(context.Context, int, time.Time) (int64, error)
+	ExpiringPoints(context.Context, string, int, time.Time) ([]*obj.ExpiringPoints, error)
+	RecalculateTiers(context.Context, []*obj.Tier, time.Time) (int64, error)
+	Referrals(context.Context, string) (*obj.Referrals, error)
+	Transfer(context.Context, string, string, float32, float32, string, *obj.WithdrawRules) (*obj.Transfer, error)
+	Transfers(context.Context, string) ([]*obj.Transfer, error)
+	RefundWithdrawal(context.Context, string, float32, string) (*obj.Withdraw, error)
+	NewHold(context.Context, string, string, float32, time.Time, *obj.WithdrawRules) (*obj.Hold, error)
+	CaptureHold(context.Context, string, string) (*obj.Hold, error)
+	ReleaseHold(context.Context, string, string) (*obj.Hold, error)
+	Holds(context.Context, string) ([]*obj.Hold, error)
+	ExpireHolds(context.Context, time.Time) (int64, error)
+	NewCampaign(context.Context, *obj.Campaign) error
+	UpdateCampaign(context.Context, *obj.Campaign) error
+	DeleteCampaign(context.Context, uint64) error
+	Campaigns(context.Context) ([]*obj.Campaign, error)
+	NewWebhook(context.Context, string, *obj.Webhook) error
+	Webhooks(context.Context, string) ([]*obj.Webhook, error)
+	DeleteWebhook(context.Context, string, uint64) error
+	WebhookDeliveries(context.Context, string, uint64) ([]*obj.WebhookDelivery, error)
+	RedeliverWebhook(context.Context, string, uint64, uint64) (*obj.WebhookDelivery, error)
+	ClaimWebhookDeliveries(context.Context, time.Time, time.Duration, int) ([]*obj.WebhookDelivery, error)
+	RecordWebhookAttempt(context.Context, *obj.WebhookDelivery, *obj.WebhookAttempt) error
+	NotificationPrefs(context.Context, string) (*obj.NotificationPrefs, error)
+	SetNotificationPrefs(context.Context, string, *obj.NotificationPrefs) error
+	ClaimNotifications(context.Context, time.Time, time.Duration, int) ([]*obj.Notification, error)
+	SettleNotification(context.Context, *obj.Notification) error
+	NewAuditRecord(context.Context, *obj.AuditRecord) error
+	AuditRecords(context.Context, *obj.AuditFilter, func(*obj.AuditRecord) error) error
+	RotateCredentials(context.Context, string, string) error
 	GracefulShutdown() error
 }
@@ -0,0 +1,148 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"github.com/eqkez0r/gophermart/pkg/audit"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	queryAlterUsersAccess = `ALTER TABLE users
+		ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'user',
+		ADD COLUMN IF NOT EXISTS blocked BOOLEAN NOT NULL DEFAULT FALSE,
+		ADD COLUMN IF NOT EXISTS created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()`
+
+	queryGetUserInfo = `SELECT user_id, login, role, blocked, accrual_balance, withdrawal_balance, created_at
+		FROM users WHERE login = $1`
+	querySearchUsers = `SELECT user_id, login, role, blocked, accrual_balance, withdrawal_balance, created_at
+		FROM users WHERE login ILIKE '%' || $1 || '%' ORDER BY login LIMIT $2`
+	querySetUserRole    = `UPDATE users SET role = $2 WHERE login = $1`
+	querySetUserBlocked = `UPDATE users SET blocked = $2 WHERE login = $1`
+	queryLockUser       = `SELECT user_id, accrual_balance, withdrawal_balance FROM users WHERE login = $1 FOR UPDATE`
+	queryRepollOrder    = `UPDATE orders SET order_status = 'NEW', order_accrual = NULL
+		WHERE order_number = $1 AND order_status <> 'PROCESSED' RETURNING order_number`
+	queryGetOrderStatus = `SELECT order_status FROM orders WHERE order_number = $1`
+)
+
+func (p *PostgreSQLStorage) GetUserInfo(ctx context.Context, login string) (*obj.UserInfo, error) {
+	u := &obj.UserInfo{}
+	err := p.pool.QueryRow(ctx, queryGetUserInfo, login).Scan(&u.UserID, &u.Login, &u.Role,
+		&u.Blocked, &u.Balance, &u.Withdraw, &u.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, e.ErrUserNotFound
+	}
+	if err != nil {
+		p.logger.Errorf("Database scan user info: %s. %v", login, err)
+		return nil, err
+	}
+	return u, nil
+}
+
+func (p *PostgreSQLStorage) SearchUsers(ctx context.Context, query string, limit int) ([]*obj.UserInfo, error) {
+	users := make([]*obj.UserInfo, 0)
+	rows, err := p.pool.Query(ctx, querySearchUsers, query, limit)
+	if err != nil {
+		p.logger.Errorf("Database query search users: %s. %v", query, err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		u := &obj.UserInfo{}
+		if err = rows.Scan(&u.UserID, &u.Login, &u.Role, &u.Blocked,
+			&u.Balance, &u.Withdraw, &u.CreatedAt); err != nil {
+			p.logger.Errorf("Database scan search users: %s. %v", query, err)
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (p *PostgreSQLStorage) SetUserRole(ctx context.Context, login, role string) error {
+	tag, err := p.pool.Exec(ctx, querySetUserRole, login, role)
+	if err != nil {
+		p.logger.Errorf("Database exec set user role: %s. %v", login, err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return e.ErrUserNotFound
+	}
+	return nil
+}
+
+func (p *PostgreSQLStorage) SetUserBlocked(ctx context.Context, login string, blocked bool) error {
+	tag, err := p.pool.Exec(ctx, querySetUserBlocked, login, blocked)
+	if err != nil {
+		p.logger.Errorf("Database exec set user blocked: %s. %v", login, err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return e.ErrUserNotFound
+	}
+	return nil
+}
+
+// AdjustBalance credits (positive amount) or debits (negative amount)
+// the user's balance and records the adjustment in the ledger.
+func (p *PostgreSQLStorage) AdjustBalance(ctx context.Context, login string, amount float32, reason string) error {
+	return p.inTx(ctx, func(tx pgx.Tx) error {
+		var userID uint64
+		before := &balanceState{}
+		err := tx.QueryRow(ctx, queryLockUser, login).Scan(&userID, &before.Balance, &before.Withdraw)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return e.ErrUserNotFound
+		}
+		if err != nil {
+			p.logger.Errorf("Database lock user: %s. %v", login, err)
+			return err
+		}
+		if before.Balance+amount < 0 {
+			return e.ErrBalanceIsNotEnough
+		}
+		after := &balanceState{}
+		err = tx.QueryRow(ctx, queryUpdateAccrualBalance, amount, userID).Scan(&after.Balance, &after.Withdraw)
+		if err != nil {
+			p.logger.Errorf("Database exec adjust balance: %s. %v", login, err)
+			return err
+		}
+		if _, err = tx.Exec(ctx, queryNewLedgerEntry,
+			userID, amount, obj.LedgerKindAdjustment, "", reason); err != nil {
+			p.logger.Errorf("Database exec new ledger entry: %s. %v", login, err)
+			return err
+		}
+		//debits spend the oldest points first like withdrawals
+		if amount < 0 {
+			if _, err = p.consumeLots(ctx, tx, userID, -amount); err != nil {
+				return err
+			}
+		}
+		return p.auditChange(ctx, tx, audit.ActionBalanceAdjust, login, before, after)
+	})
+}
+
+// RepollOrder resets the order to NEW so the order fetcher asks the
+// accrual system again. Processed orders are final because their accrual
+// has already been credited.
+func (p *PostgreSQLStorage) RepollOrder(ctx context.Context, number string) error {
+	var n string
+	err := p.pool.QueryRow(ctx, queryRepollOrder, number).Scan(&n)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		p.logger.Errorf("Database exec repoll order: %s. %v", number, err)
+		return err
+	}
+	var status string
+	err = p.pool.QueryRow(ctx, queryGetOrderStatus, number).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return e.ErrIsOrderIsNotExist
+	}
+	if err != nil {
+		return err
+	}
+	return e.ErrOrderAlreadyProcessed
+}
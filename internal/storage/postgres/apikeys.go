@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	queryCreateAPIKeysTable = `CREATE TABLE IF NOT EXISTS api_keys(
+		key_id SERIAL PRIMARY KEY,
+		user_id INTEGER REFERENCES users(user_id) ON DELETE CASCADE NOT NULL,
+		name VARCHAR(100) NOT NULL,
+		key_hash VARCHAR(64) UNIQUE NOT NULL,
+		key_prefix VARCHAR(16) NOT NULL,
+		scopes TEXT[] NOT NULL,
+		rate_limit INTEGER NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+		last_used_at TIMESTAMP WITH TIME ZONE,
+		revoked_at TIMESTAMP WITH TIME ZONE
+	)`
+
+	queryNewAPIKey = `INSERT INTO api_keys(user_id, name, key_hash, key_prefix, scopes, rate_limit)
+		SELECT user_id, $2, $3, $4, $5, $6 FROM users WHERE login = $1
+		RETURNING key_id, created_at`
+	queryGetAPIKeys = `SELECT k.key_id, k.name, k.key_prefix, k.scopes, k.rate_limit, k.created_at, k.last_used_at
+		FROM api_keys k JOIN users u ON u.user_id = k.user_id
+		WHERE u.login = $1 AND k.revoked_at IS NULL ORDER BY k.key_id`
+	queryRevokeAPIKey = `UPDATE api_keys SET revoked_at = now()
+		WHERE key_id = $2 AND revoked_at IS NULL
+		AND user_id = (SELECT user_id FROM users WHERE login = $1)`
+	queryGetAPIKeyByHash = `SELECT k.key_id, u.login, k.name, k.key_prefix, k.scopes, k.rate_limit, k.created_at, k.last_used_at
+		FROM api_keys k JOIN users u ON u.user_id = k.user_id
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL`
+	queryTouchAPIKey = `UPDATE api_keys SET last_used_at = now() WHERE key_id = $1`
+)
+
+func (p *PostgreSQLStorage) NewAPIKey(ctx context.Context, login string, key *obj.APIKey, keyHash string) error {
+	err := p.pool.QueryRow(ctx, queryNewAPIKey,
+		login, key.Name, keyHash, key.Prefix, key.Scopes, key.RateLimit).Scan(&key.KeyID, &key.CreatedAt)
+	if err != nil {
+		p.logger.Errorf("Database exec new api key: %s. %v", login, err)
+		return err
+	}
+	return nil
+}
+
+func (p *PostgreSQLStorage) APIKeys(ctx context.Context, login string) ([]*obj.APIKey, error) {
+	keys := make([]*obj.APIKey, 0)
+	rows, err := p.pool.Query(ctx, queryGetAPIKeys, login)
+	if err != nil {
+		p.logger.Errorf("Database query api keys: %s. %v", login, err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		key := &obj.APIKey{}
+		if err = rows.Scan(&key.KeyID, &key.Name, &key.Prefix, &key.Scopes,
+			&key.RateLimit, &key.CreatedAt, &key.LastUsedAt); err != nil {
+			p.logger.Errorf("Database scan api keys: %s. %v", login, err)
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (p *PostgreSQLStorage) RevokeAPIKey(ctx context.Context, login string, keyID uint64) error {
+	tag, err := p.pool.Exec(ctx, queryRevokeAPIKey, login, keyID)
+	if err != nil {
+		p.logger.Errorf("Database exec revoke api key: %s. %v", login, err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return e.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (p *PostgreSQLStorage) GetAPIKey(ctx context.Context, keyHash string) (*obj.APIKey, error) {
+	key := &obj.APIKey{}
+	err := p.pool.QueryRow(ctx, queryGetAPIKeyByHash, keyHash).Scan(&key.KeyID, &key.Login, &key.Name,
+		&key.Prefix, &key.Scopes, &key.RateLimit, &key.CreatedAt, &key.LastUsedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, e.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		p.logger.Errorf("Database scan api key. %v", err)
+		return nil, err
+	}
+	return key, nil
+}
+
+func (p *PostgreSQLStorage) TouchAPIKey(ctx context.Context, keyID uint64) error {
+	if _, err := p.pool.Exec(ctx, queryTouchAPIKey, keyID); err != nil {
+		p.logger.Errorf("Database exec touch api key: %d. %v", keyID, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/eqkez0r/gophermart/pkg/audit"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/jackc/pgx/v5/pgconn"
+	"time"
+)
+
+const (
+	queryCreateAuditTable = `CREATE TABLE IF NOT EXISTS audit_log(
+		record_id BIGSERIAL PRIMARY KEY,
+		actor VARCHAR(50) NOT NULL,
+		action VARCHAR(100) NOT NULL,
+		target VARCHAR(100),
+		details TEXT,
+		status INTEGER NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	)`
+	queryAlterAuditTable = `ALTER TABLE audit_log
+		ADD COLUMN IF NOT EXISTS ip VARCHAR(45),
+		ADD COLUMN IF NOT EXISTS user_agent TEXT,
+		ADD COLUMN IF NOT EXISTS request_id VARCHAR(64),
+		ADD COLUMN IF NOT EXISTS before_state JSONB,
+		ADD COLUMN IF NOT EXISTS after_state JSONB`
+	queryCreateAuditIndex    = `CREATE INDEX IF NOT EXISTS audit_log_time_idx ON audit_log(created_at)`
+	queryCreateAuditFunction = `CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit_log is append-only';
+		END;
+		$$ LANGUAGE plpgsql`
+	queryCreateAuditTrigger = `CREATE OR REPLACE TRIGGER audit_log_append_only
+		BEFORE UPDATE OR DELETE ON audit_log
+		FOR EACH ROW EXECUTE FUNCTION audit_log_append_only()`
+
+	queryNewAuditRecord = `INSERT INTO audit_log(actor, action, target, details, status,
+		ip, user_agent, request_id, before_state, after_state)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), $9, $10)`
+	queryGetAuditRecords = `SELECT record_id, actor, action, COALESCE(target, ''), COALESCE(details, ''), status,
+		COALESCE(ip, ''), COALESCE(user_agent, ''), COALESCE(request_id, ''), before_state, after_state, created_at
+		FROM audit_log
+		WHERE ($1 = '' OR actor = $1) AND ($2 = '' OR action = $2) AND ($3 = '' OR target = $3)
+		AND ($4::timestamptz IS NULL OR created_at >= $4) AND ($5::timestamptz IS NULL OR created_at < $5)
+		ORDER BY record_id LIMIT NULLIF($6, 0)`
+)
+
+// execer is implemented by both the pool and a transaction, so audit
+// records can be written as a part of the audited change.
+type execer interface {
+	Exec(context.Context, string, ...any) (pgconn.CommandTag, error)
+}
+
+// balanceState is the before/after snapshot of money-relevant records.
+type balanceState struct {
+	Balance  float32 `json:"current"`
+	Withdraw float32 `json:"withdrawn"`
+}
+
+func (p *PostgreSQLStorage) NewAuditRecord(ctx context.Context, record *obj.AuditRecord) error {
+	return p.writeAudit(ctx, p.pool, record)
+}
+
+// AuditRecords calls fn for every record matching the filter in the order
+// they were written. Rows are not buffered, so it is usable for exports.
+func (p *PostgreSQLStorage) AuditRecords(ctx context.Context, filter *obj.AuditFilter, fn func(*obj.AuditRecord) error) error {
+	rows, err := p.pool.Query(ctx, queryGetAuditRecords, filter.Actor, filter.Action, filter.Target,
+		nullTime(filter.From), nullTime(filter.To), filter.Limit)
+	if err != nil {
+		p.logger.Errorf("Database query audit records. %v", err)
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r := &obj.AuditRecord{}
+		if err = rows.Scan(&r.RecordID, &r.Actor, &r.Action, &r.Target, &r.Details, &r.Status,
+			&r.IP, &r.UserAgent, &r.RequestID, &r.Before, &r.After, &r.CreatedAt); err != nil {
+			p.logger.Errorf("Database scan audit record. %v", err)
+			return err
+		}
+		if err = fn(r); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// writeAudit completes the record with the request metadata from ctx.
+func (p *PostgreSQLStorage) writeAudit(ctx context.Context, db execer, record *obj.AuditRecord) error {
+	meta := audit.MetaFrom(ctx)
+	if record.Actor == "" {
+		record.Actor = meta.Actor
+	}
+	if record.IP == "" {
+		record.IP = meta.IP
+	}
+	if record.UserAgent == "" {
+		record.UserAgent = meta.UserAgent
+	}
+	if record.RequestID == "" {
+		record.RequestID = meta.RequestID
+	}
+	if _, err := db.Exec(ctx, queryNewAuditRecord,
+		record.Actor, record.Action, record.Target, record.Details, record.Status,
+		record.IP, record.UserAgent, record.RequestID, rawOrNil(record.Before), rawOrNil(record.After)); err != nil {
+		p.logger.Errorf("Database exec new audit record: %s. %v", record.Action, err)
+		return err
+	}
+	return nil
+}
+
+func (p *PostgreSQLStorage) auditChange(ctx context.Context, db execer, action, target string, before, after any) error {
+	record := &obj.AuditRecord{
+		Action: action,
+		Target: target,
+	}
+	var err error
+	if before != nil {
+		if record.Before, err = json.Marshal(before); err != nil {
+			return err
+		}
+	}
+	if after != nil {
+		if record.After, err = json.Marshal(after); err != nil {
+			return err
+		}
+	}
+	return p.writeAudit(ctx, db, record)
+}
+
+func rawOrNil(m json.RawMessage) any {
+	if len(m) == 0 {
+		return nil
+	}
+	return string(m)
+}
+
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,145 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"github.com/eqkez0r/gophermart/internal/campaigns"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// campaigns are deleted softly, so orders keep the name of the
+	// campaign applied to them
+	queryCreateCampaignsTable = `CREATE TABLE IF NOT EXISTS campaigns(
+		campaign_id SERIAL PRIMARY KEY,
+		name VARCHAR(100) NOT NULL,
+		starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		multiplier NUMERIC,
+		bonus NUMERIC,
+		segment VARCHAR(32),
+		order_prefix VARCHAR(20),
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+		deleted_at TIMESTAMP WITH TIME ZONE
+	)`
+	queryAlterOrdersCampaign = `ALTER TABLE orders
+		ADD COLUMN IF NOT EXISTS campaign_id INTEGER REFERENCES campaigns(campaign_id),
+		ADD COLUMN IF NOT EXISTS campaign_bonus NUMERIC`
+
+	campaignColumns = `campaign_id, name, starts_at, ends_at, COALESCE(multiplier, 0), COALESCE(bonus, 0),
+		COALESCE(segment, ''), COALESCE(order_prefix, ''), created_at`
+
+	queryNewCampaign = `INSERT INTO campaigns(name, starts_at, ends_at, multiplier, bonus, segment, order_prefix)
+		VALUES ($1, $2, $3, NULLIF($4::numeric, 0), NULLIF($5::numeric, 0), NULLIF($6, ''), NULLIF($7, ''))
+		RETURNING campaign_id, created_at`
+	queryUpdateCampaign = `UPDATE campaigns SET name = $2, starts_at = $3, ends_at = $4,
+		multiplier = NULLIF($5::numeric, 0), bonus = NULLIF($6::numeric, 0), segment = NULLIF($7, ''), order_prefix = NULLIF($8, '')
+		WHERE campaign_id = $1 AND deleted_at IS NULL RETURNING created_at`
+	queryDeleteCampaign = `UPDATE campaigns SET deleted_at = now() WHERE campaign_id = $1 AND deleted_at IS NULL`
+	queryGetCampaigns   = `SELECT ` + campaignColumns + ` FROM campaigns
+		WHERE deleted_at IS NULL ORDER BY starts_at DESC, campaign_id DESC`
+	//campaigns are matched by the upload time of the order, not by when it is processed
+	queryOrderCampaigns = `SELECT ` + campaignColumns + ` FROM campaigns
+		WHERE deleted_at IS NULL
+		AND starts_at <= (SELECT uploaded_at FROM orders WHERE order_number = $1)
+		AND ends_at > (SELECT uploaded_at FROM orders WHERE order_number = $1)
+		AND (segment IS NULL OR segment = $2)
+		AND (order_prefix IS NULL OR starts_with($1, order_prefix))
+		ORDER BY campaign_id`
+)
+
+func (p *PostgreSQLStorage) NewCampaign(ctx context.Context, c *obj.Campaign) error {
+	if err := p.pool.QueryRow(ctx, queryNewCampaign, c.Name, c.StartsAt, c.EndsAt,
+		c.Multiplier, c.Bonus, c.Segment, c.OrderPrefix).Scan(&c.CampaignID, &c.CreatedAt); err != nil {
+		p.logger.Errorf("Database exec new campaign: %s. %v", c.Name, err)
+		return err
+	}
+	return nil
+}
+
+func (p *PostgreSQLStorage) UpdateCampaign(ctx context.Context, c *obj.Campaign) error {
+	err := p.pool.QueryRow(ctx, queryUpdateCampaign, c.CampaignID, c.Name, c.StartsAt, c.EndsAt,
+		c.Multiplier, c.Bonus, c.Segment, c.OrderPrefix).Scan(&c.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return e.ErrCampaignNotFound
+	}
+	if err != nil {
+		p.logger.Errorf("Database exec update campaign: %d. %v", c.CampaignID, err)
+		return err
+	}
+	return nil
+}
+
+func (p *PostgreSQLStorage) DeleteCampaign(ctx context.Context, id uint64) error {
+	tag, err := p.pool.Exec(ctx, queryDeleteCampaign, id)
+	if err != nil {
+		p.logger.Errorf("Database exec delete campaign: %d. %v", id, err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return e.ErrCampaignNotFound
+	}
+	return nil
+}
+
+// Campaigns returns the campaigns which are not deleted, the latest
+// first.
+func (p *PostgreSQLStorage) Campaigns(ctx context.Context) ([]*obj.Campaign, error) {
+	rows, err := p.pool.Query(ctx, queryGetCampaigns)
+	if err != nil {
+		p.logger.Errorf("Database query campaigns: %s.", err)
+		return nil, err
+	}
+	cs, err := pgx.CollectRows(rows, scanCampaign)
+	if err != nil {
+		p.logger.Errorf("Database scan campaigns: %s.", err)
+		return nil, err
+	}
+	return cs, nil
+}
+
+// orderCampaign picks the campaign boosting the accrual of the order, nil
+// if none applies. Segments are matched against the tier of the user.
+func (p *PostgreSQLStorage) orderCampaign(ctx context.Context, tx pgx.Tx, number, tier string, accrual float32) (*obj.OrderCampaign, error) {
+	rows, err := tx.Query(ctx, queryOrderCampaigns, number, tier)
+	if err != nil {
+		p.logger.Errorf("Database query order campaigns: %s. %v", number, err)
+		return nil, err
+	}
+	cs, err := pgx.CollectRows(rows, scanCampaign)
+	if err != nil {
+		p.logger.Errorf("Database scan order campaigns: %s. %v", number, err)
+		return nil, err
+	}
+	best, boost := campaigns.Best(cs, accrual)
+	if best == nil {
+		return nil, nil
+	}
+	return &obj.OrderCampaign{
+		CampaignID: best.CampaignID,
+		Name:       best.Name,
+		Bonus:      boost,
+	}, nil
+}
+
+func scanCampaign(row pgx.CollectableRow) (*obj.Campaign, error) {
+	c := &obj.Campaign{}
+	err := row.Scan(&c.CampaignID, &c.Name, &c.StartsAt, &c.EndsAt, &c.Multiplier, &c.Bonus,
+		&c.Segment, &c.OrderPrefix, &c.CreatedAt)
+	return c, err
+}
+
+// orderCampaignOf builds the campaign of an order from the nullable
+// columns of the order queries.
+func orderCampaignOf(id *uint64, name *string, bonus *float32) *obj.OrderCampaign {
+	if id == nil || name == nil || bonus == nil {
+		return nil
+	}
+	return &obj.OrderCampaign{
+		CampaignID: *id,
+		Name:       *name,
+		Bonus:      *bonus,
+	}
+}
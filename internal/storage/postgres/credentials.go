@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+)
+
+// credentials are the user and password new connections are opened
+// with.
+type credentials struct {
+	user     string
+	password string
+}
+
+func (p *PostgreSQLStorage) beforeConnect(_ context.Context, cc *pgx.ConnConfig) error {
+	creds := p.creds.Load()
+	cc.User = creds.user
+	cc.Password = creds.password
+	return nil
+}
+
+// RotateCredentials switches the pool to the user and the password of
+// uri, password replaces the one of uri if set. The host stays the same.
+// The credentials are tried on a connection of their own first, so the
+// pool keeps the old ones if they don't work yet. Idle connections are
+// replaced right away and connections in use once their queries are
+// done, so the pool keeps serving throughout.
+func (p *PostgreSQLStorage) RotateCredentials(ctx context.Context, uri, password string) error {
+	cc, err := pgx.ParseConfig(uri)
+	if err != nil {
+		return err
+	}
+	if password != "" {
+		cc.Password = password
+	}
+	creds := &credentials{user: cc.User, password: cc.Password}
+	if *creds == *p.creds.Load() {
+		return nil
+	}
+
+	probe := p.pool.Config().ConnConfig.Copy()
+	probe.User = creds.user
+	probe.Password = creds.password
+	conn, err := pgx.ConnectConfig(ctx, probe)
+	if err != nil {
+		p.logger.Errorf("Database connect with rotated credentials: %s. %v", creds.user, err)
+		return err
+	}
+	if err = conn.Close(ctx); err != nil {
+		p.logger.Warnw("failed to close the probe connection", "error", err)
+	}
+
+	p.creds.Store(creds)
+	p.pool.Reset()
+	p.logger.Infof("database credentials rotated for %s", creds.user)
+	return nil
+}
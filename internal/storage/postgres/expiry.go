@@ -0,0 +1,212 @@
+package postgres
+
+import (
+	"context"
+	"github.com/eqkez0r/gophermart/internal/expiry"
+	"github.com/eqkez0r/gophermart/pkg/audit"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+const (
+	queryCreatePointLotsTable = `CREATE TABLE IF NOT EXISTS point_lots(
+		lot_id SERIAL PRIMARY KEY,
+		user_id INTEGER REFERENCES users(user_id) ON DELETE CASCADE NOT NULL,
+		order_number VARCHAR(20) UNIQUE,
+		amount NUMERIC NOT NULL,
+		remaining NUMERIC NOT NULL,
+		accrued_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		expired_at TIMESTAMP WITH TIME ZONE
+	)`
+	queryCreatePointLotsIndex = `CREATE INDEX IF NOT EXISTS point_lots_user_idx ON point_lots(user_id, accrued_at)
+		WHERE remaining > 0`
+
+	// queryBackfillPointLots creates the lots of the orders processed
+	// before lots existed. The spent part of the balance is taken from
+	// the oldest orders, as if withdrawals had always been FIFO.
+	queryBackfillPointLots = `INSERT INTO point_lots(user_id, order_number, amount, remaining, accrued_at)
+		SELECT o.order_customer, o.order_number, o.order_accrual,
+			GREATEST(0, LEAST(o.order_accrual, o.cumulative - (t.total - u.accrual_balance))),
+			o.order_time
+		FROM (SELECT order_customer, order_number, order_accrual, order_time,
+				SUM(order_accrual) OVER (PARTITION BY order_customer ORDER BY order_time, order_number) AS cumulative
+			FROM orders WHERE order_status = 'PROCESSED' AND order_accrual > 0) o
+		JOIN (SELECT order_customer, SUM(order_accrual) AS total
+			FROM orders WHERE order_status = 'PROCESSED' AND order_accrual > 0
+			GROUP BY order_customer) t ON t.order_customer = o.order_customer
+		JOIN users u ON u.user_id = o.order_customer
+		WHERE NOT EXISTS (SELECT 1 FROM point_lots)`
+
+	queryNewPointLot = `INSERT INTO point_lots(user_id, order_number, amount, remaining, accrued_at)
+		VALUES ($1, $2, $3, $3, $4) ON CONFLICT (order_number) DO NOTHING`
+	queryLockPointLots = `SELECT lot_id, COALESCE(order_number, ''), remaining, accrued_at FROM point_lots
+		WHERE user_id = $1 AND remaining > 0 ORDER BY accrued_at, lot_id FOR UPDATE`
+	queryUpdatePointLot = `UPDATE point_lots SET remaining = $1 WHERE lot_id = $2`
+
+	// lotExpiresAt is computed in UTC, so lots accrued at the end of a
+	// month expire at the end of shorter months like in the calendar.
+	lotExpiresAt = `((l.accrued_at AT TIME ZONE 'UTC') + make_interval(months => $1)) AT TIME ZONE 'UTC'`
+
+	queryGetDueLotUsers = `SELECT DISTINCT u.login FROM point_lots l JOIN users u ON u.user_id = l.user_id
+		WHERE l.remaining > 0 AND ` + lotExpiresAt + ` <= $2`
+	queryLockDueLots = `SELECT l.lot_id, COALESCE(l.order_number, ''), l.remaining, l.accrued_at FROM point_lots l
+		WHERE l.user_id = $3 AND l.remaining > 0 AND ` + lotExpiresAt + ` <= $2
+		ORDER BY l.accrued_at, l.lot_id FOR UPDATE`
+	queryExpirePointLot  = `UPDATE point_lots SET remaining = 0, expired_at = $1 WHERE lot_id = $2`
+	queryGetExpiringLots = `SELECT COALESCE(l.order_number, ''), l.remaining, ` + lotExpiresAt + `
+		FROM point_lots l JOIN users u ON u.user_id = l.user_id
+		WHERE u.login = $3 AND l.remaining > 0 AND ` + lotExpiresAt + ` <= $2
+		ORDER BY l.accrued_at, l.lot_id`
+)
+
+// ExpiringPoints returns the points of the user expiring until the given
+// time when points expire months after they were accrued.
+func (p *PostgreSQLStorage) ExpiringPoints(ctx context.Context, login string, months int, until time.Time) ([]*obj.ExpiringPoints, error) {
+	points := make([]*obj.ExpiringPoints, 0)
+	rows, err := p.pool.Query(ctx, queryGetExpiringLots, months, until, login)
+	if err != nil {
+		p.logger.Errorf("Database query expiring points: %s. %v", login, err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		pt := &obj.ExpiringPoints{}
+		if err = rows.Scan(&pt.Number, &pt.Amount, &pt.ExpiresAt); err != nil {
+			p.logger.Errorf("Database scan expiring points: %s. %v", login, err)
+			return nil, err
+		}
+		points = append(points, pt)
+	}
+	return points, rows.Err()
+}
+
+// ExpirePoints debits the lots accrued more than months ago and returns
+// how many lots expired. Every user is handled in its own transaction,
+// every lot gets a ledger entry referencing its order. Points reserved
+// by active holds don't expire while the hold is active.
+func (p *PostgreSQLStorage) ExpirePoints(ctx context.Context, months int, now time.Time) (int64, error) {
+	rows, err := p.pool.Query(ctx, queryGetDueLotUsers, months, now)
+	if err != nil {
+		p.logger.Errorf("Database query due point lots. %v", err)
+		return 0, err
+	}
+	logins, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		p.logger.Errorf("Database scan due point lots. %v", err)
+		return 0, err
+	}
+
+	var expired int64
+	for _, login := range logins {
+		n, err := p.expireUserPoints(ctx, login, months, now)
+		if err != nil {
+			return expired, err
+		}
+		expired += n
+	}
+	return expired, nil
+}
+
+func (p *PostgreSQLStorage) expireUserPoints(ctx context.Context, login string, months int, now time.Time) (int64, error) {
+	var expired int64
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		var userID uint64
+		before := &balanceState{}
+		if err := tx.QueryRow(ctx, queryLockUser, login).Scan(&userID, &before.Balance, &before.Withdraw); err != nil {
+			p.logger.Errorf("Database lock user: %s. %v", login, err)
+			return err
+		}
+		lots, err := p.collectLots(ctx, tx, queryLockDueLots, months, now, userID)
+		if err != nil {
+			return err
+		}
+		//points reserved by active holds must stay for the capture
+		held, err := p.heldPoints(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		amounts, kept := expiry.Expire(lots, before.Balance, held)
+		var total float32
+		for i, lot := range lots {
+			amount := amounts[i]
+			if kept[i] > 0 {
+				if _, err = tx.Exec(ctx, queryUpdatePointLot, kept[i], lot.LotID); err != nil {
+					p.logger.Errorf("Database exec keep point lot: %d. %v", lot.LotID, err)
+					return err
+				}
+			} else {
+				if _, err = tx.Exec(ctx, queryExpirePointLot, now, lot.LotID); err != nil {
+					p.logger.Errorf("Database exec expire point lot: %d. %v", lot.LotID, err)
+					return err
+				}
+				expired++
+			}
+			if amount <= 0 {
+				continue
+			}
+			if _, err = tx.Exec(ctx, queryNewLedgerEntry,
+				userID, -amount, obj.LedgerKindExpiry, lot.Number, "points expired"); err != nil {
+				p.logger.Errorf("Database exec new ledger entry: %d. %v", userID, err)
+				return err
+			}
+			total += amount
+		}
+
+		after := &balanceState{}
+		if err = tx.QueryRow(ctx, queryUpdateAccrualBalance, -total, userID).Scan(&after.Balance, &after.Withdraw); err != nil {
+			p.logger.Errorf("Database exec expire balance: %s. %v", login, err)
+			return err
+		}
+		return p.auditChange(ctx, tx, audit.ActionPointsExpire, login, before, after)
+	})
+	return expired, err
+}
+
+// consumeLots takes amount from the lots of the user oldest first and
+// returns the parts taken from every lot. The user row must be locked by
+// the transaction.
+func (p *PostgreSQLStorage) consumeLots(ctx context.Context, tx pgx.Tx, userID uint64, amount float32) ([]*obj.PointLot, error) {
+	lots, err := p.collectLots(ctx, tx, queryLockPointLots, userID)
+	if err != nil {
+		return nil, err
+	}
+	before := make(map[uint64]float32, len(lots))
+	for _, lot := range lots {
+		before[lot.LotID] = lot.Remaining
+	}
+	changed := expiry.Consume(lots, amount)
+	taken := make([]*obj.PointLot, 0, len(changed))
+	for _, lot := range changed {
+		if _, err = tx.Exec(ctx, queryUpdatePointLot, lot.Remaining, lot.LotID); err != nil {
+			p.logger.Errorf("Database exec consume point lot: %d. %v", lot.LotID, err)
+			return nil, err
+		}
+		taken = append(taken, &obj.PointLot{
+			LotID:     lot.LotID,
+			Number:    lot.Number,
+			Remaining: before[lot.LotID] - lot.Remaining,
+			AccruedAt: lot.AccruedAt,
+		})
+	}
+	return taken, nil
+}
+
+func (p *PostgreSQLStorage) collectLots(ctx context.Context, tx pgx.Tx, query string, args ...any) ([]*obj.PointLot, error) {
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		p.logger.Errorf("Database query point lots. %v", err)
+		return nil, err
+	}
+	lots, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*obj.PointLot, error) {
+		lot := &obj.PointLot{}
+		err := row.Scan(&lot.LotID, &lot.Number, &lot.Remaining, &lot.AccruedAt)
+		return lot, err
+	})
+	if err != nil {
+		p.logger.Errorf("Database scan point lots. %v", err)
+		return nil, err
+	}
+	return lots, nil
+}
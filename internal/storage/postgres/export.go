@@ -0,0 +1,49 @@
+package postgres
+
+import (
+	"context"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"time"
+)
+
+const (
+	queryExport = `WITH u AS (SELECT user_id FROM users WHERE login = $1)
+		SELECT 'order', o.uploaded_at, o.order_number, o.order_status, o.order_accrual, '', ''
+		FROM orders o, u WHERE o.order_customer = u.user_id
+		AND ($2::timestamptz IS NULL OR o.uploaded_at >= $2) AND ($3::timestamptz IS NULL OR o.uploaded_at < $3)
+		UNION ALL
+		SELECT 'withdrawal', w.withdraw_time, w.order_number, '', w.accrual, '', ''
+		FROM withdrawals w, u WHERE w.order_customer = u.user_id
+		AND ($2::timestamptz IS NULL OR w.withdraw_time >= $2) AND ($3::timestamptz IS NULL OR w.withdraw_time < $3)
+		UNION ALL
+		SELECT 'movement', l.created_at, COALESCE(l.reference, ''), '', l.amount, l.kind, COALESCE(l.reason, '')
+		FROM ledger l, u WHERE l.user_id = u.user_id AND l.kind NOT IN ($4, $5)
+		AND ($2::timestamptz IS NULL OR l.created_at >= $2) AND ($3::timestamptz IS NULL OR l.created_at < $3)
+		ORDER BY 2, 1, 3`
+)
+
+// Export calls fn for the user's orders, withdrawals and balance
+// movements within the period, ordered by time. Accruals and withdrawals
+// are exported as order and withdrawal rows only, not again as
+// movements. Rows go to fn straight from the database, nothing is
+// buffered.
+func (p *PostgreSQLStorage) Export(ctx context.Context, login string, from, to time.Time, fn func(*obj.ExportRecord) error) error {
+	rows, err := p.pool.Query(ctx, queryExport, login, nullTime(from), nullTime(to),
+		obj.LedgerKindAccrual, obj.LedgerKindWithdrawal)
+	if err != nil {
+		p.logger.Errorf("Database query export: %s. %v", login, err)
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r := &obj.ExportRecord{}
+		if err = rows.Scan(&r.Type, &r.Time, &r.Number, &r.Status, &r.Amount, &r.Kind, &r.Reason); err != nil {
+			p.logger.Errorf("Database scan export: %s. %v", login, err)
+			return err
+		}
+		if err = fn(r); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,226 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"github.com/eqkez0r/gophermart/pkg/audit"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+const (
+	queryCreateHoldsTable = `CREATE TABLE IF NOT EXISTS holds(
+		hold_id SERIAL PRIMARY KEY,
+		user_id INTEGER REFERENCES users(user_id) ON DELETE CASCADE NOT NULL,
+		order_number VARCHAR(20) NOT NULL,
+		amount NUMERIC NOT NULL CHECK (amount > 0),
+		status VARCHAR(10) NOT NULL DEFAULT 'active',
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+		expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		resolved_at TIMESTAMP WITH TIME ZONE
+	)`
+	queryCreateHoldsActiveIndex = `CREATE INDEX IF NOT EXISTS holds_active_idx ON holds(user_id, expires_at) WHERE status = 'active'`
+	queryCreateHoldsOrderIndex  = `CREATE INDEX IF NOT EXISTS holds_order_idx ON holds(order_number)`
+
+	//holds past their expiry don't reserve points even before the sweeper gets to them
+	queryHeldPoints = `SELECT COALESCE(SUM(amount), 0) FROM holds
+		WHERE user_id = $1 AND status = 'active' AND expires_at > now()`
+	queryOrderReserved = `SELECT EXISTS(SELECT 1 FROM holds WHERE order_number = $1 AND status = 'active' AND expires_at > now())
+		OR EXISTS(SELECT 1 FROM withdrawals WHERE order_number = $1)`
+	queryNewHold = `INSERT INTO holds(user_id, order_number, amount, expires_at) VALUES ($1, $2, $3, $4)
+		RETURNING hold_id, status, created_at`
+	queryLockHold = `SELECT hold_id, amount, status, created_at, expires_at, resolved_at, expires_at <= now()
+		FROM holds WHERE user_id = $1 AND order_number = $2 ORDER BY hold_id DESC LIMIT 1 FOR UPDATE`
+	queryResolveHold = `UPDATE holds SET status = $1, resolved_at = now() WHERE hold_id = $2 RETURNING resolved_at`
+	queryGetHolds    = `SELECT h.hold_id, h.order_number, h.amount, h.status, h.created_at, h.expires_at, h.resolved_at
+		FROM holds h JOIN users u ON u.user_id = h.user_id
+		WHERE u.login = $1 AND h.status = 'active' AND h.expires_at > now() ORDER BY h.expires_at`
+	queryExpireHolds = `UPDATE holds SET status = 'expired', resolved_at = expires_at
+		WHERE status = 'active' AND expires_at <= $1 RETURNING order_number`
+)
+
+// NewHold reserves sum points of the user for the order until expiresAt.
+// Reserved points can't be withdrawn or transferred, so the hold can be
+// captured as long as it is active. The withdraw rules apply when the
+// hold is made, not when it is captured.
+func (p *PostgreSQLStorage) NewHold(ctx context.Context, login, number string, sum float32, expiresAt time.Time, rules *obj.WithdrawRules) (*obj.Hold, error) {
+	hold := &obj.Hold{
+		Order:     number,
+		Sum:       sum,
+		ExpiresAt: expiresAt,
+	}
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		var userID uint64
+		before := &balanceState{}
+		if err := tx.QueryRow(ctx, queryLockUser, login).Scan(&userID, &before.Balance, &before.Withdraw); err != nil {
+			p.logger.Errorf("Database lock user: %s. %v", login, err)
+			return err
+		}
+
+		var reserved bool
+		if err := tx.QueryRow(ctx, queryOrderReserved, number).Scan(&reserved); err != nil {
+			p.logger.Errorf("Database query order reserved: %s. %v", number, err)
+			return err
+		}
+		if reserved {
+			return e.ErrOrderReserved
+		}
+
+		held, err := p.heldPoints(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		if before.Balance-held < sum {
+			p.logger.Errorf("Not enough balance for user: %d.", userID)
+			return e.ErrBalanceIsNotEnough
+		}
+		if err = p.checkWithdrawRules(ctx, tx, login, userID, sum, rules); err != nil {
+			return err
+		}
+
+		if err = tx.QueryRow(ctx, queryNewHold, userID, number, sum, expiresAt).Scan(
+			&hold.HoldID, &hold.Status, &hold.CreatedAt); err != nil {
+			p.logger.Errorf("Database exec new hold: %s. %v", number, err)
+			return err
+		}
+		return p.auditChange(ctx, tx, audit.ActionHold, number, nil, hold)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// CaptureHold turns the active hold of the order into a withdrawal.
+func (p *PostgreSQLStorage) CaptureHold(ctx context.Context, login, number string) (*obj.Hold, error) {
+	var hold *obj.Hold
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		var userID uint64
+		before := &balanceState{}
+		if err := tx.QueryRow(ctx, queryLockUser, login).Scan(&userID, &before.Balance, &before.Withdraw); err != nil {
+			p.logger.Errorf("Database lock user: %s. %v", login, err)
+			return err
+		}
+
+		var err error
+		if hold, err = p.resolveHold(ctx, tx, userID, number, obj.HoldStatusCaptured); err != nil {
+			return err
+		}
+		//the hold is resolved, so its points are available to the withdrawal
+		return p.withdraw(ctx, tx, userID, before, number, hold.Sum)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// ReleaseHold frees the points of the active hold of the order.
+func (p *PostgreSQLStorage) ReleaseHold(ctx context.Context, login, number string) (*obj.Hold, error) {
+	var hold *obj.Hold
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		var userID uint64
+		if err := tx.QueryRow(ctx, queryGetUserID, login).Scan(&userID); err != nil {
+			p.logger.Errorf("Database scan user: %s. %v", login, err)
+			return err
+		}
+
+		var err error
+		if hold, err = p.resolveHold(ctx, tx, userID, number, obj.HoldStatusReleased); err != nil {
+			return err
+		}
+		return p.auditChange(ctx, tx, audit.ActionHoldRelease, number, nil, hold)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// Holds returns the active holds of the user, the ones expiring first
+// come first.
+func (p *PostgreSQLStorage) Holds(ctx context.Context, login string) ([]*obj.Hold, error) {
+	rows, err := p.pool.Query(ctx, queryGetHolds, login)
+	if err != nil {
+		p.logger.Errorf("Database query holds: %s. %v", login, err)
+		return nil, err
+	}
+	holds, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*obj.Hold, error) {
+		h := &obj.Hold{}
+		err := row.Scan(&h.HoldID, &h.Order, &h.Sum, &h.Status, &h.CreatedAt, &h.ExpiresAt, &h.ResolvedAt)
+		return h, err
+	})
+	if err != nil {
+		p.logger.Errorf("Database scan holds: %s. %v", login, err)
+		return nil, err
+	}
+	return holds, nil
+}
+
+// ExpireHolds marks the holds which expired before now and returns how
+// many there were. Their points are available again as soon as they
+// expire, the sweep only settles their status.
+func (p *PostgreSQLStorage) ExpireHolds(ctx context.Context, now time.Time) (int64, error) {
+	var expired int64
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, queryExpireHolds, now)
+		if err != nil {
+			p.logger.Errorf("Database exec expire holds: %s.", err)
+			return err
+		}
+		numbers, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			p.logger.Errorf("Database scan expired holds: %s.", err)
+			return err
+		}
+		for _, number := range numbers {
+			if err = p.writeAudit(ctx, tx, &obj.AuditRecord{
+				Action: audit.ActionHoldExpire,
+				Target: number,
+			}); err != nil {
+				return err
+			}
+		}
+		expired = int64(len(numbers))
+		return nil
+	})
+	return expired, err
+}
+
+// resolveHold moves the latest hold of the user for the order out of the
+// active status.
+func (p *PostgreSQLStorage) resolveHold(ctx context.Context, tx pgx.Tx, userID uint64, number, status string) (*obj.Hold, error) {
+	hold := &obj.Hold{Order: number}
+	var expired bool
+	err := tx.QueryRow(ctx, queryLockHold, userID, number).Scan(
+		&hold.HoldID, &hold.Sum, &hold.Status, &hold.CreatedAt, &hold.ExpiresAt, &hold.ResolvedAt, &expired)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, e.ErrHoldNotFound
+	}
+	if err != nil {
+		p.logger.Errorf("Database lock hold: %s. %v", number, err)
+		return nil, err
+	}
+	if hold.Status != obj.HoldStatusActive || expired {
+		return nil, e.ErrHoldNotActive
+	}
+
+	hold.Status = status
+	if err = tx.QueryRow(ctx, queryResolveHold, status, hold.HoldID).Scan(&hold.ResolvedAt); err != nil {
+		p.logger.Errorf("Database exec resolve hold: %s. %v", number, err)
+		return nil, err
+	}
+	return hold, nil
+}
+
+// heldPoints returns the points of the user reserved by active holds.
+func (p *PostgreSQLStorage) heldPoints(ctx context.Context, tx pgx.Tx, userID uint64) (float32, error) {
+	var held float32
+	if err := tx.QueryRow(ctx, queryHeldPoints, userID).Scan(&held); err != nil {
+		p.logger.Errorf("Database query held points: %d. %v", userID, err)
+		return 0, err
+	}
+	return held, nil
+}
@@ -0,0 +1,45 @@
+package postgres
+
+import (
+	"context"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+)
+
+const (
+	queryCreateLedgerTable = `CREATE TABLE IF NOT EXISTS ledger(
+		entry_id SERIAL PRIMARY KEY,
+		user_id INTEGER REFERENCES users(user_id) ON DELETE CASCADE NOT NULL,
+		amount NUMERIC NOT NULL,
+		kind VARCHAR(20) NOT NULL,
+		reference VARCHAR(64),
+		reason TEXT,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	)`
+	queryCreateLedgerIndex = `CREATE INDEX IF NOT EXISTS ledger_user_time_idx ON ledger(user_id, created_at)`
+
+	queryNewLedgerEntry = `INSERT INTO ledger(user_id, amount, kind, reference, reason)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''))`
+	queryGetLedger = `SELECT l.entry_id, l.amount, l.kind, COALESCE(l.reference, ''), COALESCE(l.reason, ''), l.created_at
+		FROM ledger l JOIN users u ON u.user_id = l.user_id
+		WHERE u.login = $1 ORDER BY l.created_at DESC, l.entry_id DESC`
+)
+
+func (p *PostgreSQLStorage) Ledger(ctx context.Context, login string) ([]*obj.LedgerEntry, error) {
+	entries := make([]*obj.LedgerEntry, 0)
+	rows, err := p.pool.Query(ctx, queryGetLedger, login)
+	if err != nil {
+		p.logger.Errorf("Database query ledger: %s. %v", login, err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		entry := &obj.LedgerEntry{}
+		if err = rows.Scan(&entry.EntryID, &entry.Amount, &entry.Kind,
+			&entry.Reference, &entry.Reason, &entry.CreatedAt); err != nil {
+			p.logger.Errorf("Database scan ledger: %s. %v", login, err)
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"github.com/eqkez0r/gophermart/internal/limits"
+	"github.com/eqkez0r/gophermart/pkg/audit"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+const (
+	queryCreateAuditActorIndex = `CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log(actor, created_at)`
+
+	//refunded points don't count against the caps
+	queryWithdrawActivity = `SELECT u.created_at,
+			COALESCE(SUM(w.accrual - w.refunded) FILTER (WHERE w.withdraw_time > $2::timestamptz - interval '1 day'), 0),
+			COALESCE(SUM(w.accrual - w.refunded), 0),
+			COUNT(w.withdraw_id) FILTER (WHERE w.withdraw_time > $2::timestamptz - interval '1 hour')
+		FROM users u
+		LEFT JOIN withdrawals w ON w.order_customer = u.user_id AND w.withdraw_time > $2::timestamptz - interval '7 days'
+		WHERE u.user_id = $1 GROUP BY u.user_id`
+	queryHoldActivity = `SELECT COALESCE(SUM(amount) FILTER (WHERE created_at > $2::timestamptz - interval '1 day'), 0),
+			COALESCE(SUM(amount), 0),
+			COUNT(*) FILTER (WHERE created_at > $2::timestamptz - interval '1 hour')
+		FROM holds WHERE user_id = $1 AND status = 'active' AND expires_at > now()
+		AND created_at > $2::timestamptz - interval '7 days'`
+	//a device is known from the first successful sign-in with its user
+	//agent, the count tells whether the user has a sign-in history at all
+	queryTransferActivity = `SELECT COALESCE(SUM(amount) FILTER (WHERE created_at > $2::timestamptz - interval '1 day'), 0),
+			COALESCE(SUM(amount), 0),
+			COUNT(*) FILTER (WHERE created_at > $2::timestamptz - interval '1 hour')
+		FROM transfers WHERE sender_id = $1 AND created_at > $2::timestamptz - interval '7 days'`
+	queryDeviceSeenAt = `SELECT MIN(created_at) FILTER (WHERE user_agent = $2), COUNT(*) FROM audit_log
+		WHERE actor = $1 AND (action = $3 OR action = $4 AND status = 200)`
+	queryAPIKeySeenAt = `SELECT created_at FROM api_keys WHERE key_id = $1`
+)
+
+// checkWithdrawRules evaluates the rules for a withdrawal, hold or
+// transfer of sum by the locked user. Active holds and sent transfers
+// count as withdrawals in the windows they were created in. Requests made with an
+// api key are treated as coming from a device first seen when the key was
+// created.
+//
+// Other devices are told apart by the user agent only, so the new device
+// rule is best-effort: it holds back a stolen session used from another
+// client, not an attacker copying the user agent. Users without a sign-in
+// history, e.g. from before the audit log, have no new devices.
+func (p *PostgreSQLStorage) checkWithdrawRules(ctx context.Context, tx pgx.Tx, login string, userID uint64, sum float32, rules *obj.WithdrawRules) error {
+	if !rules.Enabled() {
+		return nil
+	}
+	now := time.Now()
+
+	a := &obj.WithdrawActivity{}
+	if err := tx.QueryRow(ctx, queryWithdrawActivity, userID, now).Scan(
+		&a.RegisteredAt, &a.Day, &a.Week, &a.LastHour); err != nil {
+		p.logger.Errorf("Database query withdraw activity: %s. %v", login, err)
+		return err
+	}
+	var heldDay, heldWeek float32
+	var holds int
+	if err := tx.QueryRow(ctx, queryHoldActivity, userID, now).Scan(&heldDay, &heldWeek, &holds); err != nil {
+		p.logger.Errorf("Database query hold activity: %s. %v", login, err)
+		return err
+	}
+	var sentDay, sentWeek float32
+	var transfers int
+	if err := tx.QueryRow(ctx, queryTransferActivity, userID, now).Scan(&sentDay, &sentWeek, &transfers); err != nil {
+		p.logger.Errorf("Database query transfer activity: %s. %v", login, err)
+		return err
+	}
+	a.Day += heldDay + sentDay
+	a.Week += heldWeek + sentWeek
+	a.LastHour += holds + transfers
+
+	if rules.NewDeviceAge > 0 {
+		var seenAt *time.Time
+		var err error
+		meta := audit.MetaFrom(ctx)
+		if meta.APIKeyID != 0 {
+			err = tx.QueryRow(ctx, queryAPIKeySeenAt, meta.APIKeyID).Scan(&seenAt)
+		} else {
+			var signIns int
+			err = tx.QueryRow(ctx, queryDeviceSeenAt, login, meta.UserAgent, audit.ActionRegister, audit.ActionLogin).Scan(&seenAt, &signIns)
+			if seenAt == nil && signIns == 0 {
+				seenAt = &a.RegisteredAt
+			}
+		}
+		if err != nil {
+			p.logger.Errorf("Database query device seen at: %s. %v", login, err)
+			return err
+		}
+		if seenAt != nil {
+			a.DeviceSeenAt = *seenAt
+		}
+	}
+
+	return limits.Check(rules, a, sum, now)
+}
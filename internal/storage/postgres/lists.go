@@ -0,0 +1,116 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+)
+
+const (
+	// order_time is overwritten when the accrual system answers, so the
+	// upload time gets its own column. Older rows are backfilled with
+	// order_time, the best value known for them.
+	queryAlterOrdersUploadedAt        = `ALTER TABLE orders ADD COLUMN IF NOT EXISTS uploaded_at TIMESTAMP WITH TIME ZONE`
+	queryBackfillOrdersUploadedAt     = `UPDATE orders SET uploaded_at = order_time WHERE uploaded_at IS NULL`
+	queryAlterOrdersUploadedAtDefault = `ALTER TABLE orders
+		ALTER COLUMN uploaded_at SET DEFAULT now(),
+		ALTER COLUMN uploaded_at SET NOT NULL`
+	queryCreateOrdersPageIndex      = `CREATE INDEX IF NOT EXISTS orders_customer_upload_idx ON orders(order_customer, uploaded_at, order_number)`
+	queryCreateWithdrawalsPageIndex = `CREATE INDEX IF NOT EXISTS withdrawals_customer_time_idx ON withdrawals(order_customer, withdraw_time, order_number)`
+
+	// The page queries take the comparison and the direction as
+	// arguments, the cursor is compared as a row so ties on time are
+	// broken by the number.
+	queryOrdersPage = `SELECT o.order_number, o.order_accrual, o.uploaded_at, o.order_status, c.campaign_id, c.name, o.campaign_bonus
+		FROM orders o JOIN users u ON u.user_id = o.order_customer
+		LEFT JOIN campaigns c ON c.campaign_id = o.campaign_id
+		WHERE u.login = $1
+		AND (COALESCE(cardinality($2::text[]), 0) = 0 OR o.order_status = ANY($2::text[]))
+		AND ($3::timestamptz IS NULL OR o.uploaded_at >= $3)
+		AND ($4::timestamptz IS NULL OR o.uploaded_at < $4)
+		AND ($5::timestamptz IS NULL OR (o.uploaded_at, o.order_number) %[1]s ($5, $6::text))
+		ORDER BY o.uploaded_at %[2]s, o.order_number %[2]s LIMIT NULLIF($7::int, 0)`
+	queryWithdrawalsPage = `SELECT w.order_number, w.accrual, w.status, w.refunded, w.withdraw_time
+		FROM withdrawals w JOIN users u ON u.user_id = w.order_customer
+		WHERE u.login = $1
+		AND (COALESCE(cardinality($2::text[]), 0) = 0 OR w.status = ANY($2::text[]))
+		AND ($3::timestamptz IS NULL OR w.withdraw_time >= $3)
+		AND ($4::timestamptz IS NULL OR w.withdraw_time < $4)
+		AND ($5::timestamptz IS NULL OR (w.withdraw_time, w.order_number) %[1]s ($5, $6::text))
+		ORDER BY w.withdraw_time %[2]s, w.order_number %[2]s LIMIT NULLIF($7::int, 0)`
+)
+
+var (
+	queryOrdersPageAsc       = fmt.Sprintf(queryOrdersPage, ">", "ASC")
+	queryOrdersPageDesc      = fmt.Sprintf(queryOrdersPage, "<", "DESC")
+	queryWithdrawalsPageAsc  = fmt.Sprintf(queryWithdrawalsPage, ">", "ASC")
+	queryWithdrawalsPageDesc = fmt.Sprintf(queryWithdrawalsPage, "<", "DESC")
+)
+
+// GetOrdersList returns a page of the user's orders, ordered by upload
+// time and number.
+func (p *PostgreSQLStorage) GetOrdersList(ctx context.Context, login string, filter *obj.ListFilter) ([]*obj.Order, error) {
+	query := queryOrdersPageAsc
+	if filter.Desc {
+		query = queryOrdersPageDesc
+	}
+	after, number := cursorArgs(filter.After)
+
+	orders := make([]*obj.Order, 0)
+	rows, err := p.pool.Query(ctx, query, login, filter.Statuses,
+		nullTime(filter.From), nullTime(filter.To), after, number, filter.Limit)
+	if err != nil {
+		p.logger.Errorf("Database query orders list: %s. %v", login, err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		order := &obj.Order{}
+		var campaignID *uint64
+		var campaignName *string
+		var campaignBonus *float32
+		if err = rows.Scan(&order.Number, &order.Accrual, &order.UploadAt, &order.Status,
+			&campaignID, &campaignName, &campaignBonus); err != nil {
+			p.logger.Errorf("Database scan orders list: %s. %v", login, err)
+			return nil, err
+		}
+		order.Campaign = orderCampaignOf(campaignID, campaignName, campaignBonus)
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
+// Withdrawals returns a page of the user's withdrawals, ordered by time
+// and order number.
+func (p *PostgreSQLStorage) Withdrawals(ctx context.Context, login string, filter *obj.ListFilter) ([]*obj.Withdraw, error) {
+	query := queryWithdrawalsPageAsc
+	if filter.Desc {
+		query = queryWithdrawalsPageDesc
+	}
+	after, number := cursorArgs(filter.After)
+
+	withdrawals := make([]*obj.Withdraw, 0)
+	rows, err := p.pool.Query(ctx, query, login, filter.Statuses,
+		nullTime(filter.From), nullTime(filter.To), after, number, filter.Limit)
+	if err != nil {
+		p.logger.Errorf("Database query withdrawals: %s. %v", login, err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		withdraw := &obj.Withdraw{}
+		if err = rows.Scan(&withdraw.Order, &withdraw.Sum, &withdraw.Status, &withdraw.Refunded, &withdraw.ProcessedAt); err != nil {
+			p.logger.Errorf("Database scan withdrawals: %s. %v", login, err)
+			return nil, err
+		}
+		withdrawals = append(withdrawals, withdraw)
+	}
+	return withdrawals, rows.Err()
+}
+
+func cursorArgs(cur *obj.Cursor) (any, string) {
+	if cur == nil {
+		return nil, ""
+	}
+	return cur.Time, cur.Number
+}
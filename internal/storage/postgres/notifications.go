@@ -0,0 +1,134 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+const (
+	queryCreateNotificationPrefsTable = `CREATE TABLE IF NOT EXISTS notification_prefs(
+		user_id INTEGER PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+		locale VARCHAR(8) NOT NULL,
+		email VARCHAR(254),
+		phone VARCHAR(16),
+		push_token TEXT,
+		channels TEXT[] NOT NULL,
+		events TEXT[] NOT NULL,
+		updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	)`
+	queryCreateNotificationsTable = `CREATE TABLE IF NOT EXISTS notifications(
+		notification_id SERIAL PRIMARY KEY,
+		user_id INTEGER REFERENCES users(user_id) ON DELETE CASCADE NOT NULL,
+		event VARCHAR(32) NOT NULL,
+		channel VARCHAR(8) NOT NULL,
+		recipient TEXT NOT NULL,
+		locale VARCHAR(8) NOT NULL,
+		data JSONB NOT NULL,
+		status VARCHAR(10) NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		error TEXT,
+		next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+		sent_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	)`
+	queryCreateNotificationsDueIndex = `CREATE INDEX IF NOT EXISTS notifications_due_idx
+		ON notifications(next_attempt_at) WHERE status = 'pending'`
+
+	//users without preferences get empty ones
+	queryGetNotificationPrefs = `SELECT COALESCE(p.locale, ''), COALESCE(p.email, ''), COALESCE(p.phone, ''),
+		COALESCE(p.push_token, ''), COALESCE(p.channels, '{}'), COALESCE(p.events, '{}')
+		FROM users u LEFT JOIN notification_prefs p ON p.user_id = u.user_id WHERE u.login = $1`
+	querySetNotificationPrefs = `INSERT INTO notification_prefs(user_id, locale, email, phone, push_token, channels, events)
+		SELECT user_id, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6, $7 FROM users WHERE login = $1
+		ON CONFLICT (user_id) DO UPDATE SET locale = EXCLUDED.locale, email = EXCLUDED.email, phone = EXCLUDED.phone,
+		push_token = EXCLUDED.push_token, channels = EXCLUDED.channels, events = EXCLUDED.events, updated_at = now()`
+	//one notification per channel of the user with an address
+	queryEnqueueNotifications = `INSERT INTO notifications(user_id, event, channel, recipient, locale, data)
+		SELECT p.user_id, $2, ch, CASE ch WHEN 'email' THEN p.email WHEN 'sms' THEN p.phone ELSE p.push_token END, p.locale, $3
+		FROM notification_prefs p, unnest(p.channels) ch
+		WHERE p.user_id = $1 AND $2 = ANY(p.events)
+		AND CASE ch WHEN 'email' THEN p.email WHEN 'sms' THEN p.phone ELSE p.push_token END IS NOT NULL`
+	queryClaimNotifications = `UPDATE notifications SET next_attempt_at = $2
+		WHERE notification_id IN (
+			SELECT notification_id FROM notifications
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at LIMIT $3 FOR UPDATE SKIP LOCKED)
+		RETURNING notification_id, event, channel, recipient, locale, data, status, attempts`
+	querySettleNotification = `UPDATE notifications SET status = $2, attempts = $3, error = NULLIF($4, ''),
+		next_attempt_at = $5, sent_at = $6 WHERE notification_id = $1`
+)
+
+func (p *PostgreSQLStorage) NotificationPrefs(ctx context.Context, login string) (*obj.NotificationPrefs, error) {
+	prefs := &obj.NotificationPrefs{}
+	err := p.pool.QueryRow(ctx, queryGetNotificationPrefs, login).Scan(
+		&prefs.Locale, &prefs.Email, &prefs.Phone, &prefs.PushToken, &prefs.Channels, &prefs.Events)
+	if err != nil {
+		p.logger.Errorf("Database query notification prefs: %s. %v", login, err)
+		return nil, err
+	}
+	return prefs, nil
+}
+
+func (p *PostgreSQLStorage) SetNotificationPrefs(ctx context.Context, login string, prefs *obj.NotificationPrefs) error {
+	if _, err := p.pool.Exec(ctx, querySetNotificationPrefs, login, prefs.Locale, prefs.Email, prefs.Phone,
+		prefs.PushToken, prefs.Channels, prefs.Events); err != nil {
+		p.logger.Errorf("Database exec set notification prefs: %s. %v", login, err)
+		return err
+	}
+	return nil
+}
+
+// ClaimNotifications returns up to limit notifications due at now and
+// postpones them by lease.
+func (p *PostgreSQLStorage) ClaimNotifications(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*obj.Notification, error) {
+	rows, err := p.pool.Query(ctx, queryClaimNotifications, now, now.Add(lease), limit)
+	if err != nil {
+		p.logger.Errorf("Database exec claim notifications: %s.", err)
+		return nil, err
+	}
+	ns, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*obj.Notification, error) {
+		n := &obj.Notification{}
+		err := row.Scan(&n.NotificationID, &n.Event, &n.Channel, &n.Recipient, &n.Locale, &n.Data, &n.Status, &n.Attempts)
+		return n, err
+	})
+	if err != nil {
+		p.logger.Errorf("Database scan notifications: %s.", err)
+		return nil, err
+	}
+	return ns, nil
+}
+
+func (p *PostgreSQLStorage) SettleNotification(ctx context.Context, n *obj.Notification) error {
+	if _, err := p.pool.Exec(ctx, querySettleNotification,
+		n.NotificationID, n.Status, n.Attempts, n.Error, n.NextAttemptAt, n.SentAt); err != nil {
+		p.logger.Errorf("Database exec settle notification: %d. %v", n.NotificationID, err)
+		return err
+	}
+	return nil
+}
+
+// enqueueNotifications queues the event for the channels of the user if
+// the user wants to be notified of it.
+func (p *PostgreSQLStorage) enqueueNotifications(ctx context.Context, tx pgx.Tx, userID uint64, event string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, queryEnqueueNotifications, userID, event, b); err != nil {
+		p.logger.Errorf("Database exec enqueue notifications: %d. %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// publish queues the event for the webhooks and the notifications of the
+// user.
+func (p *PostgreSQLStorage) publish(ctx context.Context, tx pgx.Tx, userID uint64, event string, data any) error {
+	if err := p.enqueueWebhooks(ctx, tx, userID, event, data); err != nil {
+		return err
+	}
+	return p.enqueueNotifications(ctx, tx, userID, event, data)
+}
@@ -0,0 +1,129 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"github.com/eqkez0r/gophermart/pkg/audit"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	queryAlterOrdersPolling = `ALTER TABLE orders
+		ADD COLUMN IF NOT EXISTS checked_at TIMESTAMP WITH TIME ZONE,
+		ADD COLUMN IF NOT EXISTS poll_count INTEGER NOT NULL DEFAULT 0`
+
+	queryGetUserOrder = `SELECT o.order_number, o.order_status, o.order_accrual, o.uploaded_at, o.checked_at, o.poll_count,
+			c.campaign_id, c.name, o.campaign_bonus
+		FROM orders o JOIN users u ON u.user_id = o.order_customer
+		LEFT JOIN campaigns c ON c.campaign_id = o.campaign_id
+		WHERE o.order_number = $1 AND u.login = $2`
+	queryTouchOrder = `UPDATE orders SET checked_at = now(), poll_count = poll_count + 1 WHERE order_number = $1`
+
+	queryNewOrders = `INSERT INTO orders(order_number, order_customer, order_time, uploaded_at, order_status)
+		SELECT n, $2, now(), now(), $3 FROM unnest($1::text[]) AS n
+		ON CONFLICT (order_number) DO NOTHING
+		RETURNING order_number`
+	queryGetOrderOwners = `SELECT order_number, order_customer FROM orders WHERE order_number = ANY($1::text[])`
+)
+
+// UserOrder returns the order of the user. Orders of other users are
+// reported as not existing, so numbers of other users can't be probed.
+func (p *PostgreSQLStorage) UserOrder(ctx context.Context, login, number string) (*obj.OrderDetails, error) {
+	o := &obj.OrderDetails{}
+	var campaignID *uint64
+	var campaignName *string
+	var campaignBonus *float32
+	err := p.pool.QueryRow(ctx, queryGetUserOrder, number, login).Scan(
+		&o.Number, &o.Status, &o.Accrual, &o.UploadAt, &o.CheckedAt, &o.Polls,
+		&campaignID, &campaignName, &campaignBonus)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, e.ErrIsOrderIsNotExist
+	}
+	if err != nil {
+		p.logger.Errorf("Database query user order: %s. %v", number, err)
+		return nil, err
+	}
+	o.Campaign = orderCampaignOf(campaignID, campaignName, campaignBonus)
+	return o, nil
+}
+
+// TouchOrder records a poll of the accrual system for the order.
+func (p *PostgreSQLStorage) TouchOrder(ctx context.Context, number string) error {
+	if _, err := p.pool.Exec(ctx, queryTouchOrder, number); err != nil {
+		p.logger.Errorf("Database exec touch order: %s. %v", number, err)
+		return err
+	}
+	return nil
+}
+
+// NewOrders uploads the numbers for the user in one transaction and
+// returns the result of every number: accepted, already uploaded by the
+// user or belonging to another user, like NewOrder does for one number.
+func (p *PostgreSQLStorage) NewOrders(ctx context.Context, login string, numbers []string) (map[string]string, error) {
+	results := make(map[string]string, len(numbers))
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		var userID uint64
+		if err := tx.QueryRow(ctx, queryGetUserID, login).Scan(&userID); err != nil {
+			p.logger.Errorf("Database scan user: %s. %v", login, err)
+			return err
+		}
+
+		rows, err := tx.Query(ctx, queryNewOrders, numbers, userID, obj.OrderStatusNew)
+		if err != nil {
+			p.logger.Errorf("Database exec orders batch: %s. %v", login, err)
+			return err
+		}
+		accepted, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			p.logger.Errorf("Database scan orders batch: %s. %v", login, err)
+			return err
+		}
+		for _, n := range accepted {
+			results[n] = obj.BatchOrderAccepted
+		}
+
+		//the rest existed before, tell own orders from the others
+		if len(accepted) < len(numbers) {
+			rows, err = tx.Query(ctx, queryGetOrderOwners, numbers)
+			if err != nil {
+				p.logger.Errorf("Database query order owners: %s. %v", login, err)
+				return err
+			}
+			var (
+				number   string
+				customer uint64
+			)
+			_, err = pgx.ForEachRow(rows, []any{&number, &customer}, func() error {
+				if _, ok := results[number]; ok {
+					return nil
+				}
+				results[number] = obj.BatchOrderAnotherUser
+				if customer == userID {
+					results[number] = obj.BatchOrderAlreadyUploaded
+				}
+				return nil
+			})
+			if err != nil {
+				p.logger.Errorf("Database scan order owners: %s. %v", login, err)
+				return err
+			}
+		}
+
+		for _, n := range accepted {
+			err = p.writeAudit(ctx, tx, &obj.AuditRecord{
+				Action: audit.ActionOrderUpload,
+				Target: n,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
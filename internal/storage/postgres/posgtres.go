@@ -3,12 +3,15 @@ package postgres
 import (
 	"context"
 	"errors"
+	"github.com/eqkez0r/gophermart/internal/tiers"
+	"github.com/eqkez0r/gophermart/pkg/audit"
 	e "github.com/eqkez0r/gophermart/pkg/error"
 	obj "github.com/eqkez0r/gophermart/pkg/objects"
 	"github.com/eqkez0r/gophermart/utils/retry"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
+	"sync/atomic"
 	"time"
 )
 
@@ -35,46 +38,136 @@ const (
     	accrual NUMERIC NOT NULL,
     	withdraw_time TIMESTAMP WITH TIME ZONE NOT NULL
 )`
-	queryNewUser                    = `INSERT INTO users(login, password, accrual_balance, withdrawal_balance) VALUES ($1, $2, 0, 0)`
-	queryGetUser                    = `SELECT * FROM users WHERE login = $1`
+	queryNewUser                    = `INSERT INTO users(login, password, accrual_balance, withdrawal_balance, referral_code, register_ip) VALUES ($1, $2, 0, 0, $3, NULLIF($4, '')) RETURNING user_id`
+	queryGetUser                    = `SELECT user_id, login, password, accrual_balance, withdrawal_balance, role, blocked FROM users WHERE login = $1`
 	queryGetOnlyLogin               = `SELECT login FROM users WHERE login = $1`
+	queryGetUserID                  = `SELECT user_id FROM users WHERE login = $1`
 	queryGetLastUserID              = `SELECT user_id FROM users ORDER BY user_id DESC LIMIT 1`
-	queryGetBalance                 = `SELECT accrual_balance, withdrawal_balance FROM users WHERE login = $1`
-	queryUpdateAccrualBalance       = `UPDATE users SET accrual_balance = accrual_balance + $1 WHERE user_id = $2`
+	queryGetBalance                 = `SELECT accrual_balance, withdrawal_balance, tier, tier_multiplier, tier_points, tier_calculated_at, (SELECT COALESCE(SUM(amount), 0) FROM holds h WHERE h.user_id = users.user_id AND h.status = 'active' AND h.expires_at > now()) FROM users WHERE login = $1`
+	queryUpdateAccrualBalance       = `UPDATE users SET accrual_balance = accrual_balance + $1 WHERE user_id = $2 RETURNING accrual_balance, withdrawal_balance`
 	queryUpdateBalanceAfterWithdraw = `UPDATE users SET accrual_balance = accrual_balance - $1, withdrawal_balance = withdrawal_balance + $1 WHERE user_id = $2`
 
 	queryNewOrder = `INSERT INTO orders(order_number,
                    order_customer,
                    order_time,
-                   order_status) VALUES ($1,$2,$3,$4)`
+                   uploaded_at,
+                   order_status) VALUES ($1,$2,$3,$3,$4)`
 
-	queryGetOrderList = `SELECT * FROM orders WHERE order_customer = $1`
 	//add accrual here
-	queryUpdateOrderStatus = `UPDATE orders SET order_status = $1, order_time = $2, order_accrual = $3 WHERE order_number = $4`
-	queryGetNotFinished    = `SELECT order_customer, order_number FROM orders WHERE order_status = 'NEW' OR order_status = 'PROCESSING'`
-	queryGetOrder          = `SELECT order_customer FROM orders WHERE order_number = $1`
+	queryUpdateOrderStatus = `UPDATE orders SET order_status = $1, order_time = $2, order_accrual = $3,
+		base_accrual = $5, order_tier = NULLIF($6, ''), campaign_id = $7, campaign_bonus = $8
+		WHERE order_number = $4 AND order_status <> 'PROCESSED' RETURNING uploaded_at`
+	queryGetNotFinished = `SELECT order_customer, order_number FROM orders WHERE order_status = 'NEW' OR order_status = 'PROCESSING'`
+	queryGetOrder       = `SELECT order_customer FROM orders WHERE order_number = $1`
 
-	queryNewWithdraw     = `INSERT INTO withdrawals(order_customer, order_number, accrual, withdraw_time) VALUES ($1, $2, $3, $4)`
-	queryGetWithdrawList = `SELECT * FROM withdrawals WHERE order_customer = $1`
+	queryNewWithdraw = `INSERT INTO withdrawals(order_customer, order_number, accrual, withdraw_time) VALUES ($1, $2, $3, $4)`
 )
 
+// schema holds the tables added after the initial release. Unlike the
+// tables above they are created with IF NOT EXISTS, so errors are reported.
+var schema = []string{
+	queryAlterUsersAccess,
+	queryCreateLedgerTable,
+	queryCreateLedgerIndex,
+	queryCreateAuditTable,
+	queryAlterAuditTable,
+	queryCreateAuditIndex,
+	queryCreateAuditFunction,
+	queryCreateAuditTrigger,
+	queryCreateTOTPTable,
+	queryCreateRecoveryCodesTable,
+	queryCreateAPIKeysTable,
+	queryAlterOrdersUploadedAt,
+	queryBackfillOrdersUploadedAt,
+	queryAlterOrdersUploadedAtDefault,
+	queryCreateOrdersPageIndex,
+	queryCreateWithdrawalsPageIndex,
+	queryAlterOrdersPolling,
+	queryCreateStatementsTable,
+	queryCreatePointLotsTable,
+	queryCreatePointLotsIndex,
+	queryBackfillPointLots,
+	queryAlterUsersTier,
+	queryAlterOrdersTier,
+	queryAlterUsersReferral,
+	queryBackfillReferralCodes,
+	queryCreateReferralsTable,
+	queryCreateReferralsIndex,
+	queryCreateTransfersTable,
+	queryCreateTransfersSenderIndex,
+	queryCreateTransfersRecipientIndex,
+	queryAlterWithdrawalsStatus,
+	queryCreateHoldsTable,
+	queryCreateHoldsActiveIndex,
+	queryCreateHoldsOrderIndex,
+	queryCreateAuditActorIndex,
+	queryCreateCampaignsTable,
+	queryAlterOrdersCampaign,
+	queryCreateWebhooksTable,
+	queryCreateWebhookDeliveriesTable,
+	queryCreateWebhookDeliveriesDueIndex,
+	queryCreateWebhookAttemptsTable,
+	queryCreateNotificationPrefsTable,
+	queryCreateNotificationsTable,
+	queryCreateNotificationsDueIndex,
+	queryAlterTOTPAttempts,
+	queryCreateChallengeFailuresTable,
+	queryCreateUsedChallengesTable,
+}
+
 type PostgreSQLStorage struct {
 	logger *zap.SugaredLogger
 	pool   *pgxpool.Pool
+	//credentials of new connections, see RotateCredentials
+	creds atomic.Pointer[credentials]
+}
+
+// Options tune the connection pool, zero values keep the pgx defaults.
+// Connecting and migrating are retried ConnectRetries times. Password
+// replaces the password of the uri if set.
+type Options struct {
+	Password        string
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	ConnectRetries  int
 }
 
 func New(
 	ctx context.Context,
 	logger *zap.SugaredLogger,
 	uri string,
+	opts Options,
 ) (*PostgreSQLStorage, error) {
 	const op = "Initial PostreSQL user storage error: "
-	pool, err := pgxpool.New(ctx, uri)
+	poolCfg, err := pgxpool.ParseConfig(uri)
 	if err != nil {
 		return nil, e.Wrap(op, err)
 	}
+	if opts.MaxConns > 0 {
+		poolCfg.MaxConns = opts.MaxConns
+	}
+	if opts.MinConns > 0 {
+		poolCfg.MinConns = opts.MinConns
+	}
+	if opts.MaxConnLifetime > 0 {
+		poolCfg.MaxConnLifetime = opts.MaxConnLifetime
+	}
+	if opts.Password != "" {
+		poolCfg.ConnConfig.Password = opts.Password
+	}
+	storage := &PostgreSQLStorage{
+		logger: logger,
+	}
+	storage.creds.Store(&credentials{user: poolCfg.ConnConfig.User, password: poolCfg.ConnConfig.Password})
+	poolCfg.BeforeConnect = storage.beforeConnect
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+	if err != nil {
+		return nil, e.Wrap(op, err)
+	}
+	storage.pool = pool
 
-	err = retry.Retry(logger, 3, func() error {
+	err = retry.Retry(logger, opts.ConnectRetries, func() error {
 		if err = pool.Ping(ctx); err != nil {
 			return err
 		}
@@ -84,7 +177,7 @@ func New(
 		return nil, e.Wrap(op, err)
 	}
 
-	err = retry.Retry(logger, 3, func() error {
+	err = retry.Retry(logger, opts.ConnectRetries, func() error {
 		_, err = pool.Exec(ctx, queryCreateUserTable)
 		return nil
 	})
@@ -93,7 +186,7 @@ func New(
 		return nil, e.Wrap(op, err)
 	}
 
-	err = retry.Retry(logger, 3, func() error {
+	err = retry.Retry(logger, opts.ConnectRetries, func() error {
 		_, err = pool.Exec(ctx, queryCreateOrdersTable)
 		return nil
 	})
@@ -102,7 +195,7 @@ func New(
 		return nil, e.Wrap(op, err)
 	}
 
-	err = retry.Retry(logger, 3, func() error {
+	err = retry.Retry(logger, opts.ConnectRetries, func() error {
 		_, err = pool.Exec(ctx, queryCreateWithdrawsTable)
 		return nil
 	})
@@ -111,31 +204,55 @@ func New(
 		return nil, e.Wrap(op, err)
 	}
 
-	return &PostgreSQLStorage{
-		pool:   pool,
-		logger: logger,
-	}, nil
+	for _, query := range schema {
+		err = retry.Retry(logger, opts.ConnectRetries, func() error {
+			_, err := pool.Exec(ctx, query)
+			return err
+		})
+		if err != nil {
+			return nil, e.Wrap(op, err)
+		}
+	}
+
+	return storage, nil
 }
 
-func (p *PostgreSQLStorage) NewUser(ctx context.Context, user *obj.User) error {
-	p.logger.Infof("user data %v", user)
-	_, err := p.pool.Exec(ctx, queryNewUser, user.Login, user.Password)
+// NewUser creates the user with its own referral code. When the user
+// signed up with the code of another user, the referral is recorded with
+// the given terms.
+func (p *PostgreSQLStorage) NewUser(ctx context.Context, user *obj.User, terms *obj.ReferralTerms) error {
+	p.logger.Infof("new user %s", user.Login)
+	code, err := newReferralCode()
 	if err != nil {
-		p.logger.Errorf("Database exec user: %s. %v", user.Login, err)
 		return err
 	}
-	return nil
+	return p.inTx(ctx, func(tx pgx.Tx) error {
+		var userID uint64
+		err := tx.QueryRow(ctx, queryNewUser, user.Login, user.Password, code, audit.MetaFrom(ctx).IP).Scan(&userID)
+		if err != nil {
+			p.logger.Errorf("Database exec user: %s. %v", user.Login, err)
+			return err
+		}
+		if user.ReferralCode != "" {
+			if err = p.attachReferral(ctx, tx, userID, user.ReferralCode, terms); err != nil {
+				return err
+			}
+		}
+		return p.writeAudit(ctx, tx, &obj.AuditRecord{
+			Actor:  user.Login,
+			Action: audit.ActionRegister,
+			Target: user.Login,
+		})
+	})
 }
 
 func (p *PostgreSQLStorage) GetUser(ctx context.Context, login string) (*obj.User, error) {
 	row := p.pool.QueryRow(ctx, queryGetUser, login)
 	usr := &obj.User{}
-	p.logger.Infof("initial user data %v", usr)
-	if err := row.Scan(&usr.UserID, &usr.Login, &usr.Password, &usr.Balance, &usr.Withdraw); err != nil {
+	if err := row.Scan(&usr.UserID, &usr.Login, &usr.Password, &usr.Balance, &usr.Withdraw, &usr.Role, &usr.Blocked); err != nil {
 		p.logger.Errorf("Database scan user: %s. %v", login, err)
 		return nil, err
 	}
-	p.logger.Infof("Get user data %v", usr)
 	return usr, nil
 }
 
@@ -160,84 +277,34 @@ func (p *PostgreSQLStorage) IsUserExist(ctx context.Context, login string) (bool
 
 func (p *PostgreSQLStorage) NewOrder(ctx context.Context, login, number string) error {
 	p.logger.Infof("called NewOrder, number: %v, login: %s", number, login)
-	tx, err := p.pool.Begin(ctx)
-	if err != nil {
-		return err
-	}
-
-	user, err := p.GetUser(ctx, login)
-	if err != nil {
-		return err
-	}
-
-	var userid uint64
-	row := p.pool.QueryRow(ctx, queryGetOrder, number)
-	err = row.Scan(&userid)
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		p.logger.Errorf("Scan order for check duplicate: %s. %v", login, err)
-		return err
-	}
-	if userid != user.UserID && userid != 0 {
-		p.logger.Errorf("Scan order for check duplicate: %s. %v", login, err)
-		return e.ErrIsOrderExistWithAnotherCustomer
-	}
-	t := time.Now().Format(time.RFC3339)
-	_, err = p.pool.Exec(ctx, queryNewOrder, number, user.UserID, t, obj.OrderStatusNew)
-	if err != nil {
-		p.logger.Errorf("Database exec order: %s. %v", number, err)
-		return err
-	}
-	err = tx.Commit(ctx)
-	defer func() {
-		if err != nil {
-			err = tx.Rollback(ctx)
-			if err != nil {
-				p.logger.Errorf("Database rollback order: %s. %v", number, err)
-			}
+	return p.inTx(ctx, func(tx pgx.Tx) error {
+		var userID uint64
+		if err := tx.QueryRow(ctx, queryGetUserID, login).Scan(&userID); err != nil {
+			p.logger.Errorf("Database scan user: %s. %v", login, err)
+			return err
 		}
-	}()
-	return nil
-}
-
-func (p *PostgreSQLStorage) GetOrdersList(ctx context.Context, login string) ([]*obj.Order, error) {
-	orders := make([]*obj.Order, 0)
-	tx, err := p.pool.Begin(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	user, err := p.GetUser(ctx, login)
-	if err != nil {
-		return nil, err
-	}
 
-	rows, err := p.pool.Query(ctx, queryGetOrderList, user.UserID)
-	if err != nil {
-		p.logger.Errorf("Database query orders list: %s. %v", user.UserID, err)
-		return nil, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		order := &obj.Order{}
-		if err = rows.Scan(&order.Number, &order.UserID, &order.Accrual, &order.UploadAt, &order.Status); err != nil {
-			p.logger.Errorf("Database query orders list: %s. %v", user.UserID, err)
-			return nil, err
+		var customer uint64
+		err := tx.QueryRow(ctx, queryGetOrder, number).Scan(&customer)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			p.logger.Errorf("Scan order for check duplicate: %s. %v", login, err)
+			return err
 		}
-		orders = append(orders, order)
-	}
-	err = tx.Commit(ctx)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		if err != nil {
-			err = tx.Rollback(ctx)
-			if err != nil {
-				p.logger.Errorf("Database rollback order: %s. %v", user.UserID, err)
-			}
+		if customer != userID && customer != 0 {
+			p.logger.Errorf("Order %s is uploaded by another customer: %s.", number, login)
+			return e.ErrIsOrderExistWithAnotherCustomer
 		}
-	}()
-	return orders, nil
+
+		t := time.Now().Format(time.RFC3339)
+		if _, err = tx.Exec(ctx, queryNewOrder, number, userID, t, obj.OrderStatusNew); err != nil {
+			p.logger.Errorf("Database exec order: %s. %v", number, err)
+			return err
+		}
+		return p.writeAudit(ctx, tx, &obj.AuditRecord{
+			Action: audit.ActionOrderUpload,
+			Target: number,
+		})
+	})
 }
 
 func (p *PostgreSQLStorage) GetUnfinishedOrders(ctx context.Context) ([]*obj.Order, error) {
@@ -262,123 +329,200 @@ func (p *PostgreSQLStorage) GetUnfinishedOrders(ctx context.Context) ([]*obj.Ord
 
 func (p *PostgreSQLStorage) GetBalance(ctx context.Context, login string) (*obj.AccrualBalance, error) {
 	accrualbalance := &obj.AccrualBalance{}
+	tier := &obj.TierInfo{}
+	var calculatedAt *time.Time
 	row := p.pool.QueryRow(ctx, queryGetBalance, login)
-	if err := row.Scan(&accrualbalance.Balance, &accrualbalance.Withdraw); err != nil {
+	if err := row.Scan(&accrualbalance.Balance, &accrualbalance.Withdraw,
+		&tier.Name, &tier.Multiplier, &tier.Points, &calculatedAt, &accrualbalance.Held); err != nil {
 		return nil, err
 	}
+	//expired points or adjustments may leave less than the holds reserve
+	accrualbalance.Balance = max(accrualbalance.Balance-accrualbalance.Held, 0)
+	if tier.Name != "" && calculatedAt != nil {
+		tier.CalculatedAt = *calculatedAt
+		accrualbalance.Tier = tier
+	}
 	p.logger.Infof("parsed accrual balance: %v", accrualbalance)
 	return accrualbalance, nil
 }
 
-func (p *PostgreSQLStorage) NewWithdraw(ctx context.Context, login, number string, withdraw float32) error {
-	tx, err := p.pool.Begin(ctx)
-	if err != nil {
-		return err
-	}
-	user, err := p.GetUser(ctx, login)
+// NewWithdraw withdraws points of the user for the order if the rules
+// allow it.
+func (p *PostgreSQLStorage) NewWithdraw(ctx context.Context, login, number string, withdraw float32, rules *obj.WithdrawRules) error {
+	return p.inTx(ctx, func(tx pgx.Tx) error {
+		var userID uint64
+		before := &balanceState{}
+		if err := tx.QueryRow(ctx, queryLockUser, login).Scan(&userID, &before.Balance, &before.Withdraw); err != nil {
+			p.logger.Errorf("Database lock user: %s. %v", login, err)
+			return err
+		}
+
+		if err := p.checkWithdrawRules(ctx, tx, login, userID, withdraw, rules); err != nil {
+			return err
+		}
+		return p.withdraw(ctx, tx, userID, before, number, withdraw)
+	})
+}
+
+// withdraw debits the user locked with the before balance. Points
+// reserved by active holds are not available.
+func (p *PostgreSQLStorage) withdraw(ctx context.Context, tx pgx.Tx, userID uint64, before *balanceState, number string, withdraw float32) error {
+	held, err := p.heldPoints(ctx, tx, userID)
 	if err != nil {
 		return err
 	}
-
-	if user.Balance < withdraw {
-		p.logger.Errorf("Not enough balance for user: %s.", user.UserID)
+	if before.Balance-held < withdraw {
+		p.logger.Errorf("Not enough balance for user: %d.", userID)
 		return e.ErrBalanceIsNotEnough
 	}
 
-	p.logger.Infof("update account balance %d, %f, %f", user.UserID, user.Balance, user.Withdraw)
-	if _, err = p.pool.Exec(ctx, queryUpdateBalanceAfterWithdraw, withdraw, user.UserID); err != nil {
+	if _, err = tx.Exec(ctx, queryUpdateBalanceAfterWithdraw, withdraw, userID); err != nil {
 		p.logger.Errorf("Database exec change account balance: %s.", err)
 		return err
 	}
 
-	t := time.Now().Format(time.RFC3339)
-	if _, err = p.pool.Exec(ctx, queryNewWithdraw,
-		user.UserID, number, withdraw, t); err != nil {
-		p.logger.Errorf("Database exec new withdraw: %s.", user.UserID)
+	now := time.Now()
+	t := now.Format(time.RFC3339)
+	if _, err = tx.Exec(ctx, queryNewWithdraw,
+		userID, number, withdraw, t); err != nil {
+		p.logger.Errorf("Database exec new withdraw: %d.", userID)
 		return err
 	}
 
-	userAfter, err := p.GetUser(ctx, login)
-	if err != nil {
+	if _, err = tx.Exec(ctx, queryNewLedgerEntry,
+		userID, -withdraw, obj.LedgerKindWithdrawal, number, ""); err != nil {
+		p.logger.Errorf("Database exec new ledger entry: %d. %v", userID, err)
 		return err
 	}
-	p.logger.Infof("before user data %v, after user data %v", userAfter, userAfter)
-	err = tx.Commit(ctx)
-	if err != nil {
-		p.logger.Errorf("Database commit transaction: %s.", err)
+
+	if _, err = p.consumeLots(ctx, tx, userID, withdraw); err != nil {
 		return err
 	}
-	defer func() {
-		if err != nil {
-			p.logger.Info("Rollback transaction")
-			err = tx.Rollback(ctx)
+
+	after := &balanceState{
+		Balance:  before.Balance - withdraw,
+		Withdraw: before.Withdraw + withdraw,
+	}
+	if err = p.auditChange(ctx, tx, audit.ActionWithdraw, number, before, after); err != nil {
+		return err
+	}
+	return p.publish(ctx, tx, userID, obj.EventWithdrawalCreated, &obj.Withdraw{
+		Order:       number,
+		Sum:         withdraw,
+		Status:      obj.WithdrawStatusCompleted,
+		ProcessedAt: now,
+	})
+}
+
+func (p *PostgreSQLStorage) UpdateAccrual(ctx context.Context, userid uint64, accrual *obj.Accrual) error {
+	return p.inTx(ctx, func(tx pgx.Tx) error {
+		t := time.Now().Format(time.RFC3339)
+		p.logger.Infof("Update accrual: %d, %v", userid, *accrual)
+
+		//the accrual is credited with the multiplier of the user's tier
+		//and the boost of the best running campaign
+		credited, tier := accrual.Accrual, ""
+		var campaignID *uint64
+		var campaignBonus *float32
+		order := &obj.Order{
+			Status:  obj.AccrualStatusToOrderStatus[accrual.Status],
+			Number:  accrual.Order,
+			Accrual: &credited,
+		}
+		if accrual.Status == obj.AccrualStatusProcessed {
+			if _, err := tx.Exec(ctx, queryLockReferralUsers, userid); err != nil {
+				p.logger.Errorf("Database lock referral users: %d. %v", userid, err)
+				return err
+			}
+			var multiplier float32
+			if err := tx.QueryRow(ctx, queryLockUserTier, userid).Scan(&tier, &multiplier); err != nil {
+				p.logger.Errorf("Database lock user tier: %d. %v", userid, err)
+				return err
+			}
+			credited = tiers.Apply(accrual.Accrual, multiplier)
+
+			campaign, err := p.orderCampaign(ctx, tx, accrual.Order, tier, credited)
 			if err != nil {
-				p.logger.Errorf("Rollback transaction: %s.", err)
+				return err
+			}
+			if campaign != nil {
+				credited += campaign.Bonus
+				campaignID, campaignBonus = &campaign.CampaignID, &campaign.Bonus
+				order.Campaign = campaign
 			}
 		}
-	}()
-	return nil
-}
 
-func (p *PostgreSQLStorage) Withdrawals(ctx context.Context, login string) ([]*obj.Withdraw, error) {
-	user, err := p.GetUser(ctx, login)
-	if err != nil {
-		return nil, err
-	}
-	withdrawals := make([]*obj.Withdraw, 0)
-	rows, err := p.pool.Query(ctx, queryGetWithdrawList, user.UserID)
-	if err != nil {
-		p.logger.Errorf("Database query orders: %s.", err)
-		return nil, err
-	}
-	for rows.Next() {
-		withdraw := &obj.Withdraw{}
-		err = rows.Scan(&withdraw.WithdrawID, &withdraw.WithdrawID, &withdraw.Order, &withdraw.Sum, &withdraw.ProcessedAt)
+		err := tx.QueryRow(ctx, queryUpdateOrderStatus,
+			order.Status, t, credited, accrual.Order, accrual.Accrual, tier,
+			campaignID, campaignBonus).Scan(&order.UploadAt)
+		//processed orders are final, the accrual must not be credited twice
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
 		if err != nil {
-			p.logger.Errorf("Database scan orders: %s.", err)
-			return nil, err
+			p.logger.Errorf("Database exec update order status: %s.", err)
+			return err
 		}
-		withdrawals = append(withdrawals, withdraw)
-	}
-	return withdrawals, nil
+
+		if accrual.Status == obj.AccrualStatusProcessed {
+			p.logger.Infof("Update accrual status: %s.", accrual.Order)
+			after := &balanceState{}
+			err = tx.QueryRow(ctx, queryUpdateAccrualBalance,
+				credited, userid).Scan(&after.Balance, &after.Withdraw)
+			if err != nil {
+				p.logger.Errorf("Database exec update accrual balance: %d.", userid)
+				return err
+			}
+			_, err = tx.Exec(ctx, queryNewLedgerEntry,
+				userid, credited, obj.LedgerKindAccrual, accrual.Order, "")
+			if err != nil {
+				p.logger.Errorf("Database exec new ledger entry: %d. %v", userid, err)
+				return err
+			}
+			if credited > 0 {
+				if _, err = tx.Exec(ctx, queryNewPointLot, userid, accrual.Order, credited, t); err != nil {
+					p.logger.Errorf("Database exec new point lot: %d. %v", userid, err)
+					return err
+				}
+			}
+			before := &balanceState{
+				Balance:  after.Balance - credited,
+				Withdraw: after.Withdraw,
+			}
+			if err = p.auditChange(ctx, tx, audit.ActionAccrualCredit, accrual.Order, before, after); err != nil {
+				return err
+			}
+			//only the first processed order finds a pending referral
+			if err = p.rewardReferral(ctx, tx, userid, accrual.Order); err != nil {
+				return err
+			}
+			return p.publish(ctx, tx, userid, obj.EventOrderProcessed, order)
+		}
+		if order.Status == obj.OrderStatusInvalid {
+			order.Accrual = nil
+			return p.publish(ctx, tx, userid, obj.EventOrderInvalid, order)
+		}
+		return nil
+	})
 }
 
-func (p *PostgreSQLStorage) UpdateAccrual(ctx context.Context, userid uint64, accrual *obj.Accrual) error {
+// inTx runs f in a transaction which is committed if f succeeds
+// and rolled back otherwise.
+func (p *PostgreSQLStorage) inTx(ctx context.Context, f func(pgx.Tx) error) error {
 	tx, err := p.pool.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	t := time.Now().Format(time.RFC3339)
-	p.logger.Infof("Update accrual: %d, %v", userid, *accrual)
-	_, err = p.pool.Exec(ctx, queryUpdateOrderStatus,
-		obj.AccrualStatusToOrderStatus[accrual.Status], t, accrual.Accrual, accrual.Order)
-	if err != nil {
-		p.logger.Errorf("Database exec update order status: %s.", err)
-		return err
-	}
-
-	if accrual.Status == obj.AccrualStatusProcessed {
-		p.logger.Infof("Update accrual status: %s.", accrual.Order)
-		_, err = p.pool.Exec(ctx, queryUpdateAccrualBalance,
-			accrual.Accrual, userid)
-		if err != nil {
-			p.logger.Errorf("Database exec update accrual balance: %s.", userid)
-			return err
+	if err = f(tx); err != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil {
+			p.logger.Errorf("Rollback transaction: %s.", rbErr)
 		}
+		return err
 	}
-
 	if err = tx.Commit(ctx); err != nil {
 		p.logger.Errorf("Database commit transaction: %s.", err)
 		return err
 	}
-	defer func() {
-		if err != nil {
-			err = tx.Rollback(ctx)
-			if err != nil {
-				p.logger.Errorf("Rollback transaction: %s.", err)
-			}
-		}
-	}()
 	return nil
 }
 
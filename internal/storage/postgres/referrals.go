@@ -0,0 +1,217 @@
+package postgres
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"github.com/eqkez0r/gophermart/pkg/audit"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/jackc/pgx/v5"
+	"strings"
+)
+
+const (
+	referralCodeLength = 10
+
+	queryAlterUsersReferral = `ALTER TABLE users
+		ADD COLUMN IF NOT EXISTS referral_code VARCHAR(16) UNIQUE,
+		ADD COLUMN IF NOT EXISTS register_ip VARCHAR(45)`
+	queryBackfillReferralCodes = `UPDATE users SET referral_code = upper(substr(md5(random()::text || user_id::text), 1, 12))
+		WHERE referral_code IS NULL`
+	queryCreateReferralsTable = `CREATE TABLE IF NOT EXISTS referrals(
+		referral_id SERIAL PRIMARY KEY,
+		referrer_id INTEGER REFERENCES users(user_id) ON DELETE CASCADE NOT NULL,
+		referee_id INTEGER UNIQUE REFERENCES users(user_id) ON DELETE CASCADE NOT NULL,
+		ip VARCHAR(45),
+		status VARCHAR(16) NOT NULL,
+		reason VARCHAR(32),
+		referrer_bonus NUMERIC NOT NULL,
+		referee_bonus NUMERIC NOT NULL,
+		order_number VARCHAR(20),
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+		rewarded_at TIMESTAMP WITH TIME ZONE
+	)`
+	queryCreateReferralsIndex = `CREATE INDEX IF NOT EXISTS referrals_referrer_idx ON referrals(referrer_id, created_at)`
+
+	queryLockReferrer   = `SELECT user_id, COALESCE(register_ip, '') FROM users WHERE referral_code = $1 FOR UPDATE`
+	queryCountReferrals = `SELECT COUNT(*) FROM referrals WHERE referrer_id = $1 AND status <> 'rejected'`
+	querySameIPReferral = `SELECT EXISTS (SELECT 1 FROM referrals WHERE referrer_id = $1 AND ip = $2)`
+	queryNewReferral    = `INSERT INTO referrals(referrer_id, referee_id, ip, status, reason, referrer_bonus, referee_bonus)
+		VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, ''), $6, $7)`
+
+	queryLockPendingReferral = `SELECT r.referral_id, r.referrer_id, u.login, r.referrer_bonus, r.referee_bonus
+		FROM referrals r JOIN users u ON u.user_id = r.referrer_id
+		WHERE r.referee_id = $1 AND r.status = 'pending' FOR UPDATE OF r`
+	// the referee and its pending referrer are locked in the order of
+	// their ids, like the users of a transfer, so crediting the bonuses
+	// doesn't deadlock with a transfer between the two
+	queryLockReferralUsers = `SELECT user_id FROM users
+		WHERE user_id = $1 OR user_id = (SELECT referrer_id FROM referrals WHERE referee_id = $1 AND status = 'pending')
+		ORDER BY user_id FOR UPDATE`
+	queryRewardReferral = `UPDATE referrals SET status = 'rewarded', order_number = $2, rewarded_at = now()
+		WHERE referral_id = $1`
+
+	queryGetReferralCode = `SELECT COALESCE(referral_code, '') FROM users WHERE login = $1`
+	queryGetReferrals    = `SELECT u.login, r.status, COALESCE(r.reason, ''),
+			CASE WHEN r.status = 'rejected' THEN 0 ELSE r.referrer_bonus END, r.created_at, r.rewarded_at
+		FROM referrals r
+		JOIN users u ON u.user_id = r.referee_id
+		JOIN users ru ON ru.user_id = r.referrer_id
+		WHERE ru.login = $1 ORDER BY r.created_at DESC, r.referral_id DESC`
+)
+
+type referralState struct {
+	Referrer string `json:"referrer"`
+	Status   string `json:"status"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+func newReferralCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)[:referralCodeLength], nil
+}
+
+// attachReferral links a new user to the owner of code. Referrals over the
+// limit of the referrer, or made from the IP the referrer or another of
+// its referees signed up from, are recorded as rejected and never
+// rewarded. Unknown codes fail the registration.
+func (p *PostgreSQLStorage) attachReferral(ctx context.Context, tx pgx.Tx, refereeID uint64, code string, terms *obj.ReferralTerms) error {
+	var (
+		referrerID uint64
+		referrerIP string
+	)
+	err := tx.QueryRow(ctx, queryLockReferrer, strings.ToUpper(strings.TrimSpace(code))).Scan(&referrerID, &referrerIP)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return e.ErrReferralCodeInvalid
+	}
+	if err != nil {
+		p.logger.Errorf("Database lock referrer: %s. %v", code, err)
+		return err
+	}
+
+	ip := audit.MetaFrom(ctx).IP
+	status, reason := obj.ReferralStatusPending, ""
+	var count int
+	if err = tx.QueryRow(ctx, queryCountReferrals, referrerID).Scan(&count); err != nil {
+		p.logger.Errorf("Database count referrals: %d. %v", referrerID, err)
+		return err
+	}
+	var sameIP bool
+	if ip != "" {
+		if err = tx.QueryRow(ctx, querySameIPReferral, referrerID, ip).Scan(&sameIP); err != nil {
+			p.logger.Errorf("Database query same ip referral: %d. %v", referrerID, err)
+			return err
+		}
+		sameIP = sameIP || ip == referrerIP
+	}
+	switch {
+	case terms.MaxReferrals > 0 && count >= terms.MaxReferrals:
+		status, reason = obj.ReferralStatusRejected, obj.ReferralRejectedLimit
+	case sameIP:
+		status, reason = obj.ReferralStatusRejected, obj.ReferralRejectedSameIP
+	}
+
+	if _, err = tx.Exec(ctx, queryNewReferral, referrerID, refereeID, ip, status, reason,
+		terms.ReferrerBonus, terms.RefereeBonus); err != nil {
+		p.logger.Errorf("Database exec new referral: %d. %v", refereeID, err)
+		return err
+	}
+	if status == obj.ReferralStatusRejected {
+		p.logger.Warnw("referral rejected", "referrer", referrerID, "referee", refereeID, "reason", reason, "ip", ip)
+	}
+	return p.auditChange(ctx, tx, audit.ActionReferral, code, nil, &referralState{
+		Referrer: code,
+		Status:   status,
+		Reason:   reason,
+	})
+}
+
+// rewardReferral credits the bonuses of a pending referral of the user
+// after its first processed order. Both users must be locked by the
+// caller with queryLockReferralUsers. Bonuses have no point lots and
+// don't expire.
+func (p *PostgreSQLStorage) rewardReferral(ctx context.Context, tx pgx.Tx, refereeID uint64, number string) error {
+	var (
+		referralID, referrerID      uint64
+		referrer                    string
+		referrerBonus, refereeBonus float32
+	)
+	err := tx.QueryRow(ctx, queryLockPendingReferral, refereeID).Scan(
+		&referralID, &referrerID, &referrer, &referrerBonus, &refereeBonus)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		p.logger.Errorf("Database lock pending referral: %d. %v", refereeID, err)
+		return err
+	}
+
+	for _, credit := range []struct {
+		userID uint64
+		amount float32
+		target string
+	}{
+		{userID: refereeID, amount: refereeBonus, target: number},
+		{userID: referrerID, amount: referrerBonus, target: referrer},
+	} {
+		if credit.amount <= 0 {
+			continue
+		}
+		after := &balanceState{}
+		if err = tx.QueryRow(ctx, queryUpdateAccrualBalance, credit.amount, credit.userID).Scan(
+			&after.Balance, &after.Withdraw); err != nil {
+			p.logger.Errorf("Database exec referral bonus: %d. %v", credit.userID, err)
+			return err
+		}
+		if _, err = tx.Exec(ctx, queryNewLedgerEntry,
+			credit.userID, credit.amount, obj.LedgerKindReferral, number, "referral bonus"); err != nil {
+			p.logger.Errorf("Database exec new ledger entry: %d. %v", credit.userID, err)
+			return err
+		}
+		before := &balanceState{Balance: after.Balance - credit.amount, Withdraw: after.Withdraw}
+		if err = p.auditChange(ctx, tx, audit.ActionReferralBonus, credit.target, before, after); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.Exec(ctx, queryRewardReferral, referralID, number); err != nil {
+		p.logger.Errorf("Database exec reward referral: %d. %v", referralID, err)
+		return err
+	}
+	return nil
+}
+
+// Referrals returns the referral code of the user and the users who
+// signed up with it, the latest first.
+func (p *PostgreSQLStorage) Referrals(ctx context.Context, login string) (*obj.Referrals, error) {
+	referrals := &obj.Referrals{Referrals: make([]*obj.Referral, 0)}
+	err := p.pool.QueryRow(ctx, queryGetReferralCode, login).Scan(&referrals.Code)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, e.ErrUserNotFound
+	}
+	if err != nil {
+		p.logger.Errorf("Database query referral code: %s. %v", login, err)
+		return nil, err
+	}
+
+	rows, err := p.pool.Query(ctx, queryGetReferrals, login)
+	if err != nil {
+		p.logger.Errorf("Database query referrals: %s. %v", login, err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r := &obj.Referral{}
+		if err = rows.Scan(&r.Login, &r.Status, &r.Reason, &r.Bonus, &r.CreatedAt, &r.RewardedAt); err != nil {
+			p.logger.Errorf("Database scan referrals: %s. %v", login, err)
+			return nil, err
+		}
+		referrals.Referrals = append(referrals.Referrals, r)
+	}
+	return referrals, rows.Err()
+}
@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"github.com/eqkez0r/gophermart/pkg/audit"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	queryAlterWithdrawalsStatus = `ALTER TABLE withdrawals
+		ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'completed',
+		ADD COLUMN IF NOT EXISTS refunded NUMERIC NOT NULL DEFAULT 0`
+
+	queryLockWithdrawal = `SELECT w.order_customer, u.login, w.accrual, w.refunded, w.status, w.withdraw_time
+		FROM withdrawals w JOIN users u ON u.user_id = w.order_customer
+		WHERE w.order_number = $1 FOR UPDATE OF w`
+	queryRefundWithdrawal         = `UPDATE withdrawals SET refunded = refunded + $1, status = $2 WHERE order_number = $3`
+	queryUpdateBalanceAfterRefund = `UPDATE users SET accrual_balance = accrual_balance + $1, withdrawal_balance = withdrawal_balance - $1
+		WHERE user_id = $2 RETURNING accrual_balance, withdrawal_balance`
+)
+
+// RefundWithdrawal credits amount of the withdrawal for the order back to
+// its user, a zero amount refunds the rest of it. The withdrawal is
+// refunded once the whole sum is back, partially refunded before.
+// Refunded points don't expire.
+func (p *PostgreSQLStorage) RefundWithdrawal(ctx context.Context, number string, amount float32, reason string) (*obj.Withdraw, error) {
+	w := &obj.Withdraw{Order: number}
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		var login string
+		err := tx.QueryRow(ctx, queryLockWithdrawal, number).Scan(
+			&w.UserID, &login, &w.Sum, &w.Refunded, &w.Status, &w.ProcessedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return e.ErrWithdrawalNotFound
+		}
+		if err != nil {
+			p.logger.Errorf("Database lock withdrawal: %s. %v", number, err)
+			return err
+		}
+
+		left := w.Sum - w.Refunded
+		switch {
+		case w.Status == obj.WithdrawStatusRefunded || left <= 0:
+			return e.ErrWithdrawalRefunded
+		case amount == 0:
+			amount = left
+		case amount > left:
+			return e.ErrRefundExceedsWithdrawal
+		}
+
+		w.Refunded += amount
+		w.Status = obj.WithdrawStatusPartiallyRefunded
+		if amount == left {
+			w.Status = obj.WithdrawStatusRefunded
+		}
+		if _, err = tx.Exec(ctx, queryRefundWithdrawal, amount, w.Status, number); err != nil {
+			p.logger.Errorf("Database exec refund withdrawal: %s. %v", number, err)
+			return err
+		}
+
+		before := &balanceState{}
+		if err = tx.QueryRow(ctx, queryLockUser, login).Scan(&w.UserID, &before.Balance, &before.Withdraw); err != nil {
+			p.logger.Errorf("Database lock user: %s. %v", login, err)
+			return err
+		}
+		after := &balanceState{}
+		if err = tx.QueryRow(ctx, queryUpdateBalanceAfterRefund, amount, w.UserID).Scan(&after.Balance, &after.Withdraw); err != nil {
+			p.logger.Errorf("Database exec refund balance: %s. %v", login, err)
+			return err
+		}
+		if _, err = tx.Exec(ctx, queryNewLedgerEntry,
+			w.UserID, amount, obj.LedgerKindRefund, number, reason); err != nil {
+			p.logger.Errorf("Database exec new ledger entry: %s. %v", login, err)
+			return err
+		}
+		return p.auditChange(ctx, tx, audit.ActionRefund, number, before, after)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+const (
+	queryCreateStatementsTable = `CREATE TABLE IF NOT EXISTS statements(
+		user_id INTEGER REFERENCES users(user_id) ON DELETE CASCADE NOT NULL,
+		month DATE NOT NULL,
+		opening NUMERIC NOT NULL,
+		accruals NUMERIC NOT NULL,
+		withdrawals NUMERIC NOT NULL,
+		adjustments NUMERIC NOT NULL,
+		closing NUMERIC NOT NULL,
+		generated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+		PRIMARY KEY (user_id, month)
+	)`
+
+	// queryGenerateStatements creates the missing statements of every
+	// completed month from the first month of the user up to the month
+	// before $1. Accruals are processed orders, adjustments are ledger
+	// entries other than accruals and withdrawals.
+	queryGenerateStatements = `INSERT INTO statements(user_id, month, opening, accruals, withdrawals, adjustments, closing)
+		SELECT u.user_id, m.month::date,
+			b.accruals + b.adjustments - b.withdrawals,
+			p.accruals, p.withdrawals, p.adjustments,
+			b.accruals + b.adjustments - b.withdrawals + p.accruals + p.adjustments - p.withdrawals
+		FROM users u
+		CROSS JOIN LATERAL generate_series(
+			date_trunc('month', LEAST(u.created_at,
+				(SELECT MIN(o.uploaded_at) FROM orders o WHERE o.order_customer = u.user_id)) AT TIME ZONE 'UTC'),
+			date_trunc('month', $1::timestamptz AT TIME ZONE 'UTC') - interval '1 month',
+			interval '1 month') AS m(month)
+		CROSS JOIN LATERAL (SELECT m.month AT TIME ZONE 'UTC' AS lo,
+			(m.month + interval '1 month') AT TIME ZONE 'UTC' AS hi) r
+		CROSS JOIN LATERAL (SELECT
+			(SELECT COALESCE(SUM(o.order_accrual), 0) FROM orders o
+				WHERE o.order_customer = u.user_id AND o.order_status = 'PROCESSED' AND o.order_time < r.lo) AS accruals,
+			(SELECT COALESCE(SUM(w.accrual), 0) FROM withdrawals w
+				WHERE w.order_customer = u.user_id AND w.withdraw_time < r.lo) AS withdrawals,
+			(SELECT COALESCE(SUM(l.amount), 0) FROM ledger l
+				WHERE l.user_id = u.user_id AND l.kind NOT IN ('accrual', 'withdrawal') AND l.created_at < r.lo) AS adjustments
+		) b
+		CROSS JOIN LATERAL (SELECT
+			(SELECT COALESCE(SUM(o.order_accrual), 0) FROM orders o
+				WHERE o.order_customer = u.user_id AND o.order_status = 'PROCESSED'
+				AND o.order_time >= r.lo AND o.order_time < r.hi) AS accruals,
+			(SELECT COALESCE(SUM(w.accrual), 0) FROM withdrawals w
+				WHERE w.order_customer = u.user_id AND w.withdraw_time >= r.lo AND w.withdraw_time < r.hi) AS withdrawals,
+			(SELECT COALESCE(SUM(l.amount), 0) FROM ledger l
+				WHERE l.user_id = u.user_id AND l.kind NOT IN ('accrual', 'withdrawal')
+				AND l.created_at >= r.lo AND l.created_at < r.hi) AS adjustments
+		) p
+		WHERE NOT EXISTS (SELECT 1 FROM statements s WHERE s.user_id = u.user_id AND s.month = m.month::date)
+		ON CONFLICT DO NOTHING`
+
+	queryGetStatements = `SELECT s.month, s.opening, s.accruals, s.withdrawals, s.adjustments, s.closing, s.generated_at
+		FROM statements s JOIN users u ON u.user_id = s.user_id
+		WHERE u.login = $1 ORDER BY s.month DESC`
+	queryGetStatement = `SELECT s.month, s.opening, s.accruals, s.withdrawals, s.adjustments, s.closing, s.generated_at
+		FROM statements s JOIN users u ON u.user_id = s.user_id
+		WHERE u.login = $1 AND s.month = $2`
+)
+
+// GenerateStatements stores the statements of the completed months
+// before now which don't exist yet and returns how many were created.
+// Stored statements are never recomputed.
+func (p *PostgreSQLStorage) GenerateStatements(ctx context.Context, now time.Time) (int64, error) {
+	tag, err := p.pool.Exec(ctx, queryGenerateStatements, now)
+	if err != nil {
+		p.logger.Errorf("Database exec generate statements. %v", err)
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (p *PostgreSQLStorage) Statements(ctx context.Context, login string) ([]*obj.Statement, error) {
+	statements := make([]*obj.Statement, 0)
+	rows, err := p.pool.Query(ctx, queryGetStatements, login)
+	if err != nil {
+		p.logger.Errorf("Database query statements: %s. %v", login, err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		s, err := scanStatement(rows)
+		if err != nil {
+			p.logger.Errorf("Database scan statements: %s. %v", login, err)
+			return nil, err
+		}
+		statements = append(statements, s)
+	}
+	return statements, rows.Err()
+}
+
+// Statement returns the statement of the month month starts in.
+func (p *PostgreSQLStorage) Statement(ctx context.Context, login string, month time.Time) (*obj.Statement, error) {
+	s, err := scanStatement(p.pool.QueryRow(ctx, queryGetStatement, login, month.UTC().Format(time.DateOnly)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, e.ErrStatementNotFound
+	}
+	if err != nil {
+		p.logger.Errorf("Database query statement: %s. %v", login, err)
+		return nil, err
+	}
+	return s, nil
+}
+
+func scanStatement(row pgx.Row) (*obj.Statement, error) {
+	s := &obj.Statement{}
+	var month time.Time
+	if err := row.Scan(&month, &s.Opening, &s.Accruals, &s.Withdrawals,
+		&s.Adjustments, &s.Closing, &s.GeneratedAt); err != nil {
+		return nil, err
+	}
+	s.Month = month.Format(obj.StatementMonthLayout)
+	return s, nil
+}
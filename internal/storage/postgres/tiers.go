@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"context"
+	"github.com/eqkez0r/gophermart/internal/tiers"
+	"github.com/eqkez0r/gophermart/pkg/audit"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+const (
+	queryAlterUsersTier = `ALTER TABLE users
+		ADD COLUMN IF NOT EXISTS tier VARCHAR(32) NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS tier_multiplier NUMERIC NOT NULL DEFAULT 1,
+		ADD COLUMN IF NOT EXISTS tier_points NUMERIC NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS tier_calculated_at TIMESTAMP WITH TIME ZONE`
+	// base_accrual is the amount of the accrual system, order_accrual the
+	// amount credited after the tier multiplier.
+	queryAlterOrdersTier = `ALTER TABLE orders
+		ADD COLUMN IF NOT EXISTS base_accrual NUMERIC,
+		ADD COLUMN IF NOT EXISTS order_tier VARCHAR(32)`
+
+	queryLockUserTier = `SELECT tier, tier_multiplier FROM users WHERE user_id = $1 FOR UPDATE`
+
+	queryGetTierPoints = `SELECT u.user_id, u.login, u.tier,
+			COALESCE(SUM(COALESCE(o.base_accrual, o.order_accrual))
+				FILTER (WHERE o.order_status = 'PROCESSED' AND o.order_time >= $1), 0)
+		FROM users u LEFT JOIN orders o ON o.order_customer = u.user_id
+		GROUP BY u.user_id`
+	// only the users whose tier or points changed are written
+	queryUpdateTiers = `UPDATE users u SET tier = t.tier, tier_multiplier = t.multiplier,
+			tier_points = t.points, tier_calculated_at = $5
+		FROM unnest($1::int[], $2::text[], $3::numeric[], $4::numeric[]) AS t(user_id, tier, multiplier, points)
+		WHERE u.user_id = t.user_id
+		AND (u.tier, u.tier_multiplier, u.tier_points) IS DISTINCT FROM (t.tier, t.multiplier, t.points)`
+	queryAnyUserTier = `SELECT EXISTS(SELECT 1 FROM users WHERE tier <> '')`
+)
+
+type tierState struct {
+	Tier string `json:"tier"`
+}
+
+// RecalculateTiers assigns every user the tier of the points accrued
+// since the given time and returns how many users changed their tier.
+// Tier changes are audited. Without tiers there is nothing to do unless
+// users still have the tier of a previous setup.
+func (p *PostgreSQLStorage) RecalculateTiers(ctx context.Context, defs []*obj.Tier, since time.Time) (int64, error) {
+	if len(defs) == 0 {
+		var tiered bool
+		if err := p.pool.QueryRow(ctx, queryAnyUserTier).Scan(&tiered); err != nil {
+			p.logger.Errorf("Database query user tiers. %v", err)
+			return 0, err
+		}
+		if !tiered {
+			return 0, nil
+		}
+	}
+
+	var changed int64
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, queryGetTierPoints, since)
+		if err != nil {
+			p.logger.Errorf("Database query tier points. %v", err)
+			return err
+		}
+		var (
+			ids                 []uint64
+			names, logins, olds []string
+			multipliers, points []float32
+		)
+		for rows.Next() {
+			var (
+				id          uint64
+				login, tier string
+				sum         float32
+			)
+			if err = rows.Scan(&id, &login, &tier, &sum); err != nil {
+				rows.Close()
+				p.logger.Errorf("Database scan tier points. %v", err)
+				return err
+			}
+			t := tiers.For(defs, sum)
+			ids = append(ids, id)
+			names = append(names, t.Name)
+			multipliers = append(multipliers, t.Multiplier)
+			points = append(points, sum)
+			logins = append(logins, login)
+			olds = append(olds, tier)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		if _, err = tx.Exec(ctx, queryUpdateTiers, ids, names, multipliers, points, time.Now()); err != nil {
+			p.logger.Errorf("Database exec update tiers. %v", err)
+			return err
+		}
+		for i := range ids {
+			if names[i] == olds[i] {
+				continue
+			}
+			changed++
+			if err = p.auditChange(ctx, tx, audit.ActionTierChange, logins[i],
+				&tierState{Tier: olds[i]}, &tierState{Tier: names[i]}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return changed, err
+}
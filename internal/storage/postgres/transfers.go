@@ -0,0 +1,189 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/eqkez0r/gophermart/pkg/audit"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/jackc/pgx/v5"
+	"strconv"
+)
+
+const (
+	queryCreateTransfersTable = `CREATE TABLE IF NOT EXISTS transfers(
+		transfer_id SERIAL PRIMARY KEY,
+		sender_id INTEGER REFERENCES users(user_id) ON DELETE CASCADE NOT NULL,
+		recipient_id INTEGER REFERENCES users(user_id) ON DELETE CASCADE NOT NULL,
+		amount NUMERIC NOT NULL CHECK (amount > 0),
+		note TEXT,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	)`
+	queryCreateTransfersSenderIndex    = `CREATE INDEX IF NOT EXISTS transfers_sender_idx ON transfers(sender_id, created_at)`
+	queryCreateTransfersRecipientIndex = `CREATE INDEX IF NOT EXISTS transfers_recipient_idx ON transfers(recipient_id, created_at)`
+
+	// both users are locked in the order of their ids, so concurrent
+	// transfers in opposite directions don't deadlock
+	queryLockTransferUsers = `SELECT user_id, login, accrual_balance, withdrawal_balance, blocked FROM users
+		WHERE login = $1 OR login = $2 ORDER BY user_id FOR UPDATE`
+	querySentToday = `SELECT COALESCE(SUM(amount), 0) FROM transfers
+		WHERE sender_id = $1 AND created_at >= date_trunc('day', now() AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'`
+	queryNewTransfer = `INSERT INTO transfers(sender_id, recipient_id, amount, note) VALUES ($1, $2, $3, NULLIF($4, ''))
+		RETURNING transfer_id, created_at`
+	queryNewTransferredLot = `INSERT INTO point_lots(user_id, amount, remaining, accrued_at) VALUES ($1, $2, $2, $3)`
+
+	queryGetTransfers = `SELECT t.transfer_id,
+			CASE WHEN t.sender_id = u.user_id THEN 'out' ELSE 'in' END,
+			CASE WHEN t.sender_id = u.user_id THEN r.login ELSE s.login END,
+			t.amount, COALESCE(t.note, ''), t.created_at
+		FROM users u
+		JOIN transfers t ON t.sender_id = u.user_id OR t.recipient_id = u.user_id
+		JOIN users s ON s.user_id = t.sender_id
+		JOIN users r ON r.user_id = t.recipient_id
+		WHERE u.login = $1 ORDER BY t.created_at DESC, t.transfer_id DESC`
+)
+
+type transferParty struct {
+	userID  uint64
+	login   string
+	state   balanceState
+	blocked bool
+}
+
+// Transfer moves amount from one user to another in one transaction.
+// Points keep their accrual date, so a transfer doesn't extend their
+// expiry. A positive dailyLimit caps what a user sends per UTC day, the
+// withdraw rules apply to transfers as well.
+func (p *PostgreSQLStorage) Transfer(ctx context.Context, from, to string, amount, dailyLimit float32, note string, rules *obj.WithdrawRules) (*obj.Transfer, error) {
+	transfer := &obj.Transfer{
+		Direction:    obj.TransferDirectionOut,
+		Counterparty: to,
+		Amount:       amount,
+		Note:         note,
+	}
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, queryLockTransferUsers, from, to)
+		if err != nil {
+			p.logger.Errorf("Database lock transfer users: %s, %s. %v", from, to, err)
+			return err
+		}
+		parties, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*transferParty, error) {
+			t := &transferParty{}
+			err := row.Scan(&t.userID, &t.login, &t.state.Balance, &t.state.Withdraw, &t.blocked)
+			return t, err
+		})
+		if err != nil {
+			p.logger.Errorf("Database scan transfer users: %s, %s. %v", from, to, err)
+			return err
+		}
+		var sender, recipient *transferParty
+		for _, party := range parties {
+			switch party.login {
+			case from:
+				sender = party
+			case to:
+				recipient = party
+			}
+		}
+		switch {
+		case sender == nil:
+			return e.ErrUserNotFound
+		case recipient == nil:
+			return e.ErrUserNotFound.WithDetail("recipient is not found")
+		case sender.blocked:
+			return e.ErrUserBlocked
+		case recipient.blocked:
+			return e.ErrUserBlocked.WithDetail("recipient is blocked")
+		}
+		held, err := p.heldPoints(ctx, tx, sender.userID)
+		if err != nil {
+			return err
+		}
+		if sender.state.Balance-held < amount {
+			return e.ErrBalanceIsNotEnough
+		}
+		if err = p.checkWithdrawRules(ctx, tx, from, sender.userID, amount, rules); err != nil {
+			return err
+		}
+
+		if dailyLimit > 0 {
+			var sent float32
+			if err = tx.QueryRow(ctx, querySentToday, sender.userID).Scan(&sent); err != nil {
+				p.logger.Errorf("Database query sent today: %s. %v", from, err)
+				return err
+			}
+			if sent+amount > dailyLimit {
+				return e.ErrTransferLimitExceeded.WithDetail(fmt.Sprintf("%v of %v left today", max(dailyLimit-sent, 0), dailyLimit))
+			}
+		}
+
+		if err = tx.QueryRow(ctx, queryNewTransfer, sender.userID, recipient.userID, amount, note).Scan(
+			&transfer.TransferID, &transfer.CreatedAt); err != nil {
+			p.logger.Errorf("Database exec new transfer: %s. %v", from, err)
+			return err
+		}
+		reference := strconv.FormatUint(transfer.TransferID, 10)
+
+		taken, err := p.consumeLots(ctx, tx, sender.userID, amount)
+		if err != nil {
+			return err
+		}
+		for _, lot := range taken {
+			if _, err = tx.Exec(ctx, queryNewTransferredLot, recipient.userID, lot.Remaining, lot.AccruedAt); err != nil {
+				p.logger.Errorf("Database exec transferred point lot: %s. %v", to, err)
+				return err
+			}
+		}
+
+		for _, move := range []struct {
+			party  *transferParty
+			amount float32
+			action string
+			reason string
+		}{
+			{party: sender, amount: -amount, action: audit.ActionTransferOut, reason: "transfer to " + to},
+			{party: recipient, amount: amount, action: audit.ActionTransferIn, reason: "transfer from " + from},
+		} {
+			after := &balanceState{}
+			if err = tx.QueryRow(ctx, queryUpdateAccrualBalance, move.amount, move.party.userID).Scan(
+				&after.Balance, &after.Withdraw); err != nil {
+				p.logger.Errorf("Database exec transfer balance: %s. %v", move.party.login, err)
+				return err
+			}
+			if _, err = tx.Exec(ctx, queryNewLedgerEntry,
+				move.party.userID, move.amount, obj.LedgerKindTransfer, reference, move.reason); err != nil {
+				p.logger.Errorf("Database exec new ledger entry: %s. %v", move.party.login, err)
+				return err
+			}
+			if err = p.auditChange(ctx, tx, move.action, move.party.login, &move.party.state, after); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// Transfers returns the transfers sent and received by the user, the
+// latest first.
+func (p *PostgreSQLStorage) Transfers(ctx context.Context, login string) ([]*obj.Transfer, error) {
+	transfers := make([]*obj.Transfer, 0)
+	rows, err := p.pool.Query(ctx, queryGetTransfers, login)
+	if err != nil {
+		p.logger.Errorf("Database query transfers: %s. %v", login, err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		t := &obj.Transfer{}
+		if err = rows.Scan(&t.TransferID, &t.Direction, &t.Counterparty, &t.Amount, &t.Note, &t.CreatedAt); err != nil {
+			p.logger.Errorf("Database scan transfers: %s. %v", login, err)
+			return nil, err
+		}
+		transfers = append(transfers, t)
+	}
+	return transfers, rows.Err()
+}
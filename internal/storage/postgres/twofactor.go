@@ -0,0 +1,222 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+const (
+	queryCreateTOTPTable = `CREATE TABLE IF NOT EXISTS user_totp(
+		user_id INTEGER PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+		secret VARCHAR(64) NOT NULL,
+		enabled BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	)`
+	queryCreateRecoveryCodesTable = `CREATE TABLE IF NOT EXISTS user_recovery_codes(
+		code_id SERIAL PRIMARY KEY,
+		user_id INTEGER REFERENCES users(user_id) ON DELETE CASCADE NOT NULL,
+		code_hash VARCHAR(64) NOT NULL,
+		used_at TIMESTAMP WITH TIME ZONE
+	)`
+	queryAlterTOTPAttempts = `ALTER TABLE user_totp
+		ADD COLUMN IF NOT EXISTS last_counter BIGINT NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS failed_attempts INTEGER NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP WITH TIME ZONE`
+	queryCreateChallengeFailuresTable = `CREATE TABLE IF NOT EXISTS totp_challenge_failures(
+		challenge_id VARCHAR(64) PRIMARY KEY,
+		failures INTEGER NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	)`
+	queryCreateUsedChallengesTable = `CREATE TABLE IF NOT EXISTS totp_used_challenges(
+		challenge_id VARCHAR(64) PRIMARY KEY,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	)`
+
+	querySetTOTPSecret = `INSERT INTO user_totp(user_id, secret)
+		SELECT user_id, $2 FROM users WHERE login = $1
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = now()
+		WHERE user_totp.enabled = FALSE`
+	queryGetTOTP = `SELECT t.secret, t.enabled, t.last_counter, t.locked_until FROM user_totp t
+		JOIN users u ON u.user_id = t.user_id WHERE u.login = $1`
+	queryEnableTOTP = `UPDATE user_totp SET enabled = TRUE, last_counter = $2
+		WHERE user_id = (SELECT user_id FROM users WHERE login = $1) RETURNING user_id`
+	queryDeleteRecoveryCodes = `DELETE FROM user_recovery_codes WHERE user_id = $1`
+	queryNewRecoveryCode     = `INSERT INTO user_recovery_codes(user_id, code_hash) VALUES ($1, $2)`
+	queryUseRecoveryCode     = `UPDATE user_recovery_codes SET used_at = now()
+		WHERE code_hash = $2 AND used_at IS NULL
+		AND user_id = (SELECT user_id FROM users WHERE login = $1)`
+	//the counter only moves forward, so concurrent requests can't both
+	//use the same code
+	queryUseTOTPCounter = `UPDATE user_totp SET last_counter = $2, failed_attempts = 0
+		WHERE user_id = (SELECT user_id FROM users WHERE login = $1) AND last_counter < $2`
+	queryResetTOTPFailures = `UPDATE user_totp SET failed_attempts = 0
+		WHERE user_id = (SELECT user_id FROM users WHERE login = $1)`
+	//the failures start over once the user is locked out
+	queryTOTPFailed = `UPDATE user_totp SET
+		failed_attempts = CASE WHEN failed_attempts + 1 >= $2 THEN 0 ELSE failed_attempts + 1 END,
+		locked_until = CASE WHEN failed_attempts + 1 >= $2 THEN $3::timestamptz ELSE locked_until END
+		WHERE user_id = (SELECT user_id FROM users WHERE login = $1)`
+	queryChallengeFailed = `INSERT INTO totp_challenge_failures(challenge_id, failures) VALUES ($1, 1)
+		ON CONFLICT (challenge_id) DO UPDATE SET failures = totp_challenge_failures.failures + 1`
+	//challenges live minutes, the failures of expired ones are dropped
+	queryDeleteChallengeFailures = `DELETE FROM totp_challenge_failures WHERE created_at < now() - interval '1 day'`
+	queryChallengeFailures       = `SELECT failures FROM totp_challenge_failures WHERE challenge_id = $1`
+	queryUseChallenge            = `INSERT INTO totp_used_challenges(challenge_id) VALUES ($1)
+		ON CONFLICT (challenge_id) DO NOTHING`
+	queryDeleteUsedChallenges = `DELETE FROM totp_used_challenges WHERE created_at < now() - interval '1 day'`
+)
+
+func (p *PostgreSQLStorage) SetTOTPSecret(ctx context.Context, login, secret string) error {
+	tag, err := p.pool.Exec(ctx, querySetTOTPSecret, login, secret)
+	if err != nil {
+		p.logger.Errorf("Database exec set totp secret: %s. %v", login, err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return e.ErrTOTPAlreadyEnabled
+	}
+	return nil
+}
+
+func (p *PostgreSQLStorage) GetTOTP(ctx context.Context, login string) (*obj.TOTP, error) {
+	t := &obj.TOTP{}
+	var lockedUntil *time.Time
+	err := p.pool.QueryRow(ctx, queryGetTOTP, login).Scan(&t.Secret, &t.Enabled, &t.LastCounter, &lockedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return t, nil
+	}
+	if err != nil {
+		p.logger.Errorf("Database scan totp: %s. %v", login, err)
+		return nil, err
+	}
+	if lockedUntil != nil {
+		t.LockedUntil = *lockedUntil
+	}
+	return t, nil
+}
+
+// EnableTOTP enables the second factor confirmed with the code of the
+// counter period, which can't be used again.
+func (p *PostgreSQLStorage) EnableTOTP(ctx context.Context, login string, counter int64, recoveryHashes []string) error {
+	return p.inTx(ctx, func(tx pgx.Tx) error {
+		var userID uint64
+		err := tx.QueryRow(ctx, queryEnableTOTP, login, counter).Scan(&userID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return e.ErrTOTPNotEnrolled
+		}
+		if err != nil {
+			p.logger.Errorf("Database exec enable totp: %s. %v", login, err)
+			return err
+		}
+		if _, err = tx.Exec(ctx, queryDeleteRecoveryCodes, userID); err != nil {
+			return err
+		}
+		for _, h := range recoveryHashes {
+			if _, err = tx.Exec(ctx, queryNewRecoveryCode, userID, h); err != nil {
+				p.logger.Errorf("Database exec new recovery code: %s. %v", login, err)
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (p *PostgreSQLStorage) UseRecoveryCode(ctx context.Context, login, codeHash string) (bool, error) {
+	var used bool
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, queryUseRecoveryCode, login, codeHash)
+		if err != nil {
+			return err
+		}
+		if used = tag.RowsAffected() == 1; !used {
+			return nil
+		}
+		_, err = tx.Exec(ctx, queryResetTOTPFailures, login)
+		return err
+	})
+	if err != nil {
+		p.logger.Errorf("Database exec use recovery code: %s. %v", login, err)
+		return false, err
+	}
+	return used, nil
+}
+
+// UseTOTPCounter marks the code of the counter period as used. It
+// reports false if a code of the period or a later one was already used.
+func (p *PostgreSQLStorage) UseTOTPCounter(ctx context.Context, login string, counter int64) (bool, error) {
+	tag, err := p.pool.Exec(ctx, queryUseTOTPCounter, login, counter)
+	if err != nil {
+		p.logger.Errorf("Database exec use totp counter: %s. %v", login, err)
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// SecondFactorFailed counts an invalid code of the user and of the login
+// challenge, if any. The user is locked out until lockedUntil on the
+// maxFailures-th failure in a row.
+func (p *PostgreSQLStorage) SecondFactorFailed(
+	ctx context.Context,
+	login, challengeID string,
+	maxFailures int,
+	lockedUntil time.Time,
+) error {
+	return p.inTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, queryTOTPFailed, login, maxFailures, lockedUntil); err != nil {
+			p.logger.Errorf("Database exec totp failed: %s. %v", login, err)
+			return err
+		}
+		if challengeID == "" {
+			return nil
+		}
+		if _, err := tx.Exec(ctx, queryDeleteChallengeFailures); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, queryChallengeFailed, challengeID); err != nil {
+			p.logger.Errorf("Database exec challenge failed: %s. %v", login, err)
+			return err
+		}
+		return nil
+	})
+}
+
+// ChallengeFailures returns the invalid codes entered for the login
+// challenge.
+func (p *PostgreSQLStorage) ChallengeFailures(ctx context.Context, challengeID string) (int, error) {
+	var failures int
+	err := p.pool.QueryRow(ctx, queryChallengeFailures, challengeID).Scan(&failures)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		p.logger.Errorf("Database scan challenge failures: %s. %v", challengeID, err)
+		return 0, err
+	}
+	return failures, nil
+}
+
+// UseChallenge marks the login challenge as exchanged for a token. It
+// reports false if the challenge was already used.
+func (p *PostgreSQLStorage) UseChallenge(ctx context.Context, challengeID string) (bool, error) {
+	var used bool
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, queryDeleteUsedChallenges); err != nil {
+			return err
+		}
+		tag, err := tx.Exec(ctx, queryUseChallenge, challengeID)
+		if err != nil {
+			return err
+		}
+		used = tag.RowsAffected() == 1
+		return nil
+	})
+	if err != nil {
+		p.logger.Errorf("Database exec use challenge: %s. %v", challengeID, err)
+		return false, err
+	}
+	return used, nil
+}
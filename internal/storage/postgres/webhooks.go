@@ -0,0 +1,263 @@
+package postgres
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	e "github.com/eqkez0r/gophermart/pkg/error"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+const (
+	queryCreateWebhooksTable = `CREATE TABLE IF NOT EXISTS webhooks(
+		webhook_id SERIAL PRIMARY KEY,
+		user_id INTEGER REFERENCES users(user_id) ON DELETE CASCADE NOT NULL,
+		url TEXT NOT NULL,
+		secret VARCHAR(100) NOT NULL,
+		events TEXT[] NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	)`
+	queryCreateWebhookDeliveriesTable = `CREATE TABLE IF NOT EXISTS webhook_deliveries(
+		delivery_id SERIAL PRIMARY KEY,
+		webhook_id INTEGER REFERENCES webhooks(webhook_id) ON DELETE CASCADE NOT NULL,
+		event VARCHAR(32) NOT NULL,
+		event_id VARCHAR(64) NOT NULL,
+		payload JSONB NOT NULL,
+		status VARCHAR(10) NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+		delivered_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	)`
+	queryCreateWebhookDeliveriesDueIndex = `CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx
+		ON webhook_deliveries(next_attempt_at) WHERE status = 'pending'`
+	queryCreateWebhookAttemptsTable = `CREATE TABLE IF NOT EXISTS webhook_attempts(
+		attempt_id SERIAL PRIMARY KEY,
+		delivery_id INTEGER REFERENCES webhook_deliveries(delivery_id) ON DELETE CASCADE NOT NULL,
+		status_code INTEGER,
+		error TEXT,
+		duration_ms BIGINT NOT NULL,
+		attempted_at TIMESTAMP WITH TIME ZONE NOT NULL
+	)`
+
+	queryNewWebhook = `INSERT INTO webhooks(user_id, url, secret, events)
+		SELECT user_id, $2, $3, $4 FROM users WHERE login = $1
+		RETURNING webhook_id, created_at`
+	queryGetWebhooks = `SELECT w.webhook_id, w.url, w.events, w.created_at
+		FROM webhooks w JOIN users u ON u.user_id = w.user_id
+		WHERE u.login = $1 ORDER BY w.webhook_id`
+	queryDeleteWebhook = `DELETE FROM webhooks
+		WHERE webhook_id = $2 AND user_id = (SELECT user_id FROM users WHERE login = $1)`
+	queryGetUserWebhook = `SELECT w.webhook_id FROM webhooks w JOIN users u ON u.user_id = w.user_id
+		WHERE u.login = $1 AND w.webhook_id = $2`
+	//the latest deliveries are enough to debug a receiver
+	queryGetWebhookDeliveries = `SELECT ` + deliveryColumns + ` FROM webhook_deliveries
+		WHERE webhook_id = $1 ORDER BY delivery_id DESC LIMIT 100`
+	queryGetWebhookAttempts = `SELECT delivery_id, COALESCE(status_code, 0), COALESCE(error, ''), duration_ms, attempted_at
+		FROM webhook_attempts WHERE delivery_id = ANY($1) ORDER BY attempt_id`
+	queryRedeliverWebhook = `UPDATE webhook_deliveries d SET status = 'pending', attempts = 0, next_attempt_at = now()
+		FROM webhooks w JOIN users u ON u.user_id = w.user_id
+		WHERE d.webhook_id = w.webhook_id AND u.login = $1 AND w.webhook_id = $2 AND d.delivery_id = $3
+		RETURNING ` + deliveryColumnsOf
+	queryEnqueueWebhooks = `INSERT INTO webhook_deliveries(webhook_id, event, event_id, payload)
+		SELECT webhook_id, $2, $3, $4 FROM webhooks WHERE user_id = $1 AND $2 = ANY(events)`
+	//claimed deliveries are pushed past the lease, so no other worker
+	//picks them up while they are sent
+	queryClaimWebhookDeliveries = `UPDATE webhook_deliveries d SET next_attempt_at = $2
+		FROM webhooks w
+		WHERE d.webhook_id = w.webhook_id AND d.delivery_id IN (
+			SELECT delivery_id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at LIMIT $3 FOR UPDATE SKIP LOCKED)
+		RETURNING ` + deliveryColumnsOf + `, w.url, w.secret, d.payload`
+	queryUpdateWebhookDelivery = `UPDATE webhook_deliveries SET status = $2, attempts = $3, next_attempt_at = $4, delivered_at = $5
+		WHERE delivery_id = $1`
+	queryNewWebhookAttempt = `INSERT INTO webhook_attempts(delivery_id, status_code, error, duration_ms, attempted_at)
+		VALUES ($1, NULLIF($2, 0), NULLIF($3, ''), $4, $5)`
+
+	deliveryColumns   = `delivery_id, webhook_id, event, event_id, status, attempts, next_attempt_at, delivered_at, created_at`
+	deliveryColumnsOf = `d.delivery_id, d.webhook_id, d.event, d.event_id, d.status, d.attempts, d.next_attempt_at, d.delivered_at, d.created_at`
+)
+
+// NewWebhook registers the webhook for the user. The secret is stored as
+// is, since deliveries are signed with it.
+func (p *PostgreSQLStorage) NewWebhook(ctx context.Context, login string, w *obj.Webhook) error {
+	err := p.pool.QueryRow(ctx, queryNewWebhook, login, w.URL, w.Secret, w.Events).Scan(&w.WebhookID, &w.CreatedAt)
+	if err != nil {
+		p.logger.Errorf("Database exec new webhook: %s. %v", login, err)
+		return err
+	}
+	return nil
+}
+
+func (p *PostgreSQLStorage) Webhooks(ctx context.Context, login string) ([]*obj.Webhook, error) {
+	rows, err := p.pool.Query(ctx, queryGetWebhooks, login)
+	if err != nil {
+		p.logger.Errorf("Database query webhooks: %s. %v", login, err)
+		return nil, err
+	}
+	hooks, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*obj.Webhook, error) {
+		w := &obj.Webhook{}
+		err := row.Scan(&w.WebhookID, &w.URL, &w.Events, &w.CreatedAt)
+		return w, err
+	})
+	if err != nil {
+		p.logger.Errorf("Database scan webhooks: %s. %v", login, err)
+		return nil, err
+	}
+	return hooks, nil
+}
+
+// DeleteWebhook removes the webhook with its deliveries.
+func (p *PostgreSQLStorage) DeleteWebhook(ctx context.Context, login string, id uint64) error {
+	tag, err := p.pool.Exec(ctx, queryDeleteWebhook, login, id)
+	if err != nil {
+		p.logger.Errorf("Database exec delete webhook: %s. %v", login, err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return e.ErrWebhookNotFound
+	}
+	return nil
+}
+
+// WebhookDeliveries returns the latest deliveries of the webhook with the
+// log of their attempts.
+func (p *PostgreSQLStorage) WebhookDeliveries(ctx context.Context, login string, id uint64) ([]*obj.WebhookDelivery, error) {
+	err := p.pool.QueryRow(ctx, queryGetUserWebhook, login, id).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, e.ErrWebhookNotFound
+	}
+	if err != nil {
+		p.logger.Errorf("Database query webhook: %s. %v", login, err)
+		return nil, err
+	}
+
+	rows, err := p.pool.Query(ctx, queryGetWebhookDeliveries, id)
+	if err != nil {
+		p.logger.Errorf("Database query webhook deliveries: %d. %v", id, err)
+		return nil, err
+	}
+	ds, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*obj.WebhookDelivery, error) {
+		d := &obj.WebhookDelivery{}
+		err := row.Scan(deliveryFields(d)...)
+		return d, err
+	})
+	if err != nil {
+		p.logger.Errorf("Database scan webhook deliveries: %d. %v", id, err)
+		return nil, err
+	}
+	if len(ds) == 0 {
+		return ds, nil
+	}
+
+	byID := make(map[uint64]*obj.WebhookDelivery, len(ds))
+	ids := make([]uint64, 0, len(ds))
+	for _, d := range ds {
+		byID[d.DeliveryID] = d
+		ids = append(ids, d.DeliveryID)
+	}
+	rows, err = p.pool.Query(ctx, queryGetWebhookAttempts, ids)
+	if err != nil {
+		p.logger.Errorf("Database query webhook attempts: %d. %v", id, err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var deliveryID uint64
+		a := &obj.WebhookAttempt{}
+		if err = rows.Scan(&deliveryID, &a.StatusCode, &a.Error, &a.DurationMS, &a.AttemptedAt); err != nil {
+			p.logger.Errorf("Database scan webhook attempts: %d. %v", id, err)
+			return nil, err
+		}
+		byID[deliveryID].Log = append(byID[deliveryID].Log, a)
+	}
+	return ds, rows.Err()
+}
+
+// RedeliverWebhook queues the delivery again with a fresh set of
+// attempts, whatever its status is.
+func (p *PostgreSQLStorage) RedeliverWebhook(ctx context.Context, login string, id, deliveryID uint64) (*obj.WebhookDelivery, error) {
+	d := &obj.WebhookDelivery{}
+	err := p.pool.QueryRow(ctx, queryRedeliverWebhook, login, id, deliveryID).Scan(deliveryFields(d)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, e.ErrWebhookDeliveryNotFound
+	}
+	if err != nil {
+		p.logger.Errorf("Database exec redeliver webhook: %d. %v", deliveryID, err)
+		return nil, err
+	}
+	return d, nil
+}
+
+// ClaimWebhookDeliveries returns up to limit deliveries due at now and
+// postpones them by lease.
+func (p *PostgreSQLStorage) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*obj.WebhookDelivery, error) {
+	rows, err := p.pool.Query(ctx, queryClaimWebhookDeliveries, now, now.Add(lease), limit)
+	if err != nil {
+		p.logger.Errorf("Database exec claim webhook deliveries: %s.", err)
+		return nil, err
+	}
+	ds, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*obj.WebhookDelivery, error) {
+		d := &obj.WebhookDelivery{}
+		err := row.Scan(append(deliveryFields(d), &d.URL, &d.Secret, &d.Payload)...)
+		return d, err
+	})
+	if err != nil {
+		p.logger.Errorf("Database scan webhook deliveries: %s.", err)
+		return nil, err
+	}
+	return ds, nil
+}
+
+// RecordWebhookAttempt stores the state of the delivery after the attempt
+// and logs the attempt.
+func (p *PostgreSQLStorage) RecordWebhookAttempt(ctx context.Context, d *obj.WebhookDelivery, a *obj.WebhookAttempt) error {
+	return p.inTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, queryUpdateWebhookDelivery,
+			d.DeliveryID, d.Status, d.Attempts, d.NextAttemptAt, d.DeliveredAt); err != nil {
+			p.logger.Errorf("Database exec update webhook delivery: %d. %v", d.DeliveryID, err)
+			return err
+		}
+		if _, err := tx.Exec(ctx, queryNewWebhookAttempt,
+			d.DeliveryID, a.StatusCode, a.Error, a.DurationMS, a.AttemptedAt); err != nil {
+			p.logger.Errorf("Database exec new webhook attempt: %d. %v", d.DeliveryID, err)
+			return err
+		}
+		return nil
+	})
+}
+
+// enqueueWebhooks queues the event for every webhook of the user
+// subscribed to it. It runs in the transaction of the change, so events
+// are sent only for committed changes.
+func (p *PostgreSQLStorage) enqueueWebhooks(ctx context.Context, tx pgx.Tx, userID uint64, event string, data any) error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	eventID := "evt_" + hex.EncodeToString(id)
+	payload, err := json.Marshal(&obj.WebhookEvent{
+		EventID:   eventID,
+		Type:      event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, queryEnqueueWebhooks, userID, event, eventID, payload); err != nil {
+		p.logger.Errorf("Database exec enqueue webhooks: %d. %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+func deliveryFields(d *obj.WebhookDelivery) []any {
+	return []any{&d.DeliveryID, &d.WebhookID, &d.Event, &d.EventID, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.DeliveredAt, &d.CreatedAt}
+}
@@ -15,11 +15,12 @@ func NewStorage(
 	ctx context.Context,
 	logger *zap.SugaredLogger,
 	storagetype string,
-	settings ...string) (Storage, error) {
+	uri string,
+	opts postgres.Options) (Storage, error) {
 	switch storagetype {
 	case "postgresql":
 		{
-			return postgres.New(ctx, logger, settings[0])
+			return postgres.New(ctx, logger, uri, opts)
 		}
 	default:
 		return nil, ErrUnknownStorageType
@@ -0,0 +1,123 @@
+package tiers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eqkez0r/gophermart/internal/scheduler"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"go.uber.org/zap"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WindowMonths is the rolling window of the points deciding the tier.
+const WindowMonths = 12
+
+var (
+	errInvalidTier       = errors.New("tier must be name:threshold:multiplier")
+	errDuplicateTier     = errors.New("duplicate tier")
+	errInvalidThreshold  = errors.New("tier threshold must not be negative")
+	errInvalidMultiplier = errors.New("tier multiplier must be positive")
+)
+
+// Parse reads tiers written as name:threshold:multiplier separated by
+// commas, e.g. bronze:0:1,silver:1000:1.1,gold:5000:1.25. The tiers are
+// returned ordered by threshold.
+func Parse(s string) ([]*obj.Tier, error) {
+	tiers := make([]*obj.Tier, 0)
+	if strings.TrimSpace(s) == "" {
+		return tiers, nil
+	}
+	for _, def := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(def), ":")
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("%w: %q", errInvalidTier, def)
+		}
+		threshold, err := strconv.ParseFloat(parts[1], 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", errInvalidTier, def)
+		}
+		multiplier, err := strconv.ParseFloat(parts[2], 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", errInvalidTier, def)
+		}
+		tiers = append(tiers, &obj.Tier{
+			Name:       parts[0],
+			Threshold:  float32(threshold),
+			Multiplier: float32(multiplier),
+		})
+	}
+	if err := Validate(tiers); err != nil {
+		return nil, err
+	}
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].Threshold < tiers[j].Threshold })
+	return tiers, nil
+}
+
+// Validate checks tier definitions however they were loaded.
+func Validate(tiers []*obj.Tier) error {
+	seen := make(map[string]bool, len(tiers))
+	for _, t := range tiers {
+		if seen[t.Name] {
+			return fmt.Errorf("%w: %s", errDuplicateTier, t.Name)
+		}
+		seen[t.Name] = true
+		if t.Threshold < 0 {
+			return fmt.Errorf("%w: %s", errInvalidThreshold, t.Name)
+		}
+		if t.Multiplier <= 0 {
+			return fmt.Errorf("%w: %s", errInvalidMultiplier, t.Name)
+		}
+	}
+	return nil
+}
+
+// For returns the highest tier reached with points. Users below every
+// threshold, or all users when no tiers are defined, get no tier and a
+// multiplier of 1.
+func For(tiers []*obj.Tier, points float32) *obj.Tier {
+	tier := &obj.Tier{Multiplier: 1}
+	for _, t := range tiers {
+		if points >= t.Threshold {
+			tier = t
+		}
+	}
+	return tier
+}
+
+// Apply multiplies an accrual, rounding to cents.
+func Apply(accrual, multiplier float32) float32 {
+	return float32(math.Round(float64(accrual)*float64(multiplier)*100) / 100)
+}
+
+type Recalculator interface {
+	RecalculateTiers(ctx context.Context, tiers []*obj.Tier, since time.Time) (int64, error)
+}
+
+// Job assigns every user the tier of the points accrued within the
+// rolling window.
+func Job(
+	logger *zap.SugaredLogger,
+	store Recalculator,
+	tiers []*obj.Tier,
+	interval time.Duration,
+) *scheduler.Job {
+	return &scheduler.Job{
+		Name:     "tiers",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			n, err := store.RecalculateTiers(ctx, tiers, time.Now().AddDate(0, -WindowMonths, 0))
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				logger.Infof("changed the tier of %d users", n)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,86 @@
+package tiers
+
+import (
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    []*obj.Tier
+		wantErr bool
+	}{
+		{name: "empty", s: "", want: []*obj.Tier{}},
+		{
+			name: "sorted by threshold",
+			s:    "gold:5000:1.25, bronze:0:1,silver:1000:1.1",
+			want: []*obj.Tier{
+				{Name: "bronze", Threshold: 0, Multiplier: 1},
+				{Name: "silver", Threshold: 1000, Multiplier: 1.1},
+				{Name: "gold", Threshold: 5000, Multiplier: 1.25},
+			},
+		},
+		{name: "missing multiplier", s: "gold:5000", wantErr: true},
+		{name: "not a number", s: "gold:many:2", wantErr: true},
+		{name: "duplicate", s: "gold:0:1,gold:10:2", wantErr: true},
+		{name: "negative threshold", s: "gold:-1:1", wantErr: true},
+		{name: "zero multiplier", s: "gold:10:0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFor(t *testing.T) {
+	defs, err := Parse("bronze:100:1,silver:1000:1.1,gold:5000:1.25")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		points         float32
+		wantName       string
+		wantMultiplier float32
+	}{
+		{points: 0, wantName: "", wantMultiplier: 1},
+		{points: 100, wantName: "bronze", wantMultiplier: 1},
+		{points: 999.99, wantName: "bronze", wantMultiplier: 1},
+		{points: 1000, wantName: "silver", wantMultiplier: 1.1},
+		{points: 100000, wantName: "gold", wantMultiplier: 1.25},
+	}
+	for _, tt := range tests {
+		got := For(defs, tt.points)
+		if got.Name != tt.wantName || got.Multiplier != tt.wantMultiplier {
+			t.Errorf("For(%v) = %+v, want %s x%v", tt.points, got, tt.wantName, tt.wantMultiplier)
+		}
+	}
+	if got := For(nil, 10000); got.Name != "" || got.Multiplier != 1 {
+		t.Errorf("For() without tiers = %+v", got)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		accrual, multiplier, want float32
+	}{
+		{accrual: 729.98, multiplier: 1, want: 729.98},
+		{accrual: 729.98, multiplier: 1.1, want: 802.98},
+		{accrual: 500, multiplier: 1.25, want: 625},
+		{accrual: 0.01, multiplier: 1.25, want: 0.01},
+	}
+	for _, tt := range tests {
+		if got := Apply(tt.accrual, tt.multiplier); got != tt.want {
+			t.Errorf("Apply(%v, %v) = %v, want %v", tt.accrual, tt.multiplier, got, tt.want)
+		}
+	}
+}
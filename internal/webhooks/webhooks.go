@@ -0,0 +1,287 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/eqkez0r/gophermart/internal/scheduler"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Gophermart-Signature"
+	EventHeader     = "X-Gophermart-Event"
+	DeliveryHeader  = "X-Gophermart-Delivery"
+
+	//deliveries claimed by one run of the worker, they are sent concurrently
+	batchSize = 20
+)
+
+var (
+	errMalformedSignature = errors.New("malformed webhook signature")
+	errSignatureMismatch  = errors.New("webhook signature mismatch")
+	errSignatureExpired   = errors.New("webhook signature timestamp out of tolerance")
+	errForbiddenAddress   = errors.New("webhook address is not public")
+	errRedirect           = errors.New("webhook redirects are not followed")
+)
+
+// Sign returns the signature header of a body sent at t. The signature is
+// the hex HMAC-SHA256 of "<unix time>.<body>" keyed with the secret of the
+// webhook, so a captured delivery can't be replayed with another time.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + mac(secret, ts, body)
+}
+
+// Verify checks a signature header made by Sign against the body. The
+// signing time must be within tolerance of now.
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return errMalformedSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(mac(secret, ts, body))) {
+		return errSignatureMismatch
+	}
+	if d := now.Sub(time.Unix(unix, 0)); d > tolerance || d < -tolerance {
+		return errSignatureExpired
+	}
+	return nil
+}
+
+func mac(secret, ts string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts))
+	h.Write([]byte("."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Policy controls the retries of deliveries. A failed delivery is retried
+// after Backoff, doubled on every further failure up to MaxBackoff, until
+// it failed MaxAttempts times.
+type Policy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Timeout     time.Duration
+}
+
+// Delay returns the wait after the given number of failed attempts.
+func (p Policy) Delay(attempts int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempts && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxBackoff)
+}
+
+type Store interface {
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*obj.WebhookDelivery, error)
+	RecordWebhookAttempt(context.Context, *obj.WebhookDelivery, *obj.WebhookAttempt) error
+}
+
+type Worker struct {
+	logger *zap.SugaredLogger
+	store  Store
+	policy Policy
+	client *http.Client
+}
+
+func NewWorker(
+	logger *zap.SugaredLogger,
+	store Store,
+	policy Policy,
+) *Worker {
+	return &Worker{
+		logger: logger,
+		store:  store,
+		policy: policy,
+		client: newClient(policy.Timeout, publicOnly),
+	}
+}
+
+// newClient returns the client of the deliveries. Webhook URLs are set by
+// users, so control checks every address dialed, after DNS resolution,
+// and redirects are not followed. Proxies from the environment are not
+// used, the dialer would check the proxy instead of the receiver.
+func newClient(timeout time.Duration, control func(network, address string, c syscall.RawConn) error) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: control}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return errRedirect
+		},
+	}
+}
+
+// publicOnly refuses to connect to addresses of the host or its networks.
+func publicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !Public(addr) {
+		return fmt.Errorf("%w: %s", errForbiddenAddress, addr)
+	}
+	return nil
+}
+
+// deniedPrefixes are the special purpose ranges the netip predicates
+// don't cover. The IPv6 ones translate to IPv4 addresses, private ones
+// included.
+var deniedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// Public reports whether webhooks may be delivered to addr. Loopback,
+// private, link-local, multicast, unspecified and the denied special
+// purpose addresses are refused.
+func Public(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range deniedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Run sends the deliveries which are due. Claimed deliveries are hidden
+// from other workers for twice the timeout, so a delivery is retried if
+// the worker dies before recording the attempt.
+func (w *Worker) Run(ctx context.Context) error {
+	ds, err := w.store.ClaimWebhookDeliveries(ctx, time.Now(), 2*w.policy.Timeout, batchSize)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, d := range ds {
+		wg.Add(1)
+		go func(d *obj.WebhookDelivery) {
+			defer wg.Done()
+			a := w.send(ctx, d)
+			w.settle(d, a)
+			if err := w.store.RecordWebhookAttempt(ctx, d, a); err != nil {
+				w.logger.Errorw("failed to record webhook attempt", "delivery", d.DeliveryID, "error", err)
+			}
+		}(d)
+	}
+	wg.Wait()
+	return nil
+}
+
+// settle moves the delivery to its next state after the attempt.
+func (w *Worker) settle(d *obj.WebhookDelivery, a *obj.WebhookAttempt) {
+	d.Attempts++
+	if a.Error == "" {
+		d.Status, d.NextAttemptAt, d.DeliveredAt = obj.DeliveryStatusDelivered, nil, &a.AttemptedAt
+		return
+	}
+	if d.Attempts >= w.policy.MaxAttempts {
+		d.Status, d.NextAttemptAt = obj.DeliveryStatusDead, nil
+		w.logger.Warnw("webhook delivery is dead", "delivery", d.DeliveryID, "webhook", d.WebhookID, "attempts", d.Attempts)
+		return
+	}
+	next := a.AttemptedAt.Add(w.policy.Delay(d.Attempts))
+	d.Status, d.NextAttemptAt = obj.DeliveryStatusPending, &next
+}
+
+// send posts the payload of the delivery. Any response but 2xx fails the
+// attempt. Only the status of the response is kept, its body is shown to
+// the webhook owner and must not leak what the receiver answered.
+func (w *Worker) send(ctx context.Context, d *obj.WebhookDelivery) *obj.WebhookAttempt {
+	a := &obj.WebhookAttempt{AttemptedAt: time.Now()}
+	defer func() {
+		a.DurationMS = time.Since(a.AttemptedAt).Milliseconds()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, d.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(d.DeliveryID, 10))
+	req.Header.Set(SignatureHeader, Sign(d.Secret, a.AttemptedAt, d.Payload))
+
+	res, err := w.client.Do(req)
+	if errors.Is(err, errForbiddenAddress) {
+		//the resolved address tells about the network, it isn't kept
+		a.Error = errForbiddenAddress.Error()
+		return a
+	}
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	defer res.Body.Close()
+
+	a.StatusCode = res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		a.Error = res.Status
+		return a
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1<<20))
+	return a
+}
+
+// Job runs the delivery worker every interval.
+func Job(
+	logger *zap.SugaredLogger,
+	store Store,
+	policy Policy,
+	interval time.Duration,
+) *scheduler.Job {
+	return &scheduler.Job{
+		Name:     "webhooks delivery",
+		Interval: interval,
+		Run:      NewWorker(logger, store, policy).Run,
+	}
+}
@@ -0,0 +1,279 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	obj "github.com/eqkez0r/gophermart/pkg/objects"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	body := []byte(`{"type":"order.processed"}`)
+	header := Sign("whsec_1", now, body)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    []byte
+		now     time.Time
+		wantErr error
+	}{
+		{name: "valid", secret: "whsec_1", header: header, body: body, now: now},
+		{name: "within tolerance", secret: "whsec_1", header: header, body: body, now: now.Add(4 * time.Minute)},
+		{name: "other secret", secret: "whsec_2", header: header, body: body, now: now, wantErr: errSignatureMismatch},
+		{name: "tampered body", secret: "whsec_1", header: header, body: []byte(`{}`), now: now, wantErr: errSignatureMismatch},
+		{name: "replayed", secret: "whsec_1", header: header, body: body, now: now.Add(time.Hour), wantErr: errSignatureExpired},
+		{name: "malformed", secret: "whsec_1", header: "v1=abc", body: body, now: now, wantErr: errMalformedSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(tt.secret, tt.header, tt.body, tt.now, 5*time.Minute); err != tt.wantErr {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyDelay(t *testing.T) {
+	policy := Policy{Backoff: 30 * time.Second, MaxBackoff: 5 * time.Minute}
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 30 * time.Second},
+		{attempts: 2, want: time.Minute},
+		{attempts: 4, want: 4 * time.Minute},
+		{attempts: 5, want: 5 * time.Minute},
+		{attempts: 40, want: 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := policy.Delay(tt.attempts); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// memStore hands out the pending deliveries which are due, like the
+// postgres claim does.
+type memStore struct {
+	mu       sync.Mutex
+	pending  []*obj.WebhookDelivery
+	attempts []*obj.WebhookAttempt
+}
+
+func (s *memStore) ClaimWebhookDeliveries(_ context.Context, now time.Time, lease time.Duration, limit int) ([]*obj.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ds []*obj.WebhookDelivery
+	for _, d := range s.pending {
+		if d.Status == obj.DeliveryStatusPending && !d.NextAttemptAt.After(now) && len(ds) < limit {
+			next := now.Add(lease)
+			d.NextAttemptAt = &next
+			ds = append(ds, d)
+		}
+	}
+	return ds, nil
+}
+
+func (s *memStore) RecordWebhookAttempt(_ context.Context, _ *obj.WebhookDelivery, a *obj.WebhookAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts = append(s.attempts, a)
+	return nil
+}
+
+func newDelivery(url string) *obj.WebhookDelivery {
+	now := time.Now()
+	return &obj.WebhookDelivery{
+		DeliveryID:    1,
+		WebhookID:     1,
+		Event:         obj.EventOrderProcessed,
+		Status:        obj.DeliveryStatusPending,
+		NextAttemptAt: &now,
+		URL:           url,
+		Secret:        "whsec_1",
+		Payload:       []byte(`{"id":"evt_1","type":"order.processed","data":{"number":"2377225624"}}`),
+	}
+}
+
+// newTestWorker returns a worker allowed to deliver to the loopback
+// receivers of the tests.
+func newTestWorker(store Store, policy Policy) *Worker {
+	w := NewWorker(zap.NewNop().Sugar(), store, policy)
+	w.client = newClient(policy.Timeout, nil)
+	return w
+}
+
+func TestWorkerDelivers(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := Verify("whsec_1", r.Header.Get(SignatureHeader), body, time.Now(), time.Minute); err != nil {
+			t.Errorf("Verify() error = %v", err)
+		}
+		event := &obj.WebhookEvent{}
+		if err := json.Unmarshal(body, event); err != nil || event.Type != obj.EventOrderProcessed {
+			t.Errorf("event = %+v, %v", event, err)
+		}
+		received <- r
+	}))
+	defer receiver.Close()
+
+	d := newDelivery(receiver.URL)
+	store := &memStore{pending: []*obj.WebhookDelivery{d}}
+	w := newTestWorker(store, Policy{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: time.Hour, Timeout: time.Second})
+	if err := w.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	r := <-received
+	if got := r.Header.Get(EventHeader); got != obj.EventOrderProcessed {
+		t.Errorf("event header = %v, want %v", got, obj.EventOrderProcessed)
+	}
+	if d.Status != obj.DeliveryStatusDelivered || d.DeliveredAt == nil || d.Attempts != 1 {
+		t.Errorf("delivery = %+v, want delivered after 1 attempt", d)
+	}
+	if len(store.attempts) != 1 || store.attempts[0].StatusCode != http.StatusOK {
+		t.Errorf("attempts = %+v, want one 200", store.attempts)
+	}
+}
+
+func TestWorkerRetriesUntilDead(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		http.Error(w, "internal details", http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	d := newDelivery(receiver.URL)
+	store := &memStore{pending: []*obj.WebhookDelivery{d}}
+	policy := Policy{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: time.Hour, Timeout: time.Second}
+	w := newTestWorker(store, policy)
+
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		if err := w.Run(context.Background()); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		//a retry is not due before its backoff
+		if err := w.Run(context.Background()); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if attempt < policy.MaxAttempts {
+			if d.Status != obj.DeliveryStatusPending || d.NextAttemptAt == nil {
+				t.Fatalf("attempt %d: delivery = %+v, want pending", attempt, d)
+			}
+			want := store.attempts[attempt-1].AttemptedAt.Add(policy.Delay(attempt))
+			if !d.NextAttemptAt.Equal(want) {
+				t.Errorf("attempt %d: next attempt = %v, want %v", attempt, d.NextAttemptAt, want)
+			}
+			now := time.Now()
+			d.NextAttemptAt = &now
+		}
+	}
+
+	if d.Status != obj.DeliveryStatusDead || d.NextAttemptAt != nil {
+		t.Errorf("delivery = %+v, want dead", d)
+	}
+	if calls != policy.MaxAttempts {
+		t.Errorf("receiver calls = %d, want %d", calls, policy.MaxAttempts)
+	}
+	last := store.attempts[len(store.attempts)-1]
+	if last.StatusCode != http.StatusServiceUnavailable || last.Error != "503 Service Unavailable" {
+		t.Errorf("last attempt = %+v, want a logged 503 without the body", last)
+	}
+}
+
+func TestWorkerRefuses(t *testing.T) {
+	calls := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer receiver.Close()
+	policy := Policy{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: time.Hour, Timeout: time.Second}
+
+	tests := []struct {
+		name      string
+		worker    func(Store) *Worker
+		wantCalls int
+	}{
+		{name: "loopback address", worker: func(s Store) *Worker {
+			return NewWorker(zap.NewNop().Sugar(), s, policy)
+		}},
+		{name: "redirect", worker: func(s Store) *Worker {
+			return newTestWorker(s, policy)
+		}, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = 0
+			d := newDelivery(receiver.URL)
+			store := &memStore{pending: []*obj.WebhookDelivery{d}}
+			if err := tt.worker(store).Run(context.Background()); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("receiver calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if d.Status != obj.DeliveryStatusPending || len(store.attempts) != 1 || store.attempts[0].Error == "" {
+				t.Errorf("attempts = %+v, want one failed", store.attempts)
+			}
+		})
+	}
+}
+
+func TestPublic(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "93.184.216.34", want: true},
+		{addr: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{addr: "127.0.0.1"},
+		{addr: "::1"},
+		{addr: "10.1.2.3"},
+		{addr: "172.16.0.1"},
+		{addr: "192.168.1.1"},
+		{addr: "fd00::1"},
+		{addr: "169.254.169.254"},
+		{addr: "fe80::1"},
+		{addr: "224.0.0.1"},
+		{addr: "0.0.0.0"},
+		{addr: "::"},
+		{addr: "::ffff:127.0.0.1"},
+		{addr: "0.1.2.3"},
+		{addr: "100.64.0.1"},
+		{addr: "100.127.255.254"},
+		{addr: "192.0.0.8"},
+		{addr: "198.18.0.1"},
+		{addr: "198.19.255.255"},
+		{addr: "240.0.0.1"},
+		{addr: "255.255.255.255"},
+		{addr: "64:ff9b::a00:1"},
+		{addr: "64:ff9b:1::1"},
+		{addr: "2002:a00:1::1"},
+		{addr: "100.128.0.1", want: true},
+		{addr: "198.20.0.1", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := Public(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("Public(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
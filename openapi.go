@@ -0,0 +1,8 @@
+package gophermart
+
+import _ "embed"
+
+// OpenAPI is the API specification the server validates requests against.
+//
+//go:embed OpenAPI.yaml
+var OpenAPI []byte
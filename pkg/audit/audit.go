@@ -0,0 +1,51 @@
+package audit
+
+import "context"
+
+const (
+	ActionRegister      = "user.register"
+	ActionLogin         = "user.login"
+	ActionLoginFailed   = "user.login_failed"
+	ActionOrderUpload   = "order.upload"
+	ActionWithdraw      = "balance.withdraw"
+	ActionAccrualCredit = "balance.accrual"
+	ActionBalanceAdjust = "balance.adjust"
+	ActionPointsExpire  = "balance.expire"
+	ActionTierChange    = "user.tier"
+	ActionReferral      = "user.referral"
+	ActionReferralBonus = "balance.referral"
+	ActionTransferOut   = "balance.transfer_out"
+	ActionTransferIn    = "balance.transfer_in"
+	ActionRefund        = "balance.refund"
+	ActionHold          = "balance.hold"
+	ActionHoldRelease   = "balance.hold_release"
+	ActionHoldExpire    = "balance.hold_expire"
+	ActionAdminPrefix   = "admin "
+	SystemActor         = "system"
+)
+
+// Meta describes who triggered an action. It is carried in the context
+// down to the storage layer, which writes the audit records.
+type Meta struct {
+	Actor     string
+	IP        string
+	UserAgent string
+	RequestID string
+	// APIKeyID is set when the request was authenticated with an api key.
+	APIKeyID uint64
+}
+
+type metaKey struct{}
+
+func WithMeta(ctx context.Context, m *Meta) context.Context {
+	return context.WithValue(ctx, metaKey{}, m)
+}
+
+// MetaFrom returns the metadata stored in ctx. Actions without a request,
+// e.g. accrual credits by the order fetcher, are attributed to the system.
+func MetaFrom(ctx context.Context) *Meta {
+	if m, ok := ctx.Value(metaKey{}).(*Meta); ok && m != nil {
+		return m
+	}
+	return &Meta{Actor: SystemActor}
+}
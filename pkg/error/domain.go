@@ -0,0 +1,77 @@
+package e
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Error is a domain error with a stable machine-readable code and the
+// HTTP status it maps to. Copies made by WithDetail and WithCause still
+// match the original with errors.Is, as errors are compared by code.
+type Error struct {
+	Code   string
+	Status int
+	Title  string
+	Detail string
+	cause  error
+}
+
+func New(code string, status int, title string) *Error {
+	return &Error{
+		Code:   code,
+		Status: status,
+		Title:  title,
+	}
+}
+
+func (er *Error) Error() string {
+	msg := er.Title
+	if er.Detail != "" {
+		msg += ": " + er.Detail
+	}
+	if er.cause != nil {
+		msg += ": " + er.cause.Error()
+	}
+	return msg
+}
+
+func (er *Error) Unwrap() error {
+	return er.cause
+}
+
+func (er *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == er.Code
+}
+
+// WithDetail returns a copy with a client-facing explanation.
+func (er *Error) WithDetail(detail string) *Error {
+	cp := *er
+	cp.Detail = detail
+	return &cp
+}
+
+// WithCause returns a copy wrapping cause. The cause is meant for logs
+// and is never shown to clients.
+func (er *Error) WithCause(cause error) *Error {
+	cp := *er
+	cp.cause = cause
+	return &cp
+}
+
+// As returns the first domain error in the chain of err.
+func As(err error) (*Error, bool) {
+	var de *Error
+	if errors.As(err, &de) {
+		return de, true
+	}
+	return nil, false
+}
+
+// StatusOf returns the HTTP status of err, 500 for non-domain errors.
+func StatusOf(err error) int {
+	if de, ok := As(err); ok {
+		return de.Status
+	}
+	return http.StatusInternalServerError
+}
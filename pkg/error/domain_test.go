@@ -0,0 +1,46 @@
+package e
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		target     error
+		wantIs     bool
+		wantStatus int
+	}{
+		{name: "same", err: ErrBalanceIsNotEnough, target: ErrBalanceIsNotEnough, wantIs: true, wantStatus: http.StatusPaymentRequired},
+		{name: "wrapped", err: Wrap("op", ErrOrderNumberLuhn), target: ErrOrderNumberLuhn, wantIs: true, wantStatus: http.StatusUnprocessableEntity},
+		{name: "wrapped twice", err: Wrap("outer", Wrap("inner", ErrUserBlocked)), target: ErrUserBlocked, wantIs: true, wantStatus: http.StatusForbidden},
+		{name: "with detail", err: ErrInvalidRequest.WithDetail("empty field"), target: ErrInvalidRequest, wantIs: true, wantStatus: http.StatusBadRequest},
+		{name: "other code", err: ErrOrderNumberLuhn, target: ErrOrderNumberNotNumeric, wantIs: false, wantStatus: http.StatusUnprocessableEntity},
+		{name: "plain error", err: errors.New("boom"), target: ErrInternal, wantIs: false, wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, tt.target); got != tt.wantIs {
+				t.Errorf("errors.Is() = %v, want %v", got, tt.wantIs)
+			}
+			if got := StatusOf(tt.err); got != tt.wantStatus {
+				t.Errorf("StatusOf() = %v, want %v", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestErrorWithCause(t *testing.T) {
+	cause := errors.New("eof")
+	err := Wrap("op", ErrInvalidRequest.WithCause(cause))
+	if !errors.Is(err, cause) {
+		t.Errorf("errors.Is(cause) = false, want true")
+	}
+	de, ok := As(err)
+	if !ok || de.Code != "invalid_request" {
+		t.Errorf("As() = %v, %v", de, ok)
+	}
+}
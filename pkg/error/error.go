@@ -1,9 +1,56 @@
 package e
 
-import "errors"
+import "net/http"
 
 var (
-	ErrBalanceIsNotEnough              = errors.New("balance is not enough")
-	ErrIsOrderIsNotExist               = errors.New("order is not exist")
-	ErrIsOrderExistWithAnotherCustomer = errors.New("order is exist with a another customer")
+	ErrBalanceIsNotEnough              = New("insufficient_balance", http.StatusPaymentRequired, "balance is not enough")
+	ErrIsOrderIsNotExist               = New("order_not_found", http.StatusNotFound, "order is not exist")
+	ErrIsOrderExistWithAnotherCustomer = New("order_belongs_to_another_user", http.StatusConflict, "order is exist with a another customer")
+	ErrTOTPAlreadyEnabled              = New("totp_already_enabled", http.StatusConflict, "two-factor authentication is already enabled")
+	ErrTOTPNotEnrolled                 = New("totp_not_enrolled", http.StatusNotFound, "two-factor authentication is not enrolled")
+	ErrTOTPCodeInvalid                 = New("totp_code_invalid", http.StatusUnprocessableEntity, "totp code is not valid")
+	ErrAPIKeyNotFound                  = New("api_key_not_found", http.StatusNotFound, "api key is not found")
+	ErrUserNotFound                    = New("user_not_found", http.StatusNotFound, "user is not found")
+	ErrUserBlocked                     = New("user_blocked", http.StatusForbidden, "user is blocked")
+	ErrOrderAlreadyProcessed           = New("order_already_processed", http.StatusConflict, "order is already processed")
+	ErrStatementNotFound               = New("statement_not_found", http.StatusNotFound, "statement is not found")
+	ErrReferralCodeInvalid             = New("referral_code_invalid", http.StatusUnprocessableEntity, "referral code is not valid")
+	ErrTransferLimitExceeded           = New("transfer_limit_exceeded", http.StatusUnprocessableEntity, "daily transfer limit exceeded")
+	ErrWithdrawalNotFound              = New("withdrawal_not_found", http.StatusNotFound, "withdrawal is not found")
+	ErrWithdrawalRefunded              = New("withdrawal_already_refunded", http.StatusConflict, "withdrawal is already refunded")
+	ErrRefundExceedsWithdrawal         = New("refund_exceeds_withdrawal", http.StatusUnprocessableEntity, "refund exceeds the withdrawn sum")
+	ErrHoldNotFound                    = New("hold_not_found", http.StatusNotFound, "hold is not found")
+	ErrHoldNotActive                   = New("hold_not_active", http.StatusConflict, "hold is already captured, released or expired")
+	ErrOrderReserved                   = New("order_already_reserved", http.StatusConflict, "order already has a hold or a withdrawal")
+	ErrCampaignNotFound                = New("campaign_not_found", http.StatusNotFound, "campaign is not found")
+	ErrWebhookNotFound                 = New("webhook_not_found", http.StatusNotFound, "webhook is not found")
+	ErrWebhookDeliveryNotFound         = New("webhook_delivery_not_found", http.StatusNotFound, "webhook delivery is not found")
+	ErrWithdrawAmountLimit             = New("withdraw_amount_limit", http.StatusUnprocessableEntity, "withdrawal exceeds the max amount")
+	ErrWithdrawDailyLimit              = New("withdraw_daily_limit", http.StatusUnprocessableEntity, "daily withdrawal limit exceeded")
+	ErrWithdrawWeeklyLimit             = New("withdraw_weekly_limit", http.StatusUnprocessableEntity, "weekly withdrawal limit exceeded")
+	ErrWithdrawVelocity                = New("withdraw_velocity_limit", http.StatusTooManyRequests, "too many withdrawals in the last hour")
+	ErrAccountTooNew                   = New("account_too_new", http.StatusForbidden, "account is too new to withdraw")
+	ErrNewDevice                       = New("new_device", http.StatusForbidden, "withdrawals from a new device are not allowed yet")
+	ErrConfigInvalid                   = New("config_invalid", http.StatusUnprocessableEntity, "config is not valid")
+	ErrConfigNotReloadable             = New("config_not_reloadable", http.StatusConflict, "config changes require a restart")
+
+	ErrInvalidRequest        = New("invalid_request", http.StatusBadRequest, "invalid request")
+	ErrRequestValidation     = New("request_validation_failed", http.StatusBadRequest, "request does not match the api specification")
+	ErrInvalidContentType    = New("invalid_content_type", http.StatusBadRequest, "invalid content type")
+	ErrRequestTooLarge       = New("request_too_large", http.StatusRequestEntityTooLarge, "request body is too large")
+	ErrOrderNumberNotNumeric = New("order_number_not_numeric", http.StatusUnprocessableEntity, "order number is not a number")
+	ErrOrderNumberLuhn       = New("order_number_invalid_luhn", http.StatusUnprocessableEntity, "order number fails the luhn check")
+	ErrLoginTaken            = New("login_taken", http.StatusConflict, "login is already taken")
+	ErrInvalidCredentials    = New("invalid_credentials", http.StatusUnauthorized, "invalid login or password")
+	ErrUnauthorized          = New("unauthorized", http.StatusUnauthorized, "authentication required")
+	ErrForbidden             = New("forbidden", http.StatusForbidden, "access denied")
+	ErrInsufficientScope     = New("insufficient_scope", http.StatusForbidden, "api key has no required scope")
+	ErrCSRFMismatch          = New("csrf_token_mismatch", http.StatusForbidden, "csrf token mismatch")
+	ErrRateLimited           = New("rate_limited", http.StatusTooManyRequests, "rate limit exceeded")
+	ErrStepUpRequired        = New("step_up_required", http.StatusForbidden, "fresh two-factor verification required")
+	ErrInvalidSecondFactor   = New("invalid_second_factor", http.StatusUnauthorized, "invalid second factor code")
+	ErrChallengeInvalid      = New("challenge_invalid", http.StatusUnauthorized, "too many invalid codes for the challenge, log in again")
+	ErrSecondFactorLocked    = New("second_factor_locked", http.StatusTooManyRequests, "too many invalid second factor codes")
+	ErrNotFound              = New("not_found", http.StatusNotFound, "not found")
+	ErrInternal              = New("internal_error", http.StatusInternalServerError, "internal server error")
 )
@@ -2,6 +2,8 @@ package e
 
 import "fmt"
 
+// Wrap prefixes err with the operation name. The original error stays
+// in the chain, so errors.Is and errors.As keep working.
 func Wrap(point string, err error) error {
-	return fmt.Errorf("%s: %s", point, err.Error())
+	return fmt.Errorf("%s: %w", point, err)
 }
@@ -1,54 +1,209 @@
 package jwt
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"github.com/golang-jwt/jwt/v4"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	key      = "7OEdd8d8mOgLnIU9tLW5"
-	tokenexp = time.Minute * 5
+	// MinKeyLen is the min length of signing keys, the size of the
+	// HS256 hash.
+	MinKeyLen = 32
+
+	ScopeAccess    = "access"
+	ScopeChallenge = "2fa_challenge"
+)
+
+var (
+	tokenexp     = durationOf(time.Minute * 5)
+	challengeexp = durationOf(time.Minute * 2)
+	//a random key until one is set, so tokens don't outlive the process
+	keys = randomKeys()
 )
 
 var (
 	ErrInvalidToken = errors.New("invalid token")
+	ErrInvalidScope = errors.New("invalid token scope")
+	ErrShortKey     = errors.New("jwt key must be at least 32 bytes")
 )
 
+// keyring signs with the current key and still accepts tokens signed
+// with the previous one until previousUntil, so rotating the key doesn't
+// sign users out.
+type keyring struct {
+	current       []byte
+	previous      []byte
+	previousUntil time.Time
+}
+
+// SetKey makes key the signing key. The replaced key is accepted for
+// verification as long as the tokens it signed may live, then dropped,
+// so a leaked key stops working soon after the rotation. It is safe to
+// call while tokens are issued.
+func SetKey(key []byte) error {
+	if len(key) < MinKeyLen {
+		return ErrShortKey
+	}
+	prev := keys.Load()
+	if bytes.Equal(prev.current, key) {
+		return nil
+	}
+	ttl := max(time.Duration(tokenexp.Load()), time.Duration(challengeexp.Load()))
+	keys.Store(&keyring{current: key, previous: prev.current, previousUntil: time.Now().Add(ttl)})
+	return nil
+}
+
+func randomKeys() *atomic.Pointer[keyring] {
+	key := make([]byte, MinKeyLen)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	p := &atomic.Pointer[keyring]{}
+	p.Store(&keyring{current: key})
+	return p
+}
+
+// SetTTL sets the lifetime of the access and the challenge tokens issued
+// from now on. It is safe to call while tokens are issued.
+func SetTTL(token, challenge time.Duration) {
+	tokenexp.Store(int64(token))
+	challengeexp.Store(int64(challenge))
+}
+
+func durationOf(d time.Duration) *atomic.Int64 {
+	v := &atomic.Int64{}
+	v.Store(int64(d))
+	return v
+}
+
 type Claims struct {
 	jwt.RegisteredClaims
-	Login string
+	Login         string
+	Role          string           `json:",omitempty"`
+	Scope         string           `json:",omitempty"`
+	MFAVerifiedAt *jwt.NumericDate `json:",omitempty"`
 }
 
-func CreateJWT(login string) (string, error) {
+func CreateJWT(login, role string) (string, error) {
+	return sign(Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(tokenexp.Load()))),
+		},
+		Login: login,
+		Role:  role,
+		Scope: ScopeAccess,
+	})
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+// CreateMFAJWT issues an access token for a user who has just passed
+// the second factor, so the token can be used for step-up operations.
+func CreateMFAJWT(login, role string) (string, error) {
+	now := time.Now()
+	return sign(Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenexp)),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(tokenexp.Load()))),
+		},
+		Login:         login,
+		Role:          role,
+		Scope:         ScopeAccess,
+		MFAVerifiedAt: jwt.NewNumericDate(now),
+	})
+}
+
+// CreateChallengeJWT issues a short-lived token which is only accepted
+// by the second login step and never as an access token. Each challenge
+// has a unique ID, so failed attempts can be counted per challenge.
+func CreateChallengeJWT(login string) (string, time.Time, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", time.Time{}, err
+	}
+	exp := time.Now().Add(time.Duration(challengeexp.Load()))
+	token, err := sign(Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(id),
+			ExpiresAt: jwt.NewNumericDate(exp),
 		},
 		Login: login,
+		Scope: ScopeChallenge,
 	})
-	tokenString, err := token.SignedString([]byte(key))
 	if err != nil {
-		return "", err
+		return "", time.Time{}, err
 	}
-	return tokenString, nil
+	return token, exp, nil
 }
 
 func JWTPayload(tokenString string) (string, time.Time, error) {
+	claims, err := AccessClaims(tokenString)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return claims.Login, claims.ExpiresAt.Time, nil
+}
+
+// AccessClaims parses an access token. Tokens issued before scopes were
+// introduced have no scope and are treated as access tokens.
+func AccessClaims(tokenString string) (*Claims, error) {
+	claims, err := ParseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Scope != ScopeAccess && claims.Scope != "" {
+		return nil, ErrInvalidScope
+	}
+	return claims, nil
+}
+
+// ChallengeClaims parses a challenge token issued by CreateChallengeJWT.
+func ChallengeClaims(tokenString string) (*Claims, error) {
+	claims, err := ParseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Scope != ScopeChallenge || claims.ID == "" {
+		return nil, ErrInvalidScope
+	}
+	return claims, nil
+}
+
+func ParseClaims(tokenString string) (*Claims, error) {
+	ring := keys.Load()
+	claims, err := parse(tokenString, ring.current)
+	if ring.previous != nil && time.Now().Before(ring.previousUntil) && errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		return parse(tokenString, ring.previous)
+	}
+	return claims, err
+}
+
+func parse(tokenString string, key []byte) (*Claims, error) {
 	claims := &Claims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(key), nil
+		return key, nil
 	})
 
 	if err != nil {
-		return "", time.Time{}, err
+		return nil, err
 	}
 
 	if !token.Valid {
-		return "", time.Time{}, ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 
-	return claims.Login, claims.ExpiresAt.Time, nil
+	return claims, nil
+}
+
+func sign(claims Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString(keys.Load().current)
+	if err != nil {
+		return "", err
+	}
+	return tokenString, nil
 }
@@ -0,0 +1,83 @@
+package jwt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetKey(t *testing.T) {
+	first := []byte(strings.Repeat("a", MinKeyLen))
+	second := []byte(strings.Repeat("b", MinKeyLen))
+	third := []byte(strings.Repeat("c", MinKeyLen))
+
+	if err := SetKey([]byte("short")); !errors.Is(err, ErrShortKey) {
+		t.Fatalf("SetKey() error = %v, want %v", err, ErrShortKey)
+	}
+	if err := SetKey(first); err != nil {
+		t.Fatalf("SetKey() error = %v", err)
+	}
+	old, err := CreateJWT("alice", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//tokens of the previous key stay valid after a rotation
+	if err = SetKey(second); err != nil {
+		t.Fatalf("SetKey() error = %v", err)
+	}
+	if claims, err := ParseClaims(old); err != nil || claims.Login != "alice" {
+		t.Errorf("ParseClaims() = %+v, %v, want the token of the previous key", claims, err)
+	}
+	current, err := CreateJWT("bob", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := ParseClaims(current); err != nil || claims.Login != "bob" {
+		t.Errorf("ParseClaims() = %+v, %v, want the token of the current key", claims, err)
+	}
+
+	//setting the same key again doesn't drop the previous one
+	if err = SetKey(second); err != nil {
+		t.Fatalf("SetKey() error = %v", err)
+	}
+	if _, err = ParseClaims(old); err != nil {
+		t.Errorf("ParseClaims() error = %v, want the previous key kept", err)
+	}
+
+	if err = SetKey(third); err != nil {
+		t.Fatalf("SetKey() error = %v", err)
+	}
+	if _, err = ParseClaims(old); err == nil {
+		t.Errorf("ParseClaims() error = nil, want tokens of two rotations ago rejected")
+	}
+	if _, err = ParseClaims(current); err != nil {
+		t.Errorf("ParseClaims() error = %v, want the previous key accepted", err)
+	}
+}
+
+func TestSetKeyDropsPreviousKey(t *testing.T) {
+	t.Cleanup(func() { SetTTL(5*time.Minute, 2*time.Minute) })
+
+	if err := SetKey([]byte(strings.Repeat("d", MinKeyLen))); err != nil {
+		t.Fatalf("SetKey() error = %v", err)
+	}
+	old, err := CreateJWT("alice", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the previous key outlives the rotation by the token lifetime only
+	SetTTL(50*time.Millisecond, 50*time.Millisecond)
+	if err = SetKey([]byte(strings.Repeat("e", MinKeyLen))); err != nil {
+		t.Fatalf("SetKey() error = %v", err)
+	}
+	if _, err = ParseClaims(old); err != nil {
+		t.Errorf("ParseClaims() error = %v, want the previous key accepted right after the rotation", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err = ParseClaims(old); err == nil {
+		t.Errorf("ParseClaims() error = nil, want the previous key dropped after the token lifetime")
+	}
+}
@@ -0,0 +1,38 @@
+package objects
+
+import "time"
+
+const (
+	ScopeOrdersRead   = "orders:read"
+	ScopeOrdersWrite  = "orders:write"
+	ScopeBalanceRead  = "balance:read"
+	ScopeBalanceWrite = "balance:write"
+)
+
+var APIKeyScopes = map[string]bool{
+	ScopeOrdersRead:   true,
+	ScopeOrdersWrite:  true,
+	ScopeBalanceRead:  true,
+	ScopeBalanceWrite: true,
+}
+
+type APIKey struct {
+	KeyID      uint64     `json:"id"`
+	Login      string     `json:"-"`
+	Name       string     `json:"name"`
+	Key        string     `json:"key,omitempty"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	RateLimit  int        `json:"rate_limit"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
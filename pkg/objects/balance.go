@@ -1,6 +1,12 @@
 package objects
 
+// AccrualBalance is the balance of a user. Balance is what the user can
+// spend, the points reserved by active holds are reported as Held.
 type AccrualBalance struct {
 	Balance  float32 `json:"current"`
 	Withdraw float32 `json:"withdrawn"`
+	Held     float32 `json:"held,omitempty"`
+	// ExpiringSoon lists the points expiring within the configured window.
+	ExpiringSoon []*ExpiringPoints `json:"expiring_soon,omitempty"`
+	Tier         *TierInfo         `json:"tier,omitempty"`
 }
@@ -0,0 +1,27 @@
+package objects
+
+import "time"
+
+// Campaign boosts the accruals of orders uploaded from StartsAt until
+// EndsAt, either by Multiplier or by a fixed Bonus. Segment limits it to
+// the members of a loyalty tier, OrderPrefix to order numbers starting
+// with the prefix.
+type Campaign struct {
+	CampaignID  uint64    `json:"id"`
+	Name        string    `json:"name"`
+	StartsAt    time.Time `json:"starts_at"`
+	EndsAt      time.Time `json:"ends_at"`
+	Multiplier  float32   `json:"multiplier,omitempty"`
+	Bonus       float32   `json:"bonus,omitempty"`
+	Segment     string    `json:"segment,omitempty"`
+	OrderPrefix string    `json:"order_prefix,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// OrderCampaign is the campaign applied to an order with the points it
+// added to the accrual.
+type OrderCampaign struct {
+	CampaignID uint64  `json:"id"`
+	Name       string  `json:"name"`
+	Bonus      float32 `json:"bonus"`
+}
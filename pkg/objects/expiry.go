@@ -0,0 +1,18 @@
+package objects
+
+import "time"
+
+// PointLot is the part of an accrual which is not spent or expired yet.
+// Lots are consumed oldest first.
+type PointLot struct {
+	LotID     uint64
+	Number    string
+	Remaining float32
+	AccruedAt time.Time
+}
+
+type ExpiringPoints struct {
+	Number    string    `json:"order"`
+	Amount    float32   `json:"amount"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,21 @@
+package objects
+
+import "time"
+
+const (
+	ExportTypeOrder      = "order"
+	ExportTypeWithdrawal = "withdrawal"
+	ExportTypeMovement   = "movement"
+)
+
+// ExportRecord is a row of the account export. Orders, withdrawals and
+// balance movements share it, fields not relevant to a type are empty.
+type ExportRecord struct {
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Number string    `json:"number,omitempty"`
+	Status string    `json:"status,omitempty"`
+	Amount *float32  `json:"amount,omitempty"`
+	Kind   string    `json:"kind,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+}
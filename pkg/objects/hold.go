@@ -0,0 +1,30 @@
+package objects
+
+import "time"
+
+const (
+	HoldStatusActive   = "active"
+	HoldStatusCaptured = "captured"
+	HoldStatusReleased = "released"
+	HoldStatusExpired  = "expired"
+)
+
+// HoldRequest reserves Sum points for the order. ExpiresIn is the lifetime
+// of the hold in seconds, the server default applies when it is 0.
+type HoldRequest struct {
+	Order     string  `json:"order"`
+	Sum       float32 `json:"sum"`
+	ExpiresIn int     `json:"expires_in,omitempty"`
+}
+
+// Hold reserves points until it is captured into a withdrawal, released
+// or expires.
+type Hold struct {
+	HoldID     uint64     `json:"-"`
+	Order      string     `json:"order"`
+	Sum        float32    `json:"sum"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
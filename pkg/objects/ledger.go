@@ -0,0 +1,30 @@
+package objects
+
+import "time"
+
+const (
+	LedgerKindAccrual    = "accrual"
+	LedgerKindWithdrawal = "withdrawal"
+	LedgerKindAdjustment = "adjustment"
+	LedgerKindExpiry     = "expiry"
+	LedgerKindReferral   = "referral"
+	LedgerKindTransfer   = "transfer"
+	LedgerKindRefund     = "refund"
+)
+
+// LedgerEntry is a single balance movement. Amount is positive for
+// credits and negative for debits.
+type LedgerEntry struct {
+	EntryID   uint64    `json:"id"`
+	UserID    uint64    `json:"-"`
+	Amount    float32   `json:"amount"`
+	Kind      string    `json:"kind"`
+	Reference string    `json:"reference,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type BalanceAdjustment struct {
+	Amount float32 `json:"amount"`
+	Reason string  `json:"reason"`
+}
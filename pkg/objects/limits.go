@@ -0,0 +1,37 @@
+package objects
+
+import "time"
+
+// WithdrawRules limit withdrawals, holds and transfers to slow down the
+// draining of a compromised account. Zero values disable a rule.
+type WithdrawRules struct {
+	// MaxAmount caps a single withdrawal.
+	MaxAmount float32
+	// DailyCap and WeeklyCap cap the points withdrawn, sent or put on
+	// hold within the last 24 hours and 7 days.
+	DailyCap  float32
+	WeeklyCap float32
+	// MinAccountAge is how long after signing up users may withdraw.
+	MinAccountAge time.Duration
+	// MaxPerHour limits the withdrawals and holds within the last hour.
+	MaxPerHour int
+	// NewDeviceAge is how long after the first sign-in from a device, or
+	// the creation of an api key, withdrawals from it are blocked. Devices
+	// are told apart by their user agent, so the rule is best-effort.
+	NewDeviceAge time.Duration
+}
+
+// Enabled reports whether any rule is set.
+func (r *WithdrawRules) Enabled() bool {
+	return r != nil && *r != WithdrawRules{}
+}
+
+// WithdrawActivity is the recent activity of a user the withdraw rules
+// are evaluated against. DeviceSeenAt is zero for unknown devices.
+type WithdrawActivity struct {
+	RegisteredAt time.Time
+	Day          float32
+	Week         float32
+	LastHour     int
+	DeviceSeenAt time.Time
+}
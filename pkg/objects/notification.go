@@ -0,0 +1,55 @@
+package objects
+
+import "time"
+
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+	ChannelPush  = "push"
+)
+
+var NotificationChannels = map[string]bool{
+	ChannelEmail: true,
+	ChannelSMS:   true,
+	ChannelPush:  true,
+}
+
+// NotificationEvents are the events users can be notified of, they share
+// the names of the webhook events.
+var NotificationEvents = map[string]bool{
+	EventOrderProcessed: true,
+	EventOrderInvalid:   true,
+}
+
+const (
+	NotificationStatusPending = "pending"
+	NotificationStatusSent    = "sent"
+	NotificationStatusFailed  = "failed"
+)
+
+// NotificationPrefs are the notification settings of a user. The user is
+// notified of Events on every channel of Channels with an address.
+type NotificationPrefs struct {
+	Locale    string   `json:"locale"`
+	Email     string   `json:"email,omitempty"`
+	Phone     string   `json:"phone,omitempty"`
+	PushToken string   `json:"push_token,omitempty"`
+	Channels  []string `json:"channels"`
+	Events    []string `json:"events"`
+}
+
+// Notification is an event queued to be sent to a user on a channel. Data
+// is the JSON of the object the event is about.
+type Notification struct {
+	NotificationID uint64
+	Event          string
+	Channel        string
+	Recipient      string
+	Locale         string
+	Data           []byte
+	Status         string
+	Attempts       int
+	Error          string
+	NextAttemptAt  *time.Time
+	SentAt         *time.Time
+}
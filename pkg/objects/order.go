@@ -15,4 +15,26 @@ type Order struct {
 	UploadAt time.Time `json:"upload_at"`
 	Number   string    `json:"number,omitempty"`
 	Accrual  *float32  `json:"accrual,omitempty"`
+	// Campaign is set when a campaign boosted the accrual.
+	Campaign *OrderCampaign `json:"campaign,omitempty"`
+}
+
+// OrderDetails is the order with the state of its accrual polling.
+type OrderDetails struct {
+	Order
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	Polls     int        `json:"polls"`
+}
+
+const (
+	BatchOrderAccepted        = "accepted"
+	BatchOrderAlreadyUploaded = "already_uploaded"
+	BatchOrderAnotherUser     = "belongs_to_another_user"
+	BatchOrderInvalid         = "invalid"
+)
+
+// BatchOrderResult is the outcome of one number of a bulk upload.
+type BatchOrderResult struct {
+	Number string `json:"number"`
+	Result string `json:"result"`
 }
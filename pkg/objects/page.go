@@ -0,0 +1,22 @@
+package objects
+
+import "time"
+
+// Cursor points at the last item of a page. Lists are ordered by time
+// and then by number, so the pair identifies a position.
+type Cursor struct {
+	Time   time.Time `json:"t"`
+	Number string    `json:"n"`
+}
+
+// ListFilter selects a page of orders or withdrawals. Zero From and To
+// leave the range open, empty Statuses match any status and a zero Limit
+// returns all of them.
+type ListFilter struct {
+	After    *Cursor
+	Desc     bool
+	Statuses []string
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
@@ -0,0 +1,39 @@
+package objects
+
+import "time"
+
+const (
+	ReferralStatusPending  = "pending"
+	ReferralStatusRewarded = "rewarded"
+	ReferralStatusRejected = "rejected"
+
+	ReferralRejectedLimit  = "limit_reached"
+	ReferralRejectedSameIP = "same_ip"
+)
+
+// ReferralTerms are the bonuses and limits a referral is made with. The
+// bonuses are fixed at sign-up and credited when the referee's first
+// order is processed.
+type ReferralTerms struct {
+	ReferrerBonus float32
+	RefereeBonus  float32
+	// MaxReferrals limits the rewarded referrals per referrer, 0 means
+	// no limit.
+	MaxReferrals int
+}
+
+// Referral is a user who signed up with the code of the referrer, as
+// shown to the referrer.
+type Referral struct {
+	Login      string     `json:"login"`
+	Status     string     `json:"status"`
+	Reason     string     `json:"reason,omitempty"`
+	Bonus      float32    `json:"bonus"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RewardedAt *time.Time `json:"rewarded_at,omitempty"`
+}
+
+type Referrals struct {
+	Code      string      `json:"code"`
+	Referrals []*Referral `json:"referrals"`
+}
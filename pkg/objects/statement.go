@@ -0,0 +1,18 @@
+package objects
+
+import "time"
+
+// StatementMonthLayout is the layout of statement months in the API.
+const StatementMonthLayout = "2006-01"
+
+// Statement sums the balance movements of a user in a calendar month
+// (UTC). Closing is Opening + Accruals + Adjustments - Withdrawals.
+type Statement struct {
+	Month       string    `json:"month"`
+	Opening     float32   `json:"opening"`
+	Accruals    float32   `json:"accruals"`
+	Withdrawals float32   `json:"withdrawals"`
+	Adjustments float32   `json:"adjustments"`
+	Closing     float32   `json:"closing"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
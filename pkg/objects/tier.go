@@ -0,0 +1,20 @@
+package objects
+
+import "time"
+
+// Tier is a loyalty level reached with Threshold points accrued within
+// the rolling window. Accruals of its members are multiplied by
+// Multiplier.
+type Tier struct {
+	Name       string  `json:"name"`
+	Threshold  float32 `json:"threshold"`
+	Multiplier float32 `json:"multiplier"`
+}
+
+// TierInfo is the tier of a user as of the last recalculation.
+type TierInfo struct {
+	Name         string    `json:"name"`
+	Multiplier   float32   `json:"multiplier"`
+	Points       float32   `json:"points"`
+	CalculatedAt time.Time `json:"calculated_at"`
+}
@@ -0,0 +1,26 @@
+package objects
+
+import "time"
+
+const (
+	TransferDirectionIn  = "in"
+	TransferDirectionOut = "out"
+)
+
+type TransferRequest struct {
+	To     string  `json:"to"`
+	Amount float32 `json:"amount"`
+	Note   string  `json:"note,omitempty"`
+}
+
+// Transfer is a movement of points between two users as seen by one of
+// them. Counterparty is the recipient of outgoing transfers and the
+// sender of incoming ones.
+type Transfer struct {
+	TransferID   uint64    `json:"id"`
+	Direction    string    `json:"direction"`
+	Counterparty string    `json:"counterparty"`
+	Amount       float32   `json:"amount"`
+	Note         string    `json:"note,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -0,0 +1,33 @@
+package objects
+
+import "time"
+
+// TOTP is the second factor of a user. LastCounter is the period of the
+// last accepted code and LockedUntil ends the lockout after too many
+// invalid codes.
+type TOTP struct {
+	Secret      string    `json:"-"`
+	Enabled     bool      `json:"enabled"`
+	LastCounter int64     `json:"-"`
+	LockedUntil time.Time `json:"-"`
+}
+
+type TOTPEnrolment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TwoFactorChallenge struct {
+	Challenge string    `json:"challenge"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type TwoFactorCode struct {
+	Challenge    string `json:"challenge,omitempty"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
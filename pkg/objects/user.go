@@ -1,8 +1,38 @@
 package objects
 
+import "time"
+
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+var Roles = map[string]bool{
+	RoleUser:    true,
+	RoleSupport: true,
+	RoleAdmin:   true,
+}
+
 type User struct {
-	UserID         uint64 `json:"user_id,omitempty"`
-	Login          string `json:"login"`
-	Password       string `json:"password"`
+	UserID   uint64 `json:"user_id,omitempty"`
+	Login    string `json:"login"`
+	Password string `json:"password"`
+	Role     string `json:"-"`
+	Blocked  bool   `json:"-"`
+	// ReferralCode is the code of the referrer given on registration.
+	ReferralCode   string `json:"referral_code,omitempty"`
 	AccrualBalance `json:"accrual_balance"`
 }
+
+// UserInfo is the user representation without credentials, used where
+// a user is shown to somebody else, e.g. in the admin API.
+type UserInfo struct {
+	UserID    uint64    `json:"user_id"`
+	Login     string    `json:"login"`
+	Role      string    `json:"role"`
+	Blocked   bool      `json:"blocked"`
+	Balance   float32   `json:"current"`
+	Withdraw  float32   `json:"withdrawn"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,69 @@
+package objects
+
+import "time"
+
+const (
+	EventOrderProcessed    = "order.processed"
+	EventOrderInvalid      = "order.invalid"
+	EventWithdrawalCreated = "withdrawal.created"
+)
+
+var WebhookEvents = map[string]bool{
+	EventOrderProcessed:    true,
+	EventOrderInvalid:      true,
+	EventWithdrawalCreated: true,
+}
+
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusDead      = "dead"
+)
+
+// Webhook receives the events of a user it is subscribed to. Secret signs
+// the deliveries and is only returned when the webhook is created.
+type Webhook struct {
+	WebhookID uint64    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookEvent is the body of a delivery. Every webhook subscribed to the
+// event receives the same EventID, so receivers can drop duplicates.
+type WebhookEvent struct {
+	EventID   string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// WebhookDelivery is an event queued for a webhook. Pending deliveries are
+// sent at NextAttemptAt until they succeed or run out of attempts, which
+// leaves them dead.
+type WebhookDelivery struct {
+	DeliveryID    uint64            `json:"id"`
+	WebhookID     uint64            `json:"webhook_id"`
+	Event         string            `json:"event"`
+	EventID       string            `json:"event_id"`
+	Status        string            `json:"status"`
+	Attempts      int               `json:"attempts"`
+	NextAttemptAt *time.Time        `json:"next_attempt_at,omitempty"`
+	DeliveredAt   *time.Time        `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+	Log           []*WebhookAttempt `json:"log,omitempty"`
+	// URL, Secret and Payload are loaded for the delivery worker.
+	URL     string `json:"-"`
+	Secret  string `json:"-"`
+	Payload []byte `json:"-"`
+}
+
+// WebhookAttempt is the outcome of one attempt of a delivery. StatusCode
+// is 0 if the receiver could not be reached.
+type WebhookAttempt struct {
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMS  int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
@@ -2,10 +2,25 @@ package objects
 
 import "time"
 
+const (
+	WithdrawStatusCompleted         = "completed"
+	WithdrawStatusRefunded          = "refunded"
+	WithdrawStatusPartiallyRefunded = "partially_refunded"
+)
+
 type Withdraw struct {
 	WithdrawID  uint64    `json:"-"`
 	UserID      uint64    `json:"-"`
 	Order       string    `json:"order"`
 	Sum         float32   `json:"sum"`
+	Status      string    `json:"status"`
+	Refunded    float32   `json:"refunded,omitempty"`
 	ProcessedAt time.Time `json:"processed_at"`
 }
+
+// Refund gives back points of a withdrawal. A zero Amount refunds what
+// is left of the withdrawal.
+type Refund struct {
+	Amount float32 `json:"amount"`
+	Reason string  `json:"reason"`
+}
@@ -0,0 +1,13 @@
+package hash
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// HashToken is used for random high-entropy secrets (recovery codes, keys)
+// that have to be looked up by value, so bcrypt is not applicable.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
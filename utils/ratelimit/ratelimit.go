@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter is a fixed window rate limiter keyed by an arbitrary string.
+type Limiter struct {
+	mu      sync.Mutex
+	window  time.Duration
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	start time.Time
+	count int
+}
+
+func New(window time.Duration) *Limiter {
+	return &Limiter{
+		window:  window,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow reports whether one more event for key fits into limit events
+// per window. A non-positive limit means unlimited.
+func (l *Limiter) Allow(key string, limit int) bool {
+	if limit <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok || now.Sub(b.start) >= l.window {
+		l.gc(now)
+		l.buckets[key] = &bucket{start: now, count: 1}
+		return true
+	}
+	if b.count >= limit {
+		return false
+	}
+	b.count++
+	return true
+}
+
+// RetryAfter returns the time left until the window of key resets.
+func (l *Limiter) RetryAfter(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		return 0
+	}
+	d := l.window - l.now().Sub(b.start)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+func (l *Limiter) gc(now time.Time) {
+	for k, b := range l.buckets {
+		if now.Sub(b.start) >= l.window {
+			delete(l.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := New(time.Minute)
+	l.now = func() time.Time { return now }
+
+	tests := []struct {
+		name    string
+		key     string
+		limit   int
+		advance time.Duration
+		want    bool
+	}{
+		{name: "first", key: "a", limit: 2, want: true},
+		{name: "second", key: "a", limit: 2, want: true},
+		{name: "over limit", key: "a", limit: 2, want: false},
+		{name: "other key", key: "b", limit: 2, want: true},
+		{name: "unlimited", key: "a", limit: 0, want: true},
+		{name: "next window", key: "a", limit: 2, advance: time.Minute, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.advance)
+			if got := l.Allow(tt.key, tt.limit); got != tt.want {
+				t.Errorf("Allow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
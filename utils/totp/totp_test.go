@@ -0,0 +1,82 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B test secret for SHA1.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).
+	EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		name string
+		unix int64
+		want string
+	}{
+		{name: "59", unix: 59, want: "287082"},
+		{name: "1111111109", unix: 1111111109, want: "081804"},
+		{name: "1234567890", unix: 1234567890, want: "005924"},
+		{name: "2000000000", unix: 2000000000, want: "279037"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Code() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	counter := now.Unix() / int64(Period.Seconds())
+	tests := []struct {
+		name string
+		code string
+		at   time.Time
+		last int64
+		want bool
+	}{
+		{name: "current period", code: "005924", at: now, want: true},
+		{name: "previous period", code: "005924", at: now.Add(Period), want: true},
+		{name: "too old", code: "005924", at: now.Add(3 * Period), want: false},
+		{name: "wrong code", code: "000000", at: now, want: false},
+		{name: "wrong length", code: "5924", at: now, want: false},
+		{name: "replayed", code: "005924", at: now, last: counter, want: false},
+		{name: "replayed later", code: "005924", at: now.Add(Period), last: counter, want: false},
+		{name: "after an older code", code: "005924", at: now, last: counter - 1, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Verify(rfcSecret, tt.code, tt.at, tt.last)
+			if ok != tt.want {
+				t.Fatalf("Verify() = %v, want %v", ok, tt.want)
+			}
+			if ok && got != counter {
+				t.Errorf("Verify() counter = %v, want %v", got, counter)
+			}
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri := URI("Gophermart", "alice", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Gophermart:alice?") {
+		t.Errorf("URI() = %v", uri)
+	}
+	if !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("URI() = %v, missing secret", uri)
+	}
+}